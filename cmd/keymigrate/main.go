@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"notification-mvp/internal/config"
+	"notification-mvp/internal/domain"
+	"notification-mvp/internal/encryption"
+	"notification-mvp/internal/redisclient"
+	"notification-mvp/internal/repository"
+)
+
+// keymigrate переносит ключи Redis из исходной схемы в схему с хэш-тегами для Redis Cluster.
+// Подключение и ключи шифрования берутся из тех же переменных окружения, что и у сервера
+func main() {
+	dryRun := flag.Bool("dry-run", false, "только подсчитать ключи без переноса")
+	flag.Parse()
+
+	cfg := config.Load()
+	// Имена старых и новых ключей миграция строит сама, поэтому REDIS_KEY_LAYOUT сервера не важен
+	cfg.RedisKeyLayout = "hashtag"
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	domain.SetKeyLayout(domain.KeyLayoutHashTag)
+
+	rdb, err := redisclient.New(cfg)
+	if err != nil {
+		log.Fatalf("Некорректная конфигурация Redis: %v", err)
+	}
+	defer func() { _ = rdb.Close() }()
+
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		log.Fatalf("Не удалось подключиться к Redis: %v", err)
+	}
+
+	repo := repository.NewRedisRepository(rdb)
+	if cfg.EncryptionKeyringFile != "" {
+		keyring, err := encryption.LoadKeyring(cfg.EncryptionKeyringFile)
+		if err != nil {
+			log.Fatalf("Не удалось загрузить ключи шифрования: %v", err)
+		}
+		repo.WithCipher(encryption.NewCipher(keyring), cfg.EncryptState)
+	}
+
+	fmt.Printf("Перенос ключей в схему hashtag (dry-run: %v)\n", *dryRun)
+
+	stats, err := repo.MigrateToHashTagLayout(ctx, *dryRun)
+	out, _ := json.Marshal(stats)
+	fmt.Println(string(out))
+	if err != nil {
+		log.Fatalf("Ошибка переноса ключей: %v", err)
+	}
+
+	fmt.Println("Готово. Запустите сервер с REDIS_KEY_LAYOUT=hashtag")
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"notification-mvp/internal/config"
+	"notification-mvp/internal/domain"
+	"notification-mvp/internal/encryption"
+	"notification-mvp/internal/redisclient"
+	"notification-mvp/internal/repository"
+)
+
+// notifbackup сохраняет данные уведомлений всех пользователей в переносимый JSONL-архив и восстанавливает их.
+// Подключение, схема ключей и ключи шифрования берутся из тех же переменных окружения, что и у сервера
+//
+//	notifbackup backup -out backup.jsonl
+//	notifbackup restore -in backup.jsonl
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "backup":
+		fs := flag.NewFlagSet("backup", flag.ExitOnError)
+		out := fs.String("out", "-", "файл архива (- — stdout)")
+		_ = fs.Parse(os.Args[2:])
+		run(func(ctx context.Context, repo *repository.RedisRepository) (repository.BackupStats, error) {
+			return backup(ctx, repo, *out)
+		})
+	case "restore":
+		fs := flag.NewFlagSet("restore", flag.ExitOnError)
+		in := fs.String("in", "-", "файл архива (- — stdin)")
+		_ = fs.Parse(os.Args[2:])
+		run(func(ctx context.Context, repo *repository.RedisRepository) (repository.BackupStats, error) {
+			return restore(ctx, repo, *in)
+		})
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Использование: notifbackup backup -out FILE | notifbackup restore -in FILE")
+	os.Exit(2)
+}
+
+// run подключается к Redis и выполняет команду, печатая итоги в stderr
+func run(cmd func(ctx context.Context, repo *repository.RedisRepository) (repository.BackupStats, error)) {
+	cfg := config.Load()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	layout, err := redisclient.KeyLayout(cfg)
+	if err != nil {
+		log.Fatalf("Некорректная конфигурация Redis: %v", err)
+	}
+	domain.SetKeyLayout(layout)
+
+	rdb, err := redisclient.New(cfg)
+	if err != nil {
+		log.Fatalf("Некорректная конфигурация Redis: %v", err)
+	}
+	defer func() { _ = rdb.Close() }()
+
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		log.Fatalf("Не удалось подключиться к Redis: %v", err)
+	}
+
+	repo := repository.NewRedisRepository(rdb)
+	if cfg.EncryptionKeyringFile != "" {
+		keyring, err := encryption.LoadKeyring(cfg.EncryptionKeyringFile)
+		if err != nil {
+			log.Fatalf("Не удалось загрузить ключи шифрования: %v", err)
+		}
+		repo.WithCipher(encryption.NewCipher(keyring), cfg.EncryptState)
+	}
+
+	stats, err := cmd(ctx, repo)
+	out, _ := json.Marshal(stats)
+	fmt.Fprintln(os.Stderr, string(out))
+	if err != nil {
+		log.Fatalf("Ошибка: %v", err)
+	}
+}
+
+// backup пишет по одной строке JSON на пользователя и завершающую строку с итогами.
+// Payload в архиве расшифрованы — храните его как секрет
+func backup(ctx context.Context, repo *repository.RedisRepository, path string) (repository.BackupStats, error) {
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			return repository.BackupStats{}, fmt.Errorf("ошибка создания файла архива: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+		w = f
+	}
+	return repo.WriteBackup(ctx, w)
+}
+
+// restore восстанавливает пользователей из архива; пользователи с существующим стримом пропускаются.
+// Архив проверяется до записи, поэтому stdin сначала сохраняется во временный файл
+func restore(ctx context.Context, repo *repository.RedisRepository, path string) (repository.BackupStats, error) {
+	var f *os.File
+	if path == "-" {
+		tmp, err := os.CreateTemp("", "notifbackup-*.jsonl")
+		if err != nil {
+			return repository.BackupStats{}, fmt.Errorf("ошибка создания временного файла: %w", err)
+		}
+		defer func() { _ = os.Remove(tmp.Name()) }()
+		if _, err := io.Copy(tmp, os.Stdin); err != nil {
+			_ = tmp.Close()
+			return repository.BackupStats{}, fmt.Errorf("ошибка чтения архива: %w", err)
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			_ = tmp.Close()
+			return repository.BackupStats{}, fmt.Errorf("ошибка чтения архива: %w", err)
+		}
+		f = tmp
+	} else {
+		opened, err := os.Open(path)
+		if err != nil {
+			return repository.BackupStats{}, fmt.Errorf("ошибка открытия файла архива: %w", err)
+		}
+		f = opened
+	}
+	defer func() { _ = f.Close() }()
+	return repo.RestoreBackup(ctx, f)
+}
@@ -3,21 +3,30 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
-	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"notification-mvp/internal/archive"
+	"notification-mvp/internal/cache"
+	"notification-mvp/internal/channel"
+	"notification-mvp/internal/clock"
 	"notification-mvp/internal/config"
 	"notification-mvp/internal/domain"
+	"notification-mvp/internal/encryption"
+	"notification-mvp/internal/erasure"
 	"notification-mvp/internal/handler"
+	"notification-mvp/internal/logging"
+	"notification-mvp/internal/redisclient"
 	"notification-mvp/internal/repository"
 	"notification-mvp/internal/service"
+	"notification-mvp/internal/streamlimit"
 	"notification-mvp/internal/websocket"
 	"notification-mvp/internal/worker"
 
@@ -26,35 +35,204 @@ import (
 )
 
 func main() {
-	// Настраиваем логгер
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
-	slog.SetDefault(logger)
-
 	// Загружаем конфигурацию
 	cfg := config.Load()
 
-	ctx := context.Background()
-
-	// Инициализируем Redis клиент
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     cfg.RedisAddr,
-		Password: cfg.RedisPassword,
-		DB:       cfg.RedisDB,
+	// Настраиваем логгер (уровень, формат и маскирование персональных данных из конфигурации)
+	logger := logging.New(os.Stdout, logging.Options{
+		Level:  cfg.LogLevel,
+		Format: cfg.LogFormat,
+		Redact: cfg.LogRedact,
 	})
+	slog.SetDefault(logger)
+
+	// ctx отменяется по SIGINT/SIGTERM: фоновые воркеры останавливаются и освобождают лизы до закрытия Redis
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Инициализируем хранилище
+	var (
+		repo    domain.NotificationRepository
+		rdb     redis.UniversalClient
+		keyring *encryption.Keyring
+	)
 
-	// Проверяем подключение к Redis
-	if err := rdb.Ping(ctx).Err(); err != nil {
-		log.Fatalf("Не удалось подключиться к Redis: %v", err)
+	switch cfg.StorageBackend {
+	case config.StorageMemory:
+		repo = repository.NewMemoryRepository(clock.System{})
+		slog.Warn("Используется хранилище в памяти: данные не переживают перезапуск, кластеризация недоступна")
+		if cfg.EncryptionKeyringFile != "" {
+			slog.Warn("Шифрование payload не применяется к хранилищу в памяти")
+		}
+	default:
+		// Инициализируем Redis клиент (одиночный узел или Cluster)
+		layout, err := redisclient.KeyLayout(cfg)
+		if err != nil {
+			log.Fatalf("Некорректная конфигурация Redis: %v", err)
+		}
+		domain.SetKeyLayout(layout)
+
+		rdb, err = redisclient.New(cfg)
+		if err != nil {
+			log.Fatalf("Некорректная конфигурация Redis: %v", err)
+		}
+
+		// Проверяем подключение к Redis
+		if err := rdb.Ping(ctx).Err(); err != nil {
+			log.Fatalf("Не удалось подключиться к Redis: %v", err)
+		}
+
+		slog.Info("Подключились к Redis",
+			"addr", cfg.RedisAddr,
+			"cluster", cfg.RedisCluster,
+			"sentinel_master", cfg.RedisSentinelMaster,
+			"tls", cfg.RedisTLS,
+			"key_layout", cfg.RedisKeyLayout)
+
+		redisRepo := repository.NewRedisRepository(rdb)
+
+		// Шифрование payload (ключи из локального файла, SIGHUP перечитывает файл при ротации)
+		if cfg.EncryptionKeyringFile != "" {
+			keyring, err = encryption.LoadKeyring(cfg.EncryptionKeyringFile)
+			if err != nil {
+				log.Fatalf("Не удалось загрузить ключи шифрования: %v", err)
+			}
+			redisRepo.WithCipher(encryption.NewCipher(keyring), cfg.EncryptState)
+			slog.Info("Включено шифрование payload", "active_key", keyring.ActiveKeyID(), "encrypt_state", cfg.EncryptState)
+		}
+
+		// Локальный кэш payload уменьшает число обращений к Redis при синхронизации истории
+		if cfg.PayloadCacheSize > 0 {
+			redisRepo.WithPayloadCache(cache.NewLRU[string, domain.NotificationPayload](cfg.PayloadCacheSize))
+			slog.Info("Включен кэш payload", "size", cfg.PayloadCacheSize)
+		}
+
+		// Однократное заполнение индексов пользователей после обновления с версии без них
+		go func() {
+			n, err := redisRepo.BackfillUserIndex(ctx)
+			if err != nil {
+				slog.Error("Ошибка заполнения индекса пользователей", "error", err)
+				return
+			}
+			if n > 0 {
+				slog.Info("Заполнен индекс пользователей", "users", n)
+			}
+		}()
+
+		repo = redisRepo
 	}
 
-	slog.Info("Подключились к Redis", "addr", cfg.RedisAddr)
+	// Лимиты стрима пользователя (по умолчанию из окружения, переопределения из файла)
+	overflow, err := domain.ParseOverflowPolicy(cfg.StreamOverflowPolicy)
+	if err != nil {
+		log.Fatalf("Некорректная политика переполнения стрима: %v", err)
+	}
+	streamLimits, err := streamlimit.Load(cfg.StreamLimitsFile, domain.StreamLimit{
+		MaxLen:   int64(cfg.StreamMaxLen),
+		Overflow: overflow,
+	})
+	if err != nil {
+		log.Fatalf("Не удалось загрузить лимиты стрима: %v", err)
+	}
 
 	// Инициализируем слои
-	repo := repository.NewRedisRepository(rdb)
-	notifyService := service.NewNotificationService(repo, logger).WithPodID(cfg.PodID)
 	connectionManager := websocket.NewConnectionManager(logger)
+
+	// deliverLocal отправляет готовое WS-сообщение локальным сессиям пользователя.
+	// domain.ErrNoLocalSession — пользователь не подключен к этому pod
+	deliverLocal := func(userKey string, payload json.RawMessage) error {
+		// userKey = "id-login"
+		// payload — это уже клиентский PushMessage JSON
+		var msg domain.WebSocketMessage
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			return fmt.Errorf("ошибка разбора сообщения: %w", err)
+		}
+		// извлекаем id/login из userKey
+		uid, login, err := domain.ParseUserKey(userKey)
+		if err != nil {
+			return err
+		}
+		if !connectionManager.IsClientConnected(uid, login) {
+			return domain.ErrNoLocalSession
+		}
+		if !connectionManager.SendToUser(uid, login, msg) {
+			return fmt.Errorf("ошибка отправки сообщения в WebSocket")
+		}
+		return nil
+	}
+
+	events := worker.NewBusPublisher(rdb, cfg.PodID, logger, deliverLocal).WithMaxLen(cfg.BusMaxLen)
+
+	notifyService := service.NewNotificationService(repo, logger).
+		WithPodID(cfg.PodID).
+		WithStreamLimits(streamLimits).
+		WithTopicChunk(cfg.TopicFanoutChunk).
+		WithEvents(events)
 	handlers := handler.NewHandlers(notifyService, repo, connectionManager, logger)
 
+	// Подпись квитанций об удалении данных пользователя
+	if signer, err := erasure.NewSigner([]byte(cfg.ErasureSigningKey)); err == nil {
+		handlers.WithErasureSigner(signer)
+	} else {
+		slog.Warn("ERASURE_SIGNING_KEY не задан: удаление данных пользователей отключено", "error", err)
+	}
+
+	// Долговременный архив в PostgreSQL или SQLite
+	var archiveSink *archive.Sink
+	if cfg.ArchiveDriver != "" {
+		store, err := archive.Open(ctx, cfg.ArchiveDriver, cfg.ArchiveDSN)
+		if err != nil {
+			log.Fatalf("Не удалось открыть архив: %v", err)
+		}
+		defer func() { _ = store.Close() }()
+		if keyring != nil {
+			// Текст уведомлений в архиве шифруется теми же ключами, что и payload в Redis
+			store.WithCipher(encryption.NewCipher(keyring))
+		}
+
+		// Архив останавливается через Close после HTTP сервера, чтобы не потерять события последних запросов
+		archiveSink = archive.NewSink(store, logger, cfg.ArchiveBatchSize, cfg.ArchiveFlushInterval)
+		go archiveSink.Start(context.Background())
+
+		notifyService.WithArchive(archiveSink)
+		handlers.WithArchive(store, archiveSink)
+		slog.Info("Подключен архив уведомлений", "driver", cfg.ArchiveDriver)
+	}
+
+	// Внешние каналы доставки для непрочитанных уведомлений
+	var channels []domain.Channel
+	if cfg.WebhooksEnabled {
+		// Webhook первым: его ответ 2xx подтверждает прочтение, и письмо уже не отправляется
+		channels = append(channels, channel.NewWebhookChannel(repo, notifyService, channel.WebhookConfig{
+			Timeout:      cfg.WebhookTimeout,
+			AllowPrivate: cfg.WebhookAllowPrivate,
+		}))
+	}
+	if cfg.SMTPAddr != "" {
+		smtpChannel, err := channel.NewSMTPChannel(channel.SMTPConfig{
+			Addr:     cfg.SMTPAddr,
+			From:     cfg.SMTPFrom,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			Subject:  cfg.SMTPSubject,
+			Timeout:  cfg.SMTPTimeout,
+		})
+		if err != nil {
+			log.Fatalf("Некорректная настройка email канала: %v", err)
+		}
+		channels = append(channels, smtpChannel)
+	}
+	var directory *channel.FileDirectory
+	if len(channels) > 0 {
+		directory, err = channel.LoadDirectory(cfg.UserDirectoryFile)
+		if err != nil {
+			log.Fatalf("Не удалось загрузить справочник пользователей: %v", err)
+		}
+		notifyService.WithChannels(cfg.ChannelUnreadWindow)
+		slog.Info("Включена доставка внешними каналами",
+			"channels", len(channels), "users", directory.Len(), "unread_window", cfg.ChannelUnreadWindow)
+	}
+
 	// Создаем HTTP сервер
 	mux := http.NewServeMux()
 
@@ -69,48 +247,165 @@ func main() {
 	mux.HandleFunc("GET /api/v1/admin/pending", handlers.PendingNotificationsHandler)
 	mux.HandleFunc("GET /api/v1/admin/users", handlers.AvailableUsersHandler)
 	mux.HandleFunc("GET /api/v1/admin/history", handlers.HistoryHandler)
+	mux.HandleFunc("GET /api/v1/admin/archive", handlers.ArchiveHandler)
+	mux.HandleFunc("GET /api/v1/admin/leaders", handlers.LeadersHandler)
+	mux.HandleFunc("GET /api/v1/admin/workers", handlers.WorkersHandler)
+	mux.HandleFunc("POST /api/v1/admin/workers/{name}/pause", handlers.PauseWorkerHandler)
+	mux.HandleFunc("POST /api/v1/admin/workers/{name}/resume", handlers.ResumeWorkerHandler)
+	mux.HandleFunc("POST /api/v1/admin/workers/{name}/trigger", handlers.TriggerWorkerHandler)
+	mux.HandleFunc("GET /api/v1/admin/users/{id}/{login}/export", handlers.ExportUserHandler)
+	mux.HandleFunc("DELETE /api/v1/admin/users/{id}/{login}/export", handlers.EraseUserHandler)
+	mux.HandleFunc("GET /api/v1/admin/users/{id}/{login}/digest", handlers.GetDigestHandler)
+	mux.HandleFunc("PUT /api/v1/admin/users/{id}/{login}/digest", handlers.SetDigestHandler)
+	mux.HandleFunc("GET /api/v1/admin/users/{id}/{login}/webhook", handlers.GetWebhookHandler)
+	mux.HandleFunc("PUT /api/v1/admin/users/{id}/{login}/webhook", handlers.SetWebhookHandler)
+	mux.HandleFunc("DELETE /api/v1/admin/users/{id}/{login}/webhook", handlers.DeleteWebhookHandler)
+	mux.HandleFunc("GET /api/v1/admin/users/{id}/{login}/settings", handlers.GetSettingsHandler)
+	mux.HandleFunc("PUT /api/v1/admin/users/{id}/{login}/settings", handlers.SetSettingsHandler)
+	mux.HandleFunc("GET /api/v1/admin/users/{id}/{login}/topics", handlers.GetTopicsHandler)
+	mux.HandleFunc("PUT /api/v1/admin/users/{id}/{login}/topics/{topic}", handlers.SubscribeTopicHandler)
+	mux.HandleFunc("DELETE /api/v1/admin/users/{id}/{login}/topics/{topic}", handlers.UnsubscribeTopicHandler)
 
 	mux.HandleFunc("/", handlers.IndexHandler) // Для тестового клиента
 
-	// Запускаем фоновые воркеры
+	// Запускаем фоновые воркеры. Обслуживающие воркеры выполняются либо на одном pod кластера (лиз в Redis),
+	// либо на всех pod, каждый для своей доли пользователей
+	election := worker.NewLeaderElection(rdb, cfg.PodID, logger, cfg.LeaderLeaseTTL)
+	handlers.WithLeaders(election)
+
+	runtime := worker.NewRuntime(logger)
+	handlers.WithWorkers(runtime)
+
+	// Все фоновые горутины учитываются в workers, чтобы при остановке дождаться их завершения
+	var workers sync.WaitGroup
+	spawn := func(fn func(ctx context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			fn(ctx)
+		}()
+	}
+
+	// С общим Redis пауза и внеочередной запуск из админ API доходят до pod, где выполняется воркер
+	if rdb != nil {
+		runtime.WithControl(rdb, cfg.PodID).WithStaleAfter(cfg.PodStaleAfter)
+		spawn(runtime.Start)
+	}
+
 	ttlJanitor := worker.NewTTLJanitor(repo, logger)
+	if archiveSink != nil {
+		ttlJanitor.WithArchive(archiveSink)
+	}
 	groupMaintenance := worker.NewGroupMaintenance(repo, logger)
-	hbWorker := worker.NewHeartbeatWorker(rdb, cfg.PodID, logger)
 	retentionTrimmer := worker.NewRetentionTrimmer(repo, logger)
+	digestWorker := worker.NewDigestWorker(repo, notifyService, logger)
+	escalationWorker := worker.NewEscalationWorker(repo, notifyService, events, logger)
+	deferredWorker := worker.NewDeferredWorker(repo, notifyService, logger)
+	var dispatcher *worker.ChannelDispatcher
+	if len(channels) > 0 {
+		dispatcher = worker.NewChannelDispatcher(repo, channels, directory, logger).
+			WithRetryPolicy(cfg.ChannelMaxAttempts, cfg.ChannelRetryBackoff)
+	}
 
-	go ttlJanitor.Start(ctx)
-	go groupMaintenance.Start(ctx)
-	go hbWorker.Start(ctx)
-	go retentionTrimmer.Start(ctx)
+	switch cfg.MaintenanceMode {
+	case config.MaintenanceLeader, config.MaintenanceSharded:
+	default:
+		log.Fatalf("Неизвестный режим обслуживания MAINTENANCE_MODE: %s", cfg.MaintenanceMode)
+	}
+	sharded := cfg.MaintenanceMode == config.MaintenanceSharded && rdb != nil
+	if sharded {
+		ring := worker.NewShardRing(rdb, cfg.PodID, logger).WithStaleAfter(cfg.PodStaleAfter)
+		spawn(ring.Start)
 
-	// Межподовый роутер шины (E4, упрощенный)
-	router := worker.NewInterPodRouter(rdb, cfg.PodID, logger, func(userKey string, payload json.RawMessage) bool {
-		// userKey = "id-login"
-		// попытаемся разослать локальным сессиям
-		// payload — это уже клиентский PushMessage JSON
-		var msg domain.WebSocketMessage
-		if err := json.Unmarshal(payload, &msg); err != nil {
-			return false
+		ttlJanitor.WithShard(ring)
+		groupMaintenance.WithShard(ring)
+		retentionTrimmer.WithShard(ring)
+		digestWorker.WithShard(ring)
+		escalationWorker.WithShard(ring)
+		deferredWorker.WithShard(ring)
+		if dispatcher != nil {
+			dispatcher.WithShard(ring)
 		}
-		// извлекаем id/login из userKey
-		parts := strings.SplitN(userKey, "-", 2)
-		if len(parts) != 2 {
-			return false
+		slog.Info("Обслуживающие воркеры шардированы между pod")
+	}
+
+	maintenance := []*worker.Job{
+		runtime.Register(ttlJanitor, worker.Schedule{Interval: cfg.TTLJanitorInterval, Jitter: cfg.TTLJanitorJitter}),
+		runtime.Register(groupMaintenance, worker.Schedule{Interval: cfg.GroupMaintenanceInterval, Jitter: cfg.GroupMaintenanceJitter}),
+		runtime.Register(retentionTrimmer, worker.Schedule{Interval: cfg.RetentionTrimInterval, Jitter: cfg.RetentionTrimJitter}),
+		runtime.Register(digestWorker, worker.Schedule{Interval: cfg.DigestInterval, Jitter: cfg.DigestJitter}),
+		runtime.Register(escalationWorker, worker.Schedule{Interval: cfg.EscalationInterval, Jitter: cfg.EscalationJitter}),
+		runtime.Register(deferredWorker, worker.Schedule{Interval: cfg.DeferredInterval, Jitter: cfg.DeferredJitter}),
+	}
+	if dispatcher != nil {
+		maintenance = append(maintenance, runtime.Register(dispatcher, worker.Schedule{
+			Interval: cfg.ChannelDispatchInterval,
+			Jitter:   cfg.ChannelDispatchJitter,
+		}))
+	}
+	for _, job := range maintenance {
+		if sharded {
+			spawn(job.Run)
+			continue
 		}
-		uid, err := strconv.ParseInt(parts[0], 10, 64)
-		if err != nil {
-			return false
+		spawn(func(ctx context.Context) { election.Run(ctx, job.Name(), job.Run) })
+	}
+
+	if keyring != nil {
+		reencryptor := worker.NewReencryptionWorker(repo.(*repository.RedisRepository), logger)
+		job := runtime.Register(reencryptor, worker.Schedule{Interval: cfg.ReencryptInterval, Jitter: cfg.ReencryptJitter})
+		spawn(func(ctx context.Context) { election.Run(ctx, job.Name(), job.Run) })
+
+		reload := make(chan os.Signal, 1)
+		signal.Notify(reload, syscall.SIGHUP)
+		go func() {
+			for range reload {
+				if err := keyring.Reload(); err != nil {
+					slog.Error("Ошибка перечитывания ключей шифрования", "error", err)
+					continue
+				}
+				slog.Info("Ключи шифрования перечитаны", "active_key", keyring.ActiveKeyID())
+			}
+		}()
+	}
+
+	// Heartbeat и межподовая шина нужны только при общем Redis
+	if rdb != nil {
+		// Первый пульс сразу, чтобы pod без задержки вошел в кольцо обслуживания соседей
+		hbWorker := worker.NewHeartbeatWorker(rdb, cfg.PodID, logger).
+			WithStaleAfter(cfg.PodStaleAfter).
+			WithTakeover(repo.(*repository.RedisRepository))
+		spawn(runtime.Register(hbWorker, worker.Schedule{
+			Interval:  cfg.HeartbeatInterval,
+			Jitter:    cfg.HeartbeatJitter,
+			Immediate: true,
+		}).Run)
+
+		// Межподовый роутер шины (E4, упрощенный)
+		router := worker.NewInterPodRouter(rdb, cfg.PodID, logger, deliverLocal).
+			WithRetryPolicy(cfg.BusMaxDeliveries, cfg.BusRetryBackoff)
+		spawn(router.Start)
+
+		// Мгновенное удаление истекших записей по событиям keyspace; TTL джанитор остается страховкой
+		if cfg.ExpiryEvents {
+			if domain.CurrentKeyLayout() == domain.KeyLayoutHashTag {
+				listener := worker.NewExpiryListener(repo.(*repository.RedisRepository), rdb, events, logger)
+				if archiveSink != nil {
+					listener.WithArchive(archiveSink)
+				}
+				spawn(listener.Start)
+			} else {
+				slog.Warn("EXPIRY_EVENTS требует REDIS_KEY_LAYOUT=hashtag, события истечения не используются")
+			}
 		}
-		return connectionManager.SendToUser(uid, parts[1], msg)
-	})
-	go router.Start(ctx)
+	}
 
 	slog.Info("Запущены фоновые воркеры")
 
 	// Создаем HTTP сервер
 	server := &http.Server{
 		Addr:    cfg.ServerAddr,
-		Handler: mux,
+		Handler: logging.Middleware(mux),
 	}
 
 	// Запускаем сервер в горутине
@@ -121,23 +416,40 @@ func main() {
 		}
 	}()
 
-	// Ожидаем сигнал завершения
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	// Ожидаем сигнал завершения; повторный сигнал завершит процесс сразу
+	<-ctx.Done()
+	stop()
 
 	slog.Info("Завершение работы...")
 
 	// Graceful shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	if err := server.Shutdown(ctx); err != nil {
+	if err := server.Shutdown(shutdownCtx); err != nil {
 		slog.Error("Ошибка при завершении сервера", "error", err)
 	}
 
-	if err := rdb.Close(); err != nil {
-		slog.Error("Ошибка при закрытии Redis", "error", err)
+	// Воркеры уже получили отмену ctx; ждем, пока они завершат итерации и освободят лизы
+	workersDone := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(workersDone)
+	}()
+	select {
+	case <-workersDone:
+	case <-shutdownCtx.Done():
+		slog.Warn("Не дождались остановки фоновых воркеров")
+	}
+
+	if archiveSink != nil {
+		archiveSink.Close()
+	}
+
+	if rdb != nil {
+		if err := rdb.Close(); err != nil {
+			slog.Error("Ошибка при закрытии Redis", "error", err)
+		}
 	}
 
 	slog.Info("Сервер завершен")
@@ -0,0 +1,149 @@
+package archive
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"notification-mvp/internal/domain"
+	"notification-mvp/internal/metrics"
+)
+
+// Sink асинхронно копирует события в архив порциями, не задерживая доставку уведомлений
+type Sink struct {
+	store         *Store
+	logger        *slog.Logger
+	events        chan domain.ArchiveEvent
+	batchSize     int
+	flushInterval time.Duration
+	flushes       chan chan struct{}
+	done          chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewSink создает асинхронный писатель архива с очередью заданного размера
+func NewSink(store *Store, logger *slog.Logger, batchSize int, flushInterval time.Duration) *Sink {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	return &Sink{
+		store:         store,
+		logger:        logger,
+		events:        make(chan domain.ArchiveEvent, batchSize*100),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		flushes:       make(chan chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// Record ставит событие в очередь; при переполнении очереди событие отбрасывается
+func (s *Sink) Record(event domain.ArchiveEvent) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.events <- event:
+	default:
+		metrics.ArchiveDropped.Inc()
+		s.logger.Warn("Очередь архива переполнена, событие отброшено",
+			"notification_id", event.NotificationID, "event", event.Type)
+	}
+}
+
+// Start обрабатывает очередь до закрытия через Close
+func (s *Sink) Start(ctx context.Context) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]domain.ArchiveEvent, 0, s.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		// Пишем с отдельным контекстом, чтобы остановка сервиса не обрывала запись
+		writeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := s.store.WriteBatch(writeCtx, batch); err != nil {
+			metrics.ArchiveDropped.Add(float64(len(batch)))
+			s.logger.Error("Ошибка записи в архив", "error", err, "count", len(batch))
+		} else {
+			metrics.ArchiveWritten.Add(float64(len(batch)))
+		}
+		batch = batch[:0]
+	}
+
+	s.logger.Info("Архив уведомлений запущен", "driver", s.store.driver)
+	for {
+		select {
+		case ev, ok := <-s.events:
+			if !ok {
+				flush()
+				s.logger.Info("Архив уведомлений остановлен")
+				return
+			}
+			batch = append(batch, ev)
+			if len(batch) >= s.batchSize {
+				flush()
+			}
+		case req := <-s.flushes:
+			// Дописываем все, что было в очереди на момент запроса
+			for n := len(s.events); n > 0; n-- {
+				ev, ok := <-s.events
+				if !ok {
+					break
+				}
+				batch = append(batch, ev)
+				if len(batch) >= s.batchSize {
+					flush()
+				}
+			}
+			flush()
+			close(req)
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			flush()
+			s.logger.Info("Архив уведомлений остановлен")
+			return
+		}
+	}
+}
+
+// Flush дожидается записи событий, поставленных в очередь до вызова. Нужен перед удалением
+// данных пользователя из архива: иначе события из очереди вставили бы его строки заново
+func (s *Sink) Flush(ctx context.Context) error {
+	req := make(chan struct{})
+	select {
+	case s.flushes <- req:
+	case <-s.done:
+		return nil // писатель остановлен и уже дописал очередь
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-req:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close дописывает оставшиеся события и дожидается завершения
+func (s *Sink) Close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+	s.mu.Unlock()
+	<-s.done
+}
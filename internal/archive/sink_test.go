@@ -0,0 +1,104 @@
+package archive
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"notification-mvp/internal/domain"
+)
+
+func newTestSink(t *testing.T) (*Sink, *Store) {
+	t.Helper()
+	ctx := context.Background()
+	store, err := Open(ctx, DriverSQLite, filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	// Интервал сброса больше времени теста: события пишутся только по Flush или при заполнении порции
+	sink := NewSink(store, slog.New(slog.NewTextHandler(io.Discard, nil)), 100, time.Hour)
+	go sink.Start(ctx)
+	t.Cleanup(sink.Close)
+	return sink, store
+}
+
+func createdEvent(nid string, target domain.Target) domain.ArchiveEvent {
+	now := time.Now()
+	return domain.ArchiveEvent{
+		Type:           domain.ArchiveEventCreated,
+		NotificationID: nid,
+		StreamID:       "1-0",
+		Target:         target,
+		Payload:        &domain.NotificationPayload{Message: "hello", Source: "test", CreatedAt: now},
+		OccurredAt:     now,
+	}
+}
+
+func TestSinkFlushWritesQueuedEvents(t *testing.T) {
+	sink, store := newTestSink(t)
+	ctx := context.Background()
+	alice := domain.Target{ID: 1, Login: "alice"}
+
+	sink.Record(createdEvent("n1", alice))
+	sink.Record(createdEvent("n2", alice))
+	if err := sink.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	rows, err := store.ExportUser(ctx, 1, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("после Flush в архиве %d строк, ожидалось 2", len(rows))
+	}
+}
+
+func TestSinkFlushBeforeDeleteUser(t *testing.T) {
+	sink, store := newTestSink(t)
+	ctx := context.Background()
+	alice := domain.Target{ID: 1, Login: "alice"}
+	bob := domain.Target{ID: 2, Login: "bob"}
+
+	sink.Record(createdEvent("a1", alice))
+	sink.Record(createdEvent("b1", bob))
+	if err := sink.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := store.DeleteUser(ctx, 1, "alice")
+	if err != nil || deleted != 1 {
+		t.Fatalf("DeleteUser = %d, %v", deleted, err)
+	}
+
+	// Прочтение из очереди после удаления не создает строк удаленного пользователя
+	sink.Record(domain.ArchiveEvent{Type: domain.ArchiveEventRead, NotificationID: "a1", Target: alice, OccurredAt: time.Now()})
+	if err := sink.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var events int
+	if err := store.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM notification_events WHERE notification_id = 'a1'`).Scan(&events); err != nil {
+		t.Fatal(err)
+	}
+	if events != 0 {
+		t.Fatalf("осталось %d событий удаленного пользователя", events)
+	}
+	if rows, _ := store.ExportUser(ctx, 2, "bob"); len(rows) != 1 {
+		t.Fatalf("данные другого пользователя затронуты: %v", rows)
+	}
+}
+
+func TestSinkFlushAfterClose(t *testing.T) {
+	sink, _ := newTestSink(t)
+	sink.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := sink.Flush(ctx); err != nil {
+		t.Fatalf("Flush после Close: %v", err)
+	}
+}
@@ -0,0 +1,315 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"notification-mvp/internal/domain"
+	"notification-mvp/internal/encryption"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // драйвер PostgreSQL ("pgx")
+	_ "modernc.org/sqlite"             // встроенный драйвер SQLite ("sqlite")
+)
+
+// Поддерживаемые драйверы архива
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Store хранит архив уведомлений в PostgreSQL или во встроенном файле SQLite
+type Store struct {
+	db     *sql.DB
+	driver string
+	cipher *encryption.Cipher // nil — текст уведомлений хранится открыто
+}
+
+// Open подключается к базе архива и создает схему при необходимости
+func Open(ctx context.Context, driver, dsn string) (*Store, error) {
+	var sqlDriver string
+	switch driver {
+	case DriverPostgres:
+		sqlDriver = "pgx"
+	case DriverSQLite:
+		sqlDriver = "sqlite"
+	default:
+		return nil, fmt.Errorf("неизвестный драйвер архива: %s", driver)
+	}
+
+	db, err := sql.Open(sqlDriver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия базы архива: %w", err)
+	}
+	if driver == DriverSQLite {
+		// SQLite допускает только одного писателя
+		db.SetMaxOpenConns(1)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("ошибка подключения к базе архива: %w", err)
+	}
+
+	s := &Store{db: db, driver: driver}
+	if err := s.migrate(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// WithCipher включает шифрование текста уведомлений ключами payload. Строки, записанные
+// до включения, читаются как есть; ротация ключей архив не перешифровывает, поэтому
+// старые ключи должны оставаться в файле ключей, пока в архиве есть зашифрованные ими строки
+func (s *Store) WithCipher(cipher *encryption.Cipher) *Store {
+	s.cipher = cipher
+	return s
+}
+
+// sealMessage шифрует текст уведомления, привязывая шифротекст к notification_id
+func (s *Store) sealMessage(notificationID, message string) (string, error) {
+	if s.cipher == nil {
+		return message, nil
+	}
+	sealed, err := s.cipher.Encrypt([]byte(message), messageAAD(notificationID))
+	if err != nil {
+		return "", fmt.Errorf("ошибка шифрования текста уведомления: %w", err)
+	}
+	return sealed, nil
+}
+
+// openMessage расшифровывает текст уведомления; при ошибке возвращает пустую строку
+func (s *Store) openMessage(notificationID, value string) string {
+	if !encryption.IsEncrypted(value) {
+		return value
+	}
+	if s.cipher == nil {
+		slog.Warn("Текст уведомления в архиве зашифрован, но ключи не настроены", "nid", notificationID)
+		return ""
+	}
+	plaintext, err := s.cipher.Decrypt(value, messageAAD(notificationID))
+	if err != nil {
+		slog.Warn("Ошибка расшифровки текста уведомления из архива", "error", err, "nid", notificationID)
+		return ""
+	}
+	return string(plaintext)
+}
+
+func messageAAD(notificationID string) []byte {
+	return []byte("archive|" + notificationID)
+}
+
+// Close закрывает подключение к базе
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) migrate(ctx context.Context) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS notifications (
+			notification_id TEXT PRIMARY KEY,
+			stream_id       TEXT NOT NULL,
+			user_id         BIGINT NOT NULL,
+			login           TEXT NOT NULL,
+			message         TEXT NOT NULL,
+			source          TEXT NOT NULL,
+			created_at      TIMESTAMP NOT NULL,
+			read_at         TIMESTAMP NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS notifications_user_created_idx
+			ON notifications (user_id, login, created_at DESC)`,
+		`CREATE TABLE IF NOT EXISTS notification_events (
+			notification_id TEXT NOT NULL,
+			event           TEXT NOT NULL,
+			occurred_at     TIMESTAMP NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS notification_events_nid_idx
+			ON notification_events (notification_id)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("ошибка создания схемы архива: %w", err)
+		}
+	}
+	return nil
+}
+
+// rebind заменяет плейсхолдеры "?" на "$n" для PostgreSQL
+func (s *Store) rebind(query string) string {
+	if s.driver != DriverPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// WriteBatch записывает порцию событий в одной транзакции
+func (s *Store) WriteBatch(ctx context.Context, events []domain.ArchiveEvent) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции архива: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	insertNotification := s.rebind(`INSERT INTO notifications
+		(notification_id, stream_id, user_id, login, message, source, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (notification_id) DO NOTHING`)
+	markRead := s.rebind(`UPDATE notifications SET read_at = ?
+		WHERE notification_id = ? AND read_at IS NULL`)
+	insertEvent := s.rebind(`INSERT INTO notification_events
+		(notification_id, event, occurred_at) VALUES (?, ?, ?)`)
+	archived := s.rebind(`SELECT COUNT(*) FROM notifications WHERE notification_id = ?`)
+
+	for _, ev := range events {
+		occurredAt := ev.OccurredAt.UTC()
+		switch ev.Type {
+		case domain.ArchiveEventCreated:
+			if ev.Payload == nil {
+				continue
+			}
+			message, err := s.sealMessage(ev.NotificationID, ev.Payload.Message)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, insertNotification,
+				ev.NotificationID, ev.StreamID, ev.Target.ID, ev.Target.Login,
+				message, ev.Payload.Source, ev.Payload.CreatedAt.UTC())
+			if err != nil {
+				return fmt.Errorf("ошибка записи уведомления в архив: %w", err)
+			}
+		case domain.ArchiveEventRead:
+			if _, err := tx.ExecContext(ctx, markRead, occurredAt, ev.NotificationID); err != nil {
+				return fmt.Errorf("ошибка записи прочтения в архив: %w", err)
+			}
+		}
+		// Удаление из стрима (expired, auto_cleared, dropped) записывается только строкой события
+
+		// События пишутся только для уведомлений из архива: иначе прочтение, пришедшее после удаления
+		// данных пользователя, оставило бы строку, которую DeleteUser уже не найдет
+		var found int
+		if err := tx.QueryRowContext(ctx, archived, ev.NotificationID).Scan(&found); err != nil {
+			return fmt.Errorf("ошибка проверки уведомления в архиве: %w", err)
+		}
+		if found == 0 {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, insertEvent, ev.NotificationID, ev.Type, occurredAt); err != nil {
+			return fmt.Errorf("ошибка записи события в архив: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка фиксации транзакции архива: %w", err)
+	}
+	return nil
+}
+
+// QueryHistory возвращает до limit уведомлений пользователя, созданных раньше before, от новых к старым
+func (s *Store) QueryHistory(
+	ctx context.Context,
+	userID int64,
+	login string,
+	before time.Time,
+	limit int,
+) ([]domain.ArchivedNotification, error) {
+	if before.IsZero() {
+		before = time.Now()
+	}
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT
+			notification_id, stream_id, message, source, created_at, read_at
+		FROM notifications
+		WHERE user_id = ? AND login = ? AND created_at < ?
+		ORDER BY created_at DESC
+		LIMIT ?`), userID, login, before.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса архива: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	return s.scanNotifications(rows, domain.Target{ID: userID, Login: login})
+}
+
+// ExportUser возвращает все уведомления пользователя из архива, от старых к новым
+func (s *Store) ExportUser(ctx context.Context, userID int64, login string) ([]domain.ArchivedNotification, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT
+			notification_id, stream_id, message, source, created_at, read_at
+		FROM notifications
+		WHERE user_id = ? AND login = ?
+		ORDER BY created_at`), userID, login)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса архива: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	return s.scanNotifications(rows, domain.Target{ID: userID, Login: login})
+}
+
+// scanNotifications читает строки уведомлений получателя, расшифровывая текст
+func (s *Store) scanNotifications(rows *sql.Rows, target domain.Target) ([]domain.ArchivedNotification, error) {
+	var out []domain.ArchivedNotification
+	for rows.Next() {
+		n := domain.ArchivedNotification{Target: target}
+		var readAt sql.NullTime
+		if err := rows.Scan(&n.NotificationID, &n.StreamID, &n.Message, &n.Source, &n.CreatedAt, &readAt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения строки архива: %w", err)
+		}
+		n.Message = s.openMessage(n.NotificationID, n.Message)
+		if readAt.Valid {
+			t := readAt.Time
+			n.ReadAt = &t
+		}
+		out = append(out, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения архива: %w", err)
+	}
+	return out, nil
+}
+
+// DeleteUser удаляет уведомления пользователя и их события в одной транзакции
+func (s *Store) DeleteUser(ctx context.Context, userID int64, login string) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка начала транзакции архива: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM notification_events
+		WHERE notification_id IN (
+			SELECT notification_id FROM notifications WHERE user_id = ? AND login = ?
+		)`), userID, login); err != nil {
+		return 0, fmt.Errorf("ошибка удаления событий из архива: %w", err)
+	}
+	res, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM notifications
+		WHERE user_id = ? AND login = ?`), userID, login)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка удаления уведомлений из архива: %w", err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка удаления уведомлений из архива: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("ошибка фиксации транзакции архива: %w", err)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,209 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"notification-mvp/internal/domain"
+	"notification-mvp/internal/encryption"
+)
+
+// testStores открывает архив в SQLite и, если задан ARCHIVE_TEST_POSTGRES_DSN, в PostgreSQL.
+// Таблицы PostgreSQL очищаются перед тестом, поэтому DSN должен указывать на отдельную тестовую базу
+func testStores(t *testing.T) map[string]*Store {
+	t.Helper()
+	ctx := context.Background()
+	stores := make(map[string]*Store)
+
+	sqlite, err := Open(ctx, DriverSQLite, filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatalf("Open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlite.Close() })
+	stores[DriverSQLite] = sqlite
+
+	if dsn := os.Getenv("ARCHIVE_TEST_POSTGRES_DSN"); dsn != "" {
+		pg, err := Open(ctx, DriverPostgres, dsn)
+		if err != nil {
+			t.Fatalf("Open postgres: %v", err)
+		}
+		t.Cleanup(func() { _ = pg.Close() })
+		for _, table := range []string{"notification_events", "notifications"} {
+			if _, err := pg.db.ExecContext(ctx, "DELETE FROM "+table); err != nil {
+				t.Fatalf("очистка %s: %v", table, err)
+			}
+		}
+		stores[DriverPostgres] = pg
+	}
+	return stores
+}
+
+// newTestCipher создает шифр с одним активным ключом
+func newTestCipher(t *testing.T) *encryption.Cipher {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	raw, _ := json.Marshal(map[string]any{"active": "k1", "keys": map[string]string{"k1": key}})
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keyring, err := encryption.LoadKeyring(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encryption.NewCipher(keyring)
+}
+
+// storedEvents возвращает события уведомления в порядке записи
+func storedEvents(t *testing.T, store *Store, nid string) []string {
+	t.Helper()
+	rows, err := store.db.QueryContext(context.Background(),
+		store.rebind(`SELECT event FROM notification_events WHERE notification_id = ? ORDER BY occurred_at`), nid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = rows.Close() }()
+	var events []string
+	for rows.Next() {
+		var ev string
+		if err := rows.Scan(&ev); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+func TestStoreLifecycleEvents(t *testing.T) {
+	alice := domain.Target{ID: 1, Login: "alice"}
+	at := func(minutes int) time.Time { return time.Date(2025, 3, 10, 12, minutes, 0, 0, time.UTC) }
+	created := func(nid string) domain.ArchiveEvent {
+		ev := createdEvent(nid, alice)
+		ev.Payload.CreatedAt, ev.OccurredAt = at(0), at(0)
+		return ev
+	}
+
+	for driver, store := range testStores(t) {
+		t.Run(driver, func(t *testing.T) {
+			ctx := context.Background()
+			err := store.WriteBatch(ctx, []domain.ArchiveEvent{
+				created("read"), created("expired"), created("cleared"), created("dropped"),
+				{Type: domain.ArchiveEventRead, NotificationID: "read", Target: alice, OccurredAt: at(1)},
+				{Type: domain.ArchiveEventExpired, NotificationID: "expired", Target: alice, OccurredAt: at(15)},
+				{Type: domain.ArchiveEventAutoCleared, NotificationID: "cleared", Target: alice, OccurredAt: at(15)},
+				{Type: domain.ArchiveEventDropped, NotificationID: "dropped", Target: alice, OccurredAt: at(2)},
+				// Событие без созданного уведомления не записывается
+				{Type: domain.ArchiveEventExpired, NotificationID: "unknown", Target: alice, OccurredAt: at(15)},
+			})
+			if err != nil {
+				t.Fatalf("WriteBatch: %v", err)
+			}
+
+			want := map[string][]string{
+				"read":    {domain.ArchiveEventCreated, domain.ArchiveEventRead},
+				"expired": {domain.ArchiveEventCreated, domain.ArchiveEventExpired},
+				"cleared": {domain.ArchiveEventCreated, domain.ArchiveEventAutoCleared},
+				"dropped": {domain.ArchiveEventCreated, domain.ArchiveEventDropped},
+				"unknown": nil,
+			}
+			for nid, events := range want {
+				if got := storedEvents(t, store, nid); strings.Join(got, ",") != strings.Join(events, ",") {
+					t.Errorf("события %s: %v, ожидалось %v", nid, got, events)
+				}
+			}
+
+			rows, err := store.QueryHistory(ctx, 1, "alice", at(30), 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 4 {
+				t.Fatalf("в истории %d уведомлений, ожидалось 4", len(rows))
+			}
+			for _, n := range rows {
+				if (n.ReadAt != nil) != (n.NotificationID == "read") {
+					t.Errorf("%s: read_at = %v", n.NotificationID, n.ReadAt)
+				}
+			}
+
+			if deleted, err := store.DeleteUser(ctx, 1, "alice"); err != nil || deleted != 4 {
+				t.Fatalf("DeleteUser = %d, %v", deleted, err)
+			}
+			if got := storedEvents(t, store, "expired"); len(got) != 0 {
+				t.Fatalf("события удаленного пользователя остались: %v", got)
+			}
+		})
+	}
+}
+
+func TestStoreEncryptsMessage(t *testing.T) {
+	alice := domain.Target{ID: 1, Login: "alice"}
+	cipher := newTestCipher(t)
+
+	for driver, store := range testStores(t) {
+		t.Run(driver, func(t *testing.T) {
+			ctx := context.Background()
+			// Строка, записанная до включения шифрования, читается как есть
+			if err := store.WriteBatch(ctx, []domain.ArchiveEvent{createdEvent("plain", alice)}); err != nil {
+				t.Fatal(err)
+			}
+			store.WithCipher(cipher)
+			t.Cleanup(func() { store.WithCipher(nil) })
+			if err := store.WriteBatch(ctx, []domain.ArchiveEvent{createdEvent("sealed", alice)}); err != nil {
+				t.Fatal(err)
+			}
+
+			var raw string
+			if err := store.db.QueryRowContext(ctx,
+				store.rebind(`SELECT message FROM notifications WHERE notification_id = ?`), "sealed").Scan(&raw); err != nil {
+				t.Fatal(err)
+			}
+			if !encryption.IsEncrypted(raw) || strings.Contains(raw, "hello") {
+				t.Fatalf("текст уведомления хранится открыто: %q", raw)
+			}
+
+			rows, err := store.ExportUser(ctx, 1, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 2 {
+				t.Fatalf("выгружено %d строк, ожидалось 2", len(rows))
+			}
+			for _, n := range rows {
+				if n.Message != "hello" {
+					t.Errorf("%s: текст %q, ожидалось hello", n.NotificationID, n.Message)
+				}
+			}
+
+			// Без ключей зашифрованный текст не отдается
+			store.WithCipher(nil)
+			rows, err = store.ExportUser(ctx, 1, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, n := range rows {
+				if n.NotificationID == "sealed" && n.Message != "" {
+					t.Fatalf("без ключей возвращен текст %q", n.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestStoreRebind(t *testing.T) {
+	query := `SELECT * FROM notifications WHERE user_id = ? AND login = ? LIMIT ?`
+	pg := &Store{driver: DriverPostgres}
+	if got, want := pg.rebind(query), `SELECT * FROM notifications WHERE user_id = $1 AND login = $2 LIMIT $3`; got != want {
+		t.Fatalf("rebind для PostgreSQL = %q", got)
+	}
+	sqlite := &Store{driver: DriverSQLite}
+	if got := sqlite.rebind(query); got != query {
+		t.Fatalf("rebind для SQLite изменил запрос: %q", got)
+	}
+}
@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testEpoch = time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+// newTestLRU создает кэш с управляемым временем
+func newTestLRU(capacity int) (*LRU[string, int], *time.Time) {
+	now := testEpoch
+	c := NewLRU[string, int](capacity)
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func TestLRUEviction(t *testing.T) {
+	far := testEpoch.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		capacity int
+		ops      func(c *LRU[string, int])
+		present  []string
+		absent   []string
+	}{
+		{
+			name:     "вытесняется самая старая запись",
+			capacity: 2,
+			ops: func(c *LRU[string, int]) {
+				c.Add("a", 1, far)
+				c.Add("b", 2, far)
+				c.Add("c", 3, far)
+			},
+			present: []string{"b", "c"},
+			absent:  []string{"a"},
+		},
+		{
+			name:     "чтение продлевает жизнь записи",
+			capacity: 2,
+			ops: func(c *LRU[string, int]) {
+				c.Add("a", 1, far)
+				c.Add("b", 2, far)
+				c.Get("a")
+				c.Add("c", 3, far)
+			},
+			present: []string{"a", "c"},
+			absent:  []string{"b"},
+		},
+		{
+			name:     "повторная запись обновляет и не вытесняет",
+			capacity: 2,
+			ops: func(c *LRU[string, int]) {
+				c.Add("a", 1, far)
+				c.Add("b", 2, far)
+				c.Add("a", 10, far)
+				c.Add("c", 3, far)
+			},
+			present: []string{"a", "c"},
+			absent:  []string{"b"},
+		},
+		{
+			name:     "емкость меньше единицы равна единице",
+			capacity: 0,
+			ops: func(c *LRU[string, int]) {
+				c.Add("a", 1, far)
+				c.Add("b", 2, far)
+			},
+			present: []string{"b"},
+			absent:  []string{"a"},
+		},
+		{
+			name:     "удаление",
+			capacity: 2,
+			ops: func(c *LRU[string, int]) {
+				c.Add("a", 1, far)
+				c.Remove("a")
+				c.Remove("missing")
+			},
+			absent: []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestLRU(tt.capacity)
+			tt.ops(c)
+			for _, k := range tt.present {
+				if _, ok := c.Get(k); !ok {
+					t.Errorf("запись %s вытеснена", k)
+				}
+			}
+			for _, k := range tt.absent {
+				if _, ok := c.Get(k); ok {
+					t.Errorf("запись %s осталась в кэше", k)
+				}
+			}
+		})
+	}
+}
+
+func TestLRUUpdateValue(t *testing.T) {
+	c, _ := newTestLRU(2)
+	c.Add("a", 1, testEpoch.Add(time.Hour))
+	c.Add("a", 2, testEpoch.Add(time.Hour))
+	if v, ok := c.Get("a"); !ok || v != 2 {
+		t.Fatalf("Get = %d, %v; ожидалось 2", v, ok)
+	}
+	if c.Len() != 1 {
+		t.Fatalf("Len = %d, ожидалось 1", c.Len())
+	}
+}
+
+func TestLRUExpiry(t *testing.T) {
+	c, now := newTestLRU(4)
+	c.Add("a", 1, testEpoch.Add(time.Minute))
+	c.Add("past", 2, testEpoch.Add(-time.Second))
+
+	if _, ok := c.Get("past"); ok {
+		t.Fatal("запись с истекшим сроком возвращена")
+	}
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatal("запись потеряна до истечения срока")
+	}
+
+	*now = testEpoch.Add(time.Minute) // срок истекает ровно в expiresAt
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("запись возвращена в момент истечения")
+	}
+	if c.Len() != 0 {
+		t.Fatalf("истекшие записи не удалены при чтении: Len = %d", c.Len())
+	}
+
+	// Обновление продлевает срок
+	c.Add("b", 3, testEpoch.Add(2*time.Minute))
+	c.Add("b", 4, testEpoch.Add(time.Hour))
+	*now = testEpoch.Add(30 * time.Minute)
+	if v, ok := c.Get("b"); !ok || v != 4 {
+		t.Fatalf("Get = %d, %v после продления срока", v, ok)
+	}
+}
+
+func TestLRUConcurrentAccess(t *testing.T) {
+	c := NewLRU[string, int](16)
+	expires := time.Now().Add(time.Hour)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprintf("k%d", (g*1000+i)%64)
+				c.Add(key, i, expires)
+				c.Get(key)
+				if i%10 == 0 {
+					c.Remove(key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if c.Len() > 16 {
+		t.Fatalf("кэш превысил емкость: %d", c.Len())
+	}
+}
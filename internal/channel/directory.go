@@ -0,0 +1,54 @@
+package channel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"notification-mvp/internal/domain"
+)
+
+// FileDirectory — справочник контактов пользователей из JSON файла
+type FileDirectory struct {
+	users map[string]domain.Contact // ключ — "<id>-<login>"
+}
+
+// directoryFile — формат файла справочника
+type directoryFile struct {
+	Users map[string]domain.Contact `json:"users"`
+}
+
+// LoadDirectory читает справочник контактов; пустой путь — пустой справочник
+func LoadDirectory(path string) (*FileDirectory, error) {
+	d := &FileDirectory{users: make(map[string]domain.Contact)}
+	if path == "" {
+		return d, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения справочника пользователей: %w", err)
+	}
+	var f directoryFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("ошибка разбора справочника пользователей: %w", err)
+	}
+	for userKey, contact := range f.Users {
+		if _, _, err := domain.ParseUserKey(userKey); err != nil {
+			return nil, fmt.Errorf("справочник пользователей: %w", err)
+		}
+		d.users[userKey] = contact
+	}
+	return d, nil
+}
+
+// Len возвращает число пользователей в справочнике
+func (d *FileDirectory) Len() int {
+	return len(d.users)
+}
+
+// Lookup возвращает контакт пользователя
+func (d *FileDirectory) Lookup(ctx context.Context, target domain.Target) (domain.Contact, error) {
+	return d.users[domain.UserKey(target.ID, target.Login)], nil
+}
@@ -0,0 +1,159 @@
+package channel
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"notification-mvp/internal/domain"
+)
+
+// SMTPConfig — параметры отправки email
+type SMTPConfig struct {
+	Addr     string // host:port SMTP сервера
+	From     string
+	Username string // пусто — без аутентификации (локальный stand-in, например MailHog)
+	Password string
+	Subject  string // начало темы письма, к нему добавляется источник уведомления
+	Timeout  time.Duration
+}
+
+// SMTPChannel отправляет уведомления письмами. STARTTLS используется, если сервер его объявляет
+type SMTPChannel struct {
+	cfg  SMTPConfig
+	host string
+}
+
+// NewSMTPChannel создает email канал
+func NewSMTPChannel(cfg SMTPConfig) (*SMTPChannel, error) {
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("неверный адрес SMTP сервера %q: %w", cfg.Addr, err)
+	}
+	if cfg.From == "" {
+		return nil, fmt.Errorf("не задан адрес отправителя SMTP")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Subject == "" {
+		cfg.Subject = "Новое уведомление"
+	}
+	return &SMTPChannel{cfg: cfg, host: host}, nil
+}
+
+func (c *SMTPChannel) Name() string {
+	return "email"
+}
+
+// Send отправляет письмо на contact.Email
+func (c *SMTPChannel) Send(ctx context.Context, contact domain.Contact, d domain.ChannelDelivery) error {
+	if contact.Email == "" {
+		return domain.ErrNoAddress
+	}
+	msg, err := c.buildMessage(contact.Email, d)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("ошибка подключения к SMTP серверу: %w", err)
+	}
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, c.host)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("ошибка приветствия SMTP сервера: %w", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: c.host}); err != nil {
+			return fmt.Errorf("ошибка STARTTLS: %w", err)
+		}
+	}
+	if c.cfg.Username != "" {
+		// PlainAuth отказывает без TLS везде, кроме localhost
+		if err := client.Auth(smtp.PlainAuth("", c.cfg.Username, c.cfg.Password, c.host)); err != nil {
+			return fmt.Errorf("ошибка аутентификации SMTP: %w", err)
+		}
+	}
+	if err := client.Mail(c.cfg.From); err != nil {
+		return fmt.Errorf("ошибка MAIL FROM: %w", err)
+	}
+	if err := client.Rcpt(contact.Email); err != nil {
+		return fmt.Errorf("ошибка RCPT TO: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("ошибка DATA: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("ошибка записи письма: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("ошибка отправки письма: %w", err)
+	}
+	return client.Quit()
+}
+
+// buildMessage формирует письмо text/plain в UTF-8 (quoted-printable)
+func (c *SMTPChannel) buildMessage(to string, d domain.ChannelDelivery) ([]byte, error) {
+	subject := c.cfg.Subject
+	if d.Source != "" {
+		subject += ": " + d.Source
+	}
+
+	var buf bytes.Buffer
+	header := func(k, v string) { fmt.Fprintf(&buf, "%s: %s\r\n", k, v) }
+	header("From", c.cfg.From)
+	header("To", to)
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%s@%s>", d.NotificationID, c.host))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=UTF-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	header("X-Notification-ID", d.NotificationID)
+	switch d.Priority {
+	case domain.PriorityUrgent:
+		header("X-Priority", "1")
+	case domain.PriorityHigh:
+		header("X-Priority", "2")
+	}
+	buf.WriteString("\r\n")
+
+	var body strings.Builder
+	body.WriteString(d.Message)
+	body.WriteString("\n\n")
+	if d.Source != "" {
+		fmt.Fprintf(&body, "Источник: %s\n", d.Source)
+	}
+	if d.Category != "" {
+		fmt.Fprintf(&body, "Категория: %s\n", d.Category)
+	}
+	fmt.Fprintf(&body, "Создано: %s\n", d.CreatedAt.UTC().Format(time.RFC3339))
+
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(body.String(), "\n", "\r\n"))); err != nil {
+		return nil, fmt.Errorf("ошибка кодирования письма: %w", err)
+	}
+	if err := qp.Close(); err != nil {
+		return nil, fmt.Errorf("ошибка кодирования письма: %w", err)
+	}
+	return buf.Bytes(), nil
+}
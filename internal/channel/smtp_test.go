@@ -0,0 +1,218 @@
+package channel
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"notification-mvp/internal/domain"
+)
+
+// smtpSession — то, что тестовый SMTP сервер получил от клиента
+type smtpSession struct {
+	from string
+	rcpt string
+	data string
+}
+
+// startSMTPServer запускает SMTP сервер на loopback, который принимает одно письмо.
+// rejectRcpt — код ответа на RCPT TO вместо 250 (пусто — адрес принимается)
+func startSMTPServer(t *testing.T, rejectRcpt string) (string, <-chan smtpSession) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { _, _ = io.WriteString(conn, line+"\r\n") }
+		var s smtpSession
+		reply("220 localhost ESMTP test")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			cmd := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250-localhost")
+				reply("250 8BITMIME")
+			case strings.HasPrefix(cmd, "MAIL FROM:"):
+				s.from = envelopeAddr(line[len("MAIL FROM:"):])
+				reply("250 OK")
+			case strings.HasPrefix(cmd, "RCPT TO:"):
+				if rejectRcpt != "" {
+					reply(rejectRcpt)
+					continue
+				}
+				s.rcpt = envelopeAddr(line[len("RCPT TO:"):])
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var data strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				s.data = data.String()
+				reply("250 OK queued")
+			case cmd == "QUIT":
+				reply("221 Bye")
+				sessions <- s
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return ln.Addr().String(), sessions
+}
+
+// envelopeAddr извлекает адрес из аргумента MAIL FROM / RCPT TO ("<addr> BODY=8BITMIME")
+func envelopeAddr(arg string) string {
+	addr, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(arg), "<"), ">")
+	return addr
+}
+
+func testDelivery() domain.ChannelDelivery {
+	return domain.ChannelDelivery{
+		NotificationID: "nid-1",
+		Target:         domain.Target{ID: 1, Login: "alice"},
+		Message:        "Отчет готов",
+		Source:         "reports",
+		Category:       "billing",
+		Priority:       domain.PriorityUrgent,
+		CreatedAt:      time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestSMTPChannelSend(t *testing.T) {
+	addr, sessions := startSMTPServer(t, "")
+	ch, err := NewSMTPChannel(SMTPConfig{Addr: addr, From: "noreply@example.com", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ch.Send(context.Background(), domain.Contact{Email: "alice@example.com"}, testDelivery()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	s := <-sessions
+	if s.from != "noreply@example.com" || s.rcpt != "alice@example.com" {
+		t.Fatalf("конверт письма: from=%q rcpt=%q", s.from, s.rcpt)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(s.data))
+	if err != nil {
+		t.Fatalf("письмо не разбирается: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "Новое уведомление: reports" {
+		t.Errorf("тема письма %q", subject)
+	}
+	for header, want := range map[string]string{
+		"X-Notification-ID": "nid-1",
+		"X-Priority":        "1",
+		"Content-Type":      "text/plain; charset=UTF-8",
+	} {
+		if got := msg.Header.Get(header); got != want {
+			t.Errorf("%s = %q, ожидалось %q", header, got, want)
+		}
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Отчет готов", "Источник: reports", "Категория: billing", "Создано: 2025-03-10T12:00:00Z"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("в теле письма нет %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestSMTPChannelErrors(t *testing.T) {
+	t.Run("нет адреса получателя", func(t *testing.T) {
+		ch, err := NewSMTPChannel(SMTPConfig{Addr: "127.0.0.1:1", From: "noreply@example.com"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ch.Send(context.Background(), domain.Contact{}, testDelivery()); !errors.Is(err, domain.ErrNoAddress) {
+			t.Fatalf("ожидалась ErrNoAddress, получено %v", err)
+		}
+	})
+
+	t.Run("сервер отклоняет получателя", func(t *testing.T) {
+		addr, _ := startSMTPServer(t, "550 No such user")
+		ch, err := NewSMTPChannel(SMTPConfig{Addr: addr, From: "noreply@example.com", Timeout: 5 * time.Second})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ch.Send(context.Background(), domain.Contact{Email: "ghost@example.com"}, testDelivery())
+		if err == nil || !strings.Contains(err.Error(), "RCPT TO") {
+			t.Fatalf("ожидалась ошибка RCPT TO, получено %v", err)
+		}
+	})
+
+	t.Run("сервер недоступен", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := ln.Addr().String()
+		_ = ln.Close()
+		ch, err := NewSMTPChannel(SMTPConfig{Addr: addr, From: "noreply@example.com", Timeout: time.Second})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ch.Send(context.Background(), domain.Contact{Email: "alice@example.com"}, testDelivery()); err == nil {
+			t.Fatal("отправка на недоступный сервер прошла без ошибки")
+		}
+	})
+}
+
+func TestNewSMTPChannelValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     SMTPConfig
+		wantErr bool
+	}{
+		{"корректная конфигурация", SMTPConfig{Addr: "mail:25", From: "noreply@example.com"}, false},
+		{"адрес без порта", SMTPConfig{Addr: "mail", From: "noreply@example.com"}, true},
+		{"нет отправителя", SMTPConfig{Addr: "mail:25"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSMTPChannel(tt.cfg); (err != nil) != tt.wantErr {
+				t.Fatalf("ошибка %v, ожидалась: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package channel
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"notification-mvp/internal/domain"
+)
+
+// errPrivateAddress — webhook указывает на внутренний адрес, а они не разрешены
+var errPrivateAddress = errors.New("адрес webhook во внутренней сети запрещен")
+
+// sharedAddressSpace — 100.64.0.0/10 (RFC 6598, CGNAT): внутренняя сеть провайдера и ряда облаков,
+// net.IP.IsPrivate ее не включает
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// blockedIP сообщает, что адрес относится к внутренней сети и webhook на него запрещен
+func blockedIP(ip net.IP) bool {
+	return ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip)
+}
+
+// WebhookStore — хранилище регистраций webhook
+type WebhookStore interface {
+	GetWebhook(ctx context.Context, userID int64, login string) (*domain.Webhook, error)
+}
+
+// Acker подтверждает прочтение уведомления так же, как WebSocket-клиент
+type Acker interface {
+	AckNotification(ctx context.Context, userID int64, login string, streamID, notificationID string) (domain.AckResult, error)
+}
+
+// WebhookConfig — параметры отправки webhook
+type WebhookConfig struct {
+	Timeout      time.Duration
+	AllowPrivate bool // разрешить loopback, частные и link-local адреса (локальная разработка)
+}
+
+// WebhookChannel отправляет уведомления POST-запросом на URL, зарегистрированный пользователем.
+// Тело подписывается HMAC-SHA256 секретом регистрации; ответ 2xx считается прочтением уведомления
+type WebhookChannel struct {
+	store  WebhookStore
+	acker  Acker
+	client *http.Client
+}
+
+// NewWebhookChannel создает webhook канал
+func NewWebhookChannel(store WebhookStore, acker Acker, cfg WebhookConfig) *WebhookChannel {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivate {
+		// Проверяем уже разрешенный адрес при подключении: так не обойти запрет через DNS
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if blockedIP(net.ParseIP(host)) {
+				return fmt.Errorf("%w: %s", errPrivateAddress, host)
+			}
+			return nil
+		}
+	}
+	// Прокси не используется: соединение с ним прошло бы проверку адреса вместо самого webhook
+	transport := &http.Transport{
+		Proxy:               nil,
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: cfg.Timeout,
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	return &WebhookChannel{
+		store: store,
+		acker: acker,
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: transport,
+			// Редиректы не следуем: подпись и проверка адреса относятся к зарегистрированному URL
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+func (c *WebhookChannel) Name() string {
+	return "webhook"
+}
+
+// Send отправляет уведомление на webhook получателя. Ошибка (в том числе ответ не 2xx)
+// оставляет доставку диспетчеру для повтора
+func (c *WebhookChannel) Send(ctx context.Context, contact domain.Contact, d domain.ChannelDelivery) error {
+	hook, err := c.store.GetWebhook(ctx, d.Target.ID, d.Target.Login)
+	if err != nil {
+		return err
+	}
+	if hook == nil {
+		return domain.ErrNoAddress
+	}
+
+	body, err := json.Marshal(domain.WebSocketMessage{
+		Type: domain.MessageTypeNotificationPush,
+		Data: domain.PushPayload{
+			NotificationID: d.NotificationID,
+			StreamID:       d.StreamID,
+			Message:        d.Message,
+			CreatedAt:      d.CreatedAt,
+			Source:         d.Source,
+			Category:       d.Category,
+			Priority:       d.Priority,
+			Status:         domain.StatusUnread,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации webhook: %w", err)
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("ошибка формирования запроса webhook: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "notification-mvp-webhook")
+	req.Header.Set("X-Notification-ID", d.NotificationID)
+	req.Header.Set("X-Notification-Timestamp", ts)
+	req.Header.Set("X-Notification-Signature", "sha256="+Sign(hook.Secret, ts, body))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ошибка отправки webhook: %w", err)
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook ответил статусом %d", resp.StatusCode)
+	}
+
+	// Успешный ответ — подтверждение прочтения: снимает доставку другими каналами и эскалацию
+	if _, err := c.acker.AckNotification(ctx, d.Target.ID, d.Target.Login, d.StreamID, d.NotificationID); err != nil {
+		return fmt.Errorf("ошибка подтверждения уведомления после webhook: %w", err)
+	}
+	return nil
+}
+
+// Sign возвращает hex HMAC-SHA256 от "<timestamp>.<body>" — значение заголовка
+// X-Notification-Signature без префикса sha256=
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,207 @@
+package channel
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"notification-mvp/internal/domain"
+)
+
+// staticWebhooks — хранилище с одной регистрацией для всех пользователей
+type staticWebhooks struct{ hook *domain.Webhook }
+
+func (s staticWebhooks) GetWebhook(context.Context, int64, string) (*domain.Webhook, error) {
+	return s.hook, nil
+}
+
+// recordingAcker запоминает подтверждения прочтения
+type recordingAcker struct {
+	mu   sync.Mutex
+	acks []string // "<stream_id>|<notification_id>"
+}
+
+func (a *recordingAcker) AckNotification(_ context.Context, _ int64, _ string, streamID, notificationID string) (domain.AckResult, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.acks = append(a.acks, streamID+"|"+notificationID)
+	return domain.AckResultAcked, nil
+}
+
+func (a *recordingAcker) acked() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.acks...)
+}
+
+// webhookRequest — то, что тестовый сервер получил от канала
+type webhookRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// startWebhookServer запускает webhook-получателя, отвечающего статусом status
+func startWebhookServer(t *testing.T, status int) (*httptest.Server, <-chan webhookRequest) {
+	t.Helper()
+	requests := make(chan webhookRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- webhookRequest{header: r.Header.Clone(), body: body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests
+}
+
+func webhookDelivery() domain.ChannelDelivery {
+	return domain.ChannelDelivery{
+		NotificationID: "nid-1",
+		StreamID:       "1741608000000-0",
+		Target:         domain.Target{ID: 1, Login: "alice"},
+		Message:        "hello",
+		Source:         "billing",
+		CreatedAt:      time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestWebhookSendSignsAndAcks(t *testing.T) {
+	srv, requests := startWebhookServer(t, http.StatusNoContent)
+	acker := &recordingAcker{}
+	ch := NewWebhookChannel(staticWebhooks{&domain.Webhook{URL: srv.URL + "/hook", Secret: "s3cret"}}, acker,
+		WebhookConfig{Timeout: time.Second, AllowPrivate: true})
+
+	d := webhookDelivery()
+	if err := ch.Send(context.Background(), domain.Contact{}, d); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	req := <-requests
+
+	// Подпись проверяем независимо от Sign: HMAC-SHA256 от "<timestamp>.<body>"
+	ts := req.header.Get("X-Notification-Timestamp")
+	if _, err := strconv.ParseInt(ts, 10, 64); err != nil {
+		t.Fatalf("неверная метка времени %q", ts)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(ts + "."))
+	mac.Write(req.body)
+	if got, want := req.header.Get("X-Notification-Signature"), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Fatalf("подпись %q, ожидалась %q", got, want)
+	}
+	if got := req.header.Get("X-Notification-ID"); got != d.NotificationID {
+		t.Fatalf("X-Notification-ID = %q", got)
+	}
+
+	var msg struct {
+		Type string             `json:"type"`
+		Data domain.PushPayload `json:"data"`
+	}
+	if err := json.Unmarshal(req.body, &msg); err != nil {
+		t.Fatalf("тело webhook: %v", err)
+	}
+	if msg.Type != domain.MessageTypeNotificationPush || msg.Data.NotificationID != d.NotificationID ||
+		msg.Data.StreamID != d.StreamID || msg.Data.Message != d.Message || !msg.Data.CreatedAt.Equal(d.CreatedAt) {
+		t.Fatalf("неверное тело webhook: %+v", msg)
+	}
+	if got := acker.acked(); len(got) != 1 || got[0] != d.StreamID+"|"+d.NotificationID {
+		t.Fatalf("подтверждения %v, ожидалось одно для %s", got, d.NotificationID)
+	}
+}
+
+func TestWebhookSendRetriesOnServerError(t *testing.T) {
+	srv, requests := startWebhookServer(t, http.StatusInternalServerError)
+	acker := &recordingAcker{}
+	ch := NewWebhookChannel(staticWebhooks{&domain.Webhook{URL: srv.URL, Secret: "s3cret"}}, acker,
+		WebhookConfig{Timeout: time.Second, AllowPrivate: true})
+
+	if err := ch.Send(context.Background(), domain.Contact{}, webhookDelivery()); err == nil {
+		t.Fatal("ответ 5xx должен возвращать ошибку для повтора доставки")
+	}
+	<-requests
+	if got := acker.acked(); len(got) != 0 {
+		t.Fatalf("уведомление подтверждено после ответа 5xx: %v", got)
+	}
+}
+
+func TestWebhookSendWithoutRegistration(t *testing.T) {
+	ch := NewWebhookChannel(staticWebhooks{}, &recordingAcker{}, WebhookConfig{})
+	if err := ch.Send(context.Background(), domain.Contact{}, webhookDelivery()); !errors.Is(err, domain.ErrNoAddress) {
+		t.Fatalf("ожидалась ошибка ErrNoAddress, получено %v", err)
+	}
+}
+
+func TestWebhookRejectsPrivateAddresses(t *testing.T) {
+	srv, requests := startWebhookServer(t, http.StatusOK)
+
+	for _, url := range []string{
+		srv.URL,                       // loopback
+		"http://10.0.0.1:9/hook",      // частная сеть
+		"http://100.64.0.1:9/hook",    // CGNAT
+		"http://169.254.169.254/",     // метаданные облака
+		"http://[::ffff:127.0.0.1]:9", // IPv4 в IPv6
+	} {
+		t.Run(url, func(t *testing.T) {
+			acker := &recordingAcker{}
+			ch := NewWebhookChannel(staticWebhooks{&domain.Webhook{URL: url, Secret: "s3cret"}}, acker,
+				WebhookConfig{Timeout: time.Second})
+			if err := ch.Send(context.Background(), domain.Contact{}, webhookDelivery()); !errors.Is(err, errPrivateAddress) {
+				t.Fatalf("ожидалась ошибка errPrivateAddress, получено %v", err)
+			}
+			if got := acker.acked(); len(got) != 0 {
+				t.Fatalf("уведомление подтверждено: %v", got)
+			}
+		})
+	}
+	select {
+	case req := <-requests:
+		t.Fatalf("запрос дошел до внутреннего адреса: %+v", req.header)
+	default:
+	}
+}
+
+func TestWebhookIgnoresEnvironmentProxy(t *testing.T) {
+	// Через прокси проверка адреса в dialer относилась бы к прокси, а не к webhook
+	ch := NewWebhookChannel(staticWebhooks{}, &recordingAcker{}, WebhookConfig{})
+	if transport, ok := ch.client.Transport.(*http.Transport); !ok || transport.Proxy != nil {
+		t.Fatal("webhook не должен ходить через прокси из окружения")
+	}
+}
+
+func TestBlockedIP(t *testing.T) {
+	tests := []struct {
+		ip      string
+		blocked bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"fe80::1", true},
+		{"0.0.0.0", true},
+		{"100.64.0.1", true},
+		{"100.127.255.255", true},
+		{"::ffff:100.64.0.1", true},
+		{"fd00::1", true},
+		{"100.63.255.255", false},
+		{"100.128.0.1", false},
+		{"93.184.216.34", false},
+		{"2606:4700::1111", false},
+	}
+	for _, tt := range tests {
+		if got := blockedIP(net.ParseIP(tt.ip)); got != tt.blocked {
+			t.Errorf("blockedIP(%s) = %v, ожидалось %v", tt.ip, got, tt.blocked)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Package clock — источник текущего времени и таймеров, подменяемый в тестах
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock абстрагирует источник текущего времени и таймеров (подменяется в тестах)
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// System возвращает системное время
+type System struct{}
+
+// Now возвращает текущее системное время
+func (System) Now() time.Time { return time.Now() }
+
+// After возвращает канал, в который придет время по истечении d
+func (System) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// fakeTimer — ожидание Fake.After
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// Fake — управляемые часы для тестов: время двигается только через Advance/Set,
+// таймеры After срабатывают, когда часы доходят до их срока
+type Fake struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+}
+
+// NewFake создает часы, стоящие на моменте now
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now возвращает текущее время часов
+func (c *Fake) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After возвращает канал, который сработает после продвижения часов на d
+func (c *Fake) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	at := c.now.Add(d)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.timers = append(c.timers, fakeTimer{at: at, ch: ch})
+	return ch
+}
+
+// Advance сдвигает часы на d и срабатывает наступившие таймеры
+func (c *Fake) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.setLocked(c.now.Add(d))
+	c.mu.Unlock()
+}
+
+// Set переставляет часы на момент t (назад время не идет)
+func (c *Fake) Set(t time.Time) {
+	c.mu.Lock()
+	if t.After(c.now) {
+		c.setLocked(t)
+	}
+	c.mu.Unlock()
+}
+
+// Waiters возвращает число несработавших таймеров: тесты ждут, пока чтение заблокируется
+func (c *Fake) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+func (c *Fake) setLocked(t time.Time) {
+	c.now = t
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if !timer.at.After(t) {
+			timer.ch <- t
+			continue
+		}
+		pending = append(pending, timer)
+	}
+	c.timers = pending
+}
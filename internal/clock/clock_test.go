@@ -0,0 +1,43 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var testEpoch = time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+func TestFakeAfter(t *testing.T) {
+	c := NewFake(testEpoch)
+
+	immediate := c.After(0)
+	select {
+	case <-immediate:
+	default:
+		t.Fatal("After(0) должен срабатывать сразу")
+	}
+
+	ch := c.After(time.Minute)
+	c.Advance(59 * time.Second)
+	select {
+	case <-ch:
+		t.Fatal("таймер сработал раньше срока")
+	default:
+	}
+	c.Set(testEpoch.Add(-time.Hour)) // назад время не идет
+	if !c.Now().Equal(testEpoch.Add(59 * time.Second)) {
+		t.Fatalf("часы ушли назад: %v", c.Now())
+	}
+	c.Advance(time.Second)
+	select {
+	case got := <-ch:
+		if !got.Equal(testEpoch.Add(time.Minute)) {
+			t.Fatalf("таймер сработал со временем %v", got)
+		}
+	default:
+		t.Fatal("таймер не сработал")
+	}
+	if c.Waiters() != 0 {
+		t.Fatalf("остались ожидающие таймеры: %d", c.Waiters())
+	}
+}
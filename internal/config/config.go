@@ -2,25 +2,239 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Бэкенды хранилища уведомлений
+const (
+	StorageRedis  = "redis"
+	StorageMemory = "memory" // только для одиночного dev-запуска
+)
+
+// Режимы распределения обслуживающих воркеров между pod
+const (
+	MaintenanceLeader  = "leader"  // все пользователи обрабатываются на pod-лидере
+	MaintenanceSharded = "sharded" // пользователи делятся между живыми pod консистентным хэшированием
 )
 
 // Config содержит конфигурацию приложения
 type Config struct {
 	ServerAddr    string
 	RedisAddr     string
+	RedisUsername string
 	RedisPassword string
 	RedisDB       int
 	PodID         string
+
+	// TLS подключения к Redis (CA и клиентский сертификат опциональны)
+	RedisTLS           bool
+	RedisTLSCAFile     string
+	RedisTLSCertFile   string
+	RedisTLSKeyFile    string
+	RedisTLSServerName string
+	RedisTLSInsecure   bool
+
+	// Redis Sentinel: имя master включает режим failover, адреса — список sentinel-узлов
+	RedisSentinelMaster   string
+	RedisSentinelAddrs    []string
+	RedisSentinelUsername string
+	RedisSentinelPassword string
+
+	// Redis Cluster: список seed-узлов и схема имен ключей (legacy | hashtag)
+	RedisAddrs     []string
+	RedisCluster   bool
+	RedisKeyLayout string
+
+	// Лимит стрима пользователя по умолчанию и файл переопределений по tenant/source/user
+	StreamMaxLen         int
+	StreamOverflowPolicy string
+	StreamLimitsFile     string
+
+	// TopicFanoutChunk — сколько подписчиков темы читается за один шаг рассылки по теме
+	TopicFanoutChunk int
+
+	// MaintenanceMode — распределение TTL джанитора, retention триммера и перехвата зависших сообщений
+	MaintenanceMode string
+
+	// LeaderLeaseTTL — срок лиза singleton-воркеров; за это время воркер переезжает на другой pod после сбоя
+	LeaderLeaseTTL time.Duration
+
+	// Межподовая шина: приблизительный MAXLEN стрима pod, число попыток доставки и начальная задержка повтора
+	BusMaxLen        int
+	BusMaxDeliveries int
+	BusRetryBackoff  time.Duration
+
+	// Расписания фоновых воркеров: период и случайная добавка к нему
+	TTLJanitorInterval       time.Duration
+	TTLJanitorJitter         time.Duration
+	GroupMaintenanceInterval time.Duration
+	GroupMaintenanceJitter   time.Duration
+	RetentionTrimInterval    time.Duration
+	RetentionTrimJitter      time.Duration
+	HeartbeatInterval        time.Duration
+	HeartbeatJitter          time.Duration
+	DigestInterval           time.Duration
+	DigestJitter             time.Duration
+	EscalationInterval       time.Duration
+	EscalationJitter         time.Duration
+	DeferredInterval         time.Duration
+	DeferredJitter           time.Duration
+
+	// PodStaleAfter — через сколько без пульса pod считается выбывшим и его сессии передаются другим pod
+	PodStaleAfter time.Duration
+
+	// ExpiryEvents включает удаление истекших записей по событиям keyspace (нужна схема hashtag)
+	ExpiryEvents bool
+
+	// PayloadCacheSize — размер локального LRU-кэша payload (0 — кэш выключен)
+	PayloadCacheSize int
+
+	// StorageBackend выбирает реализацию хранилища: redis или memory
+	StorageBackend string
+
+	// Логирование
+	LogLevel  string
+	LogFormat string
+	LogRedact string
+
+	// Шифрование payload в Redis (пустой путь — шифрование выключено)
+	EncryptionKeyringFile string
+	EncryptState          bool
+	ReencryptInterval     time.Duration
+	ReencryptJitter       time.Duration
+
+	// Долговременный архив (пустой драйвер — архив выключен)
+	ArchiveDriver        string
+	ArchiveDSN           string
+	ArchiveBatchSize     int
+	ArchiveFlushInterval time.Duration
+
+	// ErasureSigningKey — ключ HMAC-SHA256 для подписи квитанций об удалении данных (пустой — удаление отключено)
+	ErasureSigningKey string
+
+	// Email канал (пустой адрес — канал выключен)
+	SMTPAddr     string
+	SMTPFrom     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPSubject  string
+	SMTPTimeout  time.Duration
+
+	// Webhook канал: URL регистрирует сам пользователь; внутренние адреса запрещены, если не разрешены явно
+	WebhooksEnabled     bool
+	WebhookTimeout      time.Duration
+	WebhookAllowPrivate bool
+
+	// UserDirectoryFile — JSON справочник контактов пользователей для внешних каналов
+	UserDirectoryFile string
+
+	// Доставка внешними каналами: окно непрочитанности для пользователей в сети, попытки и расписание
+	ChannelUnreadWindow     time.Duration
+	ChannelMaxAttempts      int
+	ChannelRetryBackoff     time.Duration
+	ChannelDispatchInterval time.Duration
+	ChannelDispatchJitter   time.Duration
 }
 
 // Load загружает конфигурацию из переменных окружения
 func Load() *Config {
+	redisAddr := getEnv("REDIS_ADDR", "localhost:6379")
+
 	return &Config{
 		ServerAddr:    getEnv("SERVER_ADDR", ":8080"),
-		RedisAddr:     getEnv("REDIS_ADDR", "localhost:6379"),
+		RedisAddr:     redisAddr,
+		RedisUsername: getEnv("REDIS_USERNAME", ""),
 		RedisPassword: getEnv("REDIS_PASSWORD", ""),
-		RedisDB:       0, // Всегда используем DB 0 для простоты
+		RedisDB:       getEnvInt("REDIS_DB", 0),
 		PodID:         defaultPodID(),
+
+		RedisTLS:           getEnvBool("REDIS_TLS", false),
+		RedisTLSCAFile:     getEnv("REDIS_TLS_CA_FILE", ""),
+		RedisTLSCertFile:   getEnv("REDIS_TLS_CERT_FILE", ""),
+		RedisTLSKeyFile:    getEnv("REDIS_TLS_KEY_FILE", ""),
+		RedisTLSServerName: getEnv("REDIS_TLS_SERVER_NAME", ""),
+		RedisTLSInsecure:   getEnvBool("REDIS_TLS_INSECURE", false),
+
+		RedisSentinelMaster:   getEnv("REDIS_SENTINEL_MASTER", ""),
+		RedisSentinelAddrs:    splitList(getEnv("REDIS_SENTINEL_ADDRS", "")),
+		RedisSentinelUsername: getEnv("REDIS_SENTINEL_USERNAME", ""),
+		RedisSentinelPassword: getEnv("REDIS_SENTINEL_PASSWORD", ""),
+
+		RedisAddrs:     splitList(redisAddr),
+		RedisCluster:   getEnvBool("REDIS_CLUSTER", false),
+		RedisKeyLayout: getEnv("REDIS_KEY_LAYOUT", "legacy"),
+
+		StreamMaxLen:         getEnvInt("STREAM_MAX_LEN", 100),
+		StreamOverflowPolicy: getEnv("STREAM_OVERFLOW_POLICY", "drop_oldest"),
+		StreamLimitsFile:     getEnv("STREAM_LIMITS_FILE", ""),
+
+		TopicFanoutChunk: getEnvInt("TOPIC_FANOUT_CHUNK", 500),
+
+		PayloadCacheSize: getEnvInt("PAYLOAD_CACHE_SIZE", 0),
+
+		ExpiryEvents: getEnvBool("EXPIRY_EVENTS", false),
+
+		BusMaxLen:        getEnvInt("BUS_MAX_LEN", 10000),
+		BusMaxDeliveries: getEnvInt("BUS_MAX_DELIVERIES", 5),
+		BusRetryBackoff:  getEnvDuration("BUS_RETRY_BACKOFF", 1*time.Second),
+
+		TTLJanitorInterval:       getEnvDuration("TTL_JANITOR_INTERVAL", 1*time.Minute),
+		TTLJanitorJitter:         getEnvDuration("TTL_JANITOR_JITTER", 0),
+		GroupMaintenanceInterval: getEnvDuration("GROUP_MAINTENANCE_INTERVAL", 2*time.Minute),
+		GroupMaintenanceJitter:   getEnvDuration("GROUP_MAINTENANCE_JITTER", 0),
+		RetentionTrimInterval:    getEnvDuration("RETENTION_TRIM_INTERVAL", 1*time.Minute),
+		RetentionTrimJitter:      getEnvDuration("RETENTION_TRIM_JITTER", 0),
+		HeartbeatInterval:        getEnvDuration("HEARTBEAT_INTERVAL", 30*time.Second),
+		HeartbeatJitter:          getEnvDuration("HEARTBEAT_JITTER", 0),
+		DigestInterval:           getEnvDuration("DIGEST_INTERVAL", 1*time.Minute),
+		DigestJitter:             getEnvDuration("DIGEST_JITTER", 0),
+		EscalationInterval:       getEnvDuration("ESCALATION_INTERVAL", 30*time.Second),
+		EscalationJitter:         getEnvDuration("ESCALATION_JITTER", 0),
+		DeferredInterval:         getEnvDuration("DEFERRED_INTERVAL", 30*time.Second),
+		DeferredJitter:           getEnvDuration("DEFERRED_JITTER", 0),
+		PodStaleAfter:            getEnvDuration("POD_STALE_AFTER", 90*time.Second),
+
+		MaintenanceMode: getEnv("MAINTENANCE_MODE", MaintenanceLeader),
+		LeaderLeaseTTL:  getEnvDuration("LEADER_LEASE_TTL", 15*time.Second),
+
+		StorageBackend: getEnv("STORAGE_BACKEND", StorageRedis),
+
+		LogLevel:  getEnv("LOG_LEVEL", "info"),
+		LogFormat: getEnv("LOG_FORMAT", "text"),
+		LogRedact: getEnv("LOG_REDACT", "mask"),
+
+		EncryptionKeyringFile: getEnv("ENCRYPTION_KEYRING_FILE", ""),
+		EncryptState:          getEnvBool("ENCRYPTION_STATE", false),
+		ReencryptInterval:     getEnvDuration("REENCRYPT_INTERVAL", 10*time.Minute),
+		ReencryptJitter:       getEnvDuration("REENCRYPT_JITTER", 0),
+
+		ArchiveDriver:        getEnv("ARCHIVE_DRIVER", ""),
+		ArchiveDSN:           getEnv("ARCHIVE_DSN", "notifications-archive.db"),
+		ArchiveBatchSize:     getEnvInt("ARCHIVE_BATCH_SIZE", 100),
+		ArchiveFlushInterval: getEnvDuration("ARCHIVE_FLUSH_INTERVAL", 2*time.Second),
+
+		ErasureSigningKey: getEnv("ERASURE_SIGNING_KEY", ""),
+
+		SMTPAddr:     getEnv("SMTP_ADDR", ""),
+		SMTPFrom:     getEnv("SMTP_FROM", "notifications@localhost"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		SMTPSubject:  getEnv("SMTP_SUBJECT", "Новое уведомление"),
+		SMTPTimeout:  getEnvDuration("SMTP_TIMEOUT", 10*time.Second),
+
+		WebhooksEnabled:     getEnvBool("WEBHOOKS_ENABLED", false),
+		WebhookTimeout:      getEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+		WebhookAllowPrivate: getEnvBool("WEBHOOK_ALLOW_PRIVATE", false),
+
+		UserDirectoryFile: getEnv("USER_DIRECTORY_FILE", ""),
+
+		ChannelUnreadWindow:     getEnvDuration("CHANNEL_UNREAD_WINDOW", 10*time.Minute),
+		ChannelMaxAttempts:      getEnvInt("CHANNEL_MAX_ATTEMPTS", 5),
+		ChannelRetryBackoff:     getEnvDuration("CHANNEL_RETRY_BACKOFF", 30*time.Second),
+		ChannelDispatchInterval: getEnvDuration("CHANNEL_DISPATCH_INTERVAL", 15*time.Second),
+		ChannelDispatchJitter:   getEnvDuration("CHANNEL_DISPATCH_JITTER", 0),
 	}
 }
 
@@ -31,6 +245,44 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// splitList разбирает список через запятую, пропуская пустые элементы
+func splitList(value string) []string {
+	var out []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+	}
+	return defaultValue
+}
+
 func defaultPodID() string {
 	if v := os.Getenv("POD_ID"); v != "" {
 		return v
@@ -2,16 +2,39 @@ package domain
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
+// ErrStorageUnavailable оборачивает временные ошибки хранилища (разрыв соединения, failover),
+// после которых операцию можно повторить
+var ErrStorageUnavailable = errors.New("хранилище временно недоступно")
+
+// ErrWorkerNotFound возвращается для неизвестного имени фонового воркера
+var ErrWorkerNotFound = errors.New("воркер не найден")
+
+// ErrWorkerInactive возвращается при запуске воркера, цикл которого не выполняется ни на одном живом pod
+var ErrWorkerInactive = errors.New("воркер не выполняется ни на одном pod")
+
+// ErrInboxFull возвращается при заполненном стриме пользователя и политике reject_new (или drop_read без прочитанных)
+var ErrInboxFull = errors.New("очередь уведомлений пользователя заполнена")
+
+// ErrNoAddress возвращается каналом, если у пользователя нет адреса для него
+var ErrNoAddress = errors.New("нет адреса пользователя для канала")
+
+// ErrNoLocalSession возвращается при доставке события пользователю, у которого нет сессии на этом pod
+var ErrNoLocalSession = errors.New("у пользователя нет сессии на этом pod")
+
+// ErrTooManyTopics возвращается при подписке сверх MaxTopicsPerUser тем
+var ErrTooManyTopics = errors.New("превышено число тем пользователя")
+
 // NotificationRepository определяет интерфейс для работы с хранилищем уведомлений
 type NotificationRepository interface {
-	// CreateNotification создает уведомление для одного получателя
-	CreateNotification(ctx context.Context, payload *NotificationPayload, target Target) (string, error)
+	// CreateNotification создает уведомление для одного получателя с учетом лимита его стрима
+	CreateNotification(ctx context.Context, payload *NotificationPayload, target Target, limit StreamLimit) (CreateResult, error)
 
-	// GetNotification получает уведомление по ID
-	GetNotification(ctx context.Context, notificationID string) (*NotificationPayload, error)
+	// GetNotification получает уведомление получателя по ID
+	GetNotification(ctx context.Context, userID int64, login string, notificationID string) (*NotificationPayload, error)
 
 	// EnsureConsumerGroup создает Consumer Group если её нет
 	EnsureConsumerGroup(ctx context.Context, userID int64, login string) error
@@ -19,7 +42,8 @@ type NotificationRepository interface {
 	// ReadPendingMessages читает pending сообщения для consumer
 	ReadPendingMessages(ctx context.Context, userID int64, login string, count int64) ([]StreamMessage, error)
 
-	// ReadNewMessages читает новые сообщения из stream с блокировкой
+	// ReadNewMessages читает новые сообщения из stream с блокировкой.
+	// Временные ошибки оборачиваются в ErrStorageUnavailable
 	ReadNewMessages(
 		ctx context.Context,
 		userID int64,
@@ -28,11 +52,11 @@ type NotificationRepository interface {
 		count int64,
 	) ([]StreamMessage, error)
 
-	// AckMessage подтверждает прочтение сообщения и удаляет его
-	AckMessage(ctx context.Context, userID int64, login string, streamID, notificationID string) error
+	// AckMessage подтверждает прочтение сообщения, если запись стрима существует и относится к notificationID
+	AckMessage(ctx context.Context, userID int64, login string, streamID, notificationID string) (AckResult, error)
 
-	// CleanupExpiredNotifications удаляет просроченные уведомления
-	CleanupExpiredNotifications(ctx context.Context, userID int64, login string, limit int64) (int64, error)
+	// CleanupExpiredNotifications удаляет до limit просроченных уведомлений и возвращает их notification_id
+	CleanupExpiredNotifications(ctx context.Context, userID int64, login string, limit int64) ([]string, error)
 
 	// ReclaimPendingMessages перехватывает зависшие сообщения
 	ReclaimPendingMessages(
@@ -43,8 +67,13 @@ type NotificationRepository interface {
 		count int64,
 	) ([]StreamMessage, error)
 
-	// GetAllUserKeys возвращает все пользовательские ключи для джанитора
-	GetAllUserKeys(ctx context.Context) ([]string, error)
+	// GetDueUserKeys возвращает до limit пользователей, у которых к моменту now истек TTL уведомлений,
+	// пропуская первые offset в порядке индекса
+	GetDueUserKeys(ctx context.Context, now time.Time, offset, limit int64) ([]string, error)
+
+	// GetActiveUserKeys возвращает до limit пользователей с активностью не раньше since (нулевое время — всех),
+	// пропуская первые offset в порядке индекса; limit 0 — без ограничения
+	GetActiveUserKeys(ctx context.Context, since time.Time, offset, limit int64) ([]string, error)
 
 	// SaveIdempotencyResult сохраняет результат для идемпотентности
 	SaveIdempotencyResult(ctx context.Context, key string, result *NotifyResponse) error
@@ -69,6 +98,115 @@ type NotificationRepository interface {
 	GetUserRetentionDays(ctx context.Context, userID int64, login string) (int, error)
 	TrimUserStreamByRetention(ctx context.Context, userID int64, login string) error
 
+	// CompactReadStates удаляет статусы прочтения уведомлений, которых больше нет ни в стриме, ни в кандидатах в сводку.
+	// Возвращает число удаленных и оставшихся полей хэша статусов
+	CompactReadStates(ctx context.Context, userID int64, login string) (removed int64, remaining int64, err error)
+
+	// SetDigestPreference сохраняет настройки сводки и планирует следующую сводку
+	// (от LastDigestAt, а без него — от текущего времени). Режим off удаляет настройки
+	SetDigestPreference(ctx context.Context, userID int64, login string, pref DigestPreference) error
+
+	// GetDigestPreference возвращает настройки сводки; nil — сводка не настроена
+	GetDigestPreference(ctx context.Context, userID int64, login string) (*DigestPreference, error)
+
+	// GetDueDigestUserKeys возвращает до limit пользователей, чья сводка запланирована не позже now,
+	// пропуская первые offset в порядке индекса
+	GetDueDigestUserKeys(ctx context.Context, now time.Time, offset, limit int64) ([]string, error)
+
+	// AddDigestCandidate запоминает уведомление для следующей сводки, если сводка пользователю настроена.
+	// Кандидаты старше DigestCandidatesTTL удаляются
+	AddDigestCandidate(ctx context.Context, userID int64, login string, candidate DigestCandidate) error
+
+	// GetDigestCandidates возвращает до limit последних кандидатов, записанных в стрим после since,
+	// в порядке создания. Нулевой since — все сохраненные кандидаты
+	GetDigestCandidates(ctx context.Context, userID int64, login string, since time.Time, limit int64) ([]DigestCandidate, error)
+
+	// MarkDigested подтверждает записи стрима и помечает уведомления статусом digested, если они еще не прочитаны.
+	// Возвращает число помеченных уведомлений
+	MarkDigested(ctx context.Context, userID int64, login string, items []DigestCandidate) (int, error)
+
+	// ScheduleEscalation сохраняет эскалацию уведомления и планирует ее следующий шаг
+	ScheduleEscalation(ctx context.Context, esc Escalation) error
+
+	// AdvanceEscalation сохраняет эскалацию после выполненного шага, только если она не отменена.
+	// Возвращает false, если эскалация уже отменена подтверждением прочтения
+	AdvanceEscalation(ctx context.Context, esc Escalation) (bool, error)
+
+	// GetEscalation возвращает эскалацию уведомления; nil — эскалации нет
+	GetEscalation(ctx context.Context, userID int64, login string, notificationID string) (*Escalation, error)
+
+	// GetDueEscalations возвращает до limit member индекса эскалаций, чей шаг наступил не позже now,
+	// пропуская первые offset
+	GetDueEscalations(ctx context.Context, now time.Time, offset, limit int64) ([]string, error)
+
+	// CancelEscalation удаляет эскалацию уведомления. AckMessage вызывает ее при подтверждении прочтения
+	CancelEscalation(ctx context.Context, userID int64, login string, notificationID string) error
+
+	// ScheduleChannelDelivery сохраняет доставку внешними каналами и планирует ее на DueAt
+	ScheduleChannelDelivery(ctx context.Context, d ChannelDelivery) error
+
+	// GetChannelDelivery возвращает отложенную доставку уведомления; nil — доставки нет
+	GetChannelDelivery(ctx context.Context, userID int64, login string, notificationID string) (*ChannelDelivery, error)
+
+	// GetDueChannelDeliveries возвращает до limit member индекса доставок, запланированных не позже now,
+	// пропуская первые offset
+	GetDueChannelDeliveries(ctx context.Context, now time.Time, offset, limit int64) ([]string, error)
+
+	// CancelChannelDelivery удаляет отложенную доставку. AckMessage вызывает ее при подтверждении прочтения
+	CancelChannelDelivery(ctx context.Context, userID int64, login string, notificationID string) error
+
+	// SetWebhook сохраняет регистрацию webhook пользователя
+	SetWebhook(ctx context.Context, userID int64, login string, hook Webhook) error
+
+	// GetWebhook возвращает регистрацию webhook; nil — webhook не зарегистрирован
+	GetWebhook(ctx context.Context, userID int64, login string) (*Webhook, error)
+
+	// DeleteWebhook удаляет регистрацию webhook пользователя
+	DeleteWebhook(ctx context.Context, userID int64, login string) error
+
+	// SetPreferences сохраняет настройки уведомлений пользователя
+	SetPreferences(ctx context.Context, userID int64, login string, prefs Preferences) error
+
+	// GetPreferences возвращает настройки уведомлений; nil — настройки не заданы
+	GetPreferences(ctx context.Context, userID int64, login string) (*Preferences, error)
+
+	// DeferNotification сохраняет отложенное уведомление и планирует его выпуск на ReleaseAt
+	DeferNotification(ctx context.Context, d DeferredNotification) error
+
+	// GetDeferredNotification возвращает отложенное уведомление; nil — его нет
+	GetDeferredNotification(ctx context.Context, userID int64, login string, notificationID string) (*DeferredNotification, error)
+
+	// GetDueDeferred возвращает до limit member индекса отложенных уведомлений, выпуск которых наступил не позже now,
+	// пропуская первые offset
+	GetDueDeferred(ctx context.Context, now time.Time, offset, limit int64) ([]string, error)
+
+	// RemoveDeferred удаляет отложенное уведомление из хэша пользователя и индекса
+	RemoveDeferred(ctx context.Context, userID int64, login string, notificationID string) error
+
+	// Subscribe подписывает пользователя на тему, если у него меньше maxTopics тем; проверка и запись атомарны.
+	// Возвращает false, если он уже подписан, и ErrTooManyTopics при превышении лимита
+	Subscribe(ctx context.Context, userID int64, login string, topic string, maxTopics int) (bool, error)
+
+	// Unsubscribe отписывает пользователя от темы. Возвращает false, если он не был подписан
+	Unsubscribe(ctx context.Context, userID int64, login string, topic string) (bool, error)
+
+	// GetSubscriptions возвращает отсортированный список тем пользователя
+	GetSubscriptions(ctx context.Context, userID int64, login string) ([]string, error)
+
+	// ScanTopicSubscribers возвращает часть подписчиков темы (userKey) начиная с cursor.
+	// Нулевой следующий курсор означает конец обхода; часть может быть пустой и до конца
+	ScanTopicSubscribers(ctx context.Context, topic string, cursor uint64, count int64) ([]string, uint64, error)
+
+	// HasConsumerLock сообщает, держит ли какая-либо WebSocket-сессия consumer lock пользователя (пользователь в сети)
+	HasConsumerLock(ctx context.Context, userID int64, login string) (bool, error)
+
+	// ExportUserData выгружает стрим, payload, статусы прочтения и retention пользователя
+	ExportUserData(ctx context.Context, userID int64, login string) (*UserDataExport, error)
+
+	// EraseUserData удаляет все ключи пользователя: стрим, payload, планировщик TTL, статусы,
+	// блокировку, retention и записи в индексах пользователей
+	EraseUserData(ctx context.Context, userID int64, login string) (*ErasureReport, error)
+
 	// AcquireConsumerLock пытается получить эксклюзивную блокировку чтения для пользователя
 	AcquireConsumerLock(ctx context.Context, userID int64, login string, podID string, ttl time.Duration) (bool, error)
 
@@ -86,6 +224,82 @@ type NotificationService interface {
 
 	// HandleWebSocketConnection обрабатывает WebSocket подключение клиента
 	HandleWebSocketConnection(ctx context.Context, userID int64, login string, conn WebSocketConnection) error
+
+	// SetDigestPreference проверяет и сохраняет настройки сводки пользователя,
+	// сохраняя время предыдущей сводки. Возвращает сохраненные настройки
+	SetDigestPreference(ctx context.Context, userID int64, login string, pref DigestPreference) (*DigestPreference, error)
+
+	// RegisterWebhook проверяет URL и сохраняет webhook пользователя. Пустой секрет генерируется.
+	// Пустой URL удаляет регистрацию и возвращает nil
+	RegisterWebhook(ctx context.Context, userID int64, login string, url, secret string) (*Webhook, error)
+
+	// AckNotification записывает прочтение уведомления через AckMessage, как подтверждение клиента
+	AckNotification(ctx context.Context, userID int64, login string, streamID, notificationID string) (AckResult, error)
+
+	// SetPreferences проверяет и сохраняет настройки уведомлений пользователя
+	SetPreferences(ctx context.Context, userID int64, login string, prefs Preferences) (*Preferences, error)
+
+	// ReleaseDeferred создает отложенное уведомление или переносит его, если получатель все еще не принимает уведомления
+	ReleaseDeferred(ctx context.Context, d DeferredNotification) error
+
+	// SubscribeTopic подписывает пользователя на тему и возвращает все его темы
+	SubscribeTopic(ctx context.Context, userID int64, login string, topic string) ([]string, error)
+
+	// UnsubscribeTopic отписывает пользователя от темы и возвращает оставшиеся темы
+	UnsubscribeTopic(ctx context.Context, userID int64, login string, topic string) ([]string, error)
+}
+
+// StreamLimitResolver выбирает лимит стрима для уведомления (по пользователю, источнику или tenant)
+type StreamLimitResolver interface {
+	Resolve(tenant, source string, target Target) StreamLimit
+}
+
+// ClientEventPublisher доставляет служебные события в WebSocket-сессии пользователя на любом pod
+type ClientEventPublisher interface {
+	PublishToUser(ctx context.Context, userID int64, login string, msg WebSocketMessage) error
+}
+
+// ArchiveSink асинхронно копирует уведомления и переходы их состояния в долговременный архив
+type ArchiveSink interface {
+	// Record ставит событие в очередь на запись; не блокирует вызывающего
+	Record(event ArchiveEvent)
+}
+
+// ArchiveFlusher дописывает в архив события, уже поставленные в очередь
+type ArchiveFlusher interface {
+	// Flush возвращается, когда события, поставленные в очередь до вызова, записаны
+	Flush(ctx context.Context) error
+}
+
+// ArchiveReader читает историю из долговременного архива
+type ArchiveReader interface {
+	// QueryHistory возвращает до limit уведомлений пользователя, созданных раньше before, от новых к старым
+	QueryHistory(ctx context.Context, userID int64, login string, before time.Time, limit int) ([]ArchivedNotification, error)
+}
+
+// ArchiveStore читает архив и обслуживает запросы субъекта данных (выгрузка и удаление)
+type ArchiveStore interface {
+	ArchiveReader
+
+	// ExportUser возвращает все уведомления пользователя из архива
+	ExportUser(ctx context.Context, userID int64, login string) ([]ArchivedNotification, error)
+
+	// DeleteUser удаляет уведомления пользователя и их события, возвращает число удаленных уведомлений
+	DeleteUser(ctx context.Context, userID int64, login string) (int64, error)
+}
+
+// LeaderReader возвращает текущих лидеров singleton-воркеров
+type LeaderReader interface {
+	Leaders(ctx context.Context) ([]LeaderInfo, error)
+}
+
+// WorkerController управляет фоновыми воркерами кластера из админ API: пауза и внеочередной запуск
+// действуют на тот pod, где выполняется цикл воркера, независимо от pod, принявшего запрос
+type WorkerController interface {
+	Workers(ctx context.Context) ([]WorkerStatus, error)
+	PauseWorker(ctx context.Context, name string) error
+	ResumeWorker(ctx context.Context, name string) error
+	TriggerWorker(ctx context.Context, name string) error
 }
 
 // WebSocketConnection представляет интерфейс WebSocket соединения
@@ -101,3 +315,18 @@ type StreamMessage struct {
 	Fields  map[string]interface{}
 	Payload *NotificationPayload // Загруженная полезная нагрузка
 }
+
+// Channel — внешний канал доставки уведомлений (email, webhook)
+type Channel interface {
+	// Name возвращает имя канала для метрик и отметок о доставке
+	Name() string
+
+	// Send доставляет уведомление по контакту пользователя; ErrNoAddress — адреса для канала нет
+	Send(ctx context.Context, contact Contact, d ChannelDelivery) error
+}
+
+// UserDirectory возвращает контакты пользователей для внешних каналов
+type UserDirectory interface {
+	// Lookup возвращает контакт пользователя; неизвестному пользователю соответствует пустой контакт
+	Lookup(ctx context.Context, target Target) (Contact, error)
+}
@@ -2,15 +2,26 @@ package domain
 
 import (
 	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // NotifyRequest представляет входящий запрос на создание уведомления
 type NotifyRequest struct {
 	Target    []Target  `json:"target"`
+	Topics    []string  `json:"topics,omitempty"` // подписчики тем добавляются к target (без повторов)
 	Message   string    `json:"message"`
 	CreatedAt time.Time `json:"created_at"`
 	Source    string    `json:"source"`
+	Category  string    `json:"category,omitempty"` // группа уведомлений внутри источника (для сводок)
+	Tenant    string    `json:"tenant,omitempty"`   // учитывается при выборе лимита очереди
+	Priority  string    `json:"priority,omitempty"` // normal (по умолчанию), high или urgent
+
+	// Escalation — шаги эскалации, если уведомление остается непрочитанным
+	Escalation []EscalationStep `json:"escalation,omitempty"`
 }
 
 // Target представляет получателя уведомления
@@ -25,6 +36,9 @@ type NotificationPayload struct {
 	Message        string    `json:"message"`
 	CreatedAt      time.Time `json:"created_at"`
 	Source         string    `json:"source"`
+	Category       string    `json:"category,omitempty"`
+	Tenant         string    `json:"tenant,omitempty"`
+	Priority       string    `json:"priority,omitempty"`
 	Target         Target    `json:"target"`
 }
 
@@ -41,6 +55,9 @@ type PushPayload struct {
 	Message        string    `json:"message,omitempty"`
 	CreatedAt      time.Time `json:"created_at"`
 	Source         string    `json:"source"`
+	Category       string    `json:"category,omitempty"`
+	Priority       string    `json:"priority,omitempty"`
+	Escalation     int       `json:"escalation,omitempty"` // номер шага эскалации для повторной отправки
 	Status         string    `json:"status"`
 	Read           bool      `json:"read"`
 }
@@ -57,6 +74,98 @@ type ReadData struct {
 	StreamID       string `json:"stream_id"`
 }
 
+// AckResult — итог обработки подтверждения прочтения
+type AckResult string
+
+const (
+	AckResultAcked       AckResult = "acked"
+	AckResultAlreadyRead AckResult = "already_read"
+	AckResultUnknown     AckResult = "unknown"    // записи нет в стриме (неверный stream_id или уже очищена)
+	AckResultMismatched  AckResult = "mismatched" // запись есть, но относится к другому notification_id
+)
+
+// ErrorData описывает ошибку, отправляемую клиенту сообщением типа "error"
+type ErrorData struct {
+	Code           string `json:"code"`
+	Message        string `json:"message"`
+	NotificationID string `json:"notification_id,omitempty"`
+	StreamID       string `json:"stream_id,omitempty"`
+}
+
+// Коды ошибок WebSocket и результатов создания
+const (
+	ErrorCodeAckUnknown      = "ack_unknown"
+	ErrorCodeAckMismatched   = "ack_mismatched"
+	ErrorCodeInboxFull       = "inbox_full"
+	ErrorCodeInvalidWebhook  = "invalid_webhook"
+	ErrorCodeInvalidSettings = "invalid_settings"
+	ErrorCodeInvalidTopic    = "invalid_topic"
+)
+
+// OverflowPolicy определяет поведение при заполнении стрима пользователя
+type OverflowPolicy string
+
+const (
+	OverflowDropOldest OverflowPolicy = "drop_oldest" // удалять самые старые записи (поведение MAXLEN)
+	OverflowRejectNew  OverflowPolicy = "reject_new"  // отклонять новые уведомления
+	OverflowDropRead   OverflowPolicy = "drop_read"   // удалять только прочитанные, иначе отклонять новые
+)
+
+// ParseOverflowPolicy разбирает политику переполнения
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch p := OverflowPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case OverflowDropOldest, OverflowRejectNew, OverflowDropRead:
+		return p, nil
+	case "":
+		return OverflowDropOldest, nil
+	default:
+		return OverflowDropOldest, fmt.Errorf("неизвестная политика переполнения: %s", s)
+	}
+}
+
+// StreamLimit задает максимальную длину стрима пользователя и политику переполнения
+type StreamLimit struct {
+	MaxLen   int64          `json:"max_len"`
+	Overflow OverflowPolicy `json:"overflow"`
+}
+
+// DefaultStreamLimit совпадает с прежним жестким MAXLEN 100
+var DefaultStreamLimit = StreamLimit{MaxLen: 100, Overflow: OverflowDropOldest}
+
+// DroppedEntry описывает запись, удаленную из стрима при переполнении
+type DroppedEntry struct {
+	NotificationID string `json:"notification_id"`
+	StreamID       string `json:"stream_id"`
+	Read           bool   `json:"read"`
+}
+
+// CreateResult — итог добавления уведомления в стрим пользователя
+type CreateResult struct {
+	StreamID string
+	Dropped  []DroppedEntry
+}
+
+// DroppedUnread возвращает число непрочитанных записей среди удаленных
+func (r CreateResult) DroppedUnread() int {
+	n := 0
+	for _, d := range r.Dropped {
+		if !d.Read {
+			n++
+		}
+	}
+	return n
+}
+
+// InboxOverflowData — данные события inbox.overflow для клиента
+type InboxOverflowData struct {
+	Policy        OverflowPolicy `json:"policy"`
+	MaxLen        int64          `json:"max_len"`
+	Rejected      bool           `json:"rejected"` // новое уведомление не принято
+	Source        string         `json:"source,omitempty"`
+	DroppedUnread int            `json:"dropped_unread"`
+	Dropped       []DroppedEntry `json:"dropped,omitempty"`
+}
+
 // NotifyResponse представляет ответ на запрос создания уведомления
 type NotifyResponse struct {
 	Results []NotifyResult `json:"results"`
@@ -66,8 +175,19 @@ type NotifyResponse struct {
 type NotifyResult struct {
 	Target         Target `json:"target"`
 	NotificationID string `json:"notification_id"`
+	Error          string `json:"error,omitempty"` // код отказа, например inbox_full
+
+	// Status — muted (источник заглушен получателем) или deferred (доставка отложена до DeferredUntil)
+	Status        string     `json:"status,omitempty"`
+	DeferredUntil *time.Time `json:"deferred_until,omitempty"`
 }
 
+// Статусы результата создания, отличные от обычной доставки
+const (
+	NotifyStatusMuted    = "muted"
+	NotifyStatusDeferred = "deferred"
+)
+
 // WebSocketMessage представляет общий формат сообщения WebSocket
 type WebSocketMessage struct {
 	Type string      `json:"type"`
@@ -84,6 +204,44 @@ type RetentionSetData struct {
 	Days int `json:"days"`
 }
 
+// DigestSetEvent задает настройки сводки непрочитанных уведомлений
+type DigestSetEvent struct {
+	Type string           `json:"type"`
+	Data DigestPreference `json:"data"`
+}
+
+// WebhookSetEvent регистрирует webhook пользователя; пустой URL удаляет регистрацию
+type WebhookSetEvent struct {
+	Type string         `json:"type"`
+	Data WebhookSetData `json:"data"`
+}
+
+type WebhookSetData struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"` // пусто — секрет генерируется и возвращается в webhook.set.ack
+}
+
+// SettingsSetEvent задает настройки уведомлений пользователя целиком
+type SettingsSetEvent struct {
+	Type string      `json:"type"`
+	Data Preferences `json:"data"`
+}
+
+// TopicEvent подписывает на тему или отписывает от нее (topic.subscribe / topic.unsubscribe)
+type TopicEvent struct {
+	Type string    `json:"type"`
+	Data TopicData `json:"data"`
+}
+
+type TopicData struct {
+	Topic string `json:"topic"`
+}
+
+// TopicsData — ответ topics со всеми темами, на которые подписан пользователь
+type TopicsData struct {
+	Topics []string `json:"topics"`
+}
+
 // SyncRequestEvent запрашивает последние N событий
 type SyncRequestEvent struct {
 	Type string          `json:"type"`
@@ -106,12 +264,23 @@ const (
 	MessageTypeNotificationRead = "notification.read"
 	MessageTypeNotificationAck  = "notification.read.ack"
 	MessageTypeRetentionSet     = "retention.set"
+	MessageTypeDigestSet        = "digest.set"
+	MessageTypeWebhookSet       = "webhook.set"
+	MessageTypeWebhookSetAck    = "webhook.set.ack"
+	MessageTypeSettingsGet      = "settings.get"
+	MessageTypeSettingsSet      = "settings.set"
+	MessageTypeSettings         = "settings"
+	MessageTypeTopicSubscribe   = "topic.subscribe"
+	MessageTypeTopicUnsubscribe = "topic.unsubscribe"
+	MessageTypeTopics           = "topics"
 	MessageTypeSyncRequest      = "sync.request"
 	MessageTypeSyncResponse     = "sync.response"
 	MessageTypeError            = "error"
+	MessageTypeInboxOverflow    = "inbox.overflow"
 
 	StatusUnread      = "unread"
 	StatusAutoCleared = "auto_cleared"
+	StatusArchived    = "archived" // запись отдана из долговременного архива
 )
 
 // Constants для Redis ключей
@@ -124,36 +293,254 @@ const (
 	NotificationStateKeyPrefix = "notification_state:"
 	ConsumerLockKeyPrefix      = "notif:lock:consumer:"
 	RetentionKeyPrefix         = "notif:retention:"
+	DigestKeyPrefix            = "notif:digest:"
+	DigestCandidatesKeyPrefix  = "notif:digest_candidates:"
+	EscalationKeyPrefix        = "notif:escalation:"
+	ChannelDeliveryKeyPrefix   = "notif:channel:"
+	WebhookKeyPrefix           = "notif:webhook:"
+	PreferencesKeyPrefix       = "notif:prefs:"
+	DeferredKeyPrefix          = "notif:deferred:"
+	SubscriptionsKeyPrefix     = "notif:subscriptions:"
+
+	// IdempotencyIndexKeyPrefix — множество ключей идемпотентности, в сохраненном ответе которых есть пользователь
+	IdempotencyIndexKeyPrefix = "notif:idempotency:"
+
+	// TopicKeyPrefix — множество подписчиков темы (member — userKey "id-login"); ключ не пользовательский
+	TopicKeyPrefix = "notif:topic:"
+
+	// Глобальные индексы пользователей (member — userKey "id-login")
+	ActiveUsersIndexKey = "notif:users:active"  // score — время последней активности (unix сек)
+	UserExpiryIndexKey  = "notif:users:expiry"  // score — ближайшее истечение TTL (unix сек)
+	UserIndexReadyKey   = "notif:users:indexed" // отметка о завершенном заполнении индексов
+	DigestDueIndexKey   = "notif:users:digest"  // score — время следующей сводки (unix сек)
+
+	// EscalationDueIndexKey — индекс эскалаций (member — "nid:id-login", score — время следующего шага)
+	EscalationDueIndexKey = "notif:escalations:due"
+
+	// ChannelDueIndexKey — индекс отложенных доставок каналами (member — "nid:id-login", score — время доставки)
+	ChannelDueIndexKey = "notif:channels:due"
+
+	// DeferredDueIndexKey — индекс отложенных уведомлений (member — "nid:id-login", score — время выпуска)
+	DeferredDueIndexKey = "notif:deferrals:due"
+
+	// PodSessionsKeyPrefix — реестр сессий pod: userKey пользователей, чей consumer lock держит pod
+	PodSessionsKeyPrefix = "notif:pod:sessions:"
 
 	ConsumerGroupName = "notifications"
 	NotificationTTL   = 15 * time.Minute // 15 минут как указано в ТЗ
+	IdempotencyTTL    = 10 * time.Minute // срок хранения ответа по ключу идемпотентности
+
+	// PendingActivityWindow — окно активности, за пределами которого у пользователя не остается
+	// pending сообщений: их подтверждает TTL-джанитор после истечения NotificationTTL
+	PendingActivityWindow = 2 * NotificationTTL
+)
+
+// KeyLayout определяет схему имен ключей Redis
+type KeyLayout int
+
+const (
+	// KeyLayoutLegacy — исходная схема: stream:user:1-alice, notification:<uuid>
+	KeyLayoutLegacy KeyLayout = iota
+	// KeyLayoutHashTag — схема для Redis Cluster: все ключи пользователя содержат хэш-тег {1-alice}
+	// и попадают в один слот: stream:user:{1-alice}, notification:{1-alice}:<uuid>
+	KeyLayoutHashTag
 )
 
+var keyLayout = KeyLayoutLegacy
+
+// SetKeyLayout задает схему имен ключей процесса; вызывается один раз в main до любых обращений к Redis.
+// Клиенты Redis схему не меняют, поэтому несколько подключений в одном процессе ее не перезаписывают
+func SetKeyLayout(layout KeyLayout) {
+	keyLayout = layout
+}
+
+// CurrentKeyLayout возвращает текущую схему имен ключей
+func CurrentKeyLayout() KeyLayout {
+	return keyLayout
+}
+
+// ParseKeyLayout разбирает название схемы ключей (legacy | hashtag)
+func ParseKeyLayout(s string) (KeyLayout, error) {
+	switch s {
+	case "", "legacy":
+		return KeyLayoutLegacy, nil
+	case "hashtag":
+		return KeyLayoutHashTag, nil
+	default:
+		return KeyLayoutLegacy, fmt.Errorf("неизвестная схема ключей: %s", s)
+	}
+}
+
+// userKeyTag возвращает часть имени ключа, идентифицирующую пользователя в текущей схеме
+func userKeyTag(userID int64, login string) string {
+	if keyLayout == KeyLayoutHashTag {
+		return "{" + UserKey(userID, login) + "}"
+	}
+	return UserKey(userID, login)
+}
+
+// UserKeyFromTag извлекает "id-login" из суффикса ключа в любой схеме ("1-alice" или "{1-alice}")
+func UserKeyFromTag(tag string) string {
+	if strings.HasPrefix(tag, "{") && strings.HasSuffix(tag, "}") {
+		return tag[1 : len(tag)-1]
+	}
+	return tag
+}
+
 // Константы для формирования ключей
 func StreamKey(userID int64, login string) string {
-	return StreamKeyPrefix + UserKey(userID, login)
+	return StreamKeyPrefix + userKeyTag(userID, login)
 }
 
-func NotificationKey(uuid string) string {
+// NotificationKey возвращает ключ payload уведомления. В схеме hashtag ключ содержит
+// хэш-тег получателя, чтобы payload лежал в одном слоте со стримом пользователя
+func NotificationKey(userID int64, login string, uuid string) string {
+	if keyLayout == KeyLayoutHashTag {
+		return NotificationKeyPrefix + userKeyTag(userID, login) + ":" + uuid
+	}
 	return NotificationKeyPrefix + uuid
 }
 
+// ParseNotificationKey извлекает "id-login" и notification_id из ключа payload схемы hashtag
+// (notification:{1-alice}:<uuid>). Ключи исходной схемы не содержат получателя — ok == false
+func ParseNotificationKey(key string) (userKey, notificationID string, ok bool) {
+	rest, found := strings.CutPrefix(key, NotificationKeyPrefix+"{")
+	if !found {
+		return "", "", false
+	}
+	userKey, notificationID, found = strings.Cut(rest, "}:")
+	if !found || userKey == "" || notificationID == "" {
+		return "", "", false
+	}
+	return userKey, notificationID, true
+}
+
 func TTLSchedulerKey(userID int64, login string) string {
-	return TTLSchedulerKeyPrefix + UserKey(userID, login)
+	return TTLSchedulerKeyPrefix + userKeyTag(userID, login)
 }
 
 func IdempotencyKey(key string) string {
 	return IdempotencyKeyPrefix + key
 }
 
+// IdempotencyIndexKey возвращает ключ множества ключей идемпотентности, ответы которых содержат пользователя
+func IdempotencyIndexKey(userID int64, login string) string {
+	return IdempotencyIndexKeyPrefix + userKeyTag(userID, login)
+}
+
 func UserKey(userID int64, login string) string {
 	return fmt.Sprintf("%d-%s", userID, login)
 }
 
+// ParseUserKey разбирает ключ пользователя "id-login" (логин может содержать дефисы)
+func ParseUserKey(userKey string) (int64, string, error) {
+	idStr, login, ok := strings.Cut(userKey, "-")
+	if !ok {
+		return 0, "", fmt.Errorf("неверный формат user key: %s", userKey)
+	}
+
+	userID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("ошибка парсинга user ID: %w", err)
+	}
+
+	return userID, login, nil
+}
+
 func ConsumerID(userID int64) string {
 	return fmt.Sprintf("user:%d", userID)
 }
 
+// PodSessionsKey возвращает ключ реестра сессий pod
+func PodSessionsKey(podID string) string {
+	return PodSessionsKeyPrefix + podID
+}
+
+// EscalationKey возвращает ключ хэша эскалаций пользователя (notification_id -> Escalation)
+func EscalationKey(userID int64, login string) string {
+	return EscalationKeyPrefix + userKeyTag(userID, login)
+}
+
+// ChannelDeliveryKey возвращает ключ хэша отложенных доставок внешними каналами (notification_id -> ChannelDelivery)
+func ChannelDeliveryKey(userID int64, login string) string {
+	return ChannelDeliveryKeyPrefix + userKeyTag(userID, login)
+}
+
+// WebhookKey возвращает ключ регистрации webhook пользователя
+func WebhookKey(userID int64, login string) string {
+	return WebhookKeyPrefix + userKeyTag(userID, login)
+}
+
+// PreferencesKey возвращает ключ настроек уведомлений пользователя
+func PreferencesKey(userID int64, login string) string {
+	return PreferencesKeyPrefix + userKeyTag(userID, login)
+}
+
+// DeferredKey возвращает ключ хэша отложенных уведомлений пользователя (notification_id -> DeferredNotification)
+func DeferredKey(userID int64, login string) string {
+	return DeferredKeyPrefix + userKeyTag(userID, login)
+}
+
+// SubscriptionsKey возвращает ключ множества тем, на которые подписан пользователь
+func SubscriptionsKey(userID int64, login string) string {
+	return SubscriptionsKeyPrefix + userKeyTag(userID, login)
+}
+
+// TopicKey возвращает ключ множества подписчиков темы
+func TopicKey(topic string) string {
+	return TopicKeyPrefix + topic
+}
+
+// NotificationMember возвращает member индексов эскалаций, доставок каналами и отложенных уведомлений. notification_id — UUID
+// без двоеточий, поэтому логин пользователя может содержать любые символы
+func NotificationMember(userKey, notificationID string) string {
+	return notificationID + ":" + userKey
+}
+
+// ParseNotificationMember разбирает member индекса на userKey и notification_id
+func ParseNotificationMember(member string) (string, string, error) {
+	nid, userKey, ok := strings.Cut(member, ":")
+	if !ok || nid == "" || userKey == "" {
+		return "", "", fmt.Errorf("неверный формат member индекса: %s", member)
+	}
+	return userKey, nid, nil
+}
+
+// DigestKey возвращает ключ настроек сводки пользователя
+func DigestKey(userID int64, login string) string {
+	return DigestKeyPrefix + userKeyTag(userID, login)
+}
+
+// DigestCandidatesKey возвращает ключ кандидатов в сводку пользователя
+// (ZSET, member — JSON DigestCandidate, score — время записи стрима в мс)
+func DigestCandidatesKey(userID int64, login string) string {
+	return DigestCandidatesKeyPrefix + userKeyTag(userID, login)
+}
+
+// ParseStreamID разбирает ID записи стрима "<ms>-<seq>"
+func ParseStreamID(id string) (ms, seq uint64, err error) {
+	msStr, seqStr, ok := strings.Cut(id, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("неверный формат ID записи стрима: %q", id)
+	}
+	if ms, err = strconv.ParseUint(msStr, 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("неверный формат ID записи стрима: %q", id)
+	}
+	if seq, err = strconv.ParseUint(seqStr, 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("неверный формат ID записи стрима: %q", id)
+	}
+	return ms, seq, nil
+}
+
+// StreamIDTime возвращает время записи стрима по её ID; для неверного ID — нулевое время
+func StreamIDTime(id string) time.Time {
+	ms, _, err := ParseStreamID(id)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(int64(ms))
+}
+
 // TTLSchedulerEntry представляет запись в ZSET планировщика TTL
 func TTLSchedulerEntry(streamID, notificationID string) string {
 	return streamID + "|" + notificationID
@@ -161,15 +548,534 @@ func TTLSchedulerEntry(streamID, notificationID string) string {
 
 // NotificationStateKey возвращает ключ хэша статусов прочтения пользователя
 func NotificationStateKey(userID int64, login string) string {
-	return NotificationStateKeyPrefix + UserKey(userID, login)
+	return NotificationStateKeyPrefix + userKeyTag(userID, login)
 }
 
 // ConsumerLockKey возвращает ключ блокировки consumer для пользователя
 func ConsumerLockKey(userID int64, login string) string {
-	return ConsumerLockKeyPrefix + UserKey(userID, login)
+	return ConsumerLockKeyPrefix + userKeyTag(userID, login)
 }
 
 // RetentionKey возвращает ключ хранения персистентного TTL профиля пользователя
 func RetentionKey(userID int64, login string) string {
-	return RetentionKeyPrefix + UserKey(userID, login)
+	return RetentionKeyPrefix + userKeyTag(userID, login)
+}
+
+// Типы событий архива уведомлений
+const (
+	ArchiveEventCreated     = "created"
+	ArchiveEventRead        = "read"
+	ArchiveEventExpired     = "expired"      // запись удалена TTL джанитором
+	ArchiveEventAutoCleared = "auto_cleared" // запись удалена по событию истечения payload, сессии отправлен auto_cleared
+	ArchiveEventDropped     = "dropped"      // запись вытеснена при переполнении стрима
+)
+
+// ArchiveEvent описывает уведомление или переход его состояния для долговременного архива
+type ArchiveEvent struct {
+	Type           string               `json:"type"`
+	NotificationID string               `json:"notification_id"`
+	StreamID       string               `json:"stream_id,omitempty"`
+	Target         Target               `json:"target"`
+	Payload        *NotificationPayload `json:"payload,omitempty"` // только для created
+	OccurredAt     time.Time            `json:"occurred_at"`
+}
+
+// ArchivedNotification — уведомление из долговременного архива
+type ArchivedNotification struct {
+	NotificationID string     `json:"notification_id"`
+	StreamID       string     `json:"stream_id"`
+	Target         Target     `json:"target"`
+	Message        string     `json:"message"`
+	Source         string     `json:"source"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ReadAt         *time.Time `json:"read_at,omitempty"`
+}
+
+// UserDataExport — выгрузка всех данных пользователя из хранилища по запросу субъекта данных
+type UserDataExport struct {
+	Target        Target                 `json:"target"`
+	Entries       []ExportedEntry        `json:"entries"`
+	ReadStates    map[string]string      `json:"read_states"`    // notification_id -> статус
+	RetentionDays int                    `json:"retention_days"` // действующий срок хранения
+	RetentionSet  bool                   `json:"retention_set"`  // false — срок по умолчанию
+	Digest        *DigestPreference      `json:"digest,omitempty"`
+	Escalations   []Escalation           `json:"escalations,omitempty"`
+	Deliveries    []ChannelDelivery      `json:"channel_deliveries,omitempty"`
+	Webhook       *Webhook               `json:"webhook,omitempty"` // без секрета
+	Preferences   *Preferences           `json:"preferences,omitempty"`
+	Deferred      []DeferredNotification `json:"deferred,omitempty"`
+	Topics        []string               `json:"topics,omitempty"`
+	Archive       []ArchivedNotification `json:"archive,omitempty"`
+	ExportedAt    time.Time              `json:"exported_at"`
+}
+
+// ExportedEntry — запись стрима пользователя вместе с payload уведомления
+type ExportedEntry struct {
+	StreamID       string                 `json:"stream_id"`
+	NotificationID string                 `json:"notification_id"`
+	Fields         map[string]interface{} `json:"fields"`
+	Payload        *NotificationPayload   `json:"payload"` // nil — payload уже истек
+	ExpiresAt      *time.Time             `json:"expires_at,omitempty"`
+	Read           bool                   `json:"read"`
+}
+
+// ErasureReport — итог удаления данных пользователя
+type ErasureReport struct {
+	Target             Target    `json:"target"`
+	KeysDeleted        int64     `json:"keys_deleted"`
+	PayloadsDeleted    int64     `json:"payloads_deleted"`
+	ArchiveRowsDeleted int64     `json:"archive_rows_deleted"`
+	ErasedAt           time.Time `json:"erased_at"`
+}
+
+// ErasureReceipt — подписанное подтверждение удаления данных пользователя
+type ErasureReceipt struct {
+	ReceiptID string        `json:"receipt_id"`
+	Report    ErasureReport `json:"report"`
+	Algorithm string        `json:"algorithm,omitempty"`
+	Signature string        `json:"signature,omitempty"` // hex HMAC от JSON receipt_id и report
+}
+
+// LeaderInfo — текущий владелец лиза singleton-воркера
+type LeaderInfo struct {
+	Worker         string `json:"worker"`
+	PodID          string `json:"pod_id"`                     // пусто — лидера сейчас нет
+	LeaseExpiresIn int64  `json:"lease_expires_in,omitempty"` // мс до истечения лиза
+}
+
+// Результаты итерации фонового воркера
+const (
+	WorkerResultOK    = "ok"
+	WorkerResultError = "error"
+)
+
+// WorkerStatus — состояние фонового воркера на этом pod
+type WorkerStatus struct {
+	Name         string     `json:"name"`
+	Pod          string     `json:"pod,omitempty"` // pod, на котором выполняется цикл воркера
+	Interval     string     `json:"interval"`
+	Jitter       string     `json:"jitter"`
+	Active       bool       `json:"active"`  // цикл воркера выполняется на этом pod (лидер или шард)
+	Paused       bool       `json:"paused"`  // плановые запуски приостановлены
+	Running      bool       `json:"running"` // итерация выполняется прямо сейчас
+	Runs         int64      `json:"runs"`
+	Failures     int64      `json:"failures"`
+	LastRunAt    *time.Time `json:"last_run_at,omitempty"`
+	LastDuration string     `json:"last_duration,omitempty"`
+	LastResult   string     `json:"last_result,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	NextRunAt    *time.Time `json:"next_run_at,omitempty"`
+}
+
+// PodTakeover — итог освобождения сессий выбывшего pod
+type PodTakeover struct {
+	Pod           string `json:"pod"`
+	Users         int    `json:"users"`          // пользователей в реестре сессий pod
+	LocksReleased int    `json:"locks_released"` // consumer lock, еще удерживавшихся pod
+}
+
+// DigestMode задает периодичность сводки непрочитанных уведомлений
+type DigestMode string
+
+const (
+	DigestOff    DigestMode = "off"
+	DigestHourly DigestMode = "hourly" // каждый час после предыдущей сводки
+	DigestDaily  DigestMode = "daily"  // каждые 24 часа после предыдущей сводки
+	DigestAt     DigestMode = "at"     // ежедневно в фиксированное время At в часовом поясе Timezone
+)
+
+// DigestSource — источник и категория уведомлений-сводок; сами сводки в следующие сводки не попадают
+const DigestSource = "digest"
+
+// DigestCandidatesTTL — срок хранения кандидатов в сводку: самый длинный период сводки (сутки)
+// с запасом на задержку воркера. Payload живет NotificationTTL, поэтому сводка читает кандидатов, а не стрим
+const DigestCandidatesTTL = 25 * time.Hour
+
+// DigestCandidate — уведомление, которое может войти в сводку получателя
+type DigestCandidate struct {
+	StreamID       string `json:"sid"`
+	NotificationID string `json:"nid"`
+	Source         string `json:"source,omitempty"`
+	Category       string `json:"category,omitempty"`
+}
+
+// StateDigested — статус прочтения уведомления, учтенного в сводке (считается прочитанным)
+const StateDigested = "digested"
+
+// IsReadState сообщает, считается ли значение из хэша статусов прочитанным уведомлением
+func IsReadState(v string) bool {
+	return v == "read" || v == StateDigested
+}
+
+// DigestPreference — настройки сводки пользователя
+type DigestPreference struct {
+	Mode         DigestMode `json:"mode"`
+	At           string     `json:"at,omitempty"`       // HH:MM для режима at
+	Timezone     string     `json:"timezone,omitempty"` // IANA, по умолчанию UTC
+	MarkDigested bool       `json:"mark_digested"`      // помечать вошедшие в сводку уведомления как digested
+	LastDigestAt *time.Time `json:"last_digest_at,omitempty"`
+}
+
+// Validate проверяет режим, время и часовой пояс
+func (p DigestPreference) Validate() error {
+	switch p.Mode {
+	case DigestOff, DigestHourly, DigestDaily:
+	case DigestAt:
+		if _, err := time.Parse("15:04", p.At); err != nil {
+			return fmt.Errorf("время сводки должно быть в формате HH:MM: %s", p.At)
+		}
+	default:
+		return fmt.Errorf("неизвестный режим сводки: %s", p.Mode)
+	}
+	if _, err := time.LoadLocation(p.Timezone); err != nil {
+		return fmt.Errorf("неизвестный часовой пояс: %s", p.Timezone)
+	}
+	return nil
+}
+
+// NextRun возвращает время следующей сводки после момента after. Для режима off — нулевое время
+func (p DigestPreference) NextRun(after time.Time) time.Time {
+	switch p.Mode {
+	case DigestHourly:
+		return after.Add(time.Hour)
+	case DigestDaily:
+		return after.Add(24 * time.Hour)
+	case DigestAt:
+		at, err := time.Parse("15:04", p.At)
+		if err != nil {
+			return time.Time{}
+		}
+		loc, err := time.LoadLocation(p.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		local := after.In(loc)
+		next := time.Date(local.Year(), local.Month(), local.Day(), at.Hour(), at.Minute(), 0, 0, loc)
+		if !next.After(after) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next
+	default:
+		return time.Time{}
+	}
+}
+
+// Приоритеты уведомлений; пустой приоритет равен normal
+const (
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+	PriorityUrgent = "urgent"
+)
+
+// ValidPriority сообщает, допустим ли приоритет уведомления
+func ValidPriority(p string) bool {
+	switch p {
+	case "", PriorityNormal, PriorityHigh, PriorityUrgent:
+		return true
+	}
+	return false
+}
+
+// EscalationAction — действие шага эскалации
+type EscalationAction string
+
+const (
+	EscalationRepush EscalationAction = "repush" // повторная отправка получателю с повышенным приоритетом
+	EscalationNotify EscalationAction = "notify" // уведомление резервных получателей (руководитель, группа)
+)
+
+// MaxEscalationSteps ограничивает число шагов эскалации одного уведомления
+const MaxEscalationSteps = 5
+
+// EscalationStep — шаг эскалации непрочитанного уведомления
+type EscalationStep struct {
+	AfterMinutes int              `json:"after_minutes"` // минут после создания уведомления
+	Action       EscalationAction `json:"action"`
+	Priority     string           `json:"priority,omitempty"`
+	Target       []Target         `json:"target,omitempty"` // резервные получатели для notify
+}
+
+// ValidateEscalation проверяет шаги эскалации: время шагов строго возрастает и меньше NotificationTTL
+// (истекшее уведомление эскалацию отменяет), notify требует получателей
+func ValidateEscalation(steps []EscalationStep) error {
+	if len(steps) > MaxEscalationSteps {
+		return fmt.Errorf("не больше %d шагов эскалации", MaxEscalationSteps)
+	}
+	maxMinutes := int(NotificationTTL / time.Minute)
+	prev := 0
+	for i, step := range steps {
+		if step.AfterMinutes <= prev {
+			return fmt.Errorf("шаг эскалации %d: after_minutes должно быть больше %d", i, prev)
+		}
+		if step.AfterMinutes >= maxMinutes {
+			return fmt.Errorf("шаг эскалации %d: after_minutes должно быть меньше %d (срок жизни уведомления)", i, maxMinutes)
+		}
+		prev = step.AfterMinutes
+		if !ValidPriority(step.Priority) {
+			return fmt.Errorf("шаг эскалации %d: неизвестный приоритет %s", i, step.Priority)
+		}
+		switch step.Action {
+		case EscalationRepush:
+		case EscalationNotify:
+			if len(step.Target) == 0 {
+				return fmt.Errorf("шаг эскалации %d: для notify нужны получатели", i)
+			}
+			for j, t := range step.Target {
+				if t.ID <= 0 || t.Login == "" {
+					return fmt.Errorf("шаг эскалации %d: некорректный получатель %d", i, j)
+				}
+			}
+		default:
+			return fmt.Errorf("шаг эскалации %d: неизвестное действие %s", i, step.Action)
+		}
+	}
+	return nil
+}
+
+// Escalation — запланированная эскалация уведомления одного получателя
+type Escalation struct {
+	NotificationID string           `json:"notification_id"`
+	StreamID       string           `json:"stream_id"`
+	Target         Target           `json:"target"`
+	Message        string           `json:"message"`
+	Source         string           `json:"source"`
+	Category       string           `json:"category,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`   // created_at исходного уведомления, повторяется в repush
+	ScheduledAt    time.Time        `json:"scheduled_at"` // от этого момента отсчитываются шаги
+	Steps          []EscalationStep `json:"steps"`
+	NextStep       int              `json:"next_step"`
+}
+
+// Done сообщает, что все шаги эскалации выполнены
+func (e Escalation) Done() bool {
+	return e.NextStep >= len(e.Steps)
+}
+
+// NextRunAt возвращает время следующего шага
+func (e Escalation) NextRunAt() time.Time {
+	if e.Done() {
+		return time.Time{}
+	}
+	return e.ScheduledAt.Add(time.Duration(e.Steps[e.NextStep].AfterMinutes) * time.Minute)
+}
+
+// Contact — адреса пользователя во внешних каналах доставки
+type Contact struct {
+	Email string `json:"email,omitempty"`
+}
+
+// ChannelDelivery — отложенная доставка уведомления внешними каналами, если получатель
+// не в сети или не прочитал уведомление за отведенное время
+type ChannelDelivery struct {
+	NotificationID string    `json:"notification_id"`
+	StreamID       string    `json:"stream_id"`
+	Target         Target    `json:"target"`
+	Message        string    `json:"message"`
+	Source         string    `json:"source"`
+	Category       string    `json:"category,omitempty"`
+	Priority       string    `json:"priority,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	DueAt          time.Time `json:"due_at"`
+	Attempts       int       `json:"attempts"`
+	Sent           []string  `json:"sent,omitempty"`     // каналы, уже доставившие уведомление
+	Channels       []string  `json:"channels,omitempty"` // каналы, выбранные получателем для категории; пусто — все
+}
+
+// SentVia сообщает, доставлено ли уведомление каналом name
+func (d ChannelDelivery) SentVia(name string) bool {
+	return slices.Contains(d.Sent, name)
+}
+
+// Allows сообщает, выбран ли канал name получателем
+func (d ChannelDelivery) Allows(name string) bool {
+	return len(d.Channels) == 0 || slices.Contains(d.Channels, name)
+}
+
+// Webhook — зарегистрированный URL, на который уведомления пользователя отправляются POST-запросом
+type Webhook struct {
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"` // ключ HMAC-SHA256 подписи запросов
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ValidateWebhookURL проверяет, что URL абсолютный и использует http или https
+func ValidateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("некорректный URL webhook: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("URL webhook должен использовать http или https: %s", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("в URL webhook нет хоста: %s", raw)
+	}
+	return nil
+}
+
+// Ограничения настроек уведомлений пользователя
+const (
+	MaxMutedSources     = 100
+	MaxCategoryChannels = 100
+)
+
+// DefaultCategory — ключ CategoryChannels для категорий без собственной настройки
+const DefaultCategory = "*"
+
+// Preferences — настройки уведомлений пользователя. Заглушенные источники не создают уведомлений,
+// в тихие часы и до DNDUntil уведомления откладываются и доставляются после
+type Preferences struct {
+	MutedSources []string `json:"muted_sources,omitempty"`
+	// CategoryChannels — внешние каналы по категориям (ключ "*" — остальные категории).
+	// Пустой список отключает внешние каналы; входящие в WebSocket приходят всегда
+	CategoryChannels map[string][]string `json:"category_channels,omitempty"`
+	QuietHours       *QuietHours         `json:"quiet_hours,omitempty"`
+	DNDUntil         *time.Time          `json:"dnd_until,omitempty"`
+}
+
+// QuietHours — ежедневный интервал тишины в часовом поясе пользователя; Start > End — интервал через полночь
+type QuietHours struct {
+	Start    string `json:"start"`              // HH:MM
+	End      string `json:"end"`                // HH:MM
+	Timezone string `json:"timezone,omitempty"` // IANA, по умолчанию UTC
+}
+
+// Validate проверяет источники, каналы категорий и тихие часы
+func (p Preferences) Validate() error {
+	if len(p.MutedSources) > MaxMutedSources {
+		return fmt.Errorf("не больше %d заглушенных источников", MaxMutedSources)
+	}
+	for _, src := range p.MutedSources {
+		if src == "" {
+			return fmt.Errorf("заглушенный источник не может быть пустым")
+		}
+	}
+	if len(p.CategoryChannels) > MaxCategoryChannels {
+		return fmt.Errorf("не больше %d категорий с выбором каналов", MaxCategoryChannels)
+	}
+	for category, channels := range p.CategoryChannels {
+		if category == "" {
+			return fmt.Errorf("категория не может быть пустой")
+		}
+		for _, ch := range channels {
+			if ch == "" {
+				return fmt.Errorf("пустое имя канала в категории %s", category)
+			}
+		}
+	}
+	if q := p.QuietHours; q != nil {
+		if _, err := time.Parse("15:04", q.Start); err != nil {
+			return fmt.Errorf("начало тихих часов должно быть в формате HH:MM: %s", q.Start)
+		}
+		if _, err := time.Parse("15:04", q.End); err != nil {
+			return fmt.Errorf("конец тихих часов должен быть в формате HH:MM: %s", q.End)
+		}
+		if q.Start == q.End {
+			return fmt.Errorf("начало и конец тихих часов совпадают")
+		}
+		if _, err := time.LoadLocation(q.Timezone); err != nil {
+			return fmt.Errorf("неизвестный часовой пояс: %s", q.Timezone)
+		}
+	}
+	return nil
+}
+
+// Muted сообщает, заглушен ли источник
+func (p Preferences) Muted(source string) bool {
+	return slices.Contains(p.MutedSources, source)
+}
+
+// ChannelsFor возвращает внешние каналы, выбранные для категории. restricted == false — выбор не задан
+func (p Preferences) ChannelsFor(category string) (channels []string, restricted bool) {
+	if channels, ok := p.CategoryChannels[category]; ok {
+		return channels, true
+	}
+	channels, ok := p.CategoryChannels[DefaultCategory]
+	return channels, ok
+}
+
+// DeferUntil возвращает, до какого момента отложить уведомление, пришедшее в now.
+// Нулевое время — доставлять сразу
+func (p Preferences) DeferUntil(now time.Time) time.Time {
+	until := now
+	if p.DNDUntil != nil && p.DNDUntil.After(until) {
+		until = *p.DNDUntil
+	}
+	if p.QuietHours != nil {
+		if end, ok := p.QuietHours.endAfter(until); ok {
+			until = end
+		}
+	}
+	if !until.After(now) {
+		return time.Time{}
+	}
+	return until.UTC()
+}
+
+// endAfter возвращает конец тихих часов, если t попадает в них
+func (q QuietHours) endAfter(t time.Time) (time.Time, bool) {
+	start, err1 := time.Parse("15:04", q.Start)
+	end, err2 := time.Parse("15:04", q.End)
+	if err1 != nil || err2 != nil {
+		return time.Time{}, false
+	}
+	loc, err := time.LoadLocation(q.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := t.In(loc)
+	at := func(c time.Time, days int) time.Time {
+		return time.Date(local.Year(), local.Month(), local.Day()+days, c.Hour(), c.Minute(), 0, 0, loc)
+	}
+	todayStart, todayEnd := at(start, 0), at(end, 0)
+
+	if todayStart.Before(todayEnd) {
+		if !local.Before(todayStart) && local.Before(todayEnd) {
+			return todayEnd, true
+		}
+		return time.Time{}, false
+	}
+	// Интервал через полночь: [start, 24:00) и [00:00, end)
+	if local.Before(todayEnd) {
+		return todayEnd, true
+	}
+	if !local.Before(todayStart) {
+		return at(end, 1), true
+	}
+	return time.Time{}, false
+}
+
+// DeferredNotification — уведомление, отложенное до конца тихих часов или режима «не беспокоить»
+type DeferredNotification struct {
+	Payload    NotificationPayload `json:"payload"` // notification_id назначен при откладывании
+	Escalation []EscalationStep    `json:"escalation,omitempty"`
+	DeferredAt time.Time           `json:"deferred_at"`
+	ReleaseAt  time.Time           `json:"release_at"`
+}
+
+// Ограничения тем
+const (
+	MaxTopicLength      = 128
+	MaxTopicsPerUser    = 100
+	MaxTopicsPerRequest = 20
+)
+
+// ValidateTopic проверяет имя темы: латинские буквы, цифры и символы . _ - длиной до MaxTopicLength.
+// Имя темы входит в путь admin API, поэтому слэш не допускается
+func ValidateTopic(topic string) error {
+	if topic == "" {
+		return fmt.Errorf("имя темы не может быть пустым")
+	}
+	if len(topic) > MaxTopicLength {
+		return fmt.Errorf("имя темы длиннее %d символов", MaxTopicLength)
+	}
+	for _, c := range topic {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '_', c == '-':
+		default:
+			return fmt.Errorf("недопустимый символ %q в имени темы %s", c, topic)
+		}
+	}
+	return nil
 }
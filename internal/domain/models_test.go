@@ -0,0 +1,191 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata" // часовые пояса тихих часов не зависят от zoneinfo системы
+)
+
+var testEpoch = time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+func TestPreferencesDeferUntil(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2025, 3, day, hour, minute, 0, 0, time.UTC)
+	}
+	ptr := func(t time.Time) *time.Time { return &t }
+	quiet := func(start, end, tz string) *QuietHours {
+		return &QuietHours{Start: start, End: end, Timezone: tz}
+	}
+
+	tests := []struct {
+		name  string
+		prefs Preferences
+		now   time.Time
+		want  time.Time // нулевое — доставлять сразу
+	}{
+		{"без настроек", Preferences{}, testEpoch, time.Time{}},
+		{"не беспокоить до будущего момента", Preferences{DNDUntil: ptr(at(10, 14, 0))}, testEpoch, at(10, 14, 0)},
+		{"не беспокоить истек", Preferences{DNDUntil: ptr(at(10, 11, 0))}, testEpoch, time.Time{}},
+		{"не беспокоить истекает ровно сейчас", Preferences{DNDUntil: ptr(testEpoch)}, testEpoch, time.Time{}},
+
+		{"внутри дневного интервала", Preferences{QuietHours: quiet("09:00", "18:00", "")}, testEpoch, at(10, 18, 0)},
+		{"начало интервала включено", Preferences{QuietHours: quiet("12:00", "13:00", "")}, testEpoch, at(10, 13, 0)},
+		{"конец интервала исключен", Preferences{QuietHours: quiet("09:00", "12:00", "")}, testEpoch, time.Time{}},
+		{"до дневного интервала", Preferences{QuietHours: quiet("13:00", "18:00", "")}, testEpoch, time.Time{}},
+
+		{"через полночь до полуночи", Preferences{QuietHours: quiet("22:00", "07:00", "UTC")}, at(10, 23, 30), at(11, 7, 0)},
+		{"через полночь после полуночи", Preferences{QuietHours: quiet("22:00", "07:00", "UTC")}, at(10, 3, 0), at(10, 7, 0)},
+		{"вне интервала через полночь", Preferences{QuietHours: quiet("22:00", "07:00", "UTC")}, testEpoch, time.Time{}},
+
+		// 20:00 UTC — 23:00 по Москве, тишина до 07:00 MSK = 04:00 UTC
+		{"часовой пояс пользователя", Preferences{QuietHours: quiet("22:00", "07:00", "Europe/Moscow")}, at(10, 20, 0), at(11, 4, 0)},
+		{"вне интервала в часовом поясе", Preferences{QuietHours: quiet("22:00", "07:00", "Europe/Moscow")}, testEpoch, time.Time{}},
+		// Ночью 9 марта Нью-Йорк перешел на летнее время: 07:00 EDT = 11:00 UTC, а не 12:00
+		{"переход на летнее время", Preferences{QuietHours: quiet("22:00", "07:00", "America/New_York")}, at(9, 3, 0), at(9, 11, 0)},
+
+		{"не беспокоить заканчивается в тихие часы",
+			Preferences{DNDUntil: ptr(at(10, 23, 0)), QuietHours: quiet("22:00", "07:00", "")}, testEpoch, at(11, 7, 0)},
+		{"не беспокоить дольше тихих часов",
+			Preferences{DNDUntil: ptr(at(11, 9, 0)), QuietHours: quiet("22:00", "07:00", "")}, testEpoch, at(11, 9, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.prefs.DeferUntil(tt.now)
+			if !got.Equal(tt.want) {
+				t.Fatalf("DeferUntil(%v) = %v, ожидалось %v", tt.now, got, tt.want)
+			}
+			if !got.IsZero() && got.Location() != time.UTC {
+				t.Fatalf("момент выпуска не в UTC: %v", got)
+			}
+		})
+	}
+}
+
+func TestPreferencesValidate(t *testing.T) {
+	tooManySources := make([]string, MaxMutedSources+1)
+	for i := range tooManySources {
+		tooManySources[i] = "src"
+	}
+
+	tests := []struct {
+		name    string
+		prefs   Preferences
+		wantErr string // пусто — настройки корректны
+	}{
+		{"пустые настройки", Preferences{}, ""},
+		{"корректные настройки", Preferences{
+			MutedSources:     []string{"reports"},
+			CategoryChannels: map[string][]string{"billing": {"email"}, DefaultCategory: {}},
+			QuietHours:       &QuietHours{Start: "22:00", End: "07:00", Timezone: "Europe/Moscow"},
+		}, ""},
+		{"слишком много источников", Preferences{MutedSources: tooManySources}, "заглушенных источников"},
+		{"пустой источник", Preferences{MutedSources: []string{""}}, "источник не может быть пустым"},
+		{"пустая категория", Preferences{CategoryChannels: map[string][]string{"": {"email"}}}, "категория не может быть пустой"},
+		{"пустой канал", Preferences{CategoryChannels: map[string][]string{"billing": {""}}}, "пустое имя канала"},
+		{"неверное начало", Preferences{QuietHours: &QuietHours{Start: "25:00", End: "07:00"}}, "начало тихих часов"},
+		{"неверный конец", Preferences{QuietHours: &QuietHours{Start: "22:00", End: "7"}}, "конец тихих часов"},
+		{"пустой интервал", Preferences{QuietHours: &QuietHours{Start: "22:00", End: "22:00"}}, "совпадают"},
+		{"неизвестный часовой пояс", Preferences{QuietHours: &QuietHours{Start: "22:00", End: "07:00", Timezone: "Mars/Olympus"}}, "часовой пояс"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.prefs.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("неожиданная ошибка: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ошибка %v, ожидалась содержащая %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPreferencesMutedAndChannels(t *testing.T) {
+	prefs := Preferences{
+		MutedSources:     []string{"reports"},
+		CategoryChannels: map[string][]string{"billing": {"email"}, "security": {}, DefaultCategory: {"webhook"}},
+	}
+	if !prefs.Muted("reports") || prefs.Muted("billing") {
+		t.Fatal("Muted не учитывает список заглушенных источников")
+	}
+
+	tests := []struct {
+		category       string
+		wantChannels   []string
+		wantRestricted bool
+	}{
+		{"billing", []string{"email"}, true},
+		{"security", []string{}, true}, // пустой список отключает внешние каналы
+		{"other", []string{"webhook"}, true},
+	}
+	for _, tt := range tests {
+		channels, restricted := prefs.ChannelsFor(tt.category)
+		if restricted != tt.wantRestricted || strings.Join(channels, ",") != strings.Join(tt.wantChannels, ",") {
+			t.Errorf("ChannelsFor(%s) = %v, %v; ожидалось %v, %v", tt.category, channels, restricted, tt.wantChannels, tt.wantRestricted)
+		}
+	}
+	if channels, restricted := (Preferences{}).ChannelsFor("billing"); restricted || channels != nil {
+		t.Errorf("без настроек ChannelsFor = %v, %v; ожидалось без ограничений", channels, restricted)
+	}
+}
+
+func TestStreamIDTime(t *testing.T) {
+	tests := []struct {
+		id   string
+		want time.Time
+	}{
+		{"1741608000000-0", testEpoch},
+		{"1741608000123-7", testEpoch.Add(123 * time.Millisecond)},
+		{"1741608000000", time.Time{}},
+		{"x-0", time.Time{}},
+		{"", time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := StreamIDTime(tt.id); !got.Equal(tt.want) {
+			t.Errorf("StreamIDTime(%q) = %v, ожидалось %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestValidateEscalation(t *testing.T) {
+	repush := func(minutes ...int) []EscalationStep {
+		steps := make([]EscalationStep, 0, len(minutes))
+		for _, m := range minutes {
+			steps = append(steps, EscalationStep{AfterMinutes: m, Action: EscalationRepush})
+		}
+		return steps
+	}
+
+	tests := []struct {
+		name    string
+		steps   []EscalationStep
+		wantErr string // пусто — шаги корректны
+	}{
+		{"без эскалации", nil, ""},
+		{"шаги до истечения", repush(5, 14), ""},
+		{"notify с получателями", []EscalationStep{{AfterMinutes: 10, Action: EscalationNotify, Target: []Target{{ID: 2, Login: "bob"}}}}, ""},
+		{"время не возрастает", repush(5, 5), "больше 5"},
+		{"шаг в момент истечения", repush(15), "меньше 15"},
+		{"шаг через 30 минут", repush(5, 30), "меньше 15"},
+		{"notify без получателей", []EscalationStep{{AfterMinutes: 10, Action: EscalationNotify}}, "нужны получатели"},
+		{"неизвестное действие", []EscalationStep{{AfterMinutes: 10, Action: "call"}}, "неизвестное действие"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateEscalation(tt.steps)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("неожиданная ошибка: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ошибка %v, ожидалась содержащая %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// EnvelopePrefix помечает значения, зашифрованные конвертным шифрованием
+const EnvelopePrefix = "enc:v1:"
+
+// envelope хранится рядом с шифротекстом: идентификатор KEK, обёрнутый DEK и сами данные
+type envelope struct {
+	KeyID      string `json:"kid"`
+	WrappedKey []byte `json:"wk"`
+	Ciphertext []byte `json:"ct"`
+}
+
+// Cipher реализует конвертное шифрование AES-GCM:
+// для каждого значения генерируется свой ключ данных (DEK), который шифруется ключом из Keyring
+type Cipher struct {
+	keyring *Keyring
+}
+
+// NewCipher создает шифратор поверх связки ключей
+func NewCipher(keyring *Keyring) *Cipher {
+	return &Cipher{keyring: keyring}
+}
+
+// IsEncrypted проверяет, что значение сохранено в зашифрованном виде
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, EnvelopePrefix)
+}
+
+// Encrypt шифрует данные активным ключом. aad привязывает шифротекст к контексту (например, к имени ключа Redis)
+func (c *Cipher) Encrypt(plaintext, aad []byte) (string, error) {
+	keyID, kek := c.keyring.active()
+
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", fmt.Errorf("ошибка генерации ключа данных: %w", err)
+	}
+
+	ciphertext, err := seal(dek, plaintext, aad)
+	if err != nil {
+		return "", err
+	}
+
+	wrapped, err := seal(kek, dek, []byte(keyID))
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := json.Marshal(envelope{KeyID: keyID, WrappedKey: wrapped, Ciphertext: ciphertext})
+	if err != nil {
+		return "", fmt.Errorf("ошибка сериализации конверта: %w", err)
+	}
+
+	return EnvelopePrefix + string(raw), nil
+}
+
+// Decrypt расшифровывает значение. Незашифрованные значения возвращаются как есть
+func (c *Cipher) Decrypt(value string, aad []byte) ([]byte, error) {
+	if !IsEncrypted(value) {
+		return []byte(value), nil
+	}
+
+	env, err := parseEnvelope(value)
+	if err != nil {
+		return nil, err
+	}
+
+	kek, ok := c.keyring.key(env.KeyID)
+	if !ok {
+		return nil, fmt.Errorf("неизвестный ключ шифрования: %s", env.KeyID)
+	}
+
+	dek, err := open(kek, env.WrappedKey, []byte(env.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка расшифровки ключа данных: %w", err)
+	}
+
+	plaintext, err := open(dek, env.Ciphertext, aad)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка расшифровки данных: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// NeedsRotation сообщает, что значение не зашифровано или зашифровано неактивным ключом
+func (c *Cipher) NeedsRotation(value string) bool {
+	if !IsEncrypted(value) {
+		return true
+	}
+	env, err := parseEnvelope(value)
+	if err != nil {
+		return false
+	}
+	return env.KeyID != c.keyring.ActiveKeyID()
+}
+
+func parseEnvelope(value string) (*envelope, error) {
+	var env envelope
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(value, EnvelopePrefix)), &env); err != nil {
+		return nil, fmt.Errorf("ошибка разбора конверта: %w", err)
+	}
+	return &env, nil
+}
+
+// seal шифрует данные AES-GCM, nonce записывается перед шифротекстом
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("ошибка генерации nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// open расшифровывает данные, сформированные seal
+func open(key, data, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("шифротекст слишком короткий")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка инициализации AES: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка инициализации GCM: %w", err)
+	}
+	return gcm, nil
+}
@@ -0,0 +1,235 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func writeKeyring(t *testing.T, path, active string, keys map[string]string) {
+	t.Helper()
+	raw, err := json.Marshal(keyringFile{Active: active, Keys: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestKeyring(t *testing.T, active string, keys map[string]string) (*Keyring, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKeyring(t, path, active, keys)
+	k, err := LoadKeyring(path)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+	return k, path
+}
+
+func TestCipherRoundTrip(t *testing.T) {
+	k, _ := newTestKeyring(t, "k1", map[string]string{"k1": testKey(1)})
+	c := NewCipher(k)
+
+	tests := []struct {
+		name      string
+		plaintext []byte
+		aad       []byte
+	}{
+		{"обычные данные", []byte(`{"message":"привет"}`), []byte("notif:payload:1")},
+		{"пустые данные", []byte{}, []byte("notif:payload:2")},
+		{"без aad", []byte("data"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := c.Encrypt(tt.plaintext, tt.aad)
+			if err != nil {
+				t.Fatalf("Encrypt: %v", err)
+			}
+			if !IsEncrypted(enc) {
+				t.Fatalf("значение без префикса %q: %s", EnvelopePrefix, enc)
+			}
+			if len(tt.plaintext) > 0 && strings.Contains(enc, string(tt.plaintext)) {
+				t.Fatal("открытый текст виден в шифротексте")
+			}
+			got, err := c.Decrypt(enc, tt.aad)
+			if err != nil {
+				t.Fatalf("Decrypt: %v", err)
+			}
+			if !bytes.Equal(got, tt.plaintext) {
+				t.Fatalf("получено %q, ожидалось %q", got, tt.plaintext)
+			}
+		})
+	}
+}
+
+func TestCipherEncryptIsRandomized(t *testing.T) {
+	k, _ := newTestKeyring(t, "k1", map[string]string{"k1": testKey(1)})
+	c := NewCipher(k)
+
+	a, err := c.Encrypt([]byte("same"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.Encrypt([]byte("same"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Fatal("одинаковый открытый текст дал одинаковый шифротекст")
+	}
+}
+
+func TestCipherDecryptErrors(t *testing.T) {
+	k, _ := newTestKeyring(t, "k1", map[string]string{"k1": testKey(1)})
+	c := NewCipher(k)
+
+	enc, err := c.Encrypt([]byte("secret"), []byte("aad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := parseEnvelope(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reencode := func(e envelope) string {
+		raw, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return EnvelopePrefix + string(raw)
+	}
+
+	tampered := *env
+	tampered.Ciphertext = append([]byte(nil), env.Ciphertext...)
+	tampered.Ciphertext[len(tampered.Ciphertext)-1] ^= 0xff
+
+	unknownKey := *env
+	unknownKey.KeyID = "missing"
+
+	shortCT := *env
+	shortCT.Ciphertext = []byte{1, 2, 3}
+
+	tests := []struct {
+		name  string
+		value string
+		aad   []byte
+	}{
+		{"другой aad", enc, []byte("other")},
+		{"измененный шифротекст", reencode(tampered), []byte("aad")},
+		{"неизвестный ключ", reencode(unknownKey), []byte("aad")},
+		{"короткий шифротекст", reencode(shortCT), []byte("aad")},
+		{"битый конверт", EnvelopePrefix + "{not json", []byte("aad")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := c.Decrypt(tt.value, tt.aad); err == nil {
+				t.Fatal("ожидалась ошибка расшифровки")
+			}
+		})
+	}
+}
+
+func TestCipherDecryptPlaintextPassthrough(t *testing.T) {
+	k, _ := newTestKeyring(t, "k1", map[string]string{"k1": testKey(1)})
+	c := NewCipher(k)
+
+	got, err := c.Decrypt(`{"message":"legacy"}`, nil)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if string(got) != `{"message":"legacy"}` {
+		t.Fatalf("получено %q", got)
+	}
+}
+
+func TestCipherRotation(t *testing.T) {
+	k, path := newTestKeyring(t, "k1", map[string]string{"k1": testKey(1)})
+	c := NewCipher(k)
+
+	old, err := c.Encrypt([]byte("old"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.NeedsRotation(old) {
+		t.Fatal("значение активного ключа не должно требовать ротации")
+	}
+
+	writeKeyring(t, path, "k2", map[string]string{"k1": testKey(1), "k2": testKey(2)})
+	if err := k.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	if !c.NeedsRotation(old) {
+		t.Fatal("значение старого ключа должно требовать ротации")
+	}
+	if !c.NeedsRotation("plain") {
+		t.Fatal("незашифрованное значение должно требовать ротации")
+	}
+	got, err := c.Decrypt(old, nil)
+	if err != nil || string(got) != "old" {
+		t.Fatalf("старый ключ не расшифровывает: %q, %v", got, err)
+	}
+
+	fresh, err := c.Encrypt([]byte("new"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := parseEnvelope(fresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.KeyID != "k2" {
+		t.Fatalf("новые данные зашифрованы ключом %s, ожидался k2", env.KeyID)
+	}
+
+	// После удаления старого ключа его данные больше не читаются
+	writeKeyring(t, path, "k2", map[string]string{"k2": testKey(2)})
+	if err := k.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if _, err := c.Decrypt(old, nil); err == nil {
+		t.Fatal("ожидалась ошибка для удаленного ключа")
+	}
+}
+
+func TestKeyringReloadValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		active string
+		keys   map[string]string
+	}{
+		{"нет активного ключа", "", map[string]string{"k1": testKey(1)}},
+		{"активный ключ отсутствует", "k2", map[string]string{"k1": testKey(1)}},
+		{"короткий ключ", "k1", map[string]string{"k1": base64.StdEncoding.EncodeToString([]byte("short"))}},
+		{"не base64", "k1", map[string]string{"k1": "***"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys.json")
+			writeKeyring(t, path, tt.active, tt.keys)
+			if _, err := LoadKeyring(path); err == nil {
+				t.Fatal("ожидалась ошибка загрузки")
+			}
+		})
+	}
+
+	// Неудачная перезагрузка оставляет прежние ключи
+	k, path := newTestKeyring(t, "k1", map[string]string{"k1": testKey(1)})
+	writeKeyring(t, path, "k9", map[string]string{"k1": testKey(1)})
+	if err := k.Reload(); err == nil {
+		t.Fatal("ожидалась ошибка перезагрузки")
+	}
+	if k.ActiveKeyID() != "k1" {
+		t.Fatalf("активный ключ изменился на %s", k.ActiveKeyID())
+	}
+}
@@ -0,0 +1,102 @@
+package encryption
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// keyringFile описывает формат файла с ключами шифрования
+//
+//	{
+//	  "active": "2025-01",
+//	  "keys": {
+//	    "2024-10": "<base64 32 байта>",
+//	    "2025-01": "<base64 32 байта>"
+//	  }
+//	}
+type keyringFile struct {
+	Active string            `json:"active"`
+	Keys   map[string]string `json:"keys"`
+}
+
+// Keyring хранит ключи шифрования ключей (KEK) по их идентификаторам.
+// Новые данные шифруются активным ключом, старые ключи остаются для расшифровки
+type Keyring struct {
+	path     string
+	mu       sync.RWMutex
+	activeID string
+	keys     map[string][]byte
+}
+
+// LoadKeyring загружает связку ключей из локального файла
+func LoadKeyring(path string) (*Keyring, error) {
+	k := &Keyring{path: path}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload перечитывает файл ключей (используется при ротации без перезапуска)
+func (k *Keyring) Reload() error {
+	raw, err := os.ReadFile(k.path)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения файла ключей: %w", err)
+	}
+
+	var f keyringFile
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return fmt.Errorf("ошибка разбора файла ключей: %w", err)
+	}
+
+	keys := make(map[string][]byte, len(f.Keys))
+	for id, encoded := range f.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf("ошибка декодирования ключа %s: %w", id, err)
+		}
+		if len(key) != 32 {
+			return fmt.Errorf("ключ %s должен быть длиной 32 байта, получено %d", id, len(key))
+		}
+		keys[id] = key
+	}
+
+	if f.Active == "" {
+		return fmt.Errorf("в файле ключей не указан активный ключ")
+	}
+	if _, ok := keys[f.Active]; !ok {
+		return fmt.Errorf("активный ключ %s отсутствует в файле ключей", f.Active)
+	}
+
+	k.mu.Lock()
+	k.activeID = f.Active
+	k.keys = keys
+	k.mu.Unlock()
+
+	return nil
+}
+
+// ActiveKeyID возвращает идентификатор ключа для шифрования новых данных
+func (k *Keyring) ActiveKeyID() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.activeID
+}
+
+// active возвращает активный ключ и его идентификатор
+func (k *Keyring) active() (string, []byte) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.activeID, k.keys[k.activeID]
+}
+
+// key возвращает ключ по идентификатору
+func (k *Keyring) key(id string) ([]byte, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[id]
+	return key, ok
+}
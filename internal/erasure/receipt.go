@@ -0,0 +1,67 @@
+package erasure
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+
+	"notification-mvp/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+// Algorithm — алгоритм подписи квитанций
+const Algorithm = "HMAC-SHA256"
+
+// Signer выпускает и проверяет квитанции об удалении данных пользователя
+type Signer struct {
+	key []byte
+}
+
+// ErrNoSigningKey — ключ подписи не задан: квитанцию без подписи нельзя проверить
+var ErrNoSigningKey = errors.New("не задан ключ подписи квитанций об удалении данных")
+
+// NewSigner создает подписчика квитанций. Квитанции без подписи не выпускаются, поэтому ключ обязателен
+func NewSigner(key []byte) (*Signer, error) {
+	if len(key) == 0 {
+		return nil, ErrNoSigningKey
+	}
+	return &Signer{key: key}, nil
+}
+
+// Issue выпускает квитанцию с новым идентификатором для отчета об удалении
+func (s *Signer) Issue(report domain.ErasureReport) domain.ErasureReceipt {
+	receipt := domain.ErasureReceipt{
+		ReceiptID: uuid.New().String(),
+		Report:    report,
+		Algorithm: Algorithm,
+	}
+	receipt.Signature = hex.EncodeToString(s.mac(receipt))
+	return receipt
+}
+
+// Verify проверяет подпись квитанции
+func (s *Signer) Verify(receipt domain.ErasureReceipt) bool {
+	if receipt.Algorithm != Algorithm {
+		return false
+	}
+	sig, err := hex.DecodeString(receipt.Signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(sig, s.mac(receipt))
+}
+
+// mac считает HMAC от JSON идентификатора и отчета (порядок полей фиксирован структурой)
+func (s *Signer) mac(receipt domain.ErasureReceipt) []byte {
+	body, _ := json.Marshal(struct {
+		ReceiptID string               `json:"receipt_id"`
+		Report    domain.ErasureReport `json:"report"`
+	}{receipt.ReceiptID, receipt.Report})
+
+	h := hmac.New(sha256.New, s.key)
+	h.Write(body)
+	return h.Sum(nil)
+}
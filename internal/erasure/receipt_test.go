@@ -0,0 +1,52 @@
+package erasure
+
+import (
+	"errors"
+	"testing"
+
+	"notification-mvp/internal/domain"
+)
+
+func TestNewSignerRequiresKey(t *testing.T) {
+	if _, err := NewSigner(nil); !errors.Is(err, ErrNoSigningKey) {
+		t.Fatalf("ожидалась ошибка %v, получено %v", ErrNoSigningKey, err)
+	}
+}
+
+func TestSignerIssueVerify(t *testing.T) {
+	signer, err := NewSigner([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewSigner([]byte("other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipt := signer.Issue(domain.ErasureReport{Target: domain.Target{ID: 1, Login: "alice"}, KeysDeleted: 3})
+	if receipt.Algorithm != Algorithm || receipt.Signature == "" || receipt.ReceiptID == "" {
+		t.Fatalf("квитанция без подписи: %+v", receipt)
+	}
+
+	tests := []struct {
+		name   string
+		signer *Signer
+		mutate func(*domain.ErasureReceipt)
+		want   bool
+	}{
+		{"подлинная", signer, func(*domain.ErasureReceipt) {}, true},
+		{"другой ключ", other, func(*domain.ErasureReceipt) {}, false},
+		{"изменен отчет", signer, func(r *domain.ErasureReceipt) { r.Report.KeysDeleted++ }, false},
+		{"изменен идентификатор", signer, func(r *domain.ErasureReceipt) { r.ReceiptID = "x" }, false},
+		{"без алгоритма", signer, func(r *domain.ErasureReceipt) { r.Algorithm = "" }, false},
+		{"подпись не hex", signer, func(r *domain.ErasureReceipt) { r.Signature = "zz" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := receipt
+			tt.mutate(&r)
+			if got := tt.signer.Verify(r); got != tt.want {
+				t.Fatalf("Verify = %v, ожидалось %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,14 +1,17 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"notification-mvp/internal/domain"
+	"notification-mvp/internal/erasure"
 	websocketManager "notification-mvp/internal/websocket"
 
 	"github.com/gorilla/websocket"
@@ -21,6 +24,11 @@ type Handlers struct {
 	connectionManager *websocketManager.ConnectionManager
 	logger            *slog.Logger
 	upgrader          websocket.Upgrader
+	archive           domain.ArchiveStore
+	archiveQueue      domain.ArchiveFlusher
+	erasureSigner     *erasure.Signer
+	leaders           domain.LeaderReader
+	workers           domain.WorkerController
 }
 
 // NewHandlers создает новый экземпляр Handlers
@@ -48,6 +56,33 @@ func NewHandlers(
 	}
 }
 
+// WithArchive подключает долговременный архив для истории за пределами окна Redis.
+// queue — очередь асинхронной записи в этот архив; она дописывается перед удалением данных пользователя
+func (h *Handlers) WithArchive(archive domain.ArchiveStore, queue domain.ArchiveFlusher) *Handlers {
+	h.archive = archive
+	h.archiveQueue = queue
+	return h
+}
+
+// WithLeaders подключает источник сведений о лидерах singleton-воркеров
+func (h *Handlers) WithLeaders(leaders domain.LeaderReader) *Handlers {
+	h.leaders = leaders
+	return h
+}
+
+// WithWorkers подключает управление фоновыми воркерами pod
+func (h *Handlers) WithWorkers(workers domain.WorkerController) *Handlers {
+	h.workers = workers
+	return h
+}
+
+// WithErasureSigner задает подпись квитанций об удалении данных пользователя.
+// Без нее удаление данных отключено: квитанцию без подписи нельзя проверить
+func (h *Handlers) WithErasureSigner(signer *erasure.Signer) *Handlers {
+	h.erasureSigner = signer
+	return h
+}
+
 // NotifyHandler обрабатывает POST /api/v1/notify
 func (h *Handlers) NotifyHandler(w http.ResponseWriter, r *http.Request) {
 	// Получаем идемпотентный ключ из заголовка
@@ -56,7 +91,7 @@ func (h *Handlers) NotifyHandler(w http.ResponseWriter, r *http.Request) {
 	// Декодируем JSON запрос
 	var req domain.NotifyRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Warn("Ошибка декодирования JSON", "error", err)
+		h.logger.WarnContext(r.Context(), "Ошибка декодирования JSON", "error", err)
 		h.writeErrorResponse(w, http.StatusBadRequest, "Неверный формат JSON")
 		return
 	}
@@ -66,15 +101,16 @@ func (h *Handlers) NotifyHandler(w http.ResponseWriter, r *http.Request) {
 		req.CreatedAt = time.Now()
 	}
 
-	h.logger.Debug("Получен запрос на создание уведомлений",
+	h.logger.DebugContext(r.Context(), "Получен запрос на создание уведомлений",
 		"targets_count", len(req.Target),
+		"topics", req.Topics,
 		"source", req.Source,
 		"idempotency_key", idempotencyKey)
 
 	// Создаем уведомления через сервис
 	response, err := h.service.CreateNotifications(r.Context(), &req, idempotencyKey)
 	if err != nil {
-		h.logger.Error("Ошибка создания уведомлений", "error", err)
+		h.logger.ErrorContext(r.Context(), "Ошибка создания уведомлений", "error", err)
 		h.writeErrorResponse(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
 		return
 	}
@@ -84,10 +120,10 @@ func (h *Handlers) NotifyHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusAccepted) // 202 как указано в ТЗ
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		h.logger.Error("Ошибка кодирования ответа", "error", err)
+		h.logger.ErrorContext(r.Context(), "Ошибка кодирования ответа", "error", err)
 	}
 
-	h.logger.Info("Уведомления созданы успешно",
+	h.logger.InfoContext(r.Context(), "Уведомления созданы успешно",
 		"created_count", len(response.Results),
 		"requested_count", len(req.Target))
 }
@@ -99,7 +135,7 @@ func (h *Handlers) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 	login := r.URL.Query().Get("login")
 
 	if userIDStr == "" || login == "" {
-		h.logger.Warn("Отсутствуют обязательные параметры WebSocket",
+		h.logger.WarnContext(r.Context(), "Отсутствуют обязательные параметры WebSocket",
 			"user_id", userIDStr, "login", login)
 		http.Error(w, "Требуются параметры user_id и login", http.StatusBadRequest)
 		return
@@ -107,7 +143,7 @@ func (h *Handlers) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 
 	userID, err := strconv.ParseInt(userIDStr, 10, 64)
 	if err != nil {
-		h.logger.Warn("Неверный формат user_id", "user_id", userIDStr, "error", err)
+		h.logger.WarnContext(r.Context(), "Неверный формат user_id", "user_id", userIDStr, "error", err)
 		http.Error(w, "Неверный формат user_id", http.StatusBadRequest)
 		return
 	}
@@ -115,7 +151,7 @@ func (h *Handlers) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 	// Апгрейдим соединение до WebSocket
 	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		h.logger.Error("Ошибка апгрейда до WebSocket", "error", err)
+		h.logger.ErrorContext(r.Context(), "Ошибка апгрейда до WebSocket", "error", err)
 		return
 	}
 	defer func() {
@@ -124,7 +160,7 @@ func (h *Handlers) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	h.logger.Info("WebSocket соединение установлено", "user_id", userID, "login", login)
+	h.logger.InfoContext(r.Context(), "WebSocket соединение установлено", "user_id", userID, "login", login)
 
 	// Создаем обертку для WebSocket соединения
 	wsConn := &WebSocketWrapper{conn: conn}
@@ -135,10 +171,10 @@ func (h *Handlers) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Передаем соединение сервису для обработки
 	if err := h.service.HandleWebSocketConnection(r.Context(), userID, login, wsConn); err != nil {
-		h.logger.Error("Ошибка обработки WebSocket соединения", "error", err, "user_id", userID, "login", login)
+		h.logger.ErrorContext(r.Context(), "Ошибка обработки WebSocket соединения", "error", err, "user_id", userID, "login", login)
 	}
 
-	h.logger.Info("WebSocket соединение закрыто", "user_id", userID, "login", login)
+	h.logger.InfoContext(r.Context(), "WebSocket соединение закрыто", "user_id", userID, "login", login)
 }
 
 // HealthHandler обрабатывает GET /health
@@ -153,7 +189,7 @@ func (h *Handlers) HealthHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		h.logger.Error("Ошибка кодирования health ответа", "error", err)
+		h.logger.ErrorContext(r.Context(), "Ошибка кодирования health ответа", "error", err)
 	}
 }
 
@@ -181,7 +217,7 @@ func (h *Handlers) ConnectedClientsHandler(w http.ResponseWriter, r *http.Reques
 	w.WriteHeader(http.StatusOK)
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		h.logger.Error("Ошибка кодирования ответа connected clients", "error", err)
+		h.logger.ErrorContext(r.Context(), "Ошибка кодирования ответа connected clients", "error", err)
 	}
 }
 
@@ -189,7 +225,7 @@ func (h *Handlers) ConnectedClientsHandler(w http.ResponseWriter, r *http.Reques
 func (h *Handlers) PendingNotificationsHandler(w http.ResponseWriter, r *http.Request) {
 	allPending, err := h.repo.GetAllPendingNotifications(r.Context())
 	if err != nil {
-		h.logger.Error("Ошибка получения pending уведомлений", "error", err)
+		h.logger.ErrorContext(r.Context(), "Ошибка получения pending уведомлений", "error", err)
 		h.writeErrorResponse(w, http.StatusInternalServerError, "Ошибка получения pending уведомлений")
 		return
 	}
@@ -204,15 +240,10 @@ func (h *Handlers) PendingNotificationsHandler(w http.ResponseWriter, r *http.Re
 	enriched := make(map[string][]map[string]interface{})
 	for userKey, messages := range allPending {
 		// Разобрать userKey
-		parts := strings.SplitN(userKey, "-", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		userID, err := strconv.ParseInt(parts[0], 10, 64)
+		userID, login, err := domain.ParseUserKey(userKey)
 		if err != nil {
 			continue
 		}
-		login := parts[1]
 
 		// Собрать notificationIDs
 		var ids []string
@@ -256,12 +287,16 @@ func (h *Handlers) PendingNotificationsHandler(w http.ResponseWriter, r *http.Re
 	w.WriteHeader(http.StatusOK)
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		h.logger.Error("Ошибка кодирования ответа pending notifications", "error", err)
+		h.logger.ErrorContext(r.Context(), "Ошибка кодирования ответа pending notifications", "error", err)
 	}
 }
 
-// HistoryHandler возвращает последние 100 событий пользователя с read/unread
+// HistoryHandler возвращает последние 100 событий пользователя с read/unread.
+// Параметр before (RFC3339) ограничивает историю более ранними событиями; недостающее
+// окно Redis прозрачно добирается из долговременного архива, если он подключен
 func (h *Handlers) HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	const historyLimit = 100
+
 	userIDStr := r.URL.Query().Get("user_id")
 	login := r.URL.Query().Get("login")
 	if userIDStr == "" || login == "" {
@@ -273,14 +308,30 @@ func (h *Handlers) HistoryHandler(w http.ResponseWriter, r *http.Request) {
 		h.writeErrorResponse(w, http.StatusBadRequest, "Неверный формат user_id")
 		return
 	}
+	before, err := parseBefore(r.URL.Query().Get("before"))
+	if err != nil {
+		h.writeErrorResponse(w, http.StatusBadRequest, "Неверный формат before (ожидается RFC3339)")
+		return
+	}
 
-	messages, err := h.repo.RangeLastMessages(r.Context(), userID, login, 100)
+	messages, err := h.repo.RangeLastMessages(r.Context(), userID, login, historyLimit)
 	if err != nil {
-		h.logger.Error("Ошибка XRANGE", "error", err)
+		h.logger.ErrorContext(r.Context(), "Ошибка XRANGE", "error", err)
 		h.writeErrorResponse(w, http.StatusInternalServerError, "Ошибка получения истории")
 		return
 	}
 
+	// Оставляем только события раньше before
+	if !before.IsZero() {
+		filtered := messages[:0]
+		for _, m := range messages {
+			if domain.StreamIDTime(m.ID).Before(before) {
+				filtered = append(filtered, m)
+			}
+		}
+		messages = filtered
+	}
+
 	// Собираем статусы read
 	var ids []string
 	for _, m := range messages {
@@ -296,6 +347,7 @@ func (h *Handlers) HistoryHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var out []map[string]interface{}
+	seen := make(map[string]bool, len(messages))
 	for _, m := range messages {
 		item := map[string]interface{}{
 			"id": m.ID,
@@ -304,14 +356,39 @@ func (h *Handlers) HistoryHandler(w http.ResponseWriter, r *http.Request) {
 			item["payload"] = m.Payload
 			item["read"] = readMap[m.Payload.NotificationID]
 			item["status"] = domain.StatusUnread
+			seen[m.Payload.NotificationID] = true
 		} else {
 			item["payload"] = nil
 			item["read"] = true
 			item["status"] = domain.StatusAutoCleared
 		}
+		if nid, ok := m.Fields["nid"].(string); ok {
+			seen[nid] = true
+		}
 		out = append(out, item)
 	}
 
+	// Добираем более старую историю из архива
+	if h.archive != nil && len(out) < historyLimit {
+		cutoff := before
+		if len(messages) > 0 {
+			cutoff = domain.StreamIDTime(messages[0].ID)
+		}
+		archived, err := h.archive.QueryHistory(r.Context(), userID, login, cutoff, historyLimit-len(out))
+		if err != nil {
+			h.logger.WarnContext(r.Context(), "Ошибка чтения истории из архива", "error", err)
+		}
+		var older []map[string]interface{}
+		for i := len(archived) - 1; i >= 0; i-- { // архив отдает от новых к старым
+			a := archived[i]
+			if seen[a.NotificationID] {
+				continue
+			}
+			older = append(older, archivedHistoryItem(a))
+		}
+		out = append(older, out...)
+	}
+
 	resp := map[string]interface{}{
 		"user":      map[string]interface{}{"id": userID, "login": login},
 		"history":   out,
@@ -324,6 +401,520 @@ func (h *Handlers) HistoryHandler(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
+// ArchiveHandler возвращает историю пользователя из долговременного архива
+func (h *Handlers) ArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	if h.archive == nil {
+		h.writeErrorResponse(w, http.StatusNotFound, "Архив не настроен")
+		return
+	}
+
+	userIDStr := r.URL.Query().Get("user_id")
+	login := r.URL.Query().Get("login")
+	if userIDStr == "" || login == "" {
+		h.writeErrorResponse(w, http.StatusBadRequest, "Требуются параметры user_id и login")
+		return
+	}
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		h.writeErrorResponse(w, http.StatusBadRequest, "Неверный формат user_id")
+		return
+	}
+	before, err := parseBefore(r.URL.Query().Get("before"))
+	if err != nil {
+		h.writeErrorResponse(w, http.StatusBadRequest, "Неверный формат before (ожидается RFC3339)")
+		return
+	}
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 1000 {
+			limit = n
+		}
+	}
+
+	archived, err := h.archive.QueryHistory(r.Context(), userID, login, before, limit)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Ошибка чтения архива", "error", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Ошибка чтения архива")
+		return
+	}
+
+	resp := map[string]interface{}{
+		"user":          map[string]interface{}{"id": userID, "login": login},
+		"notifications": archived,
+		"count":         len(archived),
+		"timestamp":     time.Now().Format(time.RFC3339),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// LeadersHandler возвращает pod, выполняющие singleton-воркеры
+func (h *Handlers) LeadersHandler(w http.ResponseWriter, r *http.Request) {
+	if h.leaders == nil {
+		h.writeErrorResponse(w, http.StatusNotFound, "Выборы лидера не настроены")
+		return
+	}
+
+	leaders, err := h.leaders.Leaders(r.Context())
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Ошибка чтения лидеров воркеров", "error", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Ошибка чтения лидеров воркеров")
+		return
+	}
+
+	resp := map[string]interface{}{
+		"leaders":   leaders,
+		"timestamp": time.Now().Format(time.RFC3339),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// WorkersHandler возвращает состояние фоновых воркеров с тех pod, где они выполняются
+func (h *Handlers) WorkersHandler(w http.ResponseWriter, r *http.Request) {
+	if h.workers == nil {
+		h.writeErrorResponse(w, http.StatusNotFound, "Управление воркерами не настроено")
+		return
+	}
+
+	workers, err := h.workers.Workers(r.Context())
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Ошибка получения состояния воркеров", "error", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Ошибка получения состояния воркеров")
+		return
+	}
+
+	resp := map[string]interface{}{
+		"workers":   workers,
+		"timestamp": time.Now().Format(time.RFC3339),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// PauseWorkerHandler обрабатывает POST /api/v1/admin/workers/{name}/pause
+func (h *Handlers) PauseWorkerHandler(w http.ResponseWriter, r *http.Request) {
+	h.controlWorker(w, r, "paused", func(ctx context.Context, name string) error { return h.workers.PauseWorker(ctx, name) })
+}
+
+// ResumeWorkerHandler обрабатывает POST /api/v1/admin/workers/{name}/resume
+func (h *Handlers) ResumeWorkerHandler(w http.ResponseWriter, r *http.Request) {
+	h.controlWorker(w, r, "resumed", func(ctx context.Context, name string) error { return h.workers.ResumeWorker(ctx, name) })
+}
+
+// TriggerWorkerHandler обрабатывает POST /api/v1/admin/workers/{name}/trigger — внеочередной запуск
+func (h *Handlers) TriggerWorkerHandler(w http.ResponseWriter, r *http.Request) {
+	h.controlWorker(w, r, "triggered", func(ctx context.Context, name string) error { return h.workers.TriggerWorker(ctx, name) })
+}
+
+// controlWorker выполняет действие над воркером из пути запроса и отвечает его итоговым статусом
+func (h *Handlers) controlWorker(w http.ResponseWriter, r *http.Request, action string, fn func(ctx context.Context, name string) error) {
+	if h.workers == nil {
+		h.writeErrorResponse(w, http.StatusNotFound, "Управление воркерами не настроено")
+		return
+	}
+
+	name := r.PathValue("name")
+	if err := fn(r.Context(), name); err != nil {
+		switch {
+		case errors.Is(err, domain.ErrWorkerNotFound):
+			h.writeErrorResponse(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, domain.ErrWorkerInactive):
+			h.writeErrorResponse(w, http.StatusConflict, err.Error())
+		default:
+			h.logger.ErrorContext(r.Context(), "Ошибка управления воркером", "worker", name, "error", err)
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Ошибка управления воркером")
+		}
+		return
+	}
+
+	h.logger.InfoContext(r.Context(), "Воркер изменен через админ API", "worker", name, "action", action)
+
+	resp := map[string]interface{}{
+		"worker":    name,
+		"status":    action,
+		"timestamp": time.Now().Format(time.RFC3339),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// ExportUserHandler обрабатывает GET /api/v1/admin/users/{id}/{login}/export —
+// выгрузку всех данных пользователя (стрим, payload, статусы прочтения, retention и архив)
+func (h *Handlers) ExportUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, login, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	export, err := h.repo.ExportUserData(r.Context(), userID, login)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Ошибка выгрузки данных пользователя", "error", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Ошибка выгрузки данных пользователя")
+		return
+	}
+
+	if h.archive != nil {
+		export.Archive, err = h.archive.ExportUser(r.Context(), userID, login)
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "Ошибка выгрузки архива пользователя", "error", err)
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Ошибка выгрузки архива пользователя")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(export)
+}
+
+// EraseUserHandler обрабатывает DELETE /api/v1/admin/users/{id}/{login}/export —
+// удаление всех данных пользователя с выдачей подписанной квитанции.
+// Архив очищается первым: при сбое Redis повторный запрос доудалит оставшееся
+func (h *Handlers) EraseUserHandler(w http.ResponseWriter, r *http.Request) {
+	if h.erasureSigner == nil {
+		h.writeErrorResponse(w, http.StatusServiceUnavailable, "Удаление данных отключено: не задан ERASURE_SIGNING_KEY")
+		return
+	}
+
+	userID, login, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	archiveRows, err := h.eraseArchive(r.Context(), userID, login)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Ошибка удаления архива пользователя", "error", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Ошибка удаления архива пользователя")
+		return
+	}
+
+	report, err := h.repo.EraseUserData(r.Context(), userID, login)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Ошибка удаления данных пользователя", "error", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Ошибка удаления данных пользователя")
+		return
+	}
+
+	// События, поставленные в очередь архива, пока удалялись данные в Redis
+	// (прочтения из открытых сессий), не должны вернуть строки пользователя
+	lateRows, err := h.eraseArchive(r.Context(), userID, login)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Ошибка удаления архива пользователя", "error", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Ошибка удаления архива пользователя")
+		return
+	}
+	report.ArchiveRowsDeleted = archiveRows + lateRows
+
+	receipt := h.erasureSigner.Issue(*report)
+	h.logger.InfoContext(r.Context(), "Удалены данные пользователя",
+		"user_id", userID,
+		"login", login,
+		"receipt_id", receipt.ReceiptID,
+		"keys", report.KeysDeleted,
+		"payloads", report.PayloadsDeleted,
+		"archive_rows", report.ArchiveRowsDeleted)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(receipt)
+}
+
+// eraseArchive дописывает очередь архива и удаляет из него строки пользователя
+func (h *Handlers) eraseArchive(ctx context.Context, userID int64, login string) (int64, error) {
+	if h.archive == nil {
+		return 0, nil
+	}
+	if h.archiveQueue != nil {
+		if err := h.archiveQueue.Flush(ctx); err != nil {
+			return 0, fmt.Errorf("ошибка записи очереди архива: %w", err)
+		}
+	}
+	return h.archive.DeleteUser(ctx, userID, login)
+}
+
+// GetDigestHandler обрабатывает GET /api/v1/admin/users/{id}/{login}/digest — настройки сводки пользователя
+func (h *Handlers) GetDigestHandler(w http.ResponseWriter, r *http.Request) {
+	userID, login, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	pref, err := h.repo.GetDigestPreference(r.Context(), userID, login)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Ошибка чтения настроек сводки", "error", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Ошибка чтения настроек сводки")
+		return
+	}
+	if pref == nil {
+		pref = &domain.DigestPreference{Mode: domain.DigestOff}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(pref)
+}
+
+// SetDigestHandler обрабатывает PUT /api/v1/admin/users/{id}/{login}/digest — изменение настроек сводки
+func (h *Handlers) SetDigestHandler(w http.ResponseWriter, r *http.Request) {
+	userID, login, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var pref domain.DigestPreference
+	if err := json.NewDecoder(r.Body).Decode(&pref); err != nil {
+		h.writeErrorResponse(w, http.StatusBadRequest, "Неверный формат JSON")
+		return
+	}
+	if pref.Mode == "" {
+		pref.Mode = domain.DigestOff
+	}
+	if err := pref.Validate(); err != nil {
+		h.writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	saved, err := h.service.SetDigestPreference(r.Context(), userID, login, pref)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Ошибка сохранения настроек сводки", "error", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Ошибка сохранения настроек сводки")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(saved)
+}
+
+// GetWebhookHandler обрабатывает GET /api/v1/admin/users/{id}/{login}/webhook — регистрация webhook без секрета
+func (h *Handlers) GetWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	userID, login, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	hook, err := h.repo.GetWebhook(r.Context(), userID, login)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Ошибка чтения webhook", "error", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Ошибка чтения webhook")
+		return
+	}
+	if hook == nil {
+		h.writeErrorResponse(w, http.StatusNotFound, "Webhook не зарегистрирован")
+		return
+	}
+	hook.Secret = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(hook)
+}
+
+// SetWebhookHandler обрабатывает PUT /api/v1/admin/users/{id}/{login}/webhook — регистрация webhook.
+// Ответ содержит секрет подписи (сгенерированный, если он не передан)
+func (h *Handlers) SetWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	userID, login, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req domain.WebhookSetData
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeErrorResponse(w, http.StatusBadRequest, "Неверный формат JSON")
+		return
+	}
+	if err := domain.ValidateWebhookURL(req.URL); err != nil {
+		h.writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	hook, err := h.service.RegisterWebhook(r.Context(), userID, login, req.URL, req.Secret)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Ошибка сохранения webhook", "error", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Ошибка сохранения webhook")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(hook)
+}
+
+// DeleteWebhookHandler обрабатывает DELETE /api/v1/admin/users/{id}/{login}/webhook — удаление регистрации
+func (h *Handlers) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	userID, login, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := h.service.RegisterWebhook(r.Context(), userID, login, "", ""); err != nil {
+		h.logger.ErrorContext(r.Context(), "Ошибка удаления webhook", "error", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Ошибка удаления webhook")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetSettingsHandler обрабатывает GET /api/v1/admin/users/{id}/{login}/settings — настройки уведомлений
+func (h *Handlers) GetSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, login, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	prefs, err := h.repo.GetPreferences(r.Context(), userID, login)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Ошибка чтения настроек уведомлений", "error", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Ошибка чтения настроек уведомлений")
+		return
+	}
+	if prefs == nil {
+		prefs = &domain.Preferences{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(prefs)
+}
+
+// SetSettingsHandler обрабатывает PUT /api/v1/admin/users/{id}/{login}/settings — замена настроек уведомлений
+func (h *Handlers) SetSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, login, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var prefs domain.Preferences
+	if err := json.NewDecoder(r.Body).Decode(&prefs); err != nil {
+		h.writeErrorResponse(w, http.StatusBadRequest, "Неверный формат JSON")
+		return
+	}
+	if err := prefs.Validate(); err != nil {
+		h.writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	saved, err := h.service.SetPreferences(r.Context(), userID, login, prefs)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Ошибка сохранения настроек уведомлений", "error", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Ошибка сохранения настроек уведомлений")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(saved)
+}
+
+// GetTopicsHandler обрабатывает GET /api/v1/admin/users/{id}/{login}/topics — темы пользователя
+func (h *Handlers) GetTopicsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, login, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	topics, err := h.repo.GetSubscriptions(r.Context(), userID, login)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Ошибка чтения подписок", "error", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Ошибка чтения подписок")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(domain.TopicsData{Topics: topics})
+}
+
+// SubscribeTopicHandler обрабатывает PUT /api/v1/admin/users/{id}/{login}/topics/{topic} — подписка на тему
+func (h *Handlers) SubscribeTopicHandler(w http.ResponseWriter, r *http.Request) {
+	h.changeSubscription(w, r, h.service.SubscribeTopic)
+}
+
+// UnsubscribeTopicHandler обрабатывает DELETE /api/v1/admin/users/{id}/{login}/topics/{topic} — отписка от темы
+func (h *Handlers) UnsubscribeTopicHandler(w http.ResponseWriter, r *http.Request) {
+	h.changeSubscription(w, r, h.service.UnsubscribeTopic)
+}
+
+// changeSubscription выполняет подписку или отписку и отвечает списком тем пользователя
+func (h *Handlers) changeSubscription(
+	w http.ResponseWriter,
+	r *http.Request,
+	change func(ctx context.Context, userID int64, login string, topic string) ([]string, error),
+) {
+	userID, login, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+	topic := r.PathValue("topic")
+	if err := domain.ValidateTopic(topic); err != nil {
+		h.writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	topics, err := change(r.Context(), userID, login, topic)
+	if errors.Is(err, domain.ErrTooManyTopics) {
+		h.writeErrorResponse(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Ошибка изменения подписки", "error", err, "topic", topic)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Ошибка изменения подписки")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(domain.TopicsData{Topics: topics})
+}
+
+// userFromPath разбирает {id} и {login} из пути запроса, при ошибке отвечает 400
+func (h *Handlers) userFromPath(w http.ResponseWriter, r *http.Request) (int64, string, bool) {
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		h.writeErrorResponse(w, http.StatusBadRequest, "Неверный формат id пользователя")
+		return 0, "", false
+	}
+	login := r.PathValue("login")
+	if login == "" {
+		h.writeErrorResponse(w, http.StatusBadRequest, "Требуется login пользователя")
+		return 0, "", false
+	}
+	return userID, login, true
+}
+
+// archivedHistoryItem приводит запись архива к формату элемента истории
+func archivedHistoryItem(a domain.ArchivedNotification) map[string]interface{} {
+	return map[string]interface{}{
+		"id": a.StreamID,
+		"payload": domain.NotificationPayload{
+			NotificationID: a.NotificationID,
+			Message:        a.Message,
+			CreatedAt:      a.CreatedAt,
+			Source:         a.Source,
+			Target:         a.Target,
+		},
+		"read":   a.ReadAt != nil,
+		"status": domain.StatusArchived,
+	}
+}
+
+// parseBefore разбирает необязательный параметр before в формате RFC3339
+func parseBefore(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
 // AvailableUsersHandler возвращает список пользователей доступных для отправки
 func (h *Handlers) AvailableUsersHandler(w http.ResponseWriter, r *http.Request) {
 	users := h.connectionManager.GetUniqueUsers()
@@ -338,7 +929,7 @@ func (h *Handlers) AvailableUsersHandler(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusOK)
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		h.logger.Error("Ошибка кодирования ответа available users", "error", err)
+		h.logger.ErrorContext(r.Context(), "Ошибка кодирования ответа available users", "error", err)
 	}
 }
 
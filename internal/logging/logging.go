@@ -0,0 +1,75 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Options задает параметры логгера
+type Options struct {
+	Level  string // debug | info | warn | error
+	Format string // text | json
+	Redact string // off | mask | strict
+}
+
+// New создает логгер с заданным уровнем, форматом и политикой маскирования
+func New(w io.Writer, opts Options) *slog.Logger {
+	handlerOpts := &slog.HandlerOptions{Level: ParseLevel(opts.Level)}
+
+	var h slog.Handler
+	if strings.EqualFold(opts.Format, "json") {
+		h = slog.NewJSONHandler(w, handlerOpts)
+	} else {
+		h = slog.NewTextHandler(w, handlerOpts)
+	}
+
+	h = NewRedactHandler(h, ParsePolicy(opts.Redact))
+	h = &contextHandler{next: h}
+
+	return slog.New(h)
+}
+
+// ParseLevel разбирает уровень логирования (по умолчанию info)
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// contextHandler добавляет в каждую запись request_id и trace_id из контекста
+type contextHandler struct {
+	next slog.Handler
+}
+
+func (h *contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		if id := RequestID(ctx); id != "" {
+			record.AddAttrs(slog.String("request_id", id))
+		}
+		if id := TraceID(ctx); id != "" {
+			record.AddAttrs(slog.String("trace_id", id))
+		}
+	}
+	return h.next.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{next: h.next.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{next: h.next.WithGroup(name)}
+}
@@ -0,0 +1,183 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// Policy определяет, как маскируются персональные данные в логах
+type Policy int
+
+const (
+	// PolicyOff — данные пишутся как есть (только для локальной отладки)
+	PolicyOff Policy = iota
+	// PolicyMask — логины частично маскируются, тексты сообщений заменяются длиной
+	PolicyMask
+	// PolicyStrict — логины и тексты полностью скрываются
+	PolicyStrict
+)
+
+// ParsePolicy разбирает политику маскирования (по умолчанию mask)
+func ParsePolicy(s string) Policy {
+	switch strings.ToLower(s) {
+	case "off", "none":
+		return PolicyOff
+	case "strict":
+		return PolicyStrict
+	default:
+		return PolicyMask
+	}
+}
+
+// Ключи атрибутов, содержащие логины пользователей
+var loginKeys = map[string]bool{
+	"login":        true,
+	"target_login": true,
+}
+
+// Ключи атрибутов в формате "id-login"
+var userKeyKeys = map[string]bool{
+	"user":     true,
+	"user_key": true,
+	"userKey":  true,
+}
+
+// Ключи атрибутов в формате "notification_id:user_key" (member индексов эскалаций, каналов, отложенных)
+var memberKeys = map[string]bool{
+	"member": true,
+}
+
+// Ключи атрибутов с URL, в пути и параметрах которых могут быть секреты (webhook)
+var urlKeys = map[string]bool{
+	"url":         true,
+	"webhook_url": true,
+}
+
+// Ключи атрибутов, содержащие тексты и полезную нагрузку уведомлений
+var bodyKeys = map[string]bool{
+	"message": true,
+	"payload": true,
+	"body":    true,
+}
+
+// RedactHandler маскирует логины и тексты уведомлений перед записью
+type RedactHandler struct {
+	next   slog.Handler
+	policy Policy
+}
+
+// NewRedactHandler оборачивает обработчик маскированием по политике
+func NewRedactHandler(next slog.Handler, policy Policy) slog.Handler {
+	if policy == PolicyOff {
+		return next
+	}
+	return &RedactHandler{next: next, policy: policy}
+}
+
+func (h *RedactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *RedactHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(h.redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h *RedactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		out[i] = h.redactAttr(a)
+	}
+	return &RedactHandler{next: h.next.WithAttrs(out), policy: h.policy}
+}
+
+func (h *RedactHandler) WithGroup(name string) slog.Handler {
+	return &RedactHandler{next: h.next.WithGroup(name), policy: h.policy}
+}
+
+func (h *RedactHandler) redactAttr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+
+	if a.Value.Kind() == slog.KindGroup {
+		group := a.Value.Group()
+		out := make([]slog.Attr, len(group))
+		for i, ga := range group {
+			out[i] = h.redactAttr(ga)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(out...)}
+	}
+
+	switch {
+	case loginKeys[a.Key]:
+		return slog.String(a.Key, h.maskLogin(a.Value.String()))
+	case userKeyKeys[a.Key]:
+		return slog.String(a.Key, h.maskUserKey(a.Value.String()))
+	case memberKeys[a.Key]:
+		return slog.String(a.Key, h.maskMember(a.Value.String()))
+	case urlKeys[a.Key]:
+		return slog.String(a.Key, h.maskURL(a.Value.String()))
+	case bodyKeys[a.Key]:
+		return slog.String(a.Key, h.maskBody(a.Value))
+	}
+
+	return a
+}
+
+// maskLogin оставляет первый символ логина: "alice" -> "a***"
+func (h *RedactHandler) maskLogin(login string) string {
+	if login == "" {
+		return login
+	}
+	if h.policy == PolicyStrict {
+		return "***"
+	}
+	r, _ := utf8.DecodeRuneInString(login)
+	return string(r) + "***"
+}
+
+// maskUserKey маскирует логин в ключе "id-login", сохраняя ID для корреляции
+func (h *RedactHandler) maskUserKey(userKey string) string {
+	id, login, ok := strings.Cut(userKey, "-")
+	if !ok {
+		return h.maskLogin(userKey)
+	}
+	return id + "-" + h.maskLogin(login)
+}
+
+// maskMember маскирует user key в member индекса, сохраняя notification_id.
+// Member без разделителя маскируется целиком, как логин
+func (h *RedactHandler) maskMember(member string) string {
+	nid, userKey, ok := strings.Cut(member, ":")
+	if !ok {
+		return h.maskLogin(member)
+	}
+	return nid + ":" + h.maskUserKey(userKey)
+}
+
+// maskURL оставляет схему и хост: путь, параметры и userinfo могут содержать токены
+func (h *RedactHandler) maskURL(raw string) string {
+	if raw == "" {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if h.policy == PolicyStrict || err != nil || u.Host == "" {
+		return "[REDACTED]"
+	}
+	return u.Scheme + "://" + u.Host + "/[REDACTED]"
+}
+
+// maskBody заменяет текст сообщения его длиной
+func (h *RedactHandler) maskBody(v slog.Value) string {
+	if h.policy == PolicyStrict {
+		return "[REDACTED]"
+	}
+	return fmt.Sprintf("[REDACTED len=%d]", utf8.RuneCountInString(v.String()))
+}
@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestRedactHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		attr   slog.Attr
+		want   string
+	}{
+		{"логин mask", PolicyMask, slog.String("login", "alice"), "a***"},
+		{"логин strict", PolicyStrict, slog.String("login", "alice"), "***"},
+		{"user key", PolicyMask, slog.String("user", "42-alice"), "42-a***"},
+		{"текст", PolicyMask, slog.String("message", "привет"), "[REDACTED len=6]"},
+		{"текст strict", PolicyStrict, slog.String("message", "привет"), "[REDACTED]"},
+		{"member", PolicyMask, slog.String("member", "nid-1:42-alice"), "nid-1:42-a***"},
+		{"member без разделителя", PolicyMask, slog.String("member", "alice"), "a***"},
+		{"url", PolicyMask, slog.String("url", "https://user:pw@hooks.example.com/t/SECRET?k=v"), "https://hooks.example.com/[REDACTED]"},
+		{"url strict", PolicyStrict, slog.String("url", "https://hooks.example.com/t/SECRET"), "[REDACTED]"},
+		{"url без хоста", PolicyMask, slog.String("url", "SECRET"), "[REDACTED]"},
+		{"прочие атрибуты", PolicyStrict, slog.String("notification_id", "nid-1"), "nid-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(NewRedactHandler(slog.NewJSONHandler(&buf, nil), tt.policy))
+			logger.Info("test", tt.attr)
+
+			var out map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+				t.Fatalf("ошибка разбора лога: %v", err)
+			}
+			if got := out[tt.attr.Key]; got != tt.want {
+				t.Fatalf("%s = %v, ожидалось %q", tt.attr.Key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactHandlerGroupsAndWith(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewRedactHandler(slog.NewJSONHandler(&buf, nil), PolicyMask)).
+		With("login", "bob").
+		WithGroup("req")
+	logger.Info("test", slog.Group("hook", slog.String("url", "https://h.example.com/secret")))
+
+	var out struct {
+		Login string `json:"login"`
+		Req   struct {
+			Hook struct {
+				URL string `json:"url"`
+			} `json:"hook"`
+		} `json:"req"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatalf("ошибка разбора лога: %v", err)
+	}
+	if out.Login != "b***" {
+		t.Fatalf("login = %q", out.Login)
+	}
+	if out.Req.Hook.URL != "https://h.example.com/[REDACTED]" {
+		t.Fatalf("url = %q", out.Req.Hook.URL)
+	}
+}
@@ -20,6 +20,21 @@ var (
 		Help: "Количество подтверждений уведомлений (client->server)",
 	})
 
+	InboxDroppedUnread = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_inbox_dropped_unread_total",
+		Help: "Количество непрочитанных уведомлений, вытесненных из стрима при переполнении",
+	})
+
+	InboxRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_inbox_rejected_total",
+		Help: "Количество уведомлений, отклоненных из-за заполненного стрима получателя",
+	})
+
+	AcksRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_acks_rejected_total",
+		Help: "Количество ACK, отклоненных из-за неизвестной или несовпадающей записи стрима",
+	})
+
 	NotificationsAutoCleared = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "notif_messages_autocleared_total",
 		Help: "Количество истёкших/автоочищенных уведомлений, отправленных клиенту",
@@ -41,10 +56,202 @@ var (
 		Help: "Количество сообщений, доставленных через межподовую шину",
 	})
 
+	BusRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_bus_retries_total",
+		Help: "Количество повторных попыток доставки сообщений шины",
+	})
+
+	BusNoSession = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_bus_no_session_total",
+		Help: "Количество сообщений шины для пользователей без сессии на этом pod (подтверждаются без повтора)",
+	})
+
+	BusDeadLettered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "notif_bus_dead_lettered_total",
+		Help: "Количество сообщений шины, перенесенных в dead-letter стрим, по причине",
+	}, []string{"reason"})
+
+	BusStreamsRemoved = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_bus_streams_removed_total",
+		Help: "Количество удаленных стримов шины выбывших pod",
+	})
+
+	PodTakeovers = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_pod_takeovers_total",
+		Help: "Количество выбывших pod, сессии которых переданы другим pod",
+	})
+
+	PodTakeoverLocks = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_pod_takeover_locks_released_total",
+		Help: "Количество consumer lock, снятых при передаче сессий выбывших pod",
+	})
+
+	BusPending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "notif_bus_pending",
+		Help: "Размер PEL группы роутера шины этого pod (недоставленные сообщения)",
+	})
+
+	BusLag = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "notif_bus_lag",
+		Help: "Количество непрочитанных сообщений в стриме шины этого pod",
+	})
+
+	BusOldestPending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "notif_bus_oldest_pending_seconds",
+		Help: "Возраст самого старого недоставленного сообщения шины этого pod",
+	})
+
+	BusDeadLetterSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "notif_bus_dead_letter_size",
+		Help: "Длина dead-letter стрима шины",
+	})
+
+	ExpiredByEvent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_expired_by_event_total",
+		Help: "Количество записей, удаленных по событию истечения payload (keyspace notifications)",
+	})
+
 	TTLCleaned = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "notif_ttl_cleaned_total",
 		Help: "Количество записей, удалённых TTL-джанитором",
 	})
+
+	StateFieldsRemoved = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_state_fields_removed_total",
+		Help: "Количество статусов прочтения, удаленных сборкой мусора",
+	})
+
+	StateHashFields = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "notif_state_hash_fields",
+		Help:    "Размер хэша статусов прочтения пользователя после сборки мусора",
+		Buckets: []float64{0, 10, 50, 100, 250, 500, 1000, 5000, 10000},
+	})
+
+	PayloadsReencrypted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_payloads_reencrypted_total",
+		Help: "Количество значений, перешифрованных активным ключом",
+	})
+
+	PayloadCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_payload_cache_hits_total",
+		Help: "Количество payload, найденных в локальном кэше",
+	})
+
+	PayloadCacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_payload_cache_misses_total",
+		Help: "Количество payload, загруженных из Redis из-за промаха кэша",
+	})
+
+	PayloadCacheSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "notif_payload_cache_entries",
+		Help: "Текущее число записей в локальном кэше payload",
+	})
+
+	ArchiveWritten = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_archive_written_total",
+		Help: "Количество событий, записанных в долговременный архив",
+	})
+
+	ArchiveDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_archive_dropped_total",
+		Help: "Количество событий архива, отброшенных из-за переполнения очереди или ошибок записи",
+	})
+
+	StorageReadRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_storage_read_retries_total",
+		Help: "Количество повторов чтения новых сообщений после временной недоступности хранилища",
+	})
+
+	WorkerLeader = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "notif_worker_leader",
+		Help: "1, если этот pod сейчас выполняет singleton-воркер",
+	}, []string{"worker"})
+
+	WorkerRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "notif_worker_runs_total",
+		Help: "Количество итераций фоновых воркеров по результату (ok, error)",
+	}, []string{"worker", "result"})
+
+	WorkerRunDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "notif_worker_run_duration_seconds",
+		Help:    "Длительность итерации фонового воркера",
+		Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 120},
+	}, []string{"worker"})
+
+	WorkerLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "notif_worker_last_success_timestamp_seconds",
+		Help: "Время последней успешной итерации фонового воркера (unix)",
+	}, []string{"worker"})
+
+	WorkerPaused = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "notif_worker_paused",
+		Help: "1, если плановые запуски воркера приостановлены на этом pod",
+	}, []string{"worker"})
+
+	ShardPods = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "notif_shard_pods",
+		Help: "Число pod в кольце шардирования обслуживающих воркеров",
+	})
+
+	LeaderAcquired = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "notif_worker_leader_acquired_total",
+		Help: "Количество захватов лиза singleton-воркера этим pod",
+	}, []string{"worker"})
+
+	DigestsSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_digests_sent_total",
+		Help: "Количество отправленных сводок непрочитанных уведомлений",
+	})
+
+	DigestItems = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_digest_items_total",
+		Help: "Количество уведомлений, вошедших в сводки",
+	})
+
+	DigestMarked = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_digest_marked_total",
+		Help: "Количество уведомлений, помеченных статусом digested",
+	})
+
+	EscalationSteps = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "notif_escalation_steps_total",
+		Help: "Количество выполненных шагов эскалации по действию",
+	}, []string{"action"})
+
+	EscalationsCancelled = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_escalations_cancelled_total",
+		Help: "Количество эскалаций, отмененных воркером из-за прочтения уведомления",
+	})
+
+	ChannelDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "notif_channel_deliveries_total",
+		Help: "Количество попыток доставки внешними каналами по каналу и результату",
+	}, []string{"channel", "result"})
+
+	ChannelDeliveriesDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_channel_deliveries_dropped_total",
+		Help: "Количество доставок каналами, прекращенных после всех попыток",
+	})
+
+	NotificationsMuted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_notifications_muted_total",
+		Help: "Количество уведомлений, не созданных из-за заглушенного получателем источника",
+	})
+
+	NotificationsDeferred = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_notifications_deferred_total",
+		Help: "Количество уведомлений, отложенных до конца тихих часов или режима «не беспокоить»",
+	})
+
+	DeferredReleased = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_deferred_released_total",
+		Help: "Количество отложенных уведомлений, выпущенных получателю",
+	})
+
+	TopicRecipients = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notif_topic_recipients_total",
+		Help: "Количество получателей, добавленных в рассылки из подписок на темы",
+	})
 )
 
 func init() {
@@ -52,10 +259,51 @@ func init() {
 		WSConnections,
 		NotificationsSent,
 		NotificationsAcked,
+		AcksRejected,
+		InboxDroppedUnread,
+		InboxRejected,
 		NotificationsAutoCleared,
 		DeliveryLatencyMs,
 		ReclaimedMessages,
 		BusDelivered,
+		BusRetries,
+		BusNoSession,
+		BusDeadLettered,
+		BusStreamsRemoved,
+		PodTakeovers,
+		PodTakeoverLocks,
+		BusPending,
+		BusLag,
+		BusOldestPending,
+		BusDeadLetterSize,
 		TTLCleaned,
+		ExpiredByEvent,
+		StateFieldsRemoved,
+		StateHashFields,
+		PayloadsReencrypted,
+		PayloadCacheHits,
+		PayloadCacheMisses,
+		PayloadCacheSize,
+		ArchiveWritten,
+		ArchiveDropped,
+		StorageReadRetries,
+		WorkerLeader,
+		LeaderAcquired,
+		ShardPods,
+		WorkerRuns,
+		WorkerRunDuration,
+		WorkerLastSuccess,
+		WorkerPaused,
+		DigestsSent,
+		DigestItems,
+		DigestMarked,
+		EscalationSteps,
+		EscalationsCancelled,
+		ChannelDeliveries,
+		ChannelDeliveriesDropped,
+		NotificationsMuted,
+		NotificationsDeferred,
+		DeferredReleased,
+		TopicRecipients,
 	)
 }
@@ -0,0 +1,95 @@
+package redisclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"notification-mvp/internal/config"
+	"notification-mvp/internal/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// KeyLayout разбирает схему имен ключей из конфигурации и проверяет, что она подходит
+// для режима подключения: Cluster требует ключей с хэш-тегами. Схему применяет main
+// через domain.SetKeyLayout один раз при старте
+func KeyLayout(cfg *config.Config) (domain.KeyLayout, error) {
+	layout, err := domain.ParseKeyLayout(cfg.RedisKeyLayout)
+	if err != nil {
+		return layout, err
+	}
+	if cfg.RedisCluster && layout != domain.KeyLayoutHashTag {
+		return layout, fmt.Errorf("для Redis Cluster требуется REDIS_KEY_LAYOUT=hashtag (перенос ключей: cmd/keymigrate)")
+	}
+	return layout, nil
+}
+
+// New создает клиент Redis по конфигурации: одиночный узел, Sentinel (failover) или Redis Cluster.
+// Схему имен ключей клиент не меняет: она общая для процесса и задается в main
+func New(cfg *config.Config) (redis.UniversalClient, error) {
+	if _, err := KeyLayout(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.RedisCluster && cfg.RedisSentinelMaster != "" {
+		return nil, fmt.Errorf("REDIS_CLUSTER и REDIS_SENTINEL_MASTER нельзя включать одновременно")
+	}
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := cfg.RedisAddrs
+	if cfg.RedisSentinelMaster != "" && len(cfg.RedisSentinelAddrs) > 0 {
+		addrs = cfg.RedisSentinelAddrs
+	}
+
+	return redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs:            addrs,
+		Username:         cfg.RedisUsername,
+		Password:         cfg.RedisPassword,
+		DB:               cfg.RedisDB,
+		IsClusterMode:    cfg.RedisCluster,
+		MasterName:       cfg.RedisSentinelMaster,
+		SentinelUsername: cfg.RedisSentinelUsername,
+		SentinelPassword: cfg.RedisSentinelPassword,
+		TLSConfig:        tlsConfig,
+	}), nil
+}
+
+// newTLSConfig собирает настройки TLS; nil означает подключение без TLS
+func newTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	if !cfg.RedisTLS {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.RedisTLSServerName,
+		InsecureSkipVerify: cfg.RedisTLSInsecure, // только для отладки
+	}
+
+	if cfg.RedisTLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.RedisTLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения CA сертификата Redis: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("в файле %s нет PEM сертификатов", cfg.RedisTLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.RedisTLSCertFile != "" || cfg.RedisTLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.RedisTLSCertFile, cfg.RedisTLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка загрузки клиентского сертификата Redis: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,49 @@
+package redisclient
+
+import (
+	"testing"
+
+	"notification-mvp/internal/config"
+	"notification-mvp/internal/domain"
+)
+
+func TestKeyLayout(t *testing.T) {
+	tests := []struct {
+		name    string
+		layout  string
+		cluster bool
+		want    domain.KeyLayout
+		wantErr bool
+	}{
+		{"по умолчанию", "", false, domain.KeyLayoutLegacy, false},
+		{"hashtag", "hashtag", false, domain.KeyLayoutHashTag, false},
+		{"cluster с hashtag", "hashtag", true, domain.KeyLayoutHashTag, false},
+		{"cluster с legacy", "legacy", true, domain.KeyLayoutLegacy, true},
+		{"неизвестная схема", "flat", false, domain.KeyLayoutLegacy, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := KeyLayout(&config.Config{RedisKeyLayout: tt.layout, RedisCluster: tt.cluster})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ошибка %v, ожидалась: %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Fatalf("схема %v, ожидалась %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewDoesNotChangeKeyLayout(t *testing.T) {
+	before := domain.CurrentKeyLayout()
+	for _, layout := range []string{"legacy", "hashtag"} {
+		rdb, err := New(&config.Config{RedisAddrs: []string{"127.0.0.1:0"}, RedisKeyLayout: layout})
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		_ = rdb.Close()
+		if domain.CurrentKeyLayout() != before {
+			t.Fatalf("New(%s) изменил схему ключей процесса", layout)
+		}
+	}
+}
@@ -4,8 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"strconv"
-	"strings"
+	"time"
 
 	"notification-mvp/internal/domain"
 )
@@ -23,7 +22,8 @@ func (r *RedisRepository) GetPendingNotifications(
 // GetAllPendingNotifications получает pending уведомления для всех пользователей
 func (r *RedisRepository) GetAllPendingNotifications(ctx context.Context) (map[string][]domain.StreamMessage, error) {
 	// Получаем все пользовательские ключи
-	userKeys, err := r.GetAllUserKeys(ctx)
+	// Pending сообщения остаются только у пользователей, активных в пределах окна TTL
+	userKeys, err := r.GetActiveUserKeys(ctx, time.Now().Add(-domain.PendingActivityWindow), 0, 0)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка получения пользовательских ключей: %w", err)
 	}
@@ -32,16 +32,16 @@ func (r *RedisRepository) GetAllPendingNotifications(ctx context.Context) (map[s
 
 	for _, userKey := range userKeys {
 		// Парсим userKey для получения ID и логина
-		userID, login, err := parseUserKey(userKey)
+		userID, login, err := domain.ParseUserKey(userKey)
 		if err != nil {
-			slog.Warn("Ошибка парсинга user key", "user_key", userKey, "error", err)
+			slog.WarnContext(ctx, "Ошибка парсинга user key", "user_key", userKey, "error", err)
 			continue
 		}
 
 		// Получаем pending уведомления для пользователя
 		pendingMessages, err := r.GetPendingNotifications(ctx, userID, login)
 		if err != nil {
-			slog.Warn("Ошибка получения pending уведомлений",
+			slog.WarnContext(ctx, "Ошибка получения pending уведомлений",
 				"user_id", userID, "login", login, "error", err)
 			continue
 		}
@@ -53,18 +53,3 @@ func (r *RedisRepository) GetAllPendingNotifications(ctx context.Context) (map[s
 
 	return result, nil
 }
-
-// parseUserKey парсит user key в формате "id-login" (вспомогательная функция)
-func parseUserKey(userKey string) (int64, string, error) {
-	parts := strings.SplitN(userKey, "-", 2)
-	if len(parts) != 2 {
-		return 0, "", fmt.Errorf("неверный формат user key: %s", userKey)
-	}
-
-	userID, err := strconv.ParseInt(parts[0], 10, 64)
-	if err != nil {
-		return 0, "", fmt.Errorf("ошибка парсинга user ID: %w", err)
-	}
-
-	return userID, parts[1], nil
-}
@@ -0,0 +1,622 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"notification-mvp/internal/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// BackupFormatVersion — версия формата резервной копии (одна строка JSONL на пользователя)
+const BackupFormatVersion = 1
+
+// UserBackup содержит все данные одного пользователя. Payload и статусы хранятся расшифрованными,
+// чтобы копию можно было восстановить в Redis с другой схемой ключей или другими ключами шифрования
+type UserBackup struct {
+	Version       int                 `json:"version"`
+	User          domain.Target       `json:"user"`
+	Stream        []BackupStreamEntry `json:"stream"`
+	Group         *BackupGroup        `json:"group,omitempty"`
+	Payloads      []BackupPayload     `json:"payloads"`
+	TTL           []BackupScheduled   `json:"ttl"`
+	States        map[string]string   `json:"states"`
+	RetentionDays int                 `json:"retention_days,omitempty"` // 0 — срок по умолчанию
+	ActiveAt      int64               `json:"active_at,omitempty"`      // unix сек, из индекса активных
+}
+
+// BackupStreamEntry — запись стрима пользователя
+type BackupStreamEntry struct {
+	ID     string                 `json:"id"`
+	Fields map[string]interface{} `json:"fields"`
+}
+
+// BackupGroup — смещение consumer group и ее PEL
+type BackupGroup struct {
+	LastDeliveredID string          `json:"last_delivered_id"`
+	Pending         []BackupPending `json:"pending,omitempty"`
+}
+
+// BackupPending — неподтвержденная запись PEL
+type BackupPending struct {
+	ID         string `json:"id"`
+	Consumer   string `json:"consumer"`
+	RetryCount int64  `json:"retry_count"`
+}
+
+// BackupPayload — payload уведомления с абсолютным временем истечения
+type BackupPayload struct {
+	NotificationID string          `json:"notification_id"`
+	Data           json.RawMessage `json:"data"`
+	ExpiresAt      int64           `json:"expires_at"` // unix мс
+}
+
+// BackupScheduled — запись планировщика TTL
+type BackupScheduled struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// BackupTrailer — завершающая строка архива с итогами копирования. Архив без нее
+// или с несовпадающими итогами считается обрезанным
+type BackupTrailer struct {
+	Version int         `json:"version"`
+	End     bool        `json:"end"`
+	Stats   BackupStats `json:"stats"`
+}
+
+// ErrBackupCorrupt возвращается для поврежденного или неполного архива
+var ErrBackupCorrupt = errors.New("архив поврежден или неполон")
+
+// BackupStats содержит итоги резервного копирования или восстановления
+type BackupStats struct {
+	Users    int `json:"users"`
+	Entries  int `json:"entries"`
+	Payloads int `json:"payloads"`
+	Skipped  int `json:"skipped"`
+}
+
+// Префиксы ключей, по которым ищутся пользователи для резервной копии
+var backupUserKeyPrefixes = []string{
+	domain.StreamKeyPrefix,
+	domain.TTLSchedulerKeyPrefix,
+	domain.NotificationStateKeyPrefix,
+	domain.RetentionKeyPrefix,
+}
+
+// Backup обходит всех пользователей текущей схемы ключей и передает их данные в fn
+func (r *RedisRepository) Backup(ctx context.Context, fn func(*UserBackup) error) (BackupStats, error) {
+	var stats BackupStats
+
+	userKeys, err := r.backupUserKeys(ctx)
+	if err != nil {
+		return stats, err
+	}
+
+	for _, userKey := range userKeys {
+		userID, login, err := domain.ParseUserKey(userKey)
+		if err != nil {
+			slog.WarnContext(ctx, "Ошибка парсинга user key", "user_key", userKey, "error", err)
+			stats.Skipped++
+			continue
+		}
+
+		b, err := r.backupUser(ctx, userID, login)
+		if err != nil {
+			return stats, err
+		}
+		if err := fn(b); err != nil {
+			return stats, err
+		}
+		stats.Users++
+		stats.Entries += len(b.Stream)
+		stats.Payloads += len(b.Payloads)
+
+		select {
+		case <-ctx.Done():
+			return stats, ctx.Err()
+		default:
+		}
+	}
+
+	return stats, nil
+}
+
+// WriteBackup пишет архив JSONL: по строке на пользователя и завершающую строку с итогами
+func (r *RedisRepository) WriteBackup(ctx context.Context, w io.Writer) (BackupStats, error) {
+	buf := bufio.NewWriter(w)
+	enc := json.NewEncoder(buf)
+	stats, err := r.Backup(ctx, func(b *UserBackup) error {
+		if err := enc.Encode(b); err != nil {
+			return fmt.Errorf("ошибка записи архива: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	if err := enc.Encode(BackupTrailer{Version: BackupFormatVersion, End: true, Stats: stats}); err != nil {
+		return stats, fmt.Errorf("ошибка записи архива: %w", err)
+	}
+	if err := buf.Flush(); err != nil {
+		return stats, fmt.Errorf("ошибка записи архива: %w", err)
+	}
+	return stats, nil
+}
+
+// RestoreBackup восстанавливает пользователей из архива, записанного WriteBackup. Архив сначала
+// проверяется целиком, чтобы поврежденная или обрезанная копия не восстановилась частично.
+// Пользователи с существующим стримом пропускаются
+func (r *RedisRepository) RestoreBackup(ctx context.Context, src io.ReadSeeker) (BackupStats, error) {
+	if _, err := readBackup(src, func(*UserBackup) error { return nil }); err != nil {
+		return BackupStats{}, err
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return BackupStats{}, fmt.Errorf("ошибка чтения архива: %w", err)
+	}
+
+	var stats BackupStats
+	_, err := readBackup(src, func(b *UserBackup) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		restored, err := r.Restore(ctx, b)
+		if err != nil {
+			return fmt.Errorf("пользователь %d-%s: %w", b.User.ID, b.User.Login, err)
+		}
+		if !restored {
+			stats.Skipped++
+			return nil
+		}
+		stats.Users++
+		stats.Entries += len(b.Stream)
+		stats.Payloads += len(b.Payloads)
+		return nil
+	})
+	return stats, err
+}
+
+// readBackup разбирает архив, проверяя каждую строку и итоги завершающей строки, и передает пользователей в fn
+func readBackup(src io.Reader, fn func(*UserBackup) error) (BackupStats, error) {
+	var stats BackupStats
+	dec := json.NewDecoder(bufio.NewReader(src))
+	for line := 1; ; line++ {
+		var record struct {
+			UserBackup
+			End   bool        `json:"end"`
+			Stats BackupStats `json:"stats"`
+		}
+		if err := dec.Decode(&record); err == io.EOF {
+			return stats, fmt.Errorf("%w: нет завершающей строки", ErrBackupCorrupt)
+		} else if err != nil {
+			return stats, fmt.Errorf("%w: строка %d: %v", ErrBackupCorrupt, line, err)
+		}
+
+		if record.End {
+			if record.Version != BackupFormatVersion {
+				return stats, fmt.Errorf("%w: неподдерживаемая версия %d", ErrBackupCorrupt, record.Version)
+			}
+			if record.Stats.Users != stats.Users || record.Stats.Entries != stats.Entries ||
+				record.Stats.Payloads != stats.Payloads {
+				return stats, fmt.Errorf("%w: итоги %+v не совпадают с прочитанными %+v", ErrBackupCorrupt, record.Stats, stats)
+			}
+			if dec.More() {
+				return stats, fmt.Errorf("%w: данные после завершающей строки", ErrBackupCorrupt)
+			}
+			return stats, nil
+		}
+
+		b := &record.UserBackup
+		if err := b.Validate(); err != nil {
+			return stats, fmt.Errorf("%w: строка %d: %v", ErrBackupCorrupt, line, err)
+		}
+		if err := fn(b); err != nil {
+			return stats, err
+		}
+		stats.Users++
+		stats.Entries += len(b.Stream)
+		stats.Payloads += len(b.Payloads)
+	}
+}
+
+// Validate проверяет согласованность данных пользователя до записи в Redis
+func (b *UserBackup) Validate() error {
+	if b.Version != BackupFormatVersion {
+		return fmt.Errorf("неподдерживаемая версия резервной копии: %d", b.Version)
+	}
+	if b.User.ID <= 0 || b.User.Login == "" {
+		return fmt.Errorf("неверный пользователь: %+v", b.User)
+	}
+	for i, e := range b.Stream {
+		if _, _, err := domain.ParseStreamID(e.ID); err != nil {
+			return err
+		}
+		if i > 0 && streamIDNotAfter(e.ID, b.Stream[i-1].ID) {
+			return fmt.Errorf("записи стрима не упорядочены: %s после %s", e.ID, b.Stream[i-1].ID)
+		}
+		if nid, _ := e.Fields["nid"].(string); nid == "" {
+			return fmt.Errorf("запись стрима %s без nid", e.ID)
+		}
+	}
+	if b.Group != nil {
+		if _, _, err := domain.ParseStreamID(b.Group.LastDeliveredID); err != nil {
+			return fmt.Errorf("смещение consumer group: %w", err)
+		}
+	}
+	for _, p := range b.Payloads {
+		if p.NotificationID == "" || !json.Valid(p.Data) {
+			return fmt.Errorf("неверный payload уведомления %q", p.NotificationID)
+		}
+	}
+	for _, t := range b.TTL {
+		if _, nid, ok := strings.Cut(t.Member, "|"); !ok || nid == "" {
+			return fmt.Errorf("неверная запись планировщика TTL: %q", t.Member)
+		}
+	}
+	return nil
+}
+
+// backupUserKeys собирает пользователей, у которых есть ключи в текущей схеме
+func (r *RedisRepository) backupUserKeys(ctx context.Context) ([]string, error) {
+	hashTag := domain.CurrentKeyLayout() == domain.KeyLayoutHashTag
+	seen := make(map[string]bool)
+	var userKeys []string
+
+	for _, prefix := range backupUserKeyPrefixes {
+		err := r.scanKeys(ctx, prefix+"*", func(keys []string) error {
+			for _, key := range keys {
+				suffix := strings.TrimPrefix(key, prefix)
+				if strings.HasPrefix(suffix, "{") != hashTag {
+					continue // ключ другой схемы
+				}
+				userKey := domain.UserKeyFromTag(suffix)
+				if !seen[userKey] {
+					seen[userKey] = true
+					userKeys = append(userKeys, userKey)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(userKeys)
+	return userKeys, nil
+}
+
+// backupUser читает все данные пользователя
+func (r *RedisRepository) backupUser(ctx context.Context, userID int64, login string) (*UserBackup, error) {
+	streamKey := domain.StreamKey(userID, login)
+	stateKey := domain.NotificationStateKey(userID, login)
+
+	pipe := r.client.Pipeline()
+	entriesCmd := pipe.XRange(ctx, streamKey, "-", "+")
+	ttlCmd := pipe.ZRangeWithScores(ctx, domain.TTLSchedulerKey(userID, login), 0, -1)
+	statesCmd := pipe.HGetAll(ctx, stateKey)
+	retentionCmd := pipe.Get(ctx, domain.RetentionKey(userID, login))
+	activeCmd := pipe.ZScore(ctx, domain.ActiveUsersIndexKey, domain.UserKey(userID, login))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("ошибка чтения данных пользователя: %w", err)
+	}
+
+	b := &UserBackup{
+		Version:  BackupFormatVersion,
+		User:     domain.Target{ID: userID, Login: login},
+		Stream:   []BackupStreamEntry{},
+		Payloads: []BackupPayload{},
+		TTL:      []BackupScheduled{},
+		States:   make(map[string]string),
+		ActiveAt: int64(activeCmd.Val()),
+	}
+	if days, err := strconv.Atoi(retentionCmd.Val()); err == nil {
+		b.RetentionDays = days
+	}
+	for nid, value := range statesCmd.Val() {
+		if state := r.openState(stateKey, nid, value); state != "" {
+			b.States[nid] = state
+		}
+	}
+
+	var nids []string
+	seen := make(map[string]bool)
+	for _, e := range entriesCmd.Val() {
+		b.Stream = append(b.Stream, BackupStreamEntry{ID: e.ID, Fields: e.Values})
+		if nid, ok := e.Values["nid"].(string); ok && !seen[nid] {
+			seen[nid] = true
+			nids = append(nids, nid)
+		}
+	}
+	for _, z := range ttlCmd.Val() {
+		member, _ := z.Member.(string)
+		b.TTL = append(b.TTL, BackupScheduled{Member: member, Score: z.Score})
+		if _, nid, ok := strings.Cut(member, "|"); ok && !seen[nid] {
+			seen[nid] = true
+			nids = append(nids, nid)
+		}
+	}
+
+	if len(b.Stream) > 0 {
+		group, err := r.backupGroup(ctx, streamKey)
+		if err != nil {
+			return nil, err
+		}
+		b.Group = group
+	}
+
+	payloads, err := r.backupPayloads(ctx, userID, login, nids)
+	if err != nil {
+		return nil, err
+	}
+	b.Payloads = payloads
+	return b, nil
+}
+
+// backupGroup читает смещение consumer group уведомлений и ее PEL
+func (r *RedisRepository) backupGroup(ctx context.Context, streamKey string) (*BackupGroup, error) {
+	groups, err := r.client.XInfoGroups(ctx, streamKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения consumer group: %w", err)
+	}
+
+	for _, g := range groups {
+		if g.Name != domain.ConsumerGroupName {
+			continue
+		}
+		group := &BackupGroup{LastDeliveredID: g.LastDeliveredID}
+		if g.Pending == 0 {
+			return group, nil
+		}
+
+		pending, err := r.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: streamKey,
+			Group:  domain.ConsumerGroupName,
+			Start:  "-",
+			End:    "+",
+			Count:  g.Pending,
+		}).Result()
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения PEL: %w", err)
+		}
+		for _, p := range pending {
+			group.Pending = append(group.Pending, BackupPending{
+				ID:         p.ID,
+				Consumer:   p.Consumer,
+				RetryCount: p.RetryCount,
+			})
+		}
+		return group, nil
+	}
+	return nil, nil
+}
+
+// backupPayloads читает и расшифровывает payload вместе с оставшимся TTL
+func (r *RedisRepository) backupPayloads(
+	ctx context.Context,
+	userID int64,
+	login string,
+	nids []string,
+) ([]BackupPayload, error) {
+	out := []BackupPayload{}
+	if len(nids) == 0 {
+		return out, nil
+	}
+
+	gets := make([]*redis.StringCmd, len(nids))
+	ttls := make([]*redis.DurationCmd, len(nids))
+	pipe := r.client.Pipeline()
+	for i, nid := range nids {
+		key := domain.NotificationKey(userID, login, nid)
+		gets[i] = pipe.Get(ctx, key)
+		ttls[i] = pipe.PTTL(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("ошибка чтения payload: %w", err)
+	}
+
+	now := time.Now()
+	for i, nid := range nids {
+		value, err := gets[i].Result()
+		if err == redis.Nil {
+			continue // payload уже истек
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения payload: %w", err)
+		}
+		data, err := r.openPayload(domain.NotificationKey(userID, login, nid), value)
+		if err != nil {
+			return nil, err
+		}
+		ttl := ttls[i].Val()
+		if ttl <= 0 {
+			ttl = domain.NotificationTTL
+		}
+		out = append(out, BackupPayload{
+			NotificationID: nid,
+			Data:           data,
+			ExpiresAt:      now.Add(ttl).UnixMilli(),
+		})
+	}
+	return out, nil
+}
+
+// Restore восстанавливает данные пользователя из резервной копии в текущей схеме ключей.
+// Пользователь, у которого уже есть стрим, пропускается (false). Payload с истекшим сроком не восстанавливаются.
+// Счетчики доставок PEL сбрасываются: Redis не позволяет задать их при восстановлении
+func (r *RedisRepository) Restore(ctx context.Context, b *UserBackup) (bool, error) {
+	if err := b.Validate(); err != nil {
+		return false, err
+	}
+	userID, login := b.User.ID, b.User.Login
+	userKey := domain.UserKey(userID, login)
+	streamKey := domain.StreamKey(userID, login)
+
+	exists, err := r.client.Exists(ctx, streamKey).Result()
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки стрима: %w", err)
+	}
+	if exists > 0 {
+		return false, nil
+	}
+
+	now := time.Now()
+	for _, p := range b.Payloads {
+		ttl := time.UnixMilli(p.ExpiresAt).Sub(now)
+		if ttl <= 0 {
+			continue
+		}
+		key := domain.NotificationKey(userID, login, p.NotificationID)
+		sealed, err := r.sealPayload(key, p.Data)
+		if err != nil {
+			return false, err
+		}
+		if err := r.client.Set(ctx, key, sealed, ttl).Err(); err != nil {
+			return false, fmt.Errorf("ошибка записи payload: %w", err)
+		}
+	}
+
+	for _, e := range b.Stream {
+		if err := r.client.XAdd(ctx, &redis.XAddArgs{Stream: streamKey, ID: e.ID, Values: e.Fields}).Err(); err != nil {
+			return false, fmt.Errorf("ошибка записи стрима: %w", err)
+		}
+	}
+	if b.Group != nil {
+		if err := r.restoreGroup(ctx, userID, streamKey, b); err != nil {
+			return false, err
+		}
+	}
+
+	pipe := r.client.Pipeline()
+	if len(b.TTL) > 0 {
+		ttlKey := domain.TTLSchedulerKey(userID, login)
+		members := make([]redis.Z, 0, len(b.TTL))
+		next := b.TTL[0].Score
+		for _, t := range b.TTL {
+			members = append(members, redis.Z{Score: t.Score, Member: t.Member})
+			if t.Score < next {
+				next = t.Score
+			}
+		}
+		pipe.ZAdd(ctx, ttlKey, members...)
+		pipe.ZAddLT(ctx, domain.UserExpiryIndexKey, redis.Z{Score: next, Member: userKey})
+	}
+	if len(b.States) > 0 {
+		stateKey := domain.NotificationStateKey(userID, login)
+		values := make([]interface{}, 0, len(b.States)*2)
+		for nid, state := range b.States {
+			sealed, err := r.sealState(stateKey, nid, state)
+			if err != nil {
+				return false, err
+			}
+			values = append(values, nid, sealed)
+		}
+		pipe.HSet(ctx, stateKey, values...)
+	}
+	if b.RetentionDays > 0 {
+		pipe.Set(ctx, domain.RetentionKey(userID, login), b.RetentionDays, 0)
+	}
+	if len(b.Stream) > 0 {
+		activeAt := b.ActiveAt
+		if activeAt == 0 {
+			activeAt = now.Unix()
+		}
+		pipe.ZAddGT(ctx, domain.ActiveUsersIndexKey, redis.Z{Score: float64(activeAt), Member: userKey})
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("ошибка восстановления данных пользователя: %w", err)
+	}
+	return true, nil
+}
+
+// restoreGroup воссоздает consumer group. Без pending группа создается сразу на last_delivered_id.
+// Иначе записи до last_delivered_id включительно читаются одним XREADGROUP, попадая в PEL,
+// и подтверждаются все, кроме сохраненных pending; смещение группы при этом доходит до last_delivered_id
+func (r *RedisRepository) restoreGroup(ctx context.Context, userID int64, streamKey string, b *UserBackup) error {
+	var delivered int64
+	for _, e := range b.Stream {
+		if streamIDNotAfter(e.ID, b.Group.LastDeliveredID) {
+			delivered++
+		}
+	}
+
+	inStream := make(map[string]bool, len(b.Stream))
+	for _, e := range b.Stream {
+		inStream[e.ID] = true
+	}
+	pending := make(map[string]BackupPending, len(b.Group.Pending))
+	for _, p := range b.Group.Pending {
+		if inStream[p.ID] { // записи PEL, удаленные из стрима, восстановить нельзя
+			pending[p.ID] = p
+		}
+	}
+
+	if len(pending) == 0 {
+		if err := r.client.XGroupCreate(ctx, streamKey, domain.ConsumerGroupName, b.Group.LastDeliveredID).Err(); err != nil {
+			return fmt.Errorf("ошибка создания consumer group: %w", err)
+		}
+		return nil
+	}
+	if err := r.client.XGroupCreate(ctx, streamKey, domain.ConsumerGroupName, "0").Err(); err != nil {
+		return fmt.Errorf("ошибка создания consumer group: %w", err)
+	}
+
+	consumer := domain.ConsumerID(userID)
+	streams, err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    domain.ConsumerGroupName,
+		Consumer: consumer,
+		Streams:  []string{streamKey, ">"},
+		Count:    delivered,
+		Block:    -1,
+	}).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("ошибка восстановления PEL: %w", err)
+	}
+
+	var ack []string
+	claims := make(map[string][]string)
+	for _, s := range streams {
+		for _, msg := range s.Messages {
+			p, ok := pending[msg.ID]
+			switch {
+			case !ok:
+				ack = append(ack, msg.ID)
+			case p.Consumer != consumer:
+				claims[p.Consumer] = append(claims[p.Consumer], msg.ID)
+			}
+		}
+	}
+	if len(ack) > 0 {
+		if err := r.client.XAck(ctx, streamKey, domain.ConsumerGroupName, ack...).Err(); err != nil {
+			return fmt.Errorf("ошибка восстановления PEL: %w", err)
+		}
+	}
+	for owner, ids := range claims {
+		if err := r.client.XClaimJustID(ctx, &redis.XClaimArgs{
+			Stream:   streamKey,
+			Group:    domain.ConsumerGroupName,
+			Consumer: owner,
+			Messages: ids,
+		}).Err(); err != nil {
+			return fmt.Errorf("ошибка восстановления PEL: %w", err)
+		}
+	}
+	return nil
+}
+
+// streamIDNotAfter сообщает, что запись id не новее bound; формат обоих ID проверен Validate
+func streamIDNotAfter(id, bound string) bool {
+	ms, seq, _ := domain.ParseStreamID(id)
+	boundMS, boundSeq, _ := domain.ParseStreamID(bound)
+	return ms < boundMS || ms == boundMS && seq <= boundSeq
+}
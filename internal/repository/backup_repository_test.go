@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"notification-mvp/internal/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// writeTestBackup заполняет Redis двумя пользователями и возвращает архив
+func writeTestBackup(t *testing.T, r *RedisRepository) []byte {
+	t.Helper()
+	ctx := context.Background()
+	alice := domain.Target{ID: 1, Login: "alice"}
+
+	var nids []string
+	for range 3 {
+		_, nid := createRedisNotification(t, r, alice, domain.StreamLimit{})
+		nids = append(nids, nid)
+	}
+	createRedisNotification(t, r, domain.Target{ID: 2, Login: "bob"}, domain.StreamLimit{})
+	// Две записи доставлены, одна из них подтверждена: в PEL остается вторая, третья не доставлена
+	if err := r.EnsureConsumerGroup(ctx, 1, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := r.ReadNewMessages(ctx, 1, "alice", time.Millisecond, 2)
+	if err != nil || len(msgs) != 2 {
+		t.Fatalf("ReadNewMessages = %d, %v", len(msgs), err)
+	}
+	if res, err := r.AckMessage(ctx, 1, "alice", msgs[0].ID, nids[0]); err != nil || res != domain.AckResultAcked {
+		t.Fatalf("AckMessage = %s, %v", res, err)
+	}
+	if err := r.SetUserRetentionDays(ctx, 1, "alice", 5); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	stats, err := r.WriteBackup(ctx, &buf)
+	if err != nil {
+		t.Fatalf("WriteBackup: %v", err)
+	}
+	if stats.Users != 2 || stats.Entries != 4 || stats.Payloads != 4 {
+		t.Fatalf("неверные итоги копирования: %+v", stats)
+	}
+	return buf.Bytes()
+}
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	src, _, srcClient := newTestRedisRepo(t)
+	dst, _, dstClient := newTestRedisRepo(t)
+	ctx := context.Background()
+	archive := writeTestBackup(t, src)
+
+	stats, err := dst.RestoreBackup(ctx, bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("RestoreBackup: %v", err)
+	}
+	if stats.Users != 2 || stats.Entries != 4 || stats.Payloads != 4 || stats.Skipped != 0 {
+		t.Fatalf("неверные итоги восстановления: %+v", stats)
+	}
+
+	for _, u := range []domain.Target{{ID: 1, Login: "alice"}, {ID: 2, Login: "bob"}} {
+		streamKey := domain.StreamKey(u.ID, u.Login)
+		entries := srcClient.XRange(ctx, streamKey, "-", "+").Val()
+		if got := dstClient.XRange(ctx, streamKey, "-", "+").Val(); !slices.EqualFunc(entries, got, func(a, b redis.XMessage) bool {
+			return a.ID == b.ID && maps.Equal(a.Values, b.Values)
+		}) {
+			t.Errorf("%s: стрим %v, ожидалось %v", u.Login, got, entries)
+		}
+		for _, e := range entries {
+			key := domain.NotificationKey(u.ID, u.Login, e.Values["nid"].(string))
+			if got, want := dstClient.Get(ctx, key).Val(), srcClient.Get(ctx, key).Val(); got != want {
+				t.Errorf("%s: payload %q, ожидалось %q", key, got, want)
+			}
+			if ttl := dstClient.PTTL(ctx, key).Val(); ttl <= 0 || ttl > domain.NotificationTTL {
+				t.Errorf("%s: TTL payload %v", key, ttl)
+			}
+		}
+		ttlKey := domain.TTLSchedulerKey(u.ID, u.Login)
+		if got, want := dstClient.ZRangeWithScores(ctx, ttlKey, 0, -1).Val(), srcClient.ZRangeWithScores(ctx, ttlKey, 0, -1).Val(); !slices.Equal(got, want) {
+			t.Errorf("%s: планировщик TTL %v, ожидалось %v", u.Login, got, want)
+		}
+		stateKey := domain.NotificationStateKey(u.ID, u.Login)
+		if got, want := dstClient.HGetAll(ctx, stateKey).Val(), srcClient.HGetAll(ctx, stateKey).Val(); !maps.Equal(got, want) {
+			t.Errorf("%s: статусы %v, ожидалось %v", u.Login, got, want)
+		}
+		userKey := domain.UserKey(u.ID, u.Login)
+		for _, index := range []string{domain.ActiveUsersIndexKey, domain.UserExpiryIndexKey} {
+			if got, want := dstClient.ZScore(ctx, index, userKey).Val(), srcClient.ZScore(ctx, index, userKey).Val(); got != want {
+				t.Errorf("%s: score в %s = %v, ожидалось %v", u.Login, index, got, want)
+			}
+		}
+	}
+
+	if days, err := dst.GetUserRetentionDays(ctx, 1, "alice"); err != nil || days != 5 {
+		t.Errorf("срок хранения = %d, %v", days, err)
+	}
+	aliceStream := domain.StreamKey(1, "alice")
+	pending := func(c redis.UniversalClient) []string {
+		var ids []string
+		for _, p := range c.XPendingExt(ctx, &redis.XPendingExtArgs{Stream: aliceStream, Group: domain.ConsumerGroupName, Start: "-", End: "+", Count: 10}).Val() {
+			ids = append(ids, p.ID+"@"+p.Consumer)
+		}
+		return ids
+	}
+	if got, want := pending(dstClient), pending(srcClient); len(want) != 1 || !slices.Equal(got, want) {
+		t.Errorf("PEL %v, ожидалось %v", got, want)
+	}
+	// Недоставленная запись читается после восстановления, доставленные — нет
+	msgs, err := dst.ReadNewMessages(ctx, 1, "alice", time.Millisecond, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := srcClient.XRange(ctx, aliceStream, "-", "+").Val(); len(msgs) != 1 || msgs[0].ID != entries[2].ID {
+		t.Errorf("после восстановления прочитаны %v, ожидалась только %s", msgs, entries[2].ID)
+	}
+
+	again, err := dst.RestoreBackup(ctx, bytes.NewReader(archive))
+	if err != nil || again.Skipped != 2 || again.Users != 0 {
+		t.Fatalf("повторное восстановление = %+v, %v; существующие пользователи должны пропускаться", again, err)
+	}
+}
+
+func TestRestoreBackupRejectsCorruptArchive(t *testing.T) {
+	src, _, _ := newTestRedisRepo(t)
+	archive := writeTestBackup(t, src)
+	lines := bytes.SplitAfter(archive, []byte("\n"))
+	lines = lines[:len(lines)-1] // после завершающего перевода строки остается пустой элемент
+	if len(lines) != 3 {
+		t.Fatalf("в архиве %d строк, ожидалось 3", len(lines))
+	}
+	join := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	tests := []struct {
+		name    string
+		archive []byte
+	}{
+		{"обрезан посреди строки", archive[:len(lines[0])+len(lines[1])/2]},
+		{"нет завершающей строки", join(lines[0], lines[1])},
+		{"потеряна строка пользователя", join(lines[0], lines[2])},
+		{"поврежденная строка", join([]byte("{\"version\":1,\"user\":\n"), lines[1], lines[2])},
+		{"данные после завершающей строки", join(lines[0], lines[1], lines[2], lines[0])},
+		{"неверный пользователь", join(bytes.Replace(lines[0], []byte(`"login":"alice"`), []byte(`"login":""`), 1), lines[1], lines[2])},
+		{"неверный ID записи", join(bytes.Replace(lines[0], []byte(`"id":"`), []byte(`"id":"x`), 1), lines[1], lines[2])},
+		{"пустой архив", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst, mr, _ := newTestRedisRepo(t)
+			_, err := dst.RestoreBackup(context.Background(), bytes.NewReader(tt.archive))
+			if !errors.Is(err, ErrBackupCorrupt) {
+				t.Fatalf("ожидалась ошибка ErrBackupCorrupt, получено %v", err)
+			}
+			if keys := mr.Keys(); len(keys) != 0 {
+				t.Fatalf("поврежденный архив частично восстановлен: %s", strings.Join(keys, ", "))
+			}
+		})
+	}
+}
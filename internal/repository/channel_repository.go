@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"notification-mvp/internal/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ScheduleChannelDelivery сохраняет доставку в notif:channel:{id}-{login} и планирует ее в notif:channels:due
+func (r *RedisRepository) ScheduleChannelDelivery(ctx context.Context, d domain.ChannelDelivery) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации доставки каналами: %w", err)
+	}
+	userKey := domain.UserKey(d.Target.ID, d.Target.Login)
+
+	// Хэш и индекс в разных слотах Cluster, поэтому pipeline без MULTI
+	pipe := r.client.Pipeline()
+	pipe.HSet(ctx, domain.ChannelDeliveryKey(d.Target.ID, d.Target.Login), d.NotificationID, data)
+	pipe.ZAdd(ctx, domain.ChannelDueIndexKey, redis.Z{
+		Score:  float64(d.DueAt.Unix()),
+		Member: domain.NotificationMember(userKey, d.NotificationID),
+	})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("ошибка сохранения доставки каналами: %w", err)
+	}
+	return nil
+}
+
+// GetChannelDelivery возвращает отложенную доставку уведомления
+func (r *RedisRepository) GetChannelDelivery(ctx context.Context, userID int64, login string, notificationID string) (*domain.ChannelDelivery, error) {
+	data, err := r.client.HGet(ctx, domain.ChannelDeliveryKey(userID, login), notificationID).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка чтения доставки каналами: %w", err)
+	}
+
+	var d domain.ChannelDelivery
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("ошибка разбора доставки каналами: %w", err)
+	}
+	return &d, nil
+}
+
+// GetDueChannelDeliveries возвращает до limit доставок, запланированных не позже now
+func (r *RedisRepository) GetDueChannelDeliveries(ctx context.Context, now time.Time, offset, limit int64) ([]string, error) {
+	members, err := r.client.ZRangeByScore(ctx, domain.ChannelDueIndexKey, &redis.ZRangeBy{
+		Min:    "-inf",
+		Max:    fmt.Sprintf("%d", now.Unix()),
+		Offset: offset,
+		Count:  limit,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения индекса доставок каналами: %w", err)
+	}
+	return members, nil
+}
+
+// CancelChannelDelivery удаляет отложенную доставку из хэша пользователя и индекса
+func (r *RedisRepository) CancelChannelDelivery(ctx context.Context, userID int64, login string, notificationID string) error {
+	pipe := r.client.Pipeline()
+	r.cancelChannelDelivery(ctx, pipe, userID, login, notificationID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("ошибка отмены доставки каналами: %w", err)
+	}
+	return nil
+}
+
+// cancelChannelDelivery добавляет в pipeline удаление отложенной доставки
+func (r *RedisRepository) cancelChannelDelivery(ctx context.Context, pipe redis.Pipeliner, userID int64, login string, notificationID string) {
+	pipe.HDel(ctx, domain.ChannelDeliveryKey(userID, login), notificationID)
+	pipe.ZRem(ctx, domain.ChannelDueIndexKey,
+		domain.NotificationMember(domain.UserKey(userID, login), notificationID))
+}
+
+// HasConsumerLock сообщает, подключен ли пользователь к какому-либо pod
+func (r *RedisRepository) HasConsumerLock(ctx context.Context, userID int64, login string) (bool, error) {
+	n, err := r.client.Exists(ctx, domain.ConsumerLockKey(userID, login)).Result()
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки consumer lock: %w", err)
+	}
+	return n > 0, nil
+}
+
+// userChannelDeliveries возвращает все отложенные доставки пользователя (для выгрузки данных)
+func (r *RedisRepository) userChannelDeliveries(ctx context.Context, userID int64, login string) ([]domain.ChannelDelivery, error) {
+	values, err := r.client.HVals(ctx, domain.ChannelDeliveryKey(userID, login)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения доставок каналами пользователя: %w", err)
+	}
+	deliveries := make([]domain.ChannelDelivery, 0, len(values))
+	for _, v := range values {
+		var d domain.ChannelDelivery
+		if err := json.Unmarshal([]byte(v), &d); err != nil {
+			return nil, fmt.Errorf("ошибка разбора доставки каналами: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"notification-mvp/internal/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// addDigestCandidateScript добавляет кандидата в сводку, только если сводка настроена,
+// и удаляет кандидатов старше срока хранения.
+// KEYS: настройки сводки, кандидаты. ARGV: score (мс), member, минимальный score, TTL ключа (мс)
+var addDigestCandidateScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', '(' .. ARGV[3])
+redis.call('ZADD', KEYS[2], ARGV[1], ARGV[2])
+redis.call('PEXPIRE', KEYS[2], ARGV[4])
+return 1
+`)
+
+// SetDigestPreference сохраняет настройки сводки и планирует следующую сводку в индексе notif:users:digest
+func (r *RedisRepository) SetDigestPreference(ctx context.Context, userID int64, login string, pref domain.DigestPreference) error {
+	key := domain.DigestKey(userID, login)
+	userKey := domain.UserKey(userID, login)
+
+	if pref.Mode == domain.DigestOff {
+		pipe := r.client.Pipeline()
+		pipe.Del(ctx, key)
+		pipe.Del(ctx, domain.DigestCandidatesKey(userID, login))
+		pipe.ZRem(ctx, domain.DigestDueIndexKey, userKey)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("ошибка удаления настроек сводки: %w", err)
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(pref)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации настроек сводки: %w", err)
+	}
+
+	from := time.Now()
+	if pref.LastDigestAt != nil {
+		from = *pref.LastDigestAt
+	}
+	next := pref.NextRun(from)
+
+	// Настройки и индекс в разных слотах Cluster, поэтому pipeline без MULTI
+	pipe := r.client.Pipeline()
+	pipe.Set(ctx, key, data, 0)
+	pipe.ZAdd(ctx, domain.DigestDueIndexKey, redis.Z{Score: float64(next.Unix()), Member: userKey})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("ошибка сохранения настроек сводки: %w", err)
+	}
+	return nil
+}
+
+// GetDigestPreference возвращает настройки сводки пользователя
+func (r *RedisRepository) GetDigestPreference(ctx context.Context, userID int64, login string) (*domain.DigestPreference, error) {
+	data, err := r.client.Get(ctx, domain.DigestKey(userID, login)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка чтения настроек сводки: %w", err)
+	}
+
+	var pref domain.DigestPreference
+	if err := json.Unmarshal(data, &pref); err != nil {
+		return nil, fmt.Errorf("ошибка разбора настроек сводки: %w", err)
+	}
+	return &pref, nil
+}
+
+// GetDueDigestUserKeys возвращает до limit пользователей, чья сводка запланирована не позже now
+func (r *RedisRepository) GetDueDigestUserKeys(ctx context.Context, now time.Time, offset, limit int64) ([]string, error) {
+	keys, err := r.client.ZRangeByScore(ctx, domain.DigestDueIndexKey, &redis.ZRangeBy{
+		Min:    "-inf",
+		Max:    fmt.Sprintf("%d", now.Unix()),
+		Offset: offset,
+		Count:  limit,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения индекса сводок: %w", err)
+	}
+	return keys, nil
+}
+
+// AddDigestCandidate запоминает уведомление для следующей сводки, если сводка пользователю настроена.
+// Срок хранения отсчитывается от времени записи стрима, поэтому часы pod не участвуют
+func (r *RedisRepository) AddDigestCandidate(ctx context.Context, userID int64, login string, candidate domain.DigestCandidate) error {
+	at := domain.StreamIDTime(candidate.StreamID)
+	if at.IsZero() {
+		return fmt.Errorf("неверный ID записи стрима кандидата в сводку: %q", candidate.StreamID)
+	}
+	member, err := json.Marshal(candidate)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации кандидата в сводку: %w", err)
+	}
+
+	err = addDigestCandidateScript.Run(ctx, r.client,
+		[]string{domain.DigestKey(userID, login), domain.DigestCandidatesKey(userID, login)},
+		at.UnixMilli(), member, at.Add(-domain.DigestCandidatesTTL).UnixMilli(), domain.DigestCandidatesTTL.Milliseconds(),
+	).Err()
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения кандидата в сводку: %w", err)
+	}
+	return nil
+}
+
+// GetDigestCandidates возвращает до limit последних кандидатов в сводку, записанных после since
+func (r *RedisRepository) GetDigestCandidates(ctx context.Context, userID int64, login string, since time.Time, limit int64) ([]domain.DigestCandidate, error) {
+	minScore := "-inf"
+	if !since.IsZero() {
+		minScore = fmt.Sprintf("(%d", since.UnixMilli())
+	}
+	members, err := r.client.ZRevRangeByScore(ctx, domain.DigestCandidatesKey(userID, login), &redis.ZRangeBy{
+		Min:   minScore,
+		Max:   "+inf",
+		Count: limit,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения кандидатов в сводку: %w", err)
+	}
+
+	candidates := make([]domain.DigestCandidate, 0, len(members))
+	for i := len(members) - 1; i >= 0; i-- {
+		var c domain.DigestCandidate
+		if err := json.Unmarshal([]byte(members[i]), &c); err != nil {
+			return nil, fmt.Errorf("ошибка разбора кандидата в сводку: %w", err)
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, nil
+}
+
+// MarkDigested подтверждает записи стрима и помечает непрочитанные уведомления статусом digested
+// тем же скриптом, что и подтверждение прочтения клиентом. Записи, уже удаленные из стрима, пропускаются
+func (r *RedisRepository) MarkDigested(ctx context.Context, userID int64, login string, items []domain.DigestCandidate) (int, error) {
+	streamKey := domain.StreamKey(userID, login)
+	stateKey := domain.NotificationStateKey(userID, login)
+
+	marked := 0
+	for _, item := range items {
+		value, err := r.sealState(stateKey, item.NotificationID, domain.StateDigested)
+		if err != nil {
+			return marked, err
+		}
+		res, err := ackScript.Run(ctx, r.client,
+			[]string{streamKey, stateKey},
+			item.StreamID, item.NotificationID, value, domain.ConsumerGroupName,
+		).Text()
+		if err != nil {
+			return marked, fmt.Errorf("ошибка пометки уведомления digested: %w", err)
+		}
+		if domain.AckResult(res) == domain.AckResultAcked {
+			marked++
+		}
+	}
+	return marked, nil
+}
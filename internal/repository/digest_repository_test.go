@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"notification-mvp/internal/domain"
+)
+
+// digestCandidateAt возвращает кандидата в сводку с записью стрима в момент at
+func digestCandidateAt(at time.Time, nid string) domain.DigestCandidate {
+	return domain.DigestCandidate{
+		StreamID:       fmt.Sprintf("%d-0", at.UnixMilli()),
+		NotificationID: nid,
+		Source:         "billing",
+	}
+}
+
+func candidateIDs(candidates []domain.DigestCandidate) []string {
+	ids := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		ids = append(ids, c.NotificationID)
+	}
+	return ids
+}
+
+func TestDigestCandidates(t *testing.T) {
+	for name, repo := range userDataRepos(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			add := func(at time.Time, nid string) {
+				t.Helper()
+				if err := repo.AddDigestCandidate(ctx, 1, "alice", digestCandidateAt(at, nid)); err != nil {
+					t.Fatalf("AddDigestCandidate: %v", err)
+				}
+			}
+			get := func(since time.Time, limit int64) []string {
+				t.Helper()
+				candidates, err := repo.GetDigestCandidates(ctx, 1, "alice", since, limit)
+				if err != nil {
+					t.Fatalf("GetDigestCandidates: %v", err)
+				}
+				return candidateIDs(candidates)
+			}
+
+			// Без настроенной сводки кандидаты не хранятся
+			add(testEpoch, "n0")
+			if got := get(time.Time{}, 10); len(got) != 0 {
+				t.Fatalf("кандидаты без настроек сводки: %v", got)
+			}
+
+			if err := repo.SetDigestPreference(ctx, 1, "alice", domain.DigestPreference{Mode: domain.DigestDaily}); err != nil {
+				t.Fatal(err)
+			}
+			add(testEpoch, "n1")
+			add(testEpoch.Add(time.Hour), "n2")
+			add(testEpoch.Add(2*time.Hour), "n3")
+			if got := get(time.Time{}, 10); !slices.Equal(got, []string{"n1", "n2", "n3"}) {
+				t.Fatalf("кандидаты %v", got)
+			}
+			if got := get(testEpoch.Add(time.Hour), 10); !slices.Equal(got, []string{"n3"}) {
+				t.Fatalf("кандидаты после since: %v", got)
+			}
+			if got := get(time.Time{}, 2); !slices.Equal(got, []string{"n2", "n3"}) {
+				t.Fatalf("limit должен оставлять последних кандидатов: %v", got)
+			}
+
+			// Кандидаты старше DigestCandidatesTTL удаляются при добавлении
+			add(testEpoch.Add(time.Hour+domain.DigestCandidatesTTL), "n4")
+			if got := get(time.Time{}, 10); !slices.Equal(got, []string{"n2", "n3", "n4"}) {
+				t.Fatalf("после истечения срока хранения %v", got)
+			}
+
+			// Отключение сводки удаляет кандидатов
+			if err := repo.SetDigestPreference(ctx, 1, "alice", domain.DigestPreference{Mode: domain.DigestOff}); err != nil {
+				t.Fatal(err)
+			}
+			if got := get(time.Time{}, 10); len(got) != 0 {
+				t.Fatalf("кандидаты остались после отключения сводки: %v", got)
+			}
+		})
+	}
+}
+
+func TestRedisDigestCandidatesKeepReadStates(t *testing.T) {
+	r, _, client := newTestRedisRepo(t)
+	ctx := context.Background()
+	alice := domain.Target{ID: 1, Login: "alice"}
+	if err := r.SetDigestPreference(ctx, 1, "alice", domain.DigestPreference{Mode: domain.DigestHourly}); err != nil {
+		t.Fatal(err)
+	}
+	res, nid := createRedisNotification(t, r, alice, domain.StreamLimit{})
+	if err := r.AddDigestCandidate(ctx, 1, "alice", domain.DigestCandidate{StreamID: res.StreamID, NotificationID: nid}); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := client.TTL(ctx, domain.DigestCandidatesKey(1, "alice")).Val(); ttl <= domain.NotificationTTL || ttl > domain.DigestCandidatesTTL {
+		t.Fatalf("TTL кандидатов %v", ttl)
+	}
+	if ack, err := r.AckMessage(ctx, 1, "alice", res.StreamID, nid); err != nil || ack != domain.AckResultAcked {
+		t.Fatalf("AckMessage = %s, %v", ack, err)
+	}
+	// Запись удалена по истечении payload, статус прочтения еще нужен сводке
+	client.XDel(ctx, domain.StreamKey(1, "alice"), res.StreamID)
+
+	if removed, remaining, err := r.CompactReadStates(ctx, 1, "alice"); err != nil || removed != 0 || remaining != 1 {
+		t.Fatalf("CompactReadStates = %d, %d, %v", removed, remaining, err)
+	}
+	if statuses, err := r.GetReadStatuses(ctx, 1, "alice", []string{nid}); err != nil || !statuses[nid] {
+		t.Fatalf("статус прочтения кандидата потерян: %v, %v", statuses, err)
+	}
+}
@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"notification-mvp/internal/domain"
+	"notification-mvp/internal/encryption"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// WithCipher включает шифрование payload уведомлений (и, опционально, хэша статусов прочтения)
+func (r *RedisRepository) WithCipher(cipher *encryption.Cipher, encryptState bool) *RedisRepository {
+	r.cipher = cipher
+	r.encryptState = encryptState
+	return r
+}
+
+// sealPayload шифрует payload, привязывая шифротекст к имени ключа
+func (r *RedisRepository) sealPayload(key string, plaintext []byte) (string, error) {
+	if r.cipher == nil {
+		return string(plaintext), nil
+	}
+	value, err := r.cipher.Encrypt(plaintext, []byte(key))
+	if err != nil {
+		return "", fmt.Errorf("ошибка шифрования payload: %w", err)
+	}
+	return value, nil
+}
+
+// openPayload расшифровывает payload (открытые значения возвращаются без изменений)
+func (r *RedisRepository) openPayload(key, value string) ([]byte, error) {
+	if r.cipher == nil || !encryption.IsEncrypted(value) {
+		return []byte(value), nil
+	}
+	plaintext, err := r.cipher.Decrypt(value, []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка расшифровки payload: %w", err)
+	}
+	return plaintext, nil
+}
+
+// sealState шифрует значение статуса прочтения, если включено шифрование хэша статусов
+func (r *RedisRepository) sealState(stateKey, notificationID, value string) (string, error) {
+	if r.cipher == nil || !r.encryptState {
+		return value, nil
+	}
+	sealed, err := r.cipher.Encrypt([]byte(value), stateAAD(stateKey, notificationID))
+	if err != nil {
+		return "", fmt.Errorf("ошибка шифрования статуса: %w", err)
+	}
+	return sealed, nil
+}
+
+// openState расшифровывает значение статуса прочтения; при ошибке возвращает пустую строку
+func (r *RedisRepository) openState(stateKey, notificationID, value string) string {
+	if !encryption.IsEncrypted(value) {
+		return value
+	}
+	if r.cipher == nil {
+		return ""
+	}
+	plaintext, err := r.cipher.Decrypt(value, stateAAD(stateKey, notificationID))
+	if err != nil {
+		slog.Warn("Ошибка расшифровки статуса", "error", err, "nid", notificationID)
+		return ""
+	}
+	return string(plaintext)
+}
+
+func stateAAD(stateKey, notificationID string) []byte {
+	return []byte(stateKey + "|" + notificationID)
+}
+
+// ReencryptPayloads обходит все payload (и хэши статусов) и перешифровывает активным ключом
+// значения, зашифрованные старым ключом или сохраненные в открытом виде. Возвращает число перешифрованных значений
+func (r *RedisRepository) ReencryptPayloads(ctx context.Context) (int, error) {
+	if r.cipher == nil {
+		return 0, nil
+	}
+
+	var rotated int
+	err := r.scanKeys(ctx, domain.NotificationKeyPrefix+"*", func(keys []string) error {
+		for _, key := range keys {
+			ok, err := r.reencryptPayload(ctx, key)
+			if err != nil {
+				return err
+			}
+			if ok {
+				rotated++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return rotated, err
+	}
+
+	if r.encryptState {
+		err = r.scanKeys(ctx, domain.NotificationStateKeyPrefix+"*", func(keys []string) error {
+			for _, key := range keys {
+				n, err := r.reencryptState(ctx, key)
+				if err != nil {
+					return err
+				}
+				rotated += n
+			}
+			return nil
+		})
+	}
+
+	return rotated, err
+}
+
+// reencryptPayload перешифровывает один payload, если он зашифрован не активным ключом
+func (r *RedisRepository) reencryptPayload(ctx context.Context, key string) (bool, error) {
+	value, err := r.client.Get(ctx, key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return false, nil // истёк между SCAN и GET
+		}
+		return false, fmt.Errorf("ошибка чтения payload: %w", err)
+	}
+	if !r.cipher.NeedsRotation(value) {
+		return false, nil
+	}
+
+	plaintext, err := r.openPayload(key, value)
+	if err != nil {
+		slog.WarnContext(ctx, "Пропущен payload при перешифровании", "key", key, "error", err)
+		return false, nil
+	}
+	sealed, err := r.sealPayload(key, plaintext)
+	if err != nil {
+		return false, err
+	}
+
+	// XX + KEEPTTL: не воскрешаем удалённые джанитором ключи и сохраняем исходный TTL
+	err = r.client.SetArgs(ctx, key, sealed, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("ошибка записи перешифрованного payload: %w", err)
+	}
+	return true, nil
+}
+
+// reencryptState перешифровывает значения одного хэша статусов прочтения
+func (r *RedisRepository) reencryptState(ctx context.Context, key string) (int, error) {
+	fields, err := r.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка чтения хэша статусов: %w", err)
+	}
+
+	var rotated int
+	for nid, value := range fields {
+		if !r.cipher.NeedsRotation(value) {
+			continue
+		}
+		plain := r.openState(key, nid, value)
+		if plain == "" {
+			continue
+		}
+		sealed, err := r.sealState(key, nid, plain)
+		if err != nil {
+			return rotated, err
+		}
+		swapped, err := r.swapState(ctx, key, nid, value, sealed)
+		if err != nil {
+			return rotated, err
+		}
+		if swapped {
+			rotated++
+		}
+	}
+
+	return rotated, nil
+}
+
+// swapStateScript заменяет значение поля хэша, только если оно не изменилось с момента чтения.
+// KEYS: хэш статусов. ARGV: nid, прочитанное значение, новое значение. Возвращает 1 — записано
+var swapStateScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[1]) == ARGV[2] then
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[3])
+	return 1
+end
+return 0
+`)
+
+// swapState записывает перешифрованный статус, если поле все еще хранит прежний шифротекст.
+// Так перешифрование не восстанавливает статус, удаленный EraseUserData или CompactReadStates
+func (r *RedisRepository) swapState(ctx context.Context, key, nid, old, sealed string) (bool, error) {
+	swapped, err := swapStateScript.Run(ctx, r.client, []string{key}, nid, old, sealed).Int()
+	if err != nil {
+		return false, fmt.Errorf("ошибка записи статуса: %w", err)
+	}
+	return swapped == 1, nil
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"notification-mvp/internal/domain"
+	"notification-mvp/internal/encryption"
+)
+
+// writeTestKeyring записывает файл ключей с ключами k1 и k2 и активным ключом active
+func writeTestKeyring(t *testing.T, path, active string) {
+	t.Helper()
+	key := func(b byte) string { return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32)) }
+	raw, err := json.Marshal(map[string]any{"active": active, "keys": map[string]string{"k1": key(1), "k2": key(2)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newEncryptedRedisRepo создает репозиторий с шифрованием payload и статусов ключом k1.
+// Возвращаемая функция делает активным ключ k2
+func newEncryptedRedisRepo(t *testing.T) (*RedisRepository, func()) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeTestKeyring(t, path, "k1")
+	keyring, err := encryption.LoadKeyring(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _, _ := newTestRedisRepo(t)
+	r.WithCipher(encryption.NewCipher(keyring), true)
+	rotate := func() {
+		writeTestKeyring(t, path, "k2")
+		if err := keyring.Reload(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r, rotate
+}
+
+func TestRedisReencryptState(t *testing.T) {
+	ctx := context.Background()
+	alice := domain.Target{ID: 1, Login: "alice"}
+	stateKey := domain.NotificationStateKey(1, "alice")
+
+	r, rotate := newEncryptedRedisRepo(t)
+	res, nid := createRedisNotification(t, r, alice, domain.StreamLimit{})
+	if ack, err := r.AckMessage(ctx, 1, "alice", res.StreamID, nid); err != nil || ack != domain.AckResultAcked {
+		t.Fatalf("AckMessage = %s, %v", ack, err)
+	}
+	rotate()
+
+	if _, err := r.ReencryptPayloads(ctx); err != nil {
+		t.Fatal(err)
+	}
+	value, err := r.client.HGet(ctx, stateKey, nid).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.cipher.NeedsRotation(value) {
+		t.Fatal("статус не перешифрован активным ключом")
+	}
+	if statuses, err := r.GetReadStatuses(ctx, 1, "alice", []string{nid}); err != nil || !statuses[nid] {
+		t.Fatalf("статус прочтения потерян после перешифрования: %v, %v", statuses, err)
+	}
+}
+
+func TestRedisReencryptStateAfterErase(t *testing.T) {
+	ctx := context.Background()
+	alice := domain.Target{ID: 1, Login: "alice"}
+	stateKey := domain.NotificationStateKey(1, "alice")
+
+	r, rotate := newEncryptedRedisRepo(t)
+	res, nid := createRedisNotification(t, r, alice, domain.StreamLimit{})
+	if ack, err := r.AckMessage(ctx, 1, "alice", res.StreamID, nid); err != nil || ack != domain.AckResultAcked {
+		t.Fatalf("AckMessage = %s, %v", ack, err)
+	}
+	rotate()
+
+	// Перешифрование прочитало статус, затем данные пользователя стерты до записи нового значения
+	old, err := r.client.HGet(ctx, stateKey, nid).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := r.sealState(stateKey, nid, r.openState(stateKey, nid, old))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.EraseUserData(ctx, 1, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	swapped, err := r.swapState(ctx, stateKey, nid, old, sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if swapped {
+		t.Fatal("статус записан после стирания данных")
+	}
+	if n, _ := r.client.Exists(ctx, stateKey).Result(); n != 0 {
+		t.Fatal("перешифрование восстановило стертый хэш статусов")
+	}
+}
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"notification-mvp/internal/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// advanceEscalationScript обновляет эскалацию, только если ее еще не удалило подтверждение прочтения.
+// KEYS: хэш эскалаций. ARGV: notification_id, JSON эскалации. Возвращает 1, если эскалация обновлена
+var advanceEscalationScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+return 1
+`)
+
+// ScheduleEscalation сохраняет эскалацию в notif:escalation:{id}-{login} и планирует шаг в notif:escalations:due
+func (r *RedisRepository) ScheduleEscalation(ctx context.Context, esc domain.Escalation) error {
+	data, err := json.Marshal(esc)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации эскалации: %w", err)
+	}
+	userKey := domain.UserKey(esc.Target.ID, esc.Target.Login)
+
+	// Хэш и индекс в разных слотах Cluster, поэтому pipeline без MULTI
+	pipe := r.client.Pipeline()
+	pipe.HSet(ctx, domain.EscalationKey(esc.Target.ID, esc.Target.Login), esc.NotificationID, data)
+	pipe.ZAdd(ctx, domain.EscalationDueIndexKey, redis.Z{
+		Score:  float64(esc.NextRunAt().Unix()),
+		Member: domain.NotificationMember(userKey, esc.NotificationID),
+	})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("ошибка сохранения эскалации: %w", err)
+	}
+	return nil
+}
+
+// AdvanceEscalation сохраняет эскалацию после шага. Отмененная эскалация не восстанавливается;
+// если отмена успела между скриптом и ZADD, лишний member индекса уберет следующий обход
+func (r *RedisRepository) AdvanceEscalation(ctx context.Context, esc domain.Escalation) (bool, error) {
+	if esc.Done() {
+		return false, r.CancelEscalation(ctx, esc.Target.ID, esc.Target.Login, esc.NotificationID)
+	}
+
+	data, err := json.Marshal(esc)
+	if err != nil {
+		return false, fmt.Errorf("ошибка сериализации эскалации: %w", err)
+	}
+	updated, err := advanceEscalationScript.Run(ctx, r.client,
+		[]string{domain.EscalationKey(esc.Target.ID, esc.Target.Login)},
+		esc.NotificationID, data,
+	).Int()
+	if err != nil {
+		return false, fmt.Errorf("ошибка обновления эскалации: %w", err)
+	}
+
+	member := domain.NotificationMember(domain.UserKey(esc.Target.ID, esc.Target.Login), esc.NotificationID)
+	if updated == 0 {
+		if err := r.client.ZRem(ctx, domain.EscalationDueIndexKey, member).Err(); err != nil {
+			return false, fmt.Errorf("ошибка удаления эскалации из индекса: %w", err)
+		}
+		return false, nil
+	}
+	err = r.client.ZAdd(ctx, domain.EscalationDueIndexKey, redis.Z{
+		Score:  float64(esc.NextRunAt().Unix()),
+		Member: member,
+	}).Err()
+	if err != nil {
+		return false, fmt.Errorf("ошибка планирования шага эскалации: %w", err)
+	}
+	return true, nil
+}
+
+// GetEscalation возвращает эскалацию уведомления
+func (r *RedisRepository) GetEscalation(ctx context.Context, userID int64, login string, notificationID string) (*domain.Escalation, error) {
+	data, err := r.client.HGet(ctx, domain.EscalationKey(userID, login), notificationID).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка чтения эскалации: %w", err)
+	}
+
+	var esc domain.Escalation
+	if err := json.Unmarshal(data, &esc); err != nil {
+		return nil, fmt.Errorf("ошибка разбора эскалации: %w", err)
+	}
+	return &esc, nil
+}
+
+// GetDueEscalations возвращает до limit эскалаций, чей шаг наступил не позже now
+func (r *RedisRepository) GetDueEscalations(ctx context.Context, now time.Time, offset, limit int64) ([]string, error) {
+	members, err := r.client.ZRangeByScore(ctx, domain.EscalationDueIndexKey, &redis.ZRangeBy{
+		Min:    "-inf",
+		Max:    fmt.Sprintf("%d", now.Unix()),
+		Offset: offset,
+		Count:  limit,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения индекса эскалаций: %w", err)
+	}
+	return members, nil
+}
+
+// CancelEscalation удаляет эскалацию уведомления из хэша пользователя и индекса
+func (r *RedisRepository) CancelEscalation(ctx context.Context, userID int64, login string, notificationID string) error {
+	pipe := r.client.Pipeline()
+	r.cancelEscalation(ctx, pipe, userID, login, notificationID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("ошибка отмены эскалации: %w", err)
+	}
+	return nil
+}
+
+// cancelEscalation добавляет в pipeline удаление эскалации
+func (r *RedisRepository) cancelEscalation(ctx context.Context, pipe redis.Pipeliner, userID int64, login string, notificationID string) {
+	pipe.HDel(ctx, domain.EscalationKey(userID, login), notificationID)
+	pipe.ZRem(ctx, domain.EscalationDueIndexKey,
+		domain.NotificationMember(domain.UserKey(userID, login), notificationID))
+}
+
+// userEscalations возвращает все эскалации пользователя (для выгрузки данных)
+func (r *RedisRepository) userEscalations(ctx context.Context, userID int64, login string) ([]domain.Escalation, error) {
+	values, err := r.client.HVals(ctx, domain.EscalationKey(userID, login)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения эскалаций пользователя: %w", err)
+	}
+	escalations := make([]domain.Escalation, 0, len(values))
+	for _, v := range values {
+		var esc domain.Escalation
+		if err := json.Unmarshal([]byte(v), &esc); err != nil {
+			return nil, fmt.Errorf("ошибка разбора эскалации: %w", err)
+		}
+		escalations = append(escalations, esc)
+	}
+	return escalations, nil
+}
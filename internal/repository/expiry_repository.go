@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"notification-mvp/internal/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// expiryClockSkew — запас по времени при поиске записи планировщика для истекшего payload:
+// score хранится в секундах, а Redis может сообщить об истечении с задержкой или раньше округления
+const expiryClockSkew = 60 * time.Second
+
+// expireEntryScript находит запись планировщика TTL по notification_id и удаляет запись стрима.
+// KEYS: планировщик TTL, стрим. ARGV: nid, максимальный score, consumer group.
+// Возвращает stream_id удаленной записи или nil, если её уже убрал джанитор
+var expireEntryScript = redis.NewScript(`
+local suffix = '|' .. ARGV[1]
+for _, member in ipairs(redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[2])) do
+	if string.sub(member, -#suffix) == suffix then
+		local sid = string.sub(member, 1, #member - #suffix)
+		redis.call('XACK', KEYS[2], ARGV[3], sid)
+		redis.call('XDEL', KEYS[2], sid)
+		redis.call('ZREM', KEYS[1], member)
+		return sid
+	end
+end
+return false
+`)
+
+// ExpireNotification удаляет запись стрима уведомления, payload которого истек (событие keyspace).
+// Возвращает stream_id удаленной записи; пустая строка — запись уже удалена другим pod или джанитором
+func (r *RedisRepository) ExpireNotification(ctx context.Context, userID int64, login, notificationID string) (string, error) {
+	maxScore := time.Now().Add(expiryClockSkew).Unix()
+
+	streamID, err := expireEntryScript.Run(ctx, r.client,
+		[]string{domain.TTLSchedulerKey(userID, login), domain.StreamKey(userID, login)},
+		notificationID, maxScore, domain.ConsumerGroupName,
+	).Text()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка удаления истекшей записи: %w", err)
+	}
+
+	r.invalidatePayload(domain.NotificationKey(userID, login, notificationID))
+
+	// Истекшее уведомление не эскалируется и не доставляется во внешние каналы
+	pipe := r.client.Pipeline()
+	r.cancelEscalation(ctx, pipe, userID, login, notificationID)
+	r.cancelChannelDelivery(ctx, pipe, userID, login, notificationID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", fmt.Errorf("ошибка отмены эскалации истекшего уведомления: %w", err)
+	}
+	return streamID, r.rescheduleUserExpiry(ctx, userID, login)
+}
@@ -0,0 +1,245 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"notification-mvp/internal/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// KeyMigrationStats содержит итоги переноса ключей в схему с хэш-тегами
+type KeyMigrationStats struct {
+	Users    int `json:"users"`
+	Keys     int `json:"keys"`
+	Payloads int `json:"payloads"`
+}
+
+// Префиксы пользовательских ключей, переносимых через DUMP/RESTORE
+var migratedUserKeyPrefixes = []string{
+	domain.StreamKeyPrefix,
+	domain.TTLSchedulerKeyPrefix,
+	domain.RetentionKeyPrefix,
+	domain.ConsumerLockKeyPrefix,
+	domain.DigestKeyPrefix,
+	domain.DigestCandidatesKeyPrefix,
+	domain.EscalationKeyPrefix,
+	domain.ChannelDeliveryKeyPrefix,
+	domain.WebhookKeyPrefix,
+	domain.PreferencesKeyPrefix,
+	domain.DeferredKeyPrefix,
+	domain.SubscriptionsKeyPrefix,
+}
+
+// MigrateToHashTagLayout переносит ключи из исходной схемы (stream:user:1-alice, notification:<uuid>)
+// в схему с хэш-тегами (stream:user:{1-alice}, notification:{1-alice}:<uuid>).
+// Перенос идет через DUMP/RESTORE, поэтому работает и между слотами Redis Cluster.
+// Писатели должны быть остановлены на время миграции. dryRun только подсчитывает ключи
+func (r *RedisRepository) MigrateToHashTagLayout(ctx context.Context, dryRun bool) (KeyMigrationStats, error) {
+	var stats KeyMigrationStats
+
+	userKeys, err := r.legacyUserKeys(ctx)
+	if err != nil {
+		return stats, err
+	}
+
+	for _, userKey := range userKeys {
+		stats.Users++
+
+		// Payload переносим первыми: их список берется из legacy-стрима
+		n, err := r.migrateUserPayloads(ctx, userKey, dryRun)
+		if err != nil {
+			return stats, err
+		}
+		stats.Payloads += n
+
+		for _, prefix := range migratedUserKeyPrefixes {
+			moved, err := r.moveKey(ctx, prefix+userKey, prefix+hashTagUserKey(userKey), dryRun)
+			if err != nil {
+				return stats, err
+			}
+			if moved {
+				stats.Keys++
+			}
+		}
+
+		moved, err := r.migrateStateHash(ctx, userKey, dryRun)
+		if err != nil {
+			return stats, err
+		}
+		if moved {
+			stats.Keys++
+		}
+
+		select {
+		case <-ctx.Done():
+			return stats, ctx.Err()
+		default:
+		}
+	}
+
+	return stats, nil
+}
+
+func hashTagUserKey(userKey string) string {
+	return "{" + userKey + "}"
+}
+
+// legacyUserKeys собирает пользователей, у которых остались ключи в исходной схеме
+func (r *RedisRepository) legacyUserKeys(ctx context.Context) ([]string, error) {
+	seen := make(map[string]bool)
+	var userKeys []string
+
+	prefixes := append([]string{domain.NotificationStateKeyPrefix}, migratedUserKeyPrefixes...)
+	for _, prefix := range prefixes {
+		err := r.scanKeys(ctx, prefix+"*", func(keys []string) error {
+			for _, key := range keys {
+				suffix := strings.TrimPrefix(key, prefix)
+				if strings.HasPrefix(suffix, "{") || seen[suffix] {
+					continue
+				}
+				seen[suffix] = true
+				userKeys = append(userKeys, suffix)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return userKeys, nil
+}
+
+// migrateUserPayloads переносит payload уведомлений пользователя, перешифровывая их под новое имя ключа
+func (r *RedisRepository) migrateUserPayloads(ctx context.Context, userKey string, dryRun bool) (int, error) {
+	entries, err := r.client.XRange(ctx, domain.StreamKeyPrefix+userKey, "-", "+").Result()
+	if err != nil && err != redis.Nil {
+		return 0, fmt.Errorf("ошибка чтения стрима %s: %w", userKey, err)
+	}
+
+	var moved int
+	for _, e := range entries {
+		nid, ok := e.Values["nid"].(string)
+		if !ok {
+			continue
+		}
+		oldKey := domain.NotificationKeyPrefix + nid
+		newKey := domain.NotificationKeyPrefix + hashTagUserKey(userKey) + ":" + nid
+
+		value, err := r.client.Get(ctx, oldKey).Result()
+		if err == redis.Nil {
+			continue // payload уже истёк
+		}
+		if err != nil {
+			return moved, fmt.Errorf("ошибка чтения payload: %w", err)
+		}
+		ttl, err := r.client.PTTL(ctx, oldKey).Result()
+		if err != nil {
+			return moved, fmt.Errorf("ошибка чтения TTL payload: %w", err)
+		}
+		if ttl <= 0 {
+			ttl = domain.NotificationTTL
+		}
+
+		moved++
+		if dryRun {
+			continue
+		}
+
+		// AAD шифротекста привязан к имени ключа — перешифровываем под новое имя
+		plaintext, err := r.openPayload(oldKey, value)
+		if err != nil {
+			return moved, err
+		}
+		sealed, err := r.sealPayload(newKey, plaintext)
+		if err != nil {
+			return moved, err
+		}
+		if err := r.client.Set(ctx, newKey, sealed, ttl).Err(); err != nil {
+			return moved, fmt.Errorf("ошибка записи payload: %w", err)
+		}
+		if err := r.client.Del(ctx, oldKey).Err(); err != nil {
+			return moved, fmt.Errorf("ошибка удаления старого payload: %w", err)
+		}
+	}
+
+	return moved, nil
+}
+
+// migrateStateHash переносит хэш статусов прочтения, перешифровывая значения под новое имя ключа
+func (r *RedisRepository) migrateStateHash(ctx context.Context, userKey string, dryRun bool) (bool, error) {
+	oldKey := domain.NotificationStateKeyPrefix + userKey
+	newKey := domain.NotificationStateKeyPrefix + hashTagUserKey(userKey)
+
+	fields, err := r.client.HGetAll(ctx, oldKey).Result()
+	if err != nil {
+		return false, fmt.Errorf("ошибка чтения хэша статусов: %w", err)
+	}
+	if len(fields) == 0 {
+		return false, nil
+	}
+	if dryRun {
+		return true, nil
+	}
+
+	values := make([]interface{}, 0, len(fields)*2)
+	for nid, value := range fields {
+		plain := r.openState(oldKey, nid, value)
+		if plain == "" {
+			continue
+		}
+		sealed, err := r.sealState(newKey, nid, plain)
+		if err != nil {
+			return false, err
+		}
+		values = append(values, nid, sealed)
+	}
+
+	pipe := r.client.Pipeline()
+	if len(values) > 0 {
+		pipe.HSet(ctx, newKey, values...)
+	}
+	pipe.Del(ctx, oldKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("ошибка переноса хэша статусов: %w", err)
+	}
+	return true, nil
+}
+
+// moveKey переносит ключ любого типа через DUMP/RESTORE с сохранением TTL
+func (r *RedisRepository) moveKey(ctx context.Context, oldKey, newKey string, dryRun bool) (bool, error) {
+	dump, err := r.client.Dump(ctx, oldKey).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("ошибка DUMP %s: %w", oldKey, err)
+	}
+	if dryRun {
+		return true, nil
+	}
+
+	ttl, err := r.client.PTTL(ctx, oldKey).Result()
+	if err != nil {
+		return false, fmt.Errorf("ошибка чтения TTL %s: %w", oldKey, err)
+	}
+	if ttl < 0 {
+		ttl = 0 // без срока жизни
+	}
+
+	if err := r.client.Restore(ctx, newKey, ttl, dump).Err(); err != nil {
+		if strings.Contains(err.Error(), "BUSYKEY") {
+			slog.WarnContext(ctx, "Ключ в новой схеме уже существует, пропускаем", "key", newKey)
+			return false, nil
+		}
+		return false, fmt.Errorf("ошибка RESTORE %s: %w", newKey, err)
+	}
+	if err := r.client.Del(ctx, oldKey).Err(); err != nil {
+		return false, fmt.Errorf("ошибка удаления %s: %w", oldKey, err)
+	}
+	return true, nil
+}
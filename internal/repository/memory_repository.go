@@ -0,0 +1,1643 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"notification-mvp/internal/clock"
+	"notification-mvp/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+// memValue — значение с необязательным сроком жизни
+type memValue struct {
+	data      []byte
+	expiresAt time.Time // нулевое значение — без TTL
+}
+
+func (v memValue) expired(now time.Time) bool {
+	return !v.expiresAt.IsZero() && !now.Before(v.expiresAt)
+}
+
+// memLock — consumer-lock пользователя
+type memLock struct {
+	owner     string
+	expiresAt time.Time
+}
+
+// MemoryRepository реализует NotificationRepository в памяти процесса.
+// Повторяет семантику Redis-реализации (стримы, consumer group, PEL, TTL, retention)
+// и предназначен для одиночного dev-запуска и тестов сервиса и воркеров
+type MemoryRepository struct {
+	clock clock.Clock
+
+	mu          sync.Mutex
+	newMessages chan struct{} // закрывается при каждом XADD, будит блокирующие чтения
+
+	payloads    map[string]memValue                               // notification:<uuid>
+	streams     map[string]*memStream                             // stream:user:<userKey>
+	ttl         map[string]map[string]float64                     // notif:ttl:<userKey> (member -> unix sec)
+	states      map[string]map[string]string                      // notification_state:<userKey>
+	retention   map[string]int                                    // notif:retention:<userKey>
+	digests     map[string]memDigest                              // notif:digest:<userKey> и индекс notif:users:digest
+	escalations map[string]map[string]domain.Escalation           // notif:escalation:<userKey> (nid -> эскалация)
+	deliveries  map[string]map[string]domain.ChannelDelivery      // notif:channel:<userKey> (nid -> доставка)
+	webhooks    map[string]domain.Webhook                         // notif:webhook:<userKey>
+	prefs       map[string]domain.Preferences                     // notif:prefs:<userKey>
+	deferred    map[string]map[string]domain.DeferredNotification // notif:deferred:<userKey> (nid -> уведомление)
+	topics      map[string]map[string]struct{}                    // notif:topic:<topic> (userKey подписчиков)
+	subs        map[string]map[string]struct{}                    // notif:subscriptions:<userKey> (темы)
+	locks       map[string]memLock                                // notif:lock:consumer:<userKey>
+	idempotency map[string]memValue                               // notify:req:<key>
+	activity    map[string]time.Time                              // notif:users:active (userKey -> последняя активность)
+}
+
+// NewMemoryRepository создает хранилище в памяти. clk == nil означает системное время
+func NewMemoryRepository(clk clock.Clock) *MemoryRepository {
+	if clk == nil {
+		clk = clock.System{}
+	}
+	return &MemoryRepository{
+		clock:       clk,
+		newMessages: make(chan struct{}),
+		payloads:    make(map[string]memValue),
+		streams:     make(map[string]*memStream),
+		ttl:         make(map[string]map[string]float64),
+		states:      make(map[string]map[string]string),
+		retention:   make(map[string]int),
+		digests:     make(map[string]memDigest),
+		escalations: make(map[string]map[string]domain.Escalation),
+		deliveries:  make(map[string]map[string]domain.ChannelDelivery),
+		webhooks:    make(map[string]domain.Webhook),
+		prefs:       make(map[string]domain.Preferences),
+		deferred:    make(map[string]map[string]domain.DeferredNotification),
+		topics:      make(map[string]map[string]struct{}),
+		subs:        make(map[string]map[string]struct{}),
+		locks:       make(map[string]memLock),
+		idempotency: make(map[string]memValue),
+		activity:    make(map[string]time.Time),
+	}
+}
+
+// CreateNotification создает уведомление для одного получателя с учетом лимита его стрима
+func (r *MemoryRepository) CreateNotification(
+	ctx context.Context,
+	payload *domain.NotificationPayload,
+	target domain.Target,
+	limit domain.StreamLimit,
+) (domain.CreateResult, error) {
+	notificationID := payload.NotificationID
+	if notificationID == "" {
+		notificationID = uuid.New().String()
+		payload.NotificationID = notificationID
+	}
+	payload.Target = target
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return domain.CreateResult{}, fmt.Errorf("ошибка сериализации payload: %w", err)
+	}
+
+	userKey := domain.UserKey(target.ID, target.Login)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clock.Now()
+
+	// 1. Убеждаемся что стрим и Consumer Group существуют
+	stream := r.ensureStreamLocked(userKey)
+
+	// 2. Применяем лимит стрима (аналог addEntryScript)
+	var result domain.CreateResult
+	if excess := int64(len(stream.entries)) - limit.MaxLen + 1; limit.MaxLen > 0 && excess > 0 {
+		victims, ok := r.overflowVictimsLocked(userKey, stream, limit.Overflow, excess)
+		if !ok {
+			return domain.CreateResult{}, domain.ErrInboxFull
+		}
+		for _, v := range victims {
+			id, _ := parseMemID(v.StreamID)
+			if stream.group != nil {
+				delete(stream.group.pending, id)
+			}
+			stream.remove(id)
+			delete(r.ttl[userKey], domain.TTLSchedulerEntry(v.StreamID, v.NotificationID))
+			delete(r.payloads, v.NotificationID)
+		}
+		result.Dropped = victims
+	}
+
+	// 3. Сохраняем payload с TTL
+	r.payloads[notificationID] = memValue{data: payloadBytes, expiresAt: now.Add(domain.NotificationTTL)}
+
+	// 4. Добавляем ссылку в персональный стрим
+	id := stream.nextID(now)
+	stream.add(id, map[string]interface{}{
+		"nid":        notificationID,
+		"created_at": payload.CreatedAt.Format(time.RFC3339),
+	}, 0)
+	r.wakeReadersLocked()
+	result.StreamID = id.String()
+
+	// 5. Добавляем маркер истечения в планировщик
+	if r.ttl[userKey] == nil {
+		r.ttl[userKey] = make(map[string]float64)
+	}
+	r.ttl[userKey][domain.TTLSchedulerEntry(id.String(), notificationID)] = float64(now.Add(domain.NotificationTTL).Unix())
+	r.activity[userKey] = now
+
+	slog.DebugContext(ctx, "Создано уведомление",
+		"notification_id", notificationID,
+		"stream_id", result.StreamID,
+		"dropped", len(result.Dropped),
+		"user", userKey)
+
+	return result, nil
+}
+
+// overflowVictimsLocked выбирает excess записей для вытеснения по политике; false — новое уведомление отклоняется
+func (r *MemoryRepository) overflowVictimsLocked(
+	userKey string,
+	stream *memStream,
+	policy domain.OverflowPolicy,
+	excess int64,
+) ([]domain.DroppedEntry, bool) {
+	if policy == domain.OverflowRejectNew {
+		return nil, false
+	}
+
+	var victims []domain.DroppedEntry
+	for _, e := range stream.entries {
+		if int64(len(victims)) >= excess {
+			break
+		}
+		nid, _ := e.fields["nid"].(string)
+		_, read := r.states[userKey][nid]
+		if policy == domain.OverflowDropRead && !read {
+			continue
+		}
+		victims = append(victims, domain.DroppedEntry{NotificationID: nid, StreamID: e.id.String(), Read: read})
+	}
+	if int64(len(victims)) < excess {
+		return nil, false
+	}
+	return victims, true
+}
+
+// GetNotification получает уведомление получателя по ID
+func (r *MemoryRepository) GetNotification(
+	ctx context.Context,
+	userID int64,
+	login string,
+	notificationID string,
+) (*domain.NotificationPayload, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.getNotificationLocked(notificationID)
+}
+
+func (r *MemoryRepository) getNotificationLocked(notificationID string) (*domain.NotificationPayload, error) {
+	v, ok := r.payloads[notificationID]
+	if !ok {
+		return nil, nil
+	}
+	if v.expired(r.clock.Now()) {
+		delete(r.payloads, notificationID)
+		return nil, nil // Уведомление истекло
+	}
+
+	var payload domain.NotificationPayload
+	if err := json.Unmarshal(v.data, &payload); err != nil {
+		return nil, fmt.Errorf("ошибка десериализации payload: %w", err)
+	}
+	return &payload, nil
+}
+
+// EnsureConsumerGroup создает Consumer Group если её нет
+func (r *MemoryRepository) EnsureConsumerGroup(ctx context.Context, userID int64, login string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ensureStreamLocked(domain.UserKey(userID, login))
+	return nil
+}
+
+// ensureStreamLocked создает стрим и группу с позицией "$" (аналог XGROUP CREATE ... MKSTREAM)
+func (r *MemoryRepository) ensureStreamLocked(userKey string) *memStream {
+	stream, ok := r.streams[userKey]
+	if !ok {
+		stream = &memStream{}
+		r.streams[userKey] = stream
+	}
+	if stream.group == nil {
+		stream.group = &memGroup{lastDelivered: stream.lastID, pending: make(map[memID]*memPending)}
+	}
+	return stream
+}
+
+// wakeReadersLocked будит все ожидающие ReadNewMessages
+func (r *MemoryRepository) wakeReadersLocked() {
+	close(r.newMessages)
+	r.newMessages = make(chan struct{})
+}
+
+// ReadPendingMessages читает pending сообщения для consumer
+func (r *MemoryRepository) ReadPendingMessages(
+	ctx context.Context,
+	userID int64,
+	login string,
+	count int64,
+) ([]domain.StreamMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stream, err := r.groupStreamLocked(userID, login)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения pending сообщений: %w", err)
+	}
+
+	consumerID := domain.ConsumerID(userID)
+	now := r.clock.Now()
+	messages := []domain.StreamMessage{}
+
+	for _, id := range stream.group.pendingIDs() {
+		if count > 0 && int64(len(messages)) >= count {
+			break
+		}
+		p := stream.group.pending[id]
+		if p.consumer != consumerID {
+			continue
+		}
+		p.deliveredAt = now
+		p.count++
+
+		// Удалённые из стрима записи остаются в PEL и возвращаются без полей
+		entry, _ := stream.find(id)
+		messages = append(messages, r.toStreamMessageLocked(id, entry.fields))
+	}
+
+	return messages, nil
+}
+
+// ReadNewMessages читает новые сообщения из stream с блокировкой
+func (r *MemoryRepository) ReadNewMessages(
+	ctx context.Context,
+	userID int64,
+	login string,
+	blockTime time.Duration,
+	count int64,
+) ([]domain.StreamMessage, error) {
+	// Таймаут блокировки идет по часам хранилища: в тестах его срабатывание управляется clock.Fake
+	deadline := r.clock.After(blockTime)
+
+	for {
+		r.mu.Lock()
+		stream, err := r.groupStreamLocked(userID, login)
+		if err != nil {
+			r.mu.Unlock()
+			return nil, fmt.Errorf("ошибка чтения новых сообщений: %w", err)
+		}
+
+		messages := r.deliverNewLocked(stream, domain.ConsumerID(userID), count)
+		wait := r.newMessages
+		r.mu.Unlock()
+
+		if len(messages) > 0 {
+			return messages, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("ошибка чтения новых сообщений: %w", ctx.Err())
+		case <-deadline:
+			return []domain.StreamMessage{}, nil // Нет новых сообщений за время блокировки
+		case <-wait:
+		}
+	}
+}
+
+// deliverNewLocked выдаёт записи после last-delivered-id и заносит их в PEL (XREADGROUP ">")
+func (r *MemoryRepository) deliverNewLocked(stream *memStream, consumerID string, count int64) []domain.StreamMessage {
+	now := r.clock.Now()
+	var messages []domain.StreamMessage
+
+	for _, e := range stream.entries {
+		if count > 0 && int64(len(messages)) >= count {
+			break
+		}
+		if !stream.group.lastDelivered.less(e.id) {
+			continue
+		}
+		stream.group.lastDelivered = e.id
+		stream.group.pending[e.id] = &memPending{consumer: consumerID, deliveredAt: now, count: 1}
+		messages = append(messages, r.toStreamMessageLocked(e.id, e.fields))
+	}
+
+	return messages
+}
+
+// groupStreamLocked возвращает стрим с группой или ошибку NOGROUP, как Redis
+func (r *MemoryRepository) groupStreamLocked(userID int64, login string) (*memStream, error) {
+	stream, ok := r.streams[domain.UserKey(userID, login)]
+	if !ok || stream.group == nil {
+		return nil, fmt.Errorf("NOGROUP нет consumer group %s для стрима %s",
+			domain.ConsumerGroupName, domain.StreamKey(userID, login))
+	}
+	return stream, nil
+}
+
+// toStreamMessageLocked формирует сообщение и подгружает payload
+func (r *MemoryRepository) toStreamMessageLocked(id memID, fields map[string]interface{}) domain.StreamMessage {
+	msg := domain.StreamMessage{ID: id.String(), Fields: copyFields(fields)}
+	if nid, ok := fields["nid"].(string); ok {
+		payload, err := r.getNotificationLocked(nid)
+		if err != nil {
+			slog.Warn("Ошибка загрузки payload", "error", err, "nid", nid)
+		}
+		msg.Payload = payload
+	}
+	return msg
+}
+
+// AckMessage подтверждает прочтение сообщения, проверяя запись стрима (аналог ackScript)
+func (r *MemoryRepository) AckMessage(
+	ctx context.Context,
+	userID int64,
+	login string,
+	streamID, notificationID string,
+) (domain.AckResult, error) {
+	userKey := domain.UserKey(userID, login)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := r.ackLocked(userKey, streamID, notificationID, "read")
+	if result == domain.AckResultAcked || result == domain.AckResultAlreadyRead {
+		r.cancelEscalationLocked(userKey, notificationID)
+		r.cancelChannelDeliveryLocked(userKey, notificationID)
+	}
+	if result == domain.AckResultAcked {
+		slog.DebugContext(ctx, "Помечено прочтение уведомления",
+			"notification_id", notificationID,
+			"stream_id", streamID,
+			"user", userKey)
+	}
+	return result, nil
+}
+
+// ackLocked подтверждает запись стрима и записывает статус уведомления, если его еще нет
+func (r *MemoryRepository) ackLocked(userKey, streamID, notificationID, state string) domain.AckResult {
+	// 1. Проверяем, что запись существует и ссылается на notificationID
+	stream, ok := r.streams[userKey]
+	if !ok {
+		return domain.AckResultUnknown
+	}
+	id, err := parseMemID(streamID)
+	if err != nil {
+		return domain.AckResultUnknown
+	}
+	entry, ok := stream.find(id)
+	if !ok {
+		return domain.AckResultUnknown
+	}
+	if nid, _ := entry.fields["nid"].(string); nid != notificationID {
+		return domain.AckResultMismatched
+	}
+
+	// 2. Подтверждаем сообщение в Consumer Group (оставляем запись в стриме)
+	if stream.group != nil {
+		delete(stream.group.pending, id)
+	}
+	r.activity[userKey] = r.clock.Now()
+
+	// 3. Помечаем уведомление как прочитанное
+	if r.states[userKey] == nil {
+		r.states[userKey] = make(map[string]string)
+	}
+	if _, ok := r.states[userKey][notificationID]; ok {
+		return domain.AckResultAlreadyRead
+	}
+	r.states[userKey][notificationID] = state
+	return domain.AckResultAcked
+}
+
+// AcquireConsumerLock пытается получить эксклюзивную блокировку чтения для пользователя
+func (r *MemoryRepository) AcquireConsumerLock(
+	ctx context.Context,
+	userID int64,
+	login string,
+	podID string,
+	ttl time.Duration,
+) (bool, error) {
+	userKey := domain.UserKey(userID, login)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clock.Now()
+	if l, ok := r.locks[userKey]; ok && now.Before(l.expiresAt) {
+		return false, nil
+	}
+	r.locks[userKey] = memLock{owner: podID, expiresAt: now.Add(ttl)}
+	return true, nil
+}
+
+// RenewConsumerLock продлевает блокировку если она принадлежит podID
+func (r *MemoryRepository) RenewConsumerLock(
+	ctx context.Context,
+	userID int64,
+	login string,
+	podID string,
+	ttl time.Duration,
+) (bool, error) {
+	userKey := domain.UserKey(userID, login)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clock.Now()
+	l, ok := r.locks[userKey]
+	if !ok || !now.Before(l.expiresAt) || l.owner != podID {
+		return false, nil
+	}
+	l.expiresAt = now.Add(ttl)
+	r.locks[userKey] = l
+	return true, nil
+}
+
+// ReleaseConsumerLock снимает блокировку если она принадлежит podID
+func (r *MemoryRepository) ReleaseConsumerLock(
+	ctx context.Context,
+	userID int64,
+	login string,
+	podID string,
+) error {
+	userKey := domain.UserKey(userID, login)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if l, ok := r.locks[userKey]; ok && l.owner == podID {
+		delete(r.locks, userKey)
+	}
+	return nil
+}
+
+// CleanupExpiredNotifications удаляет просроченные уведомления и возвращает их notification_id
+func (r *MemoryRepository) CleanupExpiredNotifications(
+	ctx context.Context,
+	userID int64,
+	login string,
+	limit int64,
+) ([]string, error) {
+	userKey := domain.UserKey(userID, login)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := float64(r.clock.Now().Unix())
+	expired := r.expiredMembersLocked(userKey, now, limit)
+	if len(expired) == 0 {
+		return nil, nil
+	}
+
+	stream := r.streams[userKey]
+	var cleaned []string
+	for _, member := range expired {
+		delete(r.ttl[userKey], member)
+
+		streamID, notificationID, ok := strings.Cut(member, "|")
+		if !ok {
+			continue
+		}
+
+		// Подтверждаем и удаляем сообщение
+		if id, err := parseMemID(streamID); err == nil && stream != nil {
+			if stream.group != nil {
+				delete(stream.group.pending, id)
+			}
+			stream.remove(id)
+		}
+		delete(r.payloads, notificationID)
+		r.cancelEscalationLocked(userKey, notificationID)
+		r.cancelChannelDeliveryLocked(userKey, notificationID)
+
+		cleaned = append(cleaned, notificationID)
+	}
+
+	if len(r.ttl[userKey]) == 0 {
+		delete(r.ttl, userKey) // пустой ZSET в Redis не существует
+	}
+
+	slog.DebugContext(ctx, "Очищены просроченные уведомления",
+		"user", userKey,
+		"count", len(cleaned))
+
+	return cleaned, nil
+}
+
+// expiredMembersLocked возвращает до limit записей планировщика со score <= now по возрастанию score
+func (r *MemoryRepository) expiredMembersLocked(userKey string, now float64, limit int64) []string {
+	type scored struct {
+		member string
+		score  float64
+	}
+	var due []scored
+	for member, score := range r.ttl[userKey] {
+		if score <= now {
+			due = append(due, scored{member, score})
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].score != due[j].score {
+			return due[i].score < due[j].score
+		}
+		return due[i].member < due[j].member
+	})
+	if limit > 0 && int64(len(due)) > limit {
+		due = due[:limit]
+	}
+
+	members := make([]string, len(due))
+	for i, d := range due {
+		members[i] = d.member
+	}
+	return members
+}
+
+// ReclaimPendingMessages перехватывает зависшие сообщения (аналог XAUTOCLAIM)
+func (r *MemoryRepository) ReclaimPendingMessages(
+	ctx context.Context,
+	userID int64,
+	login string,
+	minIdleTime time.Duration,
+	count int64,
+) ([]domain.StreamMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stream, err := r.groupStreamLocked(userID, login)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка перехвата зависших сообщений: %w", err)
+	}
+
+	consumerID := domain.ConsumerID(userID)
+	now := r.clock.Now()
+	var messages []domain.StreamMessage
+
+	for _, id := range stream.group.pendingIDs() {
+		if count > 0 && int64(len(messages)) >= count {
+			break
+		}
+		p := stream.group.pending[id]
+		if now.Sub(p.deliveredAt) < minIdleTime {
+			continue
+		}
+
+		entry, ok := stream.find(id)
+		if !ok {
+			// XAUTOCLAIM убирает из PEL записи, удалённые из стрима
+			delete(stream.group.pending, id)
+			continue
+		}
+
+		p.consumer = consumerID
+		p.deliveredAt = now
+		p.count++
+		messages = append(messages, r.toStreamMessageLocked(id, entry.fields))
+	}
+
+	if len(messages) > 0 {
+		slog.DebugContext(ctx, "Перехвачены зависшие сообщения",
+			"user", domain.UserKey(userID, login),
+			"count", len(messages))
+	}
+
+	return messages, nil
+}
+
+// GetDueUserKeys возвращает до limit пользователей, у которых к моменту now истек TTL уведомлений.
+// Индекс истечений в памяти не нужен: ближайшее истечение вычисляется по планировщику
+func (r *MemoryRepository) GetDueUserKeys(ctx context.Context, now time.Time, offset, limit int64) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	type scored struct {
+		userKey string
+		next    float64
+	}
+	var due []scored
+	for userKey, members := range r.ttl {
+		next := math.Inf(1)
+		for _, score := range members {
+			next = math.Min(next, score)
+		}
+		if next <= float64(now.Unix()) {
+			due = append(due, scored{userKey, next})
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].next != due[j].next {
+			return due[i].next < due[j].next
+		}
+		return due[i].userKey < due[j].userKey
+	})
+
+	keys := make([]string, len(due))
+	for i, d := range due {
+		keys[i] = d.userKey
+	}
+	return pageDue(keys, offset, limit), nil
+}
+
+// pageDue вырезает страницу из отсортированной выборки индекса, как ZRANGEBYSCORE ... LIMIT offset count
+func pageDue(items []string, offset, limit int64) []string {
+	if offset >= int64(len(items)) {
+		return []string{}
+	}
+	items = items[offset:]
+	if limit > 0 && int64(len(items)) > limit {
+		items = items[:limit]
+	}
+	return items
+}
+
+// GetActiveUserKeys возвращает до limit пользователей с активностью не раньше since (нулевое время — всех)
+// в порядке индекса активных: по времени активности с точностью до секунды, затем по ключу
+func (r *MemoryRepository) GetActiveUserKeys(ctx context.Context, since time.Time, offset, limit int64) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := make([]string, 0, len(r.activity))
+	for userKey, at := range r.activity {
+		if !at.Before(since) {
+			keys = append(keys, userKey)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ai, aj := r.activity[keys[i]].Unix(), r.activity[keys[j]].Unix()
+		if ai != aj {
+			return ai < aj
+		}
+		return keys[i] < keys[j]
+	})
+	return pageDue(keys, offset, limit), nil
+}
+
+// SaveIdempotencyResult сохраняет результат для идемпотентности
+func (r *MemoryRepository) SaveIdempotencyResult(ctx context.Context, key string, result *domain.NotifyResponse) error {
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации результата идемпотентности: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.idempotency[key] = memValue{data: resultBytes, expiresAt: r.clock.Now().Add(domain.IdempotencyTTL)}
+	return nil
+}
+
+// GetIdempotencyResult получает сохраненный результат
+func (r *MemoryRepository) GetIdempotencyResult(ctx context.Context, key string) (*domain.NotifyResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, ok := r.idempotency[key]
+	if !ok {
+		return nil, nil
+	}
+	if v.expired(r.clock.Now()) {
+		delete(r.idempotency, key)
+		return nil, nil
+	}
+
+	var result domain.NotifyResponse
+	if err := json.Unmarshal(v.data, &result); err != nil {
+		return nil, fmt.Errorf("ошибка десериализации результата идемпотентности: %w", err)
+	}
+	return &result, nil
+}
+
+// GetPendingNotifications получает список pending уведомлений для пользователя
+func (r *MemoryRepository) GetPendingNotifications(
+	ctx context.Context,
+	userID int64,
+	login string,
+) ([]domain.StreamMessage, error) {
+	return r.ReadPendingMessages(ctx, userID, login, 100)
+}
+
+// GetAllPendingNotifications получает pending уведомления для всех пользователей
+func (r *MemoryRepository) GetAllPendingNotifications(ctx context.Context) (map[string][]domain.StreamMessage, error) {
+	// Pending сообщения остаются только у пользователей, активных в пределах окна TTL
+	userKeys, err := r.GetActiveUserKeys(ctx, r.clock.Now().Add(-domain.PendingActivityWindow), 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения пользовательских ключей: %w", err)
+	}
+
+	result := make(map[string][]domain.StreamMessage)
+	for _, userKey := range userKeys {
+		userID, login, err := domain.ParseUserKey(userKey)
+		if err != nil {
+			slog.WarnContext(ctx, "Ошибка парсинга user key", "user_key", userKey, "error", err)
+			continue
+		}
+
+		pendingMessages, err := r.GetPendingNotifications(ctx, userID, login)
+		if err != nil {
+			slog.WarnContext(ctx, "Ошибка получения pending уведомлений",
+				"user_id", userID, "login", login, "error", err)
+			continue
+		}
+		if len(pendingMessages) > 0 {
+			result[userKey] = pendingMessages
+		}
+	}
+
+	return result, nil
+}
+
+// RangeLastMessages возвращает последние count сообщений из стрима пользователя
+func (r *MemoryRepository) RangeLastMessages(
+	ctx context.Context,
+	userID int64,
+	login string,
+	count int64,
+) ([]domain.StreamMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stream, ok := r.streams[domain.UserKey(userID, login)]
+	if !ok {
+		return []domain.StreamMessage{}, nil
+	}
+
+	entries := stream.entries
+	if count > 0 && int64(len(entries)) > count {
+		entries = entries[int64(len(entries))-count:]
+	}
+
+	messages := make([]domain.StreamMessage, 0, len(entries))
+	for _, e := range entries {
+		messages = append(messages, r.toStreamMessageLocked(e.id, e.fields))
+	}
+	return messages, nil
+}
+
+// GetReadStatuses возвращает признак прочтения для списка notification_id
+func (r *MemoryRepository) GetReadStatuses(
+	ctx context.Context,
+	userID int64,
+	login string,
+	notificationIDs []string,
+) (map[string]bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state := r.states[domain.UserKey(userID, login)]
+	result := make(map[string]bool, len(notificationIDs))
+	for _, nid := range notificationIDs {
+		result[nid] = domain.IsReadState(state[nid])
+	}
+	return result, nil
+}
+
+// SetUserRetentionDays сохраняет срок хранения для пользователя (1..15 дней)
+func (r *MemoryRepository) SetUserRetentionDays(ctx context.Context, userID int64, login string, days int) error {
+	if days < 1 {
+		days = 1
+	}
+	if days > 15 {
+		days = 15
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.retention[domain.UserKey(userID, login)] = days
+	return nil
+}
+
+// GetUserRetentionDays возвращает срок хранения в днях (дефолт 7)
+func (r *MemoryRepository) GetUserRetentionDays(ctx context.Context, userID int64, login string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if d, ok := r.retention[domain.UserKey(userID, login)]; ok {
+		return d, nil
+	}
+	return 7, nil
+}
+
+// memDigest — настройки сводки пользователя, время следующей сводки и кандидаты в нее
+type memDigest struct {
+	pref       domain.DigestPreference
+	next       time.Time
+	candidates []domain.DigestCandidate // в порядке записи стрима, аналог notif:digest_candidates:<userKey>
+}
+
+// SetDigestPreference сохраняет настройки сводки и планирует следующую сводку
+func (r *MemoryRepository) SetDigestPreference(ctx context.Context, userID int64, login string, pref domain.DigestPreference) error {
+	userKey := domain.UserKey(userID, login)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if pref.Mode == domain.DigestOff {
+		delete(r.digests, userKey)
+		return nil
+	}
+	from := r.clock.Now()
+	if pref.LastDigestAt != nil {
+		from = *pref.LastDigestAt
+	}
+	r.digests[userKey] = memDigest{pref: pref, next: pref.NextRun(from), candidates: r.digests[userKey].candidates}
+	return nil
+}
+
+// GetDigestPreference возвращает настройки сводки пользователя
+func (r *MemoryRepository) GetDigestPreference(ctx context.Context, userID int64, login string) (*domain.DigestPreference, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, ok := r.digests[domain.UserKey(userID, login)]
+	if !ok {
+		return nil, nil
+	}
+	pref := d.pref
+	return &pref, nil
+}
+
+// GetDueDigestUserKeys возвращает до limit пользователей, чья сводка запланирована не позже now
+func (r *MemoryRepository) GetDueDigestUserKeys(ctx context.Context, now time.Time, offset, limit int64) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	type due struct {
+		userKey string
+		next    time.Time
+	}
+	var dues []due
+	for userKey, d := range r.digests {
+		if !d.next.After(now) {
+			dues = append(dues, due{userKey: userKey, next: d.next})
+		}
+	}
+	sort.Slice(dues, func(i, j int) bool {
+		if !dues[i].next.Equal(dues[j].next) {
+			return dues[i].next.Before(dues[j].next)
+		}
+		return dues[i].userKey < dues[j].userKey
+	})
+
+	keys := make([]string, len(dues))
+	for i, d := range dues {
+		keys[i] = d.userKey
+	}
+	return pageDue(keys, offset, limit), nil
+}
+
+// AddDigestCandidate запоминает уведомление для следующей сводки, если сводка пользователю настроена
+func (r *MemoryRepository) AddDigestCandidate(ctx context.Context, userID int64, login string, candidate domain.DigestCandidate) error {
+	at := domain.StreamIDTime(candidate.StreamID)
+	if at.IsZero() {
+		return fmt.Errorf("неверный ID записи стрима кандидата в сводку: %q", candidate.StreamID)
+	}
+	userKey := domain.UserKey(userID, login)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, ok := r.digests[userKey]
+	if !ok {
+		return nil
+	}
+	cutoff := at.Add(-domain.DigestCandidatesTTL)
+	kept := d.candidates[:0]
+	for _, c := range d.candidates {
+		if !domain.StreamIDTime(c.StreamID).Before(cutoff) {
+			kept = append(kept, c)
+		}
+	}
+	d.candidates = append(kept, candidate)
+	r.digests[userKey] = d
+	return nil
+}
+
+// GetDigestCandidates возвращает до limit последних кандидатов в сводку, записанных после since
+func (r *MemoryRepository) GetDigestCandidates(ctx context.Context, userID int64, login string, since time.Time, limit int64) ([]domain.DigestCandidate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var candidates []domain.DigestCandidate
+	for _, c := range r.digests[domain.UserKey(userID, login)].candidates {
+		if since.IsZero() || domain.StreamIDTime(c.StreamID).After(since) {
+			candidates = append(candidates, c)
+		}
+	}
+	if limit > 0 && int64(len(candidates)) > limit {
+		candidates = candidates[int64(len(candidates))-limit:]
+	}
+	return candidates, nil
+}
+
+// MarkDigested подтверждает записи стрима и помечает непрочитанные уведомления статусом digested
+func (r *MemoryRepository) MarkDigested(ctx context.Context, userID int64, login string, items []domain.DigestCandidate) (int, error) {
+	userKey := domain.UserKey(userID, login)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	marked := 0
+	for _, item := range items {
+		if r.ackLocked(userKey, item.StreamID, item.NotificationID, domain.StateDigested) == domain.AckResultAcked {
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+// TrimUserStreamByRetention удаляет записи старше срока хранения (аналог XTRIM MINID)
+func (r *MemoryRepository) TrimUserStreamByRetention(ctx context.Context, userID int64, login string) error {
+	days, err := r.GetUserRetentionDays(ctx, userID, login)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	userKey := domain.UserKey(userID, login)
+	stream, ok := r.streams[userKey]
+	if !ok {
+		delete(r.activity, userKey)
+		return nil
+	}
+	cutoff := r.clock.Now().Add(-time.Duration(days) * 24 * time.Hour)
+	stream.trimMinID(memID{ms: cutoff.UnixMilli()})
+	if len(stream.entries) == 0 {
+		delete(r.activity, userKey) // пустой стрим — пользователь выпадает из индекса активных
+	}
+	return nil
+}
+
+// CompactReadStates удаляет статусы прочтения уведомлений, которых больше нет ни в стриме, ни в кандидатах в сводку
+func (r *MemoryRepository) CompactReadStates(ctx context.Context, userID int64, login string) (int64, int64, error) {
+	userKey := domain.UserKey(userID, login)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	states := r.states[userKey]
+	if len(states) == 0 {
+		return 0, 0, nil
+	}
+
+	present := make(map[string]bool)
+	if stream, ok := r.streams[userKey]; ok {
+		for _, e := range stream.entries {
+			if nid, ok := e.fields["nid"].(string); ok {
+				present[nid] = true
+			}
+		}
+	}
+	for _, c := range r.digests[userKey].candidates {
+		present[c.NotificationID] = true
+	}
+
+	var removed int64
+	for nid := range states {
+		if !present[nid] {
+			delete(states, nid)
+			removed++
+		}
+	}
+	if len(states) == 0 {
+		delete(r.states, userKey) // пустой хэш в Redis не существует
+	}
+	return removed, int64(len(states)), nil
+}
+
+// ExportUserData выгружает стрим, payload, статусы прочтения и retention пользователя
+func (r *MemoryRepository) ExportUserData(ctx context.Context, userID int64, login string) (*domain.UserDataExport, error) {
+	userKey := domain.UserKey(userID, login)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	days, retentionSet := r.retention[userKey]
+	if !retentionSet {
+		days = 7
+	}
+	export := &domain.UserDataExport{
+		Target:        domain.Target{ID: userID, Login: login},
+		Entries:       []domain.ExportedEntry{},
+		ReadStates:    make(map[string]string, len(r.states[userKey])),
+		RetentionDays: days,
+		RetentionSet:  retentionSet,
+		ExportedAt:    r.clock.Now().UTC(),
+	}
+	if d, ok := r.digests[userKey]; ok {
+		pref := d.pref
+		export.Digest = &pref
+	}
+	for _, esc := range r.escalations[userKey] {
+		export.Escalations = append(export.Escalations, esc)
+	}
+	for _, d := range r.deliveries[userKey] {
+		export.Deliveries = append(export.Deliveries, d)
+	}
+	if hook, ok := r.webhooks[userKey]; ok {
+		hook.Secret = ""
+		export.Webhook = &hook
+	}
+	if prefs, ok := r.prefs[userKey]; ok {
+		export.Preferences = &prefs
+	}
+	for _, d := range r.deferred[userKey] {
+		export.Deferred = append(export.Deferred, d)
+	}
+	for topic := range r.subs[userKey] {
+		export.Topics = append(export.Topics, topic)
+	}
+	sort.Strings(export.Topics)
+	for nid, state := range r.states[userKey] {
+		export.ReadStates[nid] = state
+	}
+
+	stream, ok := r.streams[userKey]
+	if !ok {
+		return export, nil
+	}
+	for _, e := range stream.entries {
+		nid, _ := e.fields["nid"].(string)
+		payload, err := r.getNotificationLocked(nid)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка выгрузки уведомления %s: %w", nid, err)
+		}
+		entry := domain.ExportedEntry{
+			StreamID:       e.id.String(),
+			NotificationID: nid,
+			Fields:         copyFields(e.fields),
+			Payload:        payload,
+			Read:           domain.IsReadState(export.ReadStates[nid]),
+		}
+		if score, ok := r.ttl[userKey][domain.TTLSchedulerEntry(e.id.String(), nid)]; ok {
+			t := time.Unix(int64(score), 0).UTC()
+			entry.ExpiresAt = &t
+		}
+		export.Entries = append(export.Entries, entry)
+	}
+	return export, nil
+}
+
+// EraseUserData удаляет все данные пользователя, включая payload вытесненных из стрима уведомлений
+func (r *MemoryRepository) EraseUserData(ctx context.Context, userID int64, login string) (*domain.ErasureReport, error) {
+	userKey := domain.UserKey(userID, login)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	nids := make(map[string]bool)
+	if stream, ok := r.streams[userKey]; ok {
+		for _, e := range stream.entries {
+			if nid, ok := e.fields["nid"].(string); ok {
+				nids[nid] = true
+			}
+		}
+	}
+	for member := range r.ttl[userKey] {
+		if _, nid, ok := strings.Cut(member, "|"); ok {
+			nids[nid] = true
+		}
+	}
+	for nid := range r.states[userKey] {
+		nids[nid] = true
+	}
+
+	now := r.clock.Now()
+	report := &domain.ErasureReport{
+		Target:   domain.Target{ID: userID, Login: login},
+		ErasedAt: now.UTC(),
+	}
+	for nid := range nids {
+		if v, ok := r.payloads[nid]; ok {
+			delete(r.payloads, nid)
+			if !v.expired(now) {
+				report.PayloadsDeleted++
+			}
+		}
+	}
+
+	if _, ok := r.streams[userKey]; ok {
+		delete(r.streams, userKey)
+		report.KeysDeleted++
+	}
+	if _, ok := r.ttl[userKey]; ok {
+		delete(r.ttl, userKey)
+		report.KeysDeleted++
+	}
+	if _, ok := r.states[userKey]; ok {
+		delete(r.states, userKey)
+		report.KeysDeleted++
+	}
+	if lock, ok := r.locks[userKey]; ok {
+		delete(r.locks, userKey)
+		if now.Before(lock.expiresAt) {
+			report.KeysDeleted++
+		}
+	}
+	if _, ok := r.retention[userKey]; ok {
+		delete(r.retention, userKey)
+		report.KeysDeleted++
+	}
+	if _, ok := r.digests[userKey]; ok {
+		delete(r.digests, userKey)
+		report.KeysDeleted++
+	}
+	if _, ok := r.escalations[userKey]; ok {
+		delete(r.escalations, userKey)
+		report.KeysDeleted++
+	}
+	if _, ok := r.deliveries[userKey]; ok {
+		delete(r.deliveries, userKey)
+		report.KeysDeleted++
+	}
+	if _, ok := r.webhooks[userKey]; ok {
+		delete(r.webhooks, userKey)
+		report.KeysDeleted++
+	}
+	if _, ok := r.prefs[userKey]; ok {
+		delete(r.prefs, userKey)
+		report.KeysDeleted++
+	}
+	if _, ok := r.deferred[userKey]; ok {
+		delete(r.deferred, userKey)
+		report.KeysDeleted++
+	}
+	if topics, ok := r.subs[userKey]; ok {
+		for topic := range topics {
+			r.removeSubscriberLocked(topic, userKey)
+		}
+		delete(r.subs, userKey)
+		report.KeysDeleted++
+	}
+	delete(r.activity, userKey)
+
+	// Результаты пользователя вырезаются из сохраненных ответов идемпотентности
+	for key, v := range r.idempotency {
+		if v.expired(now) {
+			continue
+		}
+		var result domain.NotifyResponse
+		if err := json.Unmarshal(v.data, &result); err != nil {
+			return nil, fmt.Errorf("ошибка десериализации результата идемпотентности: %w", err)
+		}
+		kept := result.Results[:0]
+		for _, res := range result.Results {
+			if res.Target != report.Target {
+				kept = append(kept, res)
+			}
+		}
+		if len(kept) == len(result.Results) {
+			continue
+		}
+		if len(kept) == 0 {
+			delete(r.idempotency, key)
+			report.KeysDeleted++
+			continue
+		}
+		result.Results = kept
+		data, err := json.Marshal(result)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сериализации результата идемпотентности: %w", err)
+		}
+		r.idempotency[key] = memValue{data: data, expiresAt: v.expiresAt}
+	}
+	return report, nil
+}
+
+// ScheduleEscalation сохраняет эскалацию уведомления; время шага вычисляется из самой эскалации
+func (r *MemoryRepository) ScheduleEscalation(ctx context.Context, esc domain.Escalation) error {
+	userKey := domain.UserKey(esc.Target.ID, esc.Target.Login)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.escalations[userKey] == nil {
+		r.escalations[userKey] = make(map[string]domain.Escalation)
+	}
+	r.escalations[userKey][esc.NotificationID] = esc
+	return nil
+}
+
+// AdvanceEscalation сохраняет эскалацию после шага, если она не отменена
+func (r *MemoryRepository) AdvanceEscalation(ctx context.Context, esc domain.Escalation) (bool, error) {
+	userKey := domain.UserKey(esc.Target.ID, esc.Target.Login)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.escalations[userKey][esc.NotificationID]; !ok {
+		return false, nil
+	}
+	if esc.Done() {
+		r.cancelEscalationLocked(userKey, esc.NotificationID)
+		return false, nil
+	}
+	r.escalations[userKey][esc.NotificationID] = esc
+	return true, nil
+}
+
+// GetEscalation возвращает эскалацию уведомления
+func (r *MemoryRepository) GetEscalation(ctx context.Context, userID int64, login string, notificationID string) (*domain.Escalation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	esc, ok := r.escalations[domain.UserKey(userID, login)][notificationID]
+	if !ok {
+		return nil, nil
+	}
+	return &esc, nil
+}
+
+// GetDueEscalations возвращает до limit эскалаций, чей шаг наступил не позже now
+func (r *MemoryRepository) GetDueEscalations(ctx context.Context, now time.Time, offset, limit int64) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	type due struct {
+		member string
+		next   time.Time
+	}
+	var dues []due
+	for userKey, byID := range r.escalations {
+		for nid, esc := range byID {
+			if next := esc.NextRunAt(); !next.After(now) {
+				dues = append(dues, due{member: domain.NotificationMember(userKey, nid), next: next})
+			}
+		}
+	}
+	sort.Slice(dues, func(i, j int) bool {
+		if !dues[i].next.Equal(dues[j].next) {
+			return dues[i].next.Before(dues[j].next)
+		}
+		return dues[i].member < dues[j].member
+	})
+
+	members := make([]string, len(dues))
+	for i, d := range dues {
+		members[i] = d.member
+	}
+	return pageDue(members, offset, limit), nil
+}
+
+// CancelEscalation удаляет эскалацию уведомления
+func (r *MemoryRepository) CancelEscalation(ctx context.Context, userID int64, login string, notificationID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cancelEscalationLocked(domain.UserKey(userID, login), notificationID)
+	return nil
+}
+
+func (r *MemoryRepository) cancelEscalationLocked(userKey, notificationID string) {
+	byID, ok := r.escalations[userKey]
+	if !ok {
+		return
+	}
+	delete(byID, notificationID)
+	if len(byID) == 0 {
+		delete(r.escalations, userKey)
+	}
+}
+
+// ScheduleChannelDelivery сохраняет отложенную доставку внешними каналами
+func (r *MemoryRepository) ScheduleChannelDelivery(ctx context.Context, d domain.ChannelDelivery) error {
+	userKey := domain.UserKey(d.Target.ID, d.Target.Login)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.deliveries[userKey] == nil {
+		r.deliveries[userKey] = make(map[string]domain.ChannelDelivery)
+	}
+	r.deliveries[userKey][d.NotificationID] = d
+	return nil
+}
+
+// GetChannelDelivery возвращает отложенную доставку уведомления
+func (r *MemoryRepository) GetChannelDelivery(ctx context.Context, userID int64, login string, notificationID string) (*domain.ChannelDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, ok := r.deliveries[domain.UserKey(userID, login)][notificationID]
+	if !ok {
+		return nil, nil
+	}
+	d.Sent = slices.Clone(d.Sent)
+	d.Channels = slices.Clone(d.Channels)
+	return &d, nil
+}
+
+// GetDueChannelDeliveries возвращает до limit доставок, запланированных не позже now
+func (r *MemoryRepository) GetDueChannelDeliveries(ctx context.Context, now time.Time, offset, limit int64) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	type due struct {
+		member string
+		at     time.Time
+	}
+	var dues []due
+	for userKey, byID := range r.deliveries {
+		for nid, d := range byID {
+			if !d.DueAt.After(now) {
+				dues = append(dues, due{member: domain.NotificationMember(userKey, nid), at: d.DueAt})
+			}
+		}
+	}
+	sort.Slice(dues, func(i, j int) bool {
+		if !dues[i].at.Equal(dues[j].at) {
+			return dues[i].at.Before(dues[j].at)
+		}
+		return dues[i].member < dues[j].member
+	})
+
+	members := make([]string, len(dues))
+	for i, d := range dues {
+		members[i] = d.member
+	}
+	return pageDue(members, offset, limit), nil
+}
+
+// CancelChannelDelivery удаляет отложенную доставку
+func (r *MemoryRepository) CancelChannelDelivery(ctx context.Context, userID int64, login string, notificationID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cancelChannelDeliveryLocked(domain.UserKey(userID, login), notificationID)
+	return nil
+}
+
+func (r *MemoryRepository) cancelChannelDeliveryLocked(userKey, notificationID string) {
+	byID, ok := r.deliveries[userKey]
+	if !ok {
+		return
+	}
+	delete(byID, notificationID)
+	if len(byID) == 0 {
+		delete(r.deliveries, userKey)
+	}
+}
+
+// HasConsumerLock сообщает, держит ли какая-либо сессия consumer lock пользователя
+func (r *MemoryRepository) HasConsumerLock(ctx context.Context, userID int64, login string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lock, ok := r.locks[domain.UserKey(userID, login)]
+	return ok && r.clock.Now().Before(lock.expiresAt), nil
+}
+
+// SetWebhook сохраняет регистрацию webhook пользователя
+func (r *MemoryRepository) SetWebhook(ctx context.Context, userID int64, login string, hook domain.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.webhooks[domain.UserKey(userID, login)] = hook
+	return nil
+}
+
+// GetWebhook возвращает регистрацию webhook пользователя
+func (r *MemoryRepository) GetWebhook(ctx context.Context, userID int64, login string) (*domain.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hook, ok := r.webhooks[domain.UserKey(userID, login)]
+	if !ok {
+		return nil, nil
+	}
+	return &hook, nil
+}
+
+// DeleteWebhook удаляет регистрацию webhook пользователя
+func (r *MemoryRepository) DeleteWebhook(ctx context.Context, userID int64, login string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.webhooks, domain.UserKey(userID, login))
+	return nil
+}
+
+// SetPreferences сохраняет настройки уведомлений пользователя
+func (r *MemoryRepository) SetPreferences(ctx context.Context, userID int64, login string, prefs domain.Preferences) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.prefs[domain.UserKey(userID, login)] = clonePreferences(prefs)
+	return nil
+}
+
+// GetPreferences возвращает настройки уведомлений пользователя
+func (r *MemoryRepository) GetPreferences(ctx context.Context, userID int64, login string) (*domain.Preferences, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prefs, ok := r.prefs[domain.UserKey(userID, login)]
+	if !ok {
+		return nil, nil
+	}
+	prefs = clonePreferences(prefs)
+	return &prefs, nil
+}
+
+// clonePreferences копирует срезы и карту настроек, чтобы вызывающий не менял хранимое значение
+func clonePreferences(p domain.Preferences) domain.Preferences {
+	p.MutedSources = slices.Clone(p.MutedSources)
+	if p.CategoryChannels != nil {
+		channels := make(map[string][]string, len(p.CategoryChannels))
+		for category, list := range p.CategoryChannels {
+			channels[category] = slices.Clone(list)
+		}
+		p.CategoryChannels = channels
+	}
+	if p.QuietHours != nil {
+		q := *p.QuietHours
+		p.QuietHours = &q
+	}
+	if p.DNDUntil != nil {
+		t := *p.DNDUntil
+		p.DNDUntil = &t
+	}
+	return p
+}
+
+// DeferNotification сохраняет отложенное уведомление; время выпуска берется из него самого
+func (r *MemoryRepository) DeferNotification(ctx context.Context, d domain.DeferredNotification) error {
+	userKey := domain.UserKey(d.Payload.Target.ID, d.Payload.Target.Login)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.deferred[userKey] == nil {
+		r.deferred[userKey] = make(map[string]domain.DeferredNotification)
+	}
+	r.deferred[userKey][d.Payload.NotificationID] = d
+	return nil
+}
+
+// GetDeferredNotification возвращает отложенное уведомление
+func (r *MemoryRepository) GetDeferredNotification(ctx context.Context, userID int64, login string, notificationID string) (*domain.DeferredNotification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, ok := r.deferred[domain.UserKey(userID, login)][notificationID]
+	if !ok {
+		return nil, nil
+	}
+	d.Escalation = slices.Clone(d.Escalation)
+	return &d, nil
+}
+
+// GetDueDeferred возвращает до limit отложенных уведомлений, выпуск которых наступил не позже now
+func (r *MemoryRepository) GetDueDeferred(ctx context.Context, now time.Time, offset, limit int64) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	type due struct {
+		member string
+		at     time.Time
+	}
+	var dues []due
+	for userKey, byID := range r.deferred {
+		for nid, d := range byID {
+			if !d.ReleaseAt.After(now) {
+				dues = append(dues, due{member: domain.NotificationMember(userKey, nid), at: d.ReleaseAt})
+			}
+		}
+	}
+	sort.Slice(dues, func(i, j int) bool {
+		if !dues[i].at.Equal(dues[j].at) {
+			return dues[i].at.Before(dues[j].at)
+		}
+		return dues[i].member < dues[j].member
+	})
+
+	members := make([]string, len(dues))
+	for i, d := range dues {
+		members[i] = d.member
+	}
+	return pageDue(members, offset, limit), nil
+}
+
+// RemoveDeferred удаляет отложенное уведомление
+func (r *MemoryRepository) RemoveDeferred(ctx context.Context, userID int64, login string, notificationID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	userKey := domain.UserKey(userID, login)
+	byID, ok := r.deferred[userKey]
+	if !ok {
+		return nil
+	}
+	delete(byID, notificationID)
+	if len(byID) == 0 {
+		delete(r.deferred, userKey)
+	}
+	return nil
+}
+
+// Subscribe подписывает пользователя на тему, если у него меньше maxTopics тем
+func (r *MemoryRepository) Subscribe(ctx context.Context, userID int64, login string, topic string, maxTopics int) (bool, error) {
+	userKey := domain.UserKey(userID, login)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, exists := r.subs[userKey][topic]
+	if !exists && len(r.subs[userKey]) >= maxTopics {
+		return false, fmt.Errorf("%w: не больше %d", domain.ErrTooManyTopics, maxTopics)
+	}
+	if r.topics[topic] == nil {
+		r.topics[topic] = make(map[string]struct{})
+	}
+	if r.subs[userKey] == nil {
+		r.subs[userKey] = make(map[string]struct{})
+	}
+	r.topics[topic][userKey] = struct{}{}
+	r.subs[userKey][topic] = struct{}{}
+	return !exists, nil
+}
+
+// Unsubscribe отписывает пользователя от темы
+func (r *MemoryRepository) Unsubscribe(ctx context.Context, userID int64, login string, topic string) (bool, error) {
+	userKey := domain.UserKey(userID, login)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, exists := r.topics[topic][userKey]
+	r.removeSubscriberLocked(topic, userKey)
+	if topics, ok := r.subs[userKey]; ok {
+		delete(topics, topic)
+		if len(topics) == 0 {
+			delete(r.subs, userKey)
+		}
+	}
+	return exists, nil
+}
+
+func (r *MemoryRepository) removeSubscriberLocked(topic, userKey string) {
+	subscribers, ok := r.topics[topic]
+	if !ok {
+		return
+	}
+	delete(subscribers, userKey)
+	if len(subscribers) == 0 {
+		delete(r.topics, topic)
+	}
+}
+
+// GetSubscriptions возвращает темы пользователя
+func (r *MemoryRepository) GetSubscriptions(ctx context.Context, userID int64, login string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	topics := make([]string, 0, len(r.subs[domain.UserKey(userID, login)]))
+	for topic := range r.subs[domain.UserKey(userID, login)] {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics, nil
+}
+
+// ScanTopicSubscribers возвращает подписчиков темы по count штук; курсор — смещение в отсортированном списке
+func (r *MemoryRepository) ScanTopicSubscribers(ctx context.Context, topic string, cursor uint64, count int64) ([]string, uint64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	subscribers := make([]string, 0, len(r.topics[topic]))
+	for userKey := range r.topics[topic] {
+		subscribers = append(subscribers, userKey)
+	}
+	sort.Strings(subscribers)
+
+	if count <= 0 {
+		count = 10
+	}
+	start := min(int(cursor), len(subscribers))
+	end := min(start+int(count), len(subscribers))
+	next := uint64(end)
+	if end >= len(subscribers) {
+		next = 0
+	}
+	return subscribers[start:end], next, nil
+}
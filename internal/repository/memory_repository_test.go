@@ -0,0 +1,388 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"notification-mvp/internal/clock"
+	"notification-mvp/internal/domain"
+)
+
+var testEpoch = time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+func newTestMemoryRepo(t *testing.T) (*MemoryRepository, *clock.Fake) {
+	t.Helper()
+	clock := clock.NewFake(testEpoch)
+	return NewMemoryRepository(clock), clock
+}
+
+func createTestNotification(t *testing.T, r *MemoryRepository, target domain.Target, message string) domain.CreateResult {
+	t.Helper()
+	payload := &domain.NotificationPayload{
+		Message:   message,
+		CreatedAt: r.clock.Now(),
+		Source:    "test",
+	}
+	res, err := r.CreateNotification(context.Background(), payload, target, domain.StreamLimit{})
+	if err != nil {
+		t.Fatalf("CreateNotification: %v", err)
+	}
+	return res
+}
+
+// waitForWaiters ждет, пока чтение заблокируется на таймере часов
+func waitForWaiters(t *testing.T, clock *clock.Fake, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for clock.Waiters() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("чтение не заблокировалось: ожидающих таймеров %d", clock.Waiters())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMemoryReadNewMessagesBlockUsesClock(t *testing.T) {
+	r, clock := newTestMemoryRepo(t)
+	ctx := context.Background()
+	if err := r.EnsureConsumerGroup(ctx, 1, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	type readResult struct {
+		messages []domain.StreamMessage
+		err      error
+	}
+	done := make(chan readResult, 1)
+	go func() {
+		messages, err := r.ReadNewMessages(ctx, 1, "alice", 30*time.Second, 10)
+		done <- readResult{messages, err}
+	}()
+
+	waitForWaiters(t, clock, 1)
+	clock.Advance(29 * time.Second)
+	select {
+	case <-done:
+		t.Fatal("чтение завершилось раньше таймаута блокировки")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case res := <-done:
+		if res.err != nil || len(res.messages) != 0 {
+			t.Fatalf("ожидался пустой результат по таймауту, получено %v, %v", res.messages, res.err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("таймаут блокировки не сработал по часам хранилища")
+	}
+}
+
+func TestMemoryReadNewMessagesWakesOnCreate(t *testing.T) {
+	r, clock := newTestMemoryRepo(t)
+	ctx := context.Background()
+	if err := r.EnsureConsumerGroup(ctx, 1, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan []domain.StreamMessage, 1)
+	go func() {
+		messages, _ := r.ReadNewMessages(ctx, 1, "alice", time.Hour, 10)
+		done <- messages
+	}()
+	waitForWaiters(t, clock, 1)
+
+	created := createTestNotification(t, r, domain.Target{ID: 1, Login: "alice"}, "hello")
+	select {
+	case messages := <-done:
+		if len(messages) != 1 || messages[0].ID != created.StreamID {
+			t.Fatalf("получено %+v, ожидалась запись %s", messages, created.StreamID)
+		}
+		if messages[0].Payload == nil || messages[0].Payload.Message != "hello" {
+			t.Fatalf("payload не загружен: %+v", messages[0].Payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("новое уведомление не разбудило чтение")
+	}
+}
+
+func TestMemoryReadNewMessagesContextCancel(t *testing.T) {
+	r, clock := newTestMemoryRepo(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := r.EnsureConsumerGroup(ctx, 1, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.ReadNewMessages(ctx, 1, "alice", time.Hour, 10)
+		done <- err
+	}()
+	waitForWaiters(t, clock, 1)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("ожидалась ошибка отмены контекста")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("чтение не завершилось после отмены контекста")
+	}
+}
+
+func TestMemoryAckMessage(t *testing.T) {
+	r, _ := newTestMemoryRepo(t)
+	ctx := context.Background()
+	target := domain.Target{ID: 1, Login: "alice"}
+	first := createTestNotification(t, r, target, "first")
+	second := createTestNotification(t, r, target, "second")
+	nid := func(res domain.CreateResult) string {
+		msgs, err := r.RangeLastMessages(ctx, 1, "alice", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range msgs {
+			if m.ID == res.StreamID {
+				return m.Payload.NotificationID
+			}
+		}
+		t.Fatalf("запись %s не найдена", res.StreamID)
+		return ""
+	}
+	firstNID, secondNID := nid(first), nid(second)
+
+	tests := []struct {
+		name     string
+		login    string
+		streamID string
+		nid      string
+		want     domain.AckResult
+	}{
+		{"первое прочтение", "alice", first.StreamID, firstNID, domain.AckResultAcked},
+		{"повторное прочтение", "alice", first.StreamID, firstNID, domain.AckResultAlreadyRead},
+		{"чужой notification_id", "alice", first.StreamID, secondNID, domain.AckResultMismatched},
+		{"неизвестный stream_id", "alice", "1-0", firstNID, domain.AckResultUnknown},
+		{"неверный stream_id", "alice", "bogus", firstNID, domain.AckResultUnknown},
+		{"другой пользователь", "bob", second.StreamID, secondNID, domain.AckResultUnknown},
+		{"второе уведомление", "alice", second.StreamID, secondNID, domain.AckResultAcked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.AckMessage(ctx, 1, tt.login, tt.streamID, tt.nid)
+			if err != nil {
+				t.Fatalf("AckMessage: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("получено %s, ожидалось %s", got, tt.want)
+			}
+		})
+	}
+
+	statuses, err := r.GetReadStatuses(ctx, 1, "alice", []string{firstNID, secondNID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !statuses[firstNID] || !statuses[secondNID] {
+		t.Fatalf("статусы прочтения не записаны: %v", statuses)
+	}
+}
+
+func TestMemoryCleanupExpiredNotifications(t *testing.T) {
+	r, clock := newTestMemoryRepo(t)
+	ctx := context.Background()
+	target := domain.Target{ID: 1, Login: "alice"}
+	created := createTestNotification(t, r, target, "hello")
+
+	due, err := r.GetDueUserKeys(ctx, clock.Now(), 0, 10)
+	if err != nil || len(due) != 0 {
+		t.Fatalf("до истечения TTL пользователь не должен быть в индексе: %v, %v", due, err)
+	}
+
+	clock.Advance(domain.NotificationTTL)
+	due, err = r.GetDueUserKeys(ctx, clock.Now(), 0, 10)
+	if err != nil || len(due) != 1 || due[0] != "1-alice" {
+		t.Fatalf("GetDueUserKeys = %v, %v", due, err)
+	}
+
+	cleaned, err := r.CleanupExpiredNotifications(ctx, 1, "alice", 100)
+	if err != nil || len(cleaned) != 1 {
+		t.Fatalf("CleanupExpiredNotifications = %v, %v", cleaned, err)
+	}
+	msgs, err := r.RangeLastMessages(ctx, 1, "alice", 10)
+	if err != nil || len(msgs) != 0 {
+		t.Fatalf("запись %s осталась в стриме: %v, %v", created.StreamID, msgs, err)
+	}
+	if due, _ := r.GetDueUserKeys(ctx, clock.Now(), 0, 10); len(due) != 0 {
+		t.Fatalf("пользователь остался в индексе истечений: %v", due)
+	}
+}
+
+func TestMemoryReclaimPendingMessages(t *testing.T) {
+	r, clock := newTestMemoryRepo(t)
+	ctx := context.Background()
+	if err := r.EnsureConsumerGroup(ctx, 1, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	createTestNotification(t, r, domain.Target{ID: 1, Login: "alice"}, "hello")
+
+	if msgs, err := r.ReadNewMessages(ctx, 1, "alice", time.Second, 10); err != nil || len(msgs) != 1 {
+		t.Fatalf("ReadNewMessages = %v, %v", msgs, err)
+	}
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		want    int
+	}{
+		{"еще не зависло", 30 * time.Second, 0},
+		{"зависло", 31 * time.Second, 1},
+		{"перехват сбрасывает время доставки", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.Advance(tt.advance)
+			msgs, err := r.ReclaimPendingMessages(ctx, 1, "alice", 60*time.Second, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(msgs) != tt.want {
+				t.Fatalf("перехвачено %d, ожидалось %d", len(msgs), tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryTrimUserStreamByRetention(t *testing.T) {
+	r, clock := newTestMemoryRepo(t)
+	ctx := context.Background()
+	target := domain.Target{ID: 1, Login: "alice"}
+	if err := r.SetUserRetentionDays(ctx, 1, "alice", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	old := createTestNotification(t, r, target, "old")
+	clock.Advance(36 * time.Hour)
+	fresh := createTestNotification(t, r, target, "fresh")
+
+	if err := r.TrimUserStreamByRetention(ctx, 1, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := r.RangeLastMessages(ctx, 1, "alice", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].ID != fresh.StreamID {
+		t.Fatalf("после тримминга ожидалась только запись %s (удалена %s), получено %+v", fresh.StreamID, old.StreamID, msgs)
+	}
+}
+
+func TestMemoryGetDueUserKeysPaging(t *testing.T) {
+	r, clock := newTestMemoryRepo(t)
+	ctx := context.Background()
+	for _, login := range []string{"c", "a", "b"} {
+		createTestNotification(t, r, domain.Target{ID: 1, Login: login}, "hello")
+	}
+	clock.Advance(domain.NotificationTTL)
+
+	tests := []struct {
+		offset, limit int64
+		want          string
+	}{
+		{0, 2, "1-a,1-b"},
+		{2, 2, "1-c"},
+		{3, 2, ""},
+		{1, 0, "1-b,1-c"},
+	}
+	for _, tt := range tests {
+		got, err := r.GetDueUserKeys(ctx, clock.Now(), tt.offset, tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("offset=%d limit=%d: получено %v, ожидалось %s", tt.offset, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryGetActiveUserKeysPaging(t *testing.T) {
+	r, clock := newTestMemoryRepo(t)
+	ctx := context.Background()
+	// Порядок индекса — по времени активности, а не по ключу
+	for _, login := range []string{"c", "a", "b"} {
+		createTestNotification(t, r, domain.Target{ID: 1, Login: login}, "hello")
+		clock.Advance(time.Second)
+	}
+
+	tests := []struct {
+		since         time.Time
+		offset, limit int64
+		want          string
+	}{
+		{time.Time{}, 0, 2, "1-c,1-a"},
+		{time.Time{}, 2, 2, "1-b"},
+		{time.Time{}, 3, 2, ""},
+		{time.Time{}, 0, 0, "1-c,1-a,1-b"},
+		{clock.Now().Add(-2 * time.Second), 0, 0, "1-a,1-b"},
+	}
+	for _, tt := range tests {
+		got, err := r.GetActiveUserKeys(ctx, tt.since, tt.offset, tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("since=%v offset=%d limit=%d: получено %v, ожидалось %s", tt.since, tt.offset, tt.limit, got, tt.want)
+		}
+	}
+}
+
+// subscribeConcurrently подписывает пользователя на n разных тем параллельно и проверяет,
+// что подписок не больше maxTopics, а остальные запросы отклонены с ErrTooManyTopics
+func subscribeConcurrently(t *testing.T, repo domain.NotificationRepository, n, maxTopics int) {
+	t.Helper()
+	ctx := context.Background()
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := repo.Subscribe(ctx, 1, "alice", fmt.Sprintf("topic-%d", i), maxTopics)
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	var rejected int
+	for err := range errs {
+		switch {
+		case errors.Is(err, domain.ErrTooManyTopics):
+			rejected++
+		case err != nil:
+			t.Fatalf("Subscribe: %v", err)
+		}
+	}
+	topics, err := repo.GetSubscriptions(ctx, 1, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(topics) != maxTopics || rejected != n-maxTopics {
+		t.Fatalf("подписок %d, отклонено %d; ожидалось %d и %d", len(topics), rejected, maxTopics, n-maxTopics)
+	}
+
+	// Повторная подписка на уже выбранную тему не упирается в лимит
+	if added, err := repo.Subscribe(ctx, 1, "alice", topics[0], maxTopics); err != nil || added {
+		t.Fatalf("повторная подписка = %v, %v", added, err)
+	}
+}
+
+func TestMemorySubscribeLimit(t *testing.T) {
+	repo, _ := newTestMemoryRepo(t)
+	subscribeConcurrently(t, repo, 20, 5)
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// memID — идентификатор записи стрима в формате Redis "<ms>-<seq>"
+type memID struct {
+	ms  int64
+	seq int64
+}
+
+func (id memID) String() string {
+	return fmt.Sprintf("%d-%d", id.ms, id.seq)
+}
+
+func (id memID) less(other memID) bool {
+	if id.ms != other.ms {
+		return id.ms < other.ms
+	}
+	return id.seq < other.seq
+}
+
+// parseMemID разбирает ID записи стрима ("5", "5-1", "0-0")
+func parseMemID(s string) (memID, error) {
+	msStr, seqStr, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseInt(msStr, 10, 64)
+	if err != nil {
+		return memID{}, fmt.Errorf("неверный ID записи стрима: %s", s)
+	}
+	var seq int64
+	if hasSeq {
+		seq, err = strconv.ParseInt(seqStr, 10, 64)
+		if err != nil {
+			return memID{}, fmt.Errorf("неверный ID записи стрима: %s", s)
+		}
+	}
+	return memID{ms: ms, seq: seq}, nil
+}
+
+// memEntry — запись стрима
+type memEntry struct {
+	id     memID
+	fields map[string]interface{}
+}
+
+// memPending — запись PEL consumer group
+type memPending struct {
+	consumer    string
+	deliveredAt time.Time
+	count       int64
+}
+
+// memGroup — consumer group стрима
+type memGroup struct {
+	lastDelivered memID
+	pending       map[memID]*memPending
+}
+
+// memStream — стрим пользователя с единственной consumer group
+type memStream struct {
+	entries []memEntry
+	lastID  memID
+	group   *memGroup
+}
+
+// nextID выдаёт монотонно возрастающий ID записи, как XADD с "*"
+func (s *memStream) nextID(now time.Time) memID {
+	ms := now.UnixMilli()
+	if ms > s.lastID.ms {
+		return memID{ms: ms}
+	}
+	return memID{ms: s.lastID.ms, seq: s.lastID.seq + 1}
+}
+
+// add добавляет запись и обрезает стрим до maxLen (PEL при этом не трогается, как в Redis)
+func (s *memStream) add(id memID, fields map[string]interface{}, maxLen int) {
+	s.entries = append(s.entries, memEntry{id: id, fields: fields})
+	s.lastID = id
+	if maxLen > 0 && len(s.entries) > maxLen {
+		s.entries = append([]memEntry(nil), s.entries[len(s.entries)-maxLen:]...)
+	}
+}
+
+// find возвращает запись по ID
+func (s *memStream) find(id memID) (memEntry, bool) {
+	i := sort.Search(len(s.entries), func(i int) bool { return !s.entries[i].id.less(id) })
+	if i < len(s.entries) && s.entries[i].id == id {
+		return s.entries[i], true
+	}
+	return memEntry{}, false
+}
+
+// remove удаляет запись по ID (XDEL)
+func (s *memStream) remove(id memID) bool {
+	for i, e := range s.entries {
+		if e.id == id {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// trimMinID удаляет записи с ID меньше minID (XTRIM MINID)
+func (s *memStream) trimMinID(minID memID) int {
+	i := sort.Search(len(s.entries), func(i int) bool { return !s.entries[i].id.less(minID) })
+	if i > 0 {
+		s.entries = append([]memEntry(nil), s.entries[i:]...)
+	}
+	return i
+}
+
+// pendingIDs возвращает ID записей PEL в порядке возрастания
+func (g *memGroup) pendingIDs() []memID {
+	ids := make([]memID, 0, len(g.pending))
+	for id := range g.pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].less(ids[j]) })
+	return ids
+}
+
+// copyFields возвращает копию полей записи, чтобы вызывающий код не менял состояние хранилища
+func copyFields(fields map[string]interface{}) map[string]interface{} {
+	if fields == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"notification-mvp/internal/cache"
+	"notification-mvp/internal/domain"
+	"notification-mvp/internal/metrics"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// WithPayloadCache включает локальный LRU-кэш расшифрованных payload (nil — без кэша).
+// Payload неизменяемы, поэтому запись живет в кэше не дольше ключа в Redis
+func (r *RedisRepository) WithPayloadCache(c *cache.LRU[string, domain.NotificationPayload]) *RedisRepository {
+	r.payloadCache = c
+	return r
+}
+
+// loadedPayload — результат загрузки одного payload: nil payload без ошибки означает истекшее уведомление
+type loadedPayload struct {
+	payload *domain.NotificationPayload
+	err     error
+}
+
+// loadPayloads загружает payload уведомлений пользователя одним пайплайном GET+PTTL,
+// обращаясь в Redis только за отсутствующими в кэше. Ошибка возвращается только при сбое Redis
+func (r *RedisRepository) loadPayloads(
+	ctx context.Context,
+	userID int64,
+	login string,
+	notificationIDs []string,
+) (map[string]loadedPayload, error) {
+	result := make(map[string]loadedPayload, len(notificationIDs))
+
+	type pending struct {
+		nid string
+		key string
+		get *redis.StringCmd
+		ttl *redis.DurationCmd
+	}
+	var misses []pending
+	for _, nid := range notificationIDs {
+		if _, seen := result[nid]; seen {
+			continue
+		}
+		key := domain.NotificationKey(userID, login, nid)
+		if p, ok := r.cachedPayload(key); ok {
+			result[nid] = loadedPayload{payload: p}
+			continue
+		}
+		result[nid] = loadedPayload{}
+		misses = append(misses, pending{nid: nid, key: key})
+	}
+	if len(misses) == 0 {
+		return result, nil
+	}
+
+	pipe := r.client.Pipeline()
+	for i := range misses {
+		misses[i].get = pipe.Get(ctx, misses[i].key)
+		misses[i].ttl = pipe.PTTL(ctx, misses[i].key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, wrapRedisError("ошибка получения уведомлений", err)
+	}
+
+	now := time.Now()
+	for _, m := range misses {
+		value, err := m.get.Result()
+		if err == redis.Nil {
+			continue // Уведомление истекло или не существует
+		}
+		if err != nil {
+			result[m.nid] = loadedPayload{err: fmt.Errorf("ошибка получения уведомления: %w", err)}
+			continue
+		}
+
+		payload, err := r.decodePayload(m.key, value)
+		if err != nil {
+			result[m.nid] = loadedPayload{err: err}
+			continue
+		}
+		result[m.nid] = loadedPayload{payload: payload}
+
+		if ttl, err := m.ttl.Result(); err == nil && ttl > 0 {
+			r.cachePayload(m.key, payload, now.Add(ttl))
+		}
+	}
+	return result, nil
+}
+
+// decodePayload расшифровывает и разбирает сохраненный payload
+func (r *RedisRepository) decodePayload(key, value string) (*domain.NotificationPayload, error) {
+	payloadBytes, err := r.openPayload(key, value)
+	if err != nil {
+		return nil, err
+	}
+	var payload domain.NotificationPayload
+	if err := json.Unmarshal(payloadBytes, &payload); err != nil {
+		return nil, fmt.Errorf("ошибка десериализации payload: %w", err)
+	}
+	return &payload, nil
+}
+
+// cachedPayload возвращает копию payload из кэша
+func (r *RedisRepository) cachedPayload(key string) (*domain.NotificationPayload, bool) {
+	if r.payloadCache == nil {
+		return nil, false
+	}
+	p, ok := r.payloadCache.Get(key)
+	if !ok {
+		metrics.PayloadCacheMisses.Inc()
+		return nil, false
+	}
+	metrics.PayloadCacheHits.Inc()
+	return &p, true
+}
+
+func (r *RedisRepository) cachePayload(key string, payload *domain.NotificationPayload, expiresAt time.Time) {
+	if r.payloadCache == nil {
+		return
+	}
+	r.payloadCache.Add(key, *payload, expiresAt)
+	metrics.PayloadCacheSize.Set(float64(r.payloadCache.Len()))
+}
+
+// invalidatePayload удаляет payload из локального кэша при удалении ключа
+func (r *RedisRepository) invalidatePayload(key string) {
+	if r.payloadCache == nil {
+		return
+	}
+	r.payloadCache.Remove(key)
+	metrics.PayloadCacheSize.Set(float64(r.payloadCache.Len()))
+}
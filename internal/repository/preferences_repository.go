@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"notification-mvp/internal/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SetPreferences сохраняет настройки уведомлений в notif:prefs:{id}-{login}
+func (r *RedisRepository) SetPreferences(ctx context.Context, userID int64, login string, prefs domain.Preferences) error {
+	data, err := json.Marshal(prefs)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации настроек уведомлений: %w", err)
+	}
+	if err := r.client.Set(ctx, domain.PreferencesKey(userID, login), data, 0).Err(); err != nil {
+		return fmt.Errorf("ошибка сохранения настроек уведомлений: %w", err)
+	}
+	return nil
+}
+
+// GetPreferences возвращает настройки уведомлений пользователя
+func (r *RedisRepository) GetPreferences(ctx context.Context, userID int64, login string) (*domain.Preferences, error) {
+	data, err := r.client.Get(ctx, domain.PreferencesKey(userID, login)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка чтения настроек уведомлений: %w", err)
+	}
+
+	var prefs domain.Preferences
+	if err := json.Unmarshal(data, &prefs); err != nil {
+		return nil, fmt.Errorf("ошибка разбора настроек уведомлений: %w", err)
+	}
+	return &prefs, nil
+}
+
+// DeferNotification сохраняет уведомление в notif:deferred:{id}-{login} и планирует выпуск в notif:deferrals:due
+func (r *RedisRepository) DeferNotification(ctx context.Context, d domain.DeferredNotification) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации отложенного уведомления: %w", err)
+	}
+	target := d.Payload.Target
+	userKey := domain.UserKey(target.ID, target.Login)
+
+	// Хэш и индекс в разных слотах Cluster, поэтому pipeline без MULTI
+	pipe := r.client.Pipeline()
+	pipe.HSet(ctx, domain.DeferredKey(target.ID, target.Login), d.Payload.NotificationID, data)
+	pipe.ZAdd(ctx, domain.DeferredDueIndexKey, redis.Z{
+		Score:  float64(d.ReleaseAt.Unix()),
+		Member: domain.NotificationMember(userKey, d.Payload.NotificationID),
+	})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("ошибка сохранения отложенного уведомления: %w", err)
+	}
+	return nil
+}
+
+// GetDeferredNotification возвращает отложенное уведомление
+func (r *RedisRepository) GetDeferredNotification(ctx context.Context, userID int64, login string, notificationID string) (*domain.DeferredNotification, error) {
+	data, err := r.client.HGet(ctx, domain.DeferredKey(userID, login), notificationID).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка чтения отложенного уведомления: %w", err)
+	}
+
+	var d domain.DeferredNotification
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("ошибка разбора отложенного уведомления: %w", err)
+	}
+	return &d, nil
+}
+
+// GetDueDeferred возвращает до limit отложенных уведомлений, выпуск которых наступил не позже now
+func (r *RedisRepository) GetDueDeferred(ctx context.Context, now time.Time, offset, limit int64) ([]string, error) {
+	members, err := r.client.ZRangeByScore(ctx, domain.DeferredDueIndexKey, &redis.ZRangeBy{
+		Min:    "-inf",
+		Max:    fmt.Sprintf("%d", now.Unix()),
+		Offset: offset,
+		Count:  limit,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения индекса отложенных уведомлений: %w", err)
+	}
+	return members, nil
+}
+
+// RemoveDeferred удаляет отложенное уведомление из хэша пользователя и индекса
+func (r *RedisRepository) RemoveDeferred(ctx context.Context, userID int64, login string, notificationID string) error {
+	pipe := r.client.Pipeline()
+	pipe.HDel(ctx, domain.DeferredKey(userID, login), notificationID)
+	pipe.ZRem(ctx, domain.DeferredDueIndexKey,
+		domain.NotificationMember(domain.UserKey(userID, login), notificationID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("ошибка удаления отложенного уведомления: %w", err)
+	}
+	return nil
+}
+
+// userDeferred возвращает все отложенные уведомления пользователя (для выгрузки данных)
+func (r *RedisRepository) userDeferred(ctx context.Context, userID int64, login string) ([]domain.DeferredNotification, error) {
+	values, err := r.client.HVals(ctx, domain.DeferredKey(userID, login)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения отложенных уведомлений пользователя: %w", err)
+	}
+	deferred := make([]domain.DeferredNotification, 0, len(values))
+	for _, v := range values {
+		var d domain.DeferredNotification
+		if err := json.Unmarshal([]byte(v), &d); err != nil {
+			return nil, fmt.Errorf("ошибка разбора отложенного уведомления: %w", err)
+		}
+		deferred = append(deferred, d)
+	}
+	return deferred, nil
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"notification-mvp/internal/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Префиксы ответов Redis, означающих временную недоступность узла (failover, загрузка, перешардирование)
+var transientRedisErrorPrefixes = []string{
+	"READONLY",
+	"LOADING",
+	"MASTERDOWN",
+	"TRYAGAIN",
+	"CLUSTERDOWN",
+}
+
+// wrapRedisError оборачивает ошибку Redis, помечая временные ошибки как domain.ErrStorageUnavailable
+func wrapRedisError(msg string, err error) error {
+	if isTransientRedisError(err) {
+		return fmt.Errorf("%s: %w: %w", msg, domain.ErrStorageUnavailable, err)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// isTransientRedisError сообщает, можно ли повторить операцию после ошибки
+func isTransientRedisError(err error) bool {
+	if err == nil ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, redis.ErrClosed) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	for _, prefix := range transientRedisErrorPrefixes {
+		if redis.HasErrorPrefix(err, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,15 +3,18 @@ package repository
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"log/slog"
 	"math/rand"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"notification-mvp/internal/cache"
 	"notification-mvp/internal/domain"
+	"notification-mvp/internal/encryption"
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
@@ -19,115 +22,191 @@ import (
 
 // RedisRepository реализует интерфейс NotificationRepository
 type RedisRepository struct {
-	client *redis.Client
+	client redis.UniversalClient
+
+	// cipher включает шифрование полезной нагрузки (nil — хранение в открытом виде)
+	cipher       *encryption.Cipher
+	encryptState bool
+
+	// payloadCache — локальный кэш неизменяемых payload (nil — выключен)
+	payloadCache *cache.LRU[string, domain.NotificationPayload]
 }
 
 // NewRedisRepository создает новый экземпляр RedisRepository
-func NewRedisRepository(client *redis.Client) *RedisRepository {
+// (одиночный Redis, Sentinel или Cluster — через redis.UniversalClient)
+func NewRedisRepository(client redis.UniversalClient) *RedisRepository {
 	return &RedisRepository{
 		client: client,
 	}
 }
 
-// CreateNotification создает уведомление для одного получателя
+// addEntryScript атомарно применяет лимит стрима и добавляет запись со ссылкой на уведомление.
+// KEYS: стрим, хэш статусов, планировщик TTL.
+// ARGV: max_len, политика, nid, created_at, consumer group, score истечения.
+// Возвращает {"rejected"} или {"added", stream_id, nid1, stream_id1, read1, ...} для удаленных записей
+var addEntryScript = redis.NewScript(`
+local maxlen = tonumber(ARGV[1])
+local policy = ARGV[2]
+redis.pcall('XGROUP', 'CREATE', KEYS[1], ARGV[5], '$', 'MKSTREAM')
+
+local function entry_nid(entry)
+	local fields = entry[2]
+	for i = 1, #fields, 2 do
+		if fields[i] == 'nid' then
+			return fields[i + 1]
+		end
+	end
+	return ''
+end
+
+local result = {'added', ''}
+local excess = redis.call('XLEN', KEYS[1]) - maxlen + 1
+if maxlen > 0 and excess > 0 then
+	if policy == 'reject_new' then
+		return {'rejected'}
+	end
+
+	local victims = {}
+	if policy == 'drop_read' then
+		for _, entry in ipairs(redis.call('XRANGE', KEYS[1], '-', '+')) do
+			local nid = entry_nid(entry)
+			if nid ~= '' and redis.call('HEXISTS', KEYS[2], nid) == 1 then
+				table.insert(victims, {entry[1], nid, 1})
+				if #victims >= excess then
+					break
+				end
+			end
+		end
+		if #victims < excess then
+			return {'rejected'}
+		end
+	else
+		for _, entry in ipairs(redis.call('XRANGE', KEYS[1], '-', '+', 'COUNT', excess)) do
+			local nid = entry_nid(entry)
+			table.insert(victims, {entry[1], nid, redis.call('HEXISTS', KEYS[2], nid)})
+		end
+	end
+
+	for _, v in ipairs(victims) do
+		redis.call('XACK', KEYS[1], ARGV[5], v[1])
+		redis.call('XDEL', KEYS[1], v[1])
+		redis.call('ZREM', KEYS[3], v[1] .. '|' .. v[2])
+		table.insert(result, v[2])
+		table.insert(result, v[1])
+		table.insert(result, tostring(v[3]))
+	end
+end
+
+local id = redis.call('XADD', KEYS[1], '*', 'nid', ARGV[3], 'created_at', ARGV[4])
+redis.call('ZADD', KEYS[3], ARGV[6], id .. '|' .. ARGV[3])
+result[2] = id
+return result
+`)
+
+// CreateNotification создает уведомление для одного получателя с учетом лимита его стрима
 func (r *RedisRepository) CreateNotification(
 	ctx context.Context,
 	payload *domain.NotificationPayload,
 	target domain.Target,
-) (string, error) {
-	// Генерируем UUID для уведомления
-	notificationID := uuid.New().String()
-	payload.NotificationID = notificationID
+	limit domain.StreamLimit,
+) (domain.CreateResult, error) {
+	// Генерируем UUID для уведомления; отложенное уведомление приходит с уже назначенным ID
+	notificationID := payload.NotificationID
+	if notificationID == "" {
+		notificationID = uuid.New().String()
+		payload.NotificationID = notificationID
+	}
 	payload.Target = target
 
 	// Сериализуем payload в JSON
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
-		return "", fmt.Errorf("ошибка сериализации payload: %w", err)
+		return domain.CreateResult{}, fmt.Errorf("ошибка сериализации payload: %w", err)
 	}
 
 	userKey := domain.UserKey(target.ID, target.Login)
 	streamKey := domain.StreamKey(target.ID, target.Login)
-	notificationKey := domain.NotificationKey(notificationID)
+	stateKey := domain.NotificationStateKey(target.ID, target.Login)
+	notificationKey := domain.NotificationKey(target.ID, target.Login, notificationID)
 	ttlSchedulerKey := domain.TTLSchedulerKey(target.ID, target.Login)
 
-	// Выполняем операции в пайплайне для атомарности
-	pipe := r.client.Pipeline()
-
-	// 1. Сохраняем payload с TTL = 15 минут
-	pipe.Set(ctx, notificationKey, string(payloadBytes), domain.NotificationTTL)
+	storedPayload, err := r.sealPayload(notificationKey, payloadBytes)
+	if err != nil {
+		return domain.CreateResult{}, err
+	}
 
-	// 2. Убеждаемся что Consumer Group существует
-	pipe.XGroupCreateMkStream(ctx, streamKey, domain.ConsumerGroupName, "$")
+	// 1. Сохраняем payload с TTL = 15 минут (до записи в стрим, чтобы читатель сразу его нашел)
+	if err := r.client.Set(ctx, notificationKey, storedPayload, domain.NotificationTTL).Err(); err != nil {
+		return domain.CreateResult{}, fmt.Errorf("ошибка сохранения payload: %w", err)
+	}
 
-	// 3. Добавляем ссылку в персональный стрим
-	xAddCmd := pipe.XAdd(ctx, &redis.XAddArgs{
-		Stream: streamKey,
-		MaxLen: 100,
-		Approx: false,
-		Values: map[string]interface{}{
-			"nid":        notificationID,
-			"created_at": payload.CreatedAt.Format(time.RFC3339),
-		},
-	})
+	// 2. Применяем лимит стрима, добавляем ссылку в персональный стрим и маркер в планировщик TTL.
+	// Планировщик пишется раньше индекса — на этот порядок опирается rescheduleUserExpiry
+	now := time.Now()
+	expirationTime := now.Add(domain.NotificationTTL).Unix()
 
-	// Выполняем пайплайн
-	_, err = pipe.Exec(ctx)
+	reply, err := addEntryScript.Run(ctx, r.client,
+		[]string{streamKey, stateKey, ttlSchedulerKey},
+		limit.MaxLen, string(limit.Overflow), notificationID,
+		payload.CreatedAt.Format(time.RFC3339), domain.ConsumerGroupName, expirationTime,
+	).StringSlice()
 	if err != nil {
-		// Игнорируем ошибку создания группы если она уже существует
-		if !strings.Contains(err.Error(), "BUSYGROUP") {
-			return "", fmt.Errorf("ошибка выполнения пайплайна: %w", err)
-		}
+		_ = r.client.Del(ctx, notificationKey).Err()
+		return domain.CreateResult{}, fmt.Errorf("ошибка добавления в стрим: %w", err)
+	}
+	if len(reply) == 0 || reply[0] == "rejected" {
+		_ = r.client.Del(ctx, notificationKey).Err()
+		return domain.CreateResult{}, domain.ErrInboxFull
 	}
 
-	// Получаем ID записи в стриме
-	streamID, err := xAddCmd.Result()
-	if err != nil {
-		return "", fmt.Errorf("ошибка получения stream ID: %w", err)
+	result := domain.CreateResult{StreamID: reply[1]}
+	for i := 2; i+2 < len(reply); i += 3 {
+		result.Dropped = append(result.Dropped, domain.DroppedEntry{
+			NotificationID: reply[i],
+			StreamID:       reply[i+1],
+			Read:           reply[i+2] == "1",
+		})
 	}
 
-	// 4. Добавляем маркер истечения в ZSET планировщика
-	expirationTime := time.Now().Add(domain.NotificationTTL).Unix()
-	ttlEntry := domain.TTLSchedulerEntry(streamID, notificationID)
+	// 3. Удаляем payload вытесненных записей и обновляем индексы пользователей
+	r.cachePayload(notificationKey, payload, now.Add(domain.NotificationTTL))
 
-	err = r.client.ZAdd(ctx, ttlSchedulerKey, redis.Z{
-		Score:  float64(expirationTime),
-		Member: ttlEntry,
-	}).Err()
-	if err != nil {
-		slog.Warn("Ошибка добавления в TTL планировщик", "error", err, "user", userKey)
-		// Не критично для MVP, продолжаем
+	pipe := r.client.Pipeline()
+	for _, d := range result.Dropped {
+		if d.NotificationID != "" {
+			droppedKey := domain.NotificationKey(target.ID, target.Login, d.NotificationID)
+			pipe.Del(ctx, droppedKey)
+			r.invalidatePayload(droppedKey)
+		}
+	}
+	pipe.ZAddLT(ctx, domain.UserExpiryIndexKey, redis.Z{Score: float64(expirationTime), Member: userKey})
+	pipe.ZAdd(ctx, domain.ActiveUsersIndexKey, redis.Z{Score: float64(now.Unix()), Member: userKey})
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.WarnContext(ctx, "Ошибка обновления индекса пользователей", "error", err, "user", userKey)
 	}
 
-	slog.Debug("Создано уведомление",
+	slog.DebugContext(ctx, "Создано уведомление",
 		"notification_id", notificationID,
-		"stream_id", streamID,
+		"stream_id", result.StreamID,
+		"dropped", len(result.Dropped),
 		"user", userKey)
 
-	return streamID, nil
+	return result, nil
 }
 
-// GetNotification получает уведомление по ID
+// GetNotification получает уведомление получателя по ID
 func (r *RedisRepository) GetNotification(
 	ctx context.Context,
+	userID int64,
+	login string,
 	notificationID string,
 ) (*domain.NotificationPayload, error) {
-	key := domain.NotificationKey(notificationID)
-
-	payloadStr, err := r.client.Get(ctx, key).Result()
+	loaded, err := r.loadPayloads(ctx, userID, login, []string{notificationID})
 	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			return nil, nil // Уведомление истекло или не существует
-		}
-		return nil, fmt.Errorf("ошибка получения уведомления: %w", err)
-	}
-
-	var payload domain.NotificationPayload
-	if err := json.Unmarshal([]byte(payloadStr), &payload); err != nil {
-		return nil, fmt.Errorf("ошибка десериализации payload: %w", err)
+		return nil, err
 	}
-
-	return &payload, nil
+	l := loaded[notificationID]
+	return l.payload, l.err
 }
 
 // EnsureConsumerGroup создает Consumer Group если её нет
@@ -165,10 +244,10 @@ func (r *RedisRepository) ReadPendingMessages(
 		if err == redis.Nil {
 			return []domain.StreamMessage{}, nil // Нет pending сообщений
 		}
-		return nil, fmt.Errorf("ошибка чтения pending сообщений: %w", err)
+		return nil, wrapRedisError("ошибка чтения pending сообщений", err)
 	}
 
-	return r.convertRedisStreamsToMessages(ctx, streams)
+	return r.convertRedisStreamsToMessages(ctx, userID, login, streams)
 }
 
 // ReadNewMessages читает новые сообщения из stream с блокировкой
@@ -195,42 +274,100 @@ func (r *RedisRepository) ReadNewMessages(
 		if err == redis.Nil {
 			return []domain.StreamMessage{}, nil // Нет новых сообщений за время блокировки
 		}
-		return nil, fmt.Errorf("ошибка чтения новых сообщений: %w", err)
+		// После failover реплика могла не получить группу (асинхронная репликация) — создаем заново
+		if redis.HasErrorPrefix(err, "NOGROUP") {
+			if err := r.EnsureConsumerGroup(ctx, userID, login); err != nil {
+				return nil, err
+			}
+			return []domain.StreamMessage{}, nil
+		}
+		return nil, wrapRedisError("ошибка чтения новых сообщений", err)
 	}
 
-	return r.convertRedisStreamsToMessages(ctx, streams)
+	return r.convertRedisStreamsToMessages(ctx, userID, login, streams)
 }
 
-// AckMessage подтверждает прочтение сообщения и удаляет его
+// ackScript атомарно проверяет, что запись стрима существует и ссылается на nid,
+// и только тогда подтверждает её и помечает уведомление прочитанным.
+// KEYS: стрим, хэш статусов. ARGV: stream_id, nid, значение статуса, consumer group
+var ackScript = redis.NewScript(`
+local entry = redis.call('XRANGE', KEYS[1], ARGV[1], ARGV[1])
+if #entry == 0 then
+	return 'unknown'
+end
+local fields = entry[1][2]
+local nid = nil
+for i = 1, #fields, 2 do
+	if fields[i] == 'nid' then
+		nid = fields[i + 1]
+		break
+	end
+end
+if nid ~= ARGV[2] then
+	return 'mismatched'
+end
+redis.call('XACK', KEYS[1], ARGV[4], ARGV[1])
+if redis.call('HEXISTS', KEYS[2], ARGV[2]) == 1 then
+	return 'already_read'
+end
+redis.call('HSET', KEYS[2], ARGV[2], ARGV[3])
+return 'acked'
+`)
+
+// streamIDPattern соответствует полному ID записи стрима "<ms>-<seq>"
+var streamIDPattern = regexp.MustCompile(`^[0-9]+-[0-9]+$`)
+
+// AckMessage подтверждает прочтение сообщения (запись остается в стриме)
 func (r *RedisRepository) AckMessage(
 	ctx context.Context,
 	userID int64,
 	login string,
 	streamID, notificationID string,
-) error {
+) (domain.AckResult, error) {
+	// Некорректный ID отклоняем до обращения к Redis: XRANGE вернул бы ошибку синтаксиса
+	if !streamIDPattern.MatchString(streamID) || notificationID == "" {
+		return domain.AckResultUnknown, nil
+	}
+
 	streamKey := domain.StreamKey(userID, login)
 	stateKey := domain.NotificationStateKey(userID, login)
 
-	// Выполняем операции в пайплайне
-	pipe := r.client.Pipeline()
-
-	// 1. Подтверждаем сообщение в Consumer Group (оставляем запись в стриме)
-	pipe.XAck(ctx, streamKey, domain.ConsumerGroupName, streamID)
-
-	// 2. Помечаем уведомление как прочитанное
-	pipe.HSet(ctx, stateKey, notificationID, "read")
+	readValue, err := r.sealState(stateKey, notificationID, "read")
+	if err != nil {
+		return "", err
+	}
 
-	_, err := pipe.Exec(ctx)
+	res, err := ackScript.Run(ctx, r.client,
+		[]string{streamKey, stateKey},
+		streamID, notificationID, readValue, domain.ConsumerGroupName,
+	).Text()
 	if err != nil {
-		return fmt.Errorf("ошибка подтверждения сообщения: %w", err)
+		return "", fmt.Errorf("ошибка подтверждения сообщения: %w", err)
+	}
+	result := domain.AckResult(res)
+
+	if result == domain.AckResultAcked || result == domain.AckResultAlreadyRead {
+		// Отмечаем активность пользователя и отменяем эскалацию и доставку каналами прочитанного уведомления
+		// (индексы в других слотах Cluster, поэтому вне скрипта)
+		pipe := r.client.Pipeline()
+		pipe.ZAdd(ctx, domain.ActiveUsersIndexKey, redis.Z{
+			Score:  float64(time.Now().Unix()),
+			Member: domain.UserKey(userID, login),
+		})
+		r.cancelEscalation(ctx, pipe, userID, login, notificationID)
+		r.cancelChannelDelivery(ctx, pipe, userID, login, notificationID)
+		if _, err := pipe.Exec(ctx); err != nil {
+			slog.WarnContext(ctx, "Ошибка обновления индексов после подтверждения", "error", err)
+		}
 	}
 
-	slog.Debug("Помечено прочтение уведомления",
+	slog.DebugContext(ctx, "Обработано подтверждение прочтения",
 		"notification_id", notificationID,
 		"stream_id", streamID,
+		"result", result,
 		"user", domain.UserKey(userID, login))
 
-	return nil
+	return result, nil
 }
 
 // AcquireConsumerLock пытается получить эксклюзивную блокировку чтения для пользователя
@@ -246,6 +383,12 @@ func (r *RedisRepository) AcquireConsumerLock(
 	if err != nil {
 		return false, fmt.Errorf("ошибка установки consumer lock: %w", err)
 	}
+	if ok {
+		// Реестр сессий pod позволяет соседям сразу снять его lock, если pod выбудет
+		if err := r.client.SAdd(ctx, domain.PodSessionsKey(podID), domain.UserKey(userID, login)).Err(); err != nil {
+			return true, fmt.Errorf("ошибка регистрации сессии pod: %w", err)
+		}
+	}
 	return ok, nil
 }
 
@@ -259,14 +402,12 @@ func (r *RedisRepository) RenewConsumerLock(
 ) (bool, error) {
 	key := domain.ConsumerLockKey(userID, login)
 	val, err := r.client.Get(ctx, key).Result()
-	if err != nil {
-		if err == redis.Nil {
-			return false, nil
-		}
+	if err != nil && err != redis.Nil {
 		return false, fmt.Errorf("ошибка чтения consumer lock: %w", err)
 	}
 	if val != podID {
-		return false, nil
+		// Lock истек или перешел к другому pod — пользователь больше не в сессиях этого pod
+		return false, r.forgetPodSession(ctx, userID, login, podID)
 	}
 	// продляем с небольшой джиттер-защитой от дребезга
 	extend := ttl + time.Duration(rand.Intn(250))*time.Millisecond
@@ -284,29 +425,28 @@ func (r *RedisRepository) ReleaseConsumerLock(
 	podID string,
 ) error {
 	key := domain.ConsumerLockKey(userID, login)
-	val, err := r.client.Get(ctx, key).Result()
-	if err != nil {
-		if err == redis.Nil {
-			return nil
-		}
-		return fmt.Errorf("ошибка чтения consumer lock: %w", err)
-	}
-	if val != podID {
-		return nil
-	}
-	if err := r.client.Del(ctx, key).Err(); err != nil {
+	if err := releaseLockIfOwnerScript.Run(ctx, r.client, []string{key}, podID).Err(); err != nil {
 		return fmt.Errorf("ошибка удаления consumer lock: %w", err)
 	}
+	// Даже если lock истек или перешел к другому pod, запись в реестре сессий pod больше не нужна
+	return r.forgetPodSession(ctx, userID, login, podID)
+}
+
+// forgetPodSession убирает пользователя из реестра сессий pod
+func (r *RedisRepository) forgetPodSession(ctx context.Context, userID int64, login, podID string) error {
+	if err := r.client.SRem(ctx, domain.PodSessionsKey(podID), domain.UserKey(userID, login)).Err(); err != nil {
+		return fmt.Errorf("ошибка удаления сессии pod: %w", err)
+	}
 	return nil
 }
 
-// CleanupExpiredNotifications удаляет просроченные уведомления
+// CleanupExpiredNotifications удаляет просроченные уведомления и возвращает их notification_id
 func (r *RedisRepository) CleanupExpiredNotifications(
 	ctx context.Context,
 	userID int64,
 	login string,
 	limit int64,
-) (int64, error) {
+) ([]string, error) {
 	ttlSchedulerKey := domain.TTLSchedulerKey(userID, login)
 	streamKey := domain.StreamKey(userID, login)
 	now := time.Now().Unix()
@@ -319,14 +459,14 @@ func (r *RedisRepository) CleanupExpiredNotifications(
 	}).Result()
 
 	if err != nil {
-		return 0, fmt.Errorf("ошибка получения просроченных записей: %w", err)
+		return nil, fmt.Errorf("ошибка получения просроченных записей: %w", err)
 	}
 
 	if len(expired) == 0 {
-		return 0, nil
+		return nil, r.rescheduleUserExpiry(ctx, userID, login)
 	}
 
-	var cleaned int64
+	var cleaned []string
 	pipe := r.client.Pipeline()
 
 	for _, z := range expired {
@@ -338,14 +478,17 @@ func (r *RedisRepository) CleanupExpiredNotifications(
 
 		streamID := parts[0]
 		notificationID := parts[1]
-		notificationKey := domain.NotificationKey(notificationID)
+		notificationKey := domain.NotificationKey(userID, login, notificationID)
 
 		// Подтверждаем и удаляем сообщение
 		pipe.XAck(ctx, streamKey, domain.ConsumerGroupName, streamID)
 		pipe.XDel(ctx, streamKey, streamID)
 		pipe.Del(ctx, notificationKey)
+		r.invalidatePayload(notificationKey)
+		r.cancelEscalation(ctx, pipe, userID, login, notificationID)
+		r.cancelChannelDelivery(ctx, pipe, userID, login, notificationID)
 
-		cleaned++
+		cleaned = append(cleaned, notificationID)
 	}
 
 	// Удаляем обработанные записи из планировщика
@@ -357,14 +500,14 @@ func (r *RedisRepository) CleanupExpiredNotifications(
 
 	_, err = pipe.Exec(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("ошибка очистки просроченных уведомлений: %w", err)
+		return nil, fmt.Errorf("ошибка очистки просроченных уведомлений: %w", err)
 	}
 
-	slog.Debug("Очищены просроченные уведомления",
+	slog.DebugContext(ctx, "Очищены просроченные уведомления",
 		"user", domain.UserKey(userID, login),
-		"count", cleaned)
+		"count", len(cleaned))
 
-	return cleaned, nil
+	return cleaned, r.rescheduleUserExpiry(ctx, userID, login)
 }
 
 // ReclaimPendingMessages перехватывает зависшие сообщения
@@ -394,27 +537,13 @@ func (r *RedisRepository) ReclaimPendingMessages(
 	}
 
 	// Конвертируем результат в наш формат
-	var messages []domain.StreamMessage
-	for _, msg := range result {
-		streamMsg := domain.StreamMessage{
-			ID:     msg.ID,
-			Fields: msg.Values,
-		}
-
-		// Загружаем payload если есть nid
-		if nidStr, ok := msg.Values["nid"].(string); ok {
-			payload, err := r.GetNotification(ctx, nidStr)
-			if err != nil {
-				slog.Warn("Ошибка загрузки payload при перехвате", "error", err, "nid", nidStr)
-			}
-			streamMsg.Payload = payload
-		}
-
-		messages = append(messages, streamMsg)
+	messages, err := r.attachPayloads(ctx, userID, login, result)
+	if err != nil {
+		return nil, err
 	}
 
 	if len(messages) > 0 {
-		slog.Debug("Перехвачены зависшие сообщения",
+		slog.DebugContext(ctx, "Перехвачены зависшие сообщения",
 			"user", domain.UserKey(userID, login),
 			"count", len(messages))
 	}
@@ -422,33 +551,39 @@ func (r *RedisRepository) ReclaimPendingMessages(
 	return messages, nil
 }
 
-// GetAllUserKeys возвращает все пользовательские ключи для джанитора
-func (r *RedisRepository) GetAllUserKeys(ctx context.Context) ([]string, error) {
-	// Сканируем все ключи TTL планировщика
-	var allKeys []string
-	var cursor uint64
-
-	for {
-		keys, newCursor, err := r.client.Scan(ctx, cursor, domain.TTLSchedulerKeyPrefix+"*", 100).Result()
-		if err != nil {
-			return nil, fmt.Errorf("ошибка сканирования ключей: %w", err)
-		}
-
-		// Извлекаем user ключи из имен
-		for _, key := range keys {
-			if strings.HasPrefix(key, domain.TTLSchedulerKeyPrefix) {
-				userKey := strings.TrimPrefix(key, domain.TTLSchedulerKeyPrefix)
-				allKeys = append(allKeys, userKey)
+// scanKeys обходит ключи по шаблону порциями. В Redis Cluster SCAN выполняется на каждом master-узле
+func (r *RedisRepository) scanKeys(ctx context.Context, pattern string, fn func(keys []string) error) error {
+	scan := func(ctx context.Context, client redis.Cmdable, handle func(keys []string) error) error {
+		var cursor uint64
+		for {
+			keys, next, err := client.Scan(ctx, cursor, pattern, 100).Result()
+			if err != nil {
+				return fmt.Errorf("ошибка сканирования ключей: %w", err)
+			}
+			if len(keys) > 0 {
+				if err := handle(keys); err != nil {
+					return err
+				}
+			}
+			cursor = next
+			if cursor == 0 {
+				return nil
 			}
-		}
-
-		cursor = newCursor
-		if cursor == 0 {
-			break
 		}
 	}
 
-	return allKeys, nil
+	if cluster, ok := r.client.(*redis.ClusterClient); ok {
+		// ForEachMaster обходит узлы параллельно — сериализуем вызовы fn
+		var mu sync.Mutex
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return scan(ctx, node, func(keys []string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				return fn(keys)
+			})
+		})
+	}
+	return scan(ctx, r.client, fn)
 }
 
 // SaveIdempotencyResult сохраняет результат для идемпотентности
@@ -460,9 +595,21 @@ func (r *RedisRepository) SaveIdempotencyResult(ctx context.Context, key string,
 		return fmt.Errorf("ошибка сериализации результата идемпотентности: %w", err)
 	}
 
-	// Сохраняем на 10 минут как указано в ТЗ
-	err = r.client.Set(ctx, redisKey, string(resultBytes), 10*time.Minute).Err()
-	if err != nil {
+	// Сохраняем на 10 минут как указано в ТЗ. Ответ содержит получателей, поэтому ключ запоминается
+	// в индексе каждого из них: при удалении данных пользователя его результаты вырезаются из ответа
+	pipe := r.client.Pipeline()
+	pipe.Set(ctx, redisKey, string(resultBytes), domain.IdempotencyTTL)
+	seen := make(map[domain.Target]bool)
+	for _, res := range result.Results {
+		if seen[res.Target] {
+			continue
+		}
+		seen[res.Target] = true
+		indexKey := domain.IdempotencyIndexKey(res.Target.ID, res.Target.Login)
+		pipe.SAdd(ctx, indexKey, key)
+		pipe.Expire(ctx, indexKey, domain.IdempotencyTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
 		return fmt.Errorf("ошибка сохранения результата идемпотентности: %w", err)
 	}
 
@@ -492,31 +639,50 @@ func (r *RedisRepository) GetIdempotencyResult(ctx context.Context, key string)
 // convertRedisStreamsToMessages конвертирует ответ Redis в наш формат
 func (r *RedisRepository) convertRedisStreamsToMessages(
 	ctx context.Context,
+	userID int64,
+	login string,
 	streams []redis.XStream,
 ) ([]domain.StreamMessage, error) {
-	var messages []domain.StreamMessage
-
+	var entries []redis.XMessage
 	for _, stream := range streams {
-		for _, msg := range stream.Messages {
-			streamMsg := domain.StreamMessage{
-				ID:     msg.ID,
-				Fields: msg.Values,
-			}
-
-			// Загружаем payload уведомления если есть nid
-			if nidStr, ok := msg.Values["nid"].(string); ok {
-				payload, err := r.GetNotification(ctx, nidStr)
-				if err != nil {
-					slog.Warn("Ошибка загрузки payload", "error", err, "nid", nidStr)
-					continue
-				}
-				streamMsg.Payload = payload
-			}
+		entries = append(entries, stream.Messages...)
+	}
+	return r.attachPayloads(ctx, userID, login, entries)
+}
 
-			messages = append(messages, streamMsg)
+// attachPayloads превращает записи стрима в сообщения, загружая payload одним пайплайном.
+// Истекший payload оставляет Payload == nil; при ошибке расшифровки запись пропускается
+func (r *RedisRepository) attachPayloads(
+	ctx context.Context,
+	userID int64,
+	login string,
+	entries []redis.XMessage,
+) ([]domain.StreamMessage, error) {
+	nids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if nid, ok := e.Values["nid"].(string); ok {
+			nids = append(nids, nid)
 		}
 	}
 
+	loaded, err := r.loadPayloads(ctx, userID, login, nids)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]domain.StreamMessage, 0, len(entries))
+	for _, e := range entries {
+		msg := domain.StreamMessage{ID: e.ID, Fields: e.Values}
+		if nid, ok := e.Values["nid"].(string); ok {
+			l := loaded[nid]
+			if l.err != nil {
+				slog.WarnContext(ctx, "Ошибка загрузки payload", "error", l.err, "nid", nid)
+				continue
+			}
+			msg.Payload = l.payload
+		}
+		messages = append(messages, msg)
+	}
 	return messages, nil
 }
 
@@ -543,20 +709,7 @@ func (r *RedisRepository) RangeLastMessages(
 	}
 
 	// Конвертируем и подгружаем payload
-	var messages []domain.StreamMessage
-	for _, m := range msgs {
-		sm := domain.StreamMessage{ID: m.ID, Fields: m.Values}
-		if nidStr, ok := m.Values["nid"].(string); ok {
-			payload, err := r.GetNotification(ctx, nidStr)
-			if err != nil {
-				slog.Warn("Ошибка загрузки payload", "error", err, "nid", nidStr)
-			}
-			sm.Payload = payload
-		}
-		messages = append(messages, sm)
-	}
-
-	return messages, nil
+	return r.attachPayloads(ctx, userID, login, msgs)
 }
 
 // GetReadStatuses возвращает признак прочтения для списка notification_id
@@ -579,7 +732,7 @@ func (r *RedisRepository) GetReadStatuses(
 
 	for i, v := range vals {
 		read := false
-		if s, ok := v.(string); ok && s == "read" {
+		if s, ok := v.(string); ok && domain.IsReadState(r.openState(stateKey, notificationIDs[i], s)) {
 			read = true
 		}
 		result[notificationIDs[i]] = read
@@ -632,5 +785,58 @@ func (r *RedisRepository) TrimUserStreamByRetention(ctx context.Context, userID
 	minID := fmt.Sprintf("%d-0", cutoff.UnixMilli())
 	streamKey := domain.StreamKey(userID, login)
 	// MINID доступен в Redis 7.0+
-	return r.client.XTrimMinID(ctx, streamKey, minID).Err()
+	if err := r.client.XTrimMinID(ctx, streamKey, minID).Err(); err != nil {
+		return err
+	}
+	return r.dropInactiveUser(ctx, userID, login)
+}
+
+// compactStatesScript удаляет из хэша статусов поля уведомлений, отсутствующих в стриме.
+// Выполняется атомарно, чтобы не потерять статус записи, добавленной и прочитанной во время сборки.
+// Статусы кандидатов в сводку сохраняются: сводка не должна считать прочитанное истекшее уведомление непрочитанным.
+// KEYS: стрим, хэш статусов, кандидаты в сводку. Возвращает {удалено, осталось}
+var compactStatesScript = redis.NewScript(`
+local present = {}
+for _, entry in ipairs(redis.call('XRANGE', KEYS[1], '-', '+')) do
+	local fields = entry[2]
+	for i = 1, #fields, 2 do
+		if fields[i] == 'nid' then
+			present[fields[i + 1]] = true
+		end
+	end
+end
+for _, member in ipairs(redis.call('ZRANGE', KEYS[3], 0, -1)) do
+	local nid = string.match(member, '"nid":"([^"]+)"')
+	if nid then
+		present[nid] = true
+	end
+end
+
+local stale = {}
+for _, nid in ipairs(redis.call('HKEYS', KEYS[2])) do
+	if not present[nid] then
+		table.insert(stale, nid)
+	end
+end
+
+for i = 1, #stale, 500 do
+	redis.call('HDEL', KEYS[2], unpack(stale, i, math.min(i + 499, #stale)))
+end
+return {#stale, redis.call('HLEN', KEYS[2])}
+`)
+
+// CompactReadStates удаляет статусы прочтения уведомлений, которых больше нет ни в стриме, ни в кандидатах в сводку
+func (r *RedisRepository) CompactReadStates(ctx context.Context, userID int64, login string) (int64, int64, error) {
+	res, err := compactStatesScript.Run(ctx, r.client, []string{
+		domain.StreamKey(userID, login),
+		domain.NotificationStateKey(userID, login),
+		domain.DigestCandidatesKey(userID, login),
+	}).Int64Slice()
+	if err != nil {
+		return 0, 0, fmt.Errorf("ошибка сборки статусов прочтения: %w", err)
+	}
+	if len(res) != 2 {
+		return 0, 0, fmt.Errorf("неожиданный ответ сборки статусов прочтения: %v", res)
+	}
+	return res[0], res[1], nil
 }
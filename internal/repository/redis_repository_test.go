@@ -0,0 +1,355 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"notification-mvp/internal/domain"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRedisRepo поднимает Redis в процессе (miniredis выполняет Lua-скрипты репозитория)
+func newTestRedisRepo(t *testing.T) (*RedisRepository, *miniredis.Miniredis, redis.UniversalClient) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return NewRedisRepository(client), mr, client
+}
+
+// createRedisNotification создает уведомление и возвращает stream_id и notification_id
+func createRedisNotification(t *testing.T, r *RedisRepository, target domain.Target, limit domain.StreamLimit) (domain.CreateResult, string) {
+	t.Helper()
+	payload := &domain.NotificationPayload{Message: "hello", CreatedAt: time.Now(), Source: "test"}
+	res, err := r.CreateNotification(context.Background(), payload, target, limit)
+	if err != nil {
+		t.Fatalf("CreateNotification: %v", err)
+	}
+	return res, payload.NotificationID
+}
+
+func TestRedisAckScript(t *testing.T) {
+	r, _, client := newTestRedisRepo(t)
+	ctx := context.Background()
+	alice := domain.Target{ID: 1, Login: "alice"}
+	first, firstNID := createRedisNotification(t, r, alice, domain.StreamLimit{})
+	second, secondNID := createRedisNotification(t, r, alice, domain.StreamLimit{})
+
+	// Сообщения доставлены consumer и лежат в PEL
+	if _, err := r.ReadNewMessages(ctx, 1, "alice", time.Millisecond, 10); err != nil {
+		t.Fatalf("ReadNewMessages: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		login    string
+		streamID string
+		nid      string
+		want     domain.AckResult
+	}{
+		{"первое прочтение", "alice", first.StreamID, firstNID, domain.AckResultAcked},
+		{"повторное прочтение", "alice", first.StreamID, firstNID, domain.AckResultAlreadyRead},
+		{"чужой notification_id", "alice", first.StreamID, secondNID, domain.AckResultMismatched},
+		{"несуществующая запись", "alice", "1-1", firstNID, domain.AckResultUnknown},
+		{"неполный stream_id", "alice", "12345", firstNID, domain.AckResultUnknown},
+		{"синтаксически неверный stream_id", "alice", "bogus", firstNID, domain.AckResultUnknown},
+		{"пустой notification_id", "alice", second.StreamID, "", domain.AckResultUnknown},
+		{"стрим другого пользователя", "bob", second.StreamID, secondNID, domain.AckResultUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.AckMessage(ctx, 1, tt.login, tt.streamID, tt.nid)
+			if err != nil {
+				t.Fatalf("AckMessage: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("получено %s, ожидалось %s", got, tt.want)
+			}
+		})
+	}
+
+	// Отклоненные подтверждения не трогают PEL и хэш статусов
+	stateKey := domain.NotificationStateKey(1, "alice")
+	if exists, _ := client.HExists(ctx, stateKey, secondNID).Result(); exists {
+		t.Fatal("отклоненное подтверждение записало статус")
+	}
+	pending, err := client.XPending(ctx, domain.StreamKey(1, "alice"), domain.ConsumerGroupName).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending.Count != 1 {
+		t.Fatalf("в PEL %d записей, ожидалась одна (второе уведомление)", pending.Count)
+	}
+}
+
+func TestRedisOverflowScript(t *testing.T) {
+	alice := domain.Target{ID: 1, Login: "alice"}
+
+	tests := []struct {
+		name        string
+		policy      domain.OverflowPolicy
+		read        []int // индексы прочитанных уведомлений из трех существующих
+		wantErr     error
+		wantDropped []int // индексы вытесненных уведомлений
+		wantRead    []bool
+	}{
+		{"drop_oldest вытесняет самое старое", domain.OverflowDropOldest, nil, nil, []int{0}, []bool{false}},
+		{"drop_oldest сообщает о прочитанной жертве", domain.OverflowDropOldest, []int{0}, nil, []int{0}, []bool{true}},
+		{"drop_read вытесняет старейшее прочитанное", domain.OverflowDropRead, []int{1, 2}, nil, []int{1}, []bool{true}},
+		{"drop_read без прочитанных отклоняет", domain.OverflowDropRead, nil, domain.ErrInboxFull, nil, nil},
+		{"reject_new отклоняет", domain.OverflowRejectNew, []int{0}, domain.ErrInboxFull, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, mr, client := newTestRedisRepo(t)
+			ctx := context.Background()
+			limit := domain.StreamLimit{MaxLen: 3, Overflow: tt.policy}
+
+			var ids, nids []string
+			for i := 0; i < 3; i++ {
+				res, nid := createRedisNotification(t, r, alice, limit)
+				ids = append(ids, res.StreamID)
+				nids = append(nids, nid)
+			}
+			for _, i := range tt.read {
+				if res, err := r.AckMessage(ctx, 1, "alice", ids[i], nids[i]); err != nil || res != domain.AckResultAcked {
+					t.Fatalf("AckMessage = %s, %v", res, err)
+				}
+			}
+
+			payload := &domain.NotificationPayload{Message: "new", CreatedAt: time.Now(), Source: "test"}
+			res, err := r.CreateNotification(ctx, payload, alice, limit)
+			streamKey := domain.StreamKey(1, "alice")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ошибка %v, ожидалась %v", err, tt.wantErr)
+				}
+				if n, _ := client.XLen(ctx, streamKey).Result(); n != 3 {
+					t.Fatalf("отклоненное уведомление изменило стрим: %d записей", n)
+				}
+				if mr.Exists(domain.NotificationKey(1, "alice", payload.NotificationID)) {
+					t.Fatal("payload отклоненного уведомления не удален")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateNotification: %v", err)
+			}
+
+			if len(res.Dropped) != len(tt.wantDropped) {
+				t.Fatalf("вытеснено %+v, ожидались индексы %v", res.Dropped, tt.wantDropped)
+			}
+			for i, idx := range tt.wantDropped {
+				d := res.Dropped[i]
+				if d.StreamID != ids[idx] || d.NotificationID != nids[idx] || d.Read != tt.wantRead[i] {
+					t.Fatalf("вытеснена запись %+v, ожидалась %s/%s read=%v", d, ids[idx], nids[idx], tt.wantRead[i])
+				}
+				if mr.Exists(domain.NotificationKey(1, "alice", d.NotificationID)) {
+					t.Fatal("payload вытесненной записи не удален")
+				}
+				member := domain.TTLSchedulerEntry(d.StreamID, d.NotificationID)
+				if _, err := client.ZScore(ctx, domain.TTLSchedulerKey(1, "alice"), member).Result(); err != redis.Nil {
+					t.Fatalf("запись планировщика вытесненной записи осталась: %v", err)
+				}
+			}
+			if n, _ := client.XLen(ctx, streamKey).Result(); n != 3 {
+				t.Fatalf("после вытеснения в стриме %d записей, ожидалось 3", n)
+			}
+		})
+	}
+}
+
+func TestRedisOverflowUnlimited(t *testing.T) {
+	r, _, client := newTestRedisRepo(t)
+	alice := domain.Target{ID: 1, Login: "alice"}
+	for i := 0; i < 5; i++ {
+		if res, _ := createRedisNotification(t, r, alice, domain.StreamLimit{}); len(res.Dropped) != 0 {
+			t.Fatalf("без лимита вытеснены записи: %+v", res.Dropped)
+		}
+	}
+	if n, _ := client.XLen(context.Background(), domain.StreamKey(1, "alice")).Result(); n != 5 {
+		t.Fatalf("в стриме %d записей, ожидалось 5", n)
+	}
+}
+
+func TestRedisGetDuePaging(t *testing.T) {
+	r, _, client := newTestRedisRepo(t)
+	ctx := context.Background()
+	now := time.Now()
+	for i, member := range []string{"n3:1-c", "n1:1-a", "n2:1-b", "n4:1-d"} {
+		score := float64(now.Unix())
+		if i == 3 {
+			score = float64(now.Add(time.Hour).Unix()) // еще не наступила
+		}
+		client.ZAdd(ctx, domain.EscalationDueIndexKey, redis.Z{Score: score, Member: member})
+	}
+
+	var pages [][]string
+	for offset := int64(0); offset < 4; offset += 2 {
+		page, err := r.GetDueEscalations(ctx, now, offset, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, page)
+	}
+	if len(pages[0]) != 2 || pages[0][0] != "n1:1-a" || pages[0][1] != "n2:1-b" {
+		t.Fatalf("первая страница %v", pages[0])
+	}
+	if len(pages[1]) != 1 || pages[1][0] != "n3:1-c" {
+		t.Fatalf("вторая страница %v", pages[1])
+	}
+}
+
+func TestRedisGetActiveUserKeysPaging(t *testing.T) {
+	r, _, client := newTestRedisRepo(t)
+	ctx := context.Background()
+	now := time.Now()
+	for i, member := range []string{"1-c", "1-a", "1-b"} {
+		client.ZAdd(ctx, domain.ActiveUsersIndexKey, redis.Z{Score: float64(now.Add(time.Duration(i) * time.Hour).Unix()), Member: member})
+	}
+
+	tests := []struct {
+		since         time.Time
+		offset, limit int64
+		want          string
+	}{
+		{time.Time{}, 0, 2, "1-c,1-a"},
+		{time.Time{}, 2, 2, "1-b"},
+		{time.Time{}, 0, 0, "1-c,1-a,1-b"},
+		{now.Add(time.Hour), 0, 1, "1-a"},
+		{now.Add(time.Hour), 1, 1, "1-b"},
+	}
+	for _, tt := range tests {
+		got, err := r.GetActiveUserKeys(ctx, tt.since, tt.offset, tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("since=%v offset=%d limit=%d: получено %v, ожидалось %s", tt.since, tt.offset, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestRedisCompactReadStates(t *testing.T) {
+	r, _, client := newTestRedisRepo(t)
+	ctx := context.Background()
+	alice := domain.Target{ID: 1, Login: "alice"}
+	stateKey := domain.NotificationStateKey(1, "alice")
+
+	gone, goneNID := createRedisNotification(t, r, alice, domain.StreamLimit{})
+	kept, keptNID := createRedisNotification(t, r, alice, domain.StreamLimit{})
+	_, unreadNID := createRedisNotification(t, r, alice, domain.StreamLimit{})
+	for _, m := range []struct{ streamID, nid string }{{gone.StreamID, goneNID}, {kept.StreamID, keptNID}} {
+		if res, err := r.AckMessage(ctx, 1, "alice", m.streamID, m.nid); err != nil || res != domain.AckResultAcked {
+			t.Fatalf("AckMessage(%s) = %s, %v", m.nid, res, err)
+		}
+	}
+	// Запись удалена из стрима (retention), ее статус остался; плюс поле без записи вовсе
+	client.XDel(ctx, domain.StreamKey(1, "alice"), gone.StreamID)
+	client.HSet(ctx, stateKey, "orphan", "1")
+	before := client.HGetAll(ctx, stateKey).Val()
+
+	removed, remaining, err := r.CompactReadStates(ctx, 1, "alice")
+	if err != nil {
+		t.Fatalf("CompactReadStates: %v", err)
+	}
+	if removed != 2 || remaining != int64(len(before))-2 {
+		t.Fatalf("удалено %d, осталось %d; было полей %d", removed, remaining, len(before))
+	}
+	after := client.HGetAll(ctx, stateKey).Val()
+	for _, nid := range []string{goneNID, "orphan"} {
+		if _, ok := after[nid]; ok {
+			t.Errorf("статус %s записи, которой нет в стриме, не удален", nid)
+		}
+	}
+	for nid, value := range before {
+		if nid == goneNID || nid == "orphan" {
+			continue
+		}
+		if after[nid] != value {
+			t.Errorf("статус %s живой записи изменен: %q -> %q", nid, value, after[nid])
+		}
+	}
+	if statuses, err := r.GetReadStatuses(ctx, 1, "alice", []string{keptNID, unreadNID}); err != nil || !statuses[keptNID] || statuses[unreadNID] {
+		t.Fatalf("GetReadStatuses после сборки = %v, %v", statuses, err)
+	}
+}
+
+func TestRedisExpiryCancelsEscalationAndDelivery(t *testing.T) {
+	ctx := context.Background()
+	alice := domain.Target{ID: 1, Login: "alice"}
+
+	tests := []struct {
+		name   string
+		expire func(r *RedisRepository, nid string) error
+	}{
+		{"джанитор TTL", func(r *RedisRepository, _ string) error {
+			_, err := r.CleanupExpiredNotifications(ctx, 1, "alice", 10)
+			return err
+		}},
+		{"событие истечения payload", func(r *RedisRepository, nid string) error {
+			_, err := r.ExpireNotification(ctx, 1, "alice", nid)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _, client := newTestRedisRepo(t)
+			res, nid := createRedisNotification(t, r, alice, domain.StreamLimit{})
+			if err := r.ScheduleEscalation(ctx, domain.Escalation{
+				NotificationID: nid,
+				StreamID:       res.StreamID,
+				Target:         alice,
+				ScheduledAt:    time.Now(),
+				Steps:          []domain.EscalationStep{{AfterMinutes: 10, Action: domain.EscalationRepush}},
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.ScheduleChannelDelivery(ctx, domain.ChannelDelivery{
+				NotificationID: nid,
+				StreamID:       res.StreamID,
+				Target:         alice,
+				DueAt:          time.Now().Add(time.Hour),
+			}); err != nil {
+				t.Fatal(err)
+			}
+			// Срок хранения истек: сдвигаем запись планировщика TTL в прошлое
+			client.ZAdd(ctx, domain.TTLSchedulerKey(1, "alice"), redis.Z{Score: 1, Member: res.StreamID + "|" + nid})
+
+			if err := tt.expire(r, nid); err != nil {
+				t.Fatal(err)
+			}
+			if esc, err := r.GetEscalation(ctx, 1, "alice", nid); err != nil || esc != nil {
+				t.Fatalf("эскалация не отменена: %+v, %v", esc, err)
+			}
+			if d, err := r.GetChannelDelivery(ctx, 1, "alice", nid); err != nil || d != nil {
+				t.Fatalf("доставка не отменена: %+v, %v", d, err)
+			}
+			if n, _ := client.ZCard(ctx, domain.EscalationDueIndexKey).Result(); n != 0 {
+				t.Fatalf("в индексе эскалаций осталось %d записей", n)
+			}
+		})
+	}
+}
+
+func TestRedisSubscribeLimit(t *testing.T) {
+	r, _, client := newTestRedisRepo(t)
+	subscribeConcurrently(t, r, 20, 5)
+
+	// Подписчики темы записаны только для принятых подписок
+	topics, _ := r.GetSubscriptions(context.Background(), 1, "alice")
+	for i := 0; i < 20; i++ {
+		topic := fmt.Sprintf("topic-%d", i)
+		subscribed, _ := client.SIsMember(context.Background(), domain.TopicKey(topic), domain.UserKey(1, "alice")).Result()
+		if subscribed != slices.Contains(topics, topic) {
+			t.Fatalf("тема %s: в подписчиках %v, в подписках пользователя %v", topic, subscribed, !subscribed)
+		}
+	}
+}
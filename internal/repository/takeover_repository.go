@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"notification-mvp/internal/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// releaseLockIfOwnerScript удаляет consumer lock, только если его держит указанный pod.
+// KEYS: consumer lock. ARGV: pod_id. Возвращает 1, если lock удален
+var releaseLockIfOwnerScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// TakeOverPodSessions освобождает сессии выбывшего pod: снимает consumer lock, которые все еще держит
+// именно этот pod, и удаляет реестр сессий pod. Lock, перешедшие к другому pod, не трогаются.
+// Pending сообщения остаются в PEL единственного consumer пользователя, и новая сессия дочитывает
+// их при подключении. Повторный вызов безопасен
+func (r *RedisRepository) TakeOverPodSessions(ctx context.Context, podID string) (*domain.PodTakeover, error) {
+	report := &domain.PodTakeover{Pod: podID}
+	sessionsKey := domain.PodSessionsKey(podID)
+
+	userKeys, err := r.client.SMembers(ctx, sessionsKey).Result()
+	if err != nil {
+		return report, fmt.Errorf("ошибка чтения сессий pod: %w", err)
+	}
+
+	for _, userKey := range userKeys {
+		userID, login, err := domain.ParseUserKey(userKey)
+		if err != nil {
+			slog.WarnContext(ctx, "Некорректный user key в сессиях pod", "pod", podID, "user_key", userKey)
+			continue
+		}
+		report.Users++
+
+		released, err := releaseLockIfOwnerScript.Run(ctx, r.client,
+			[]string{domain.ConsumerLockKey(userID, login)}, podID).Int()
+		if err != nil {
+			return report, fmt.Errorf("ошибка снятия consumer lock %s: %w", userKey, err)
+		}
+		report.LocksReleased += released
+	}
+
+	if err := r.client.Del(ctx, sessionsKey).Err(); err != nil {
+		return report, fmt.Errorf("ошибка удаления сессий pod: %w", err)
+	}
+	return report, nil
+}
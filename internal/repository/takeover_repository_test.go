@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"notification-mvp/internal/domain"
+)
+
+func TestTakeOverPodSessions(t *testing.T) {
+	r, _, client := newTestRedisRepo(t)
+	ctx := context.Background()
+
+	for _, login := range []string{"alice", "bob"} {
+		if ok, err := r.AcquireConsumerLock(ctx, 1, login, "pod-dead", time.Minute); err != nil || !ok {
+			t.Fatalf("AcquireConsumerLock(%s) = %v, %v", login, ok, err)
+		}
+	}
+	// Lock bob истек и достался живому pod, а запись в реестре выбывшего pod осталась
+	bobLock := domain.ConsumerLockKey(1, "bob")
+	client.Set(ctx, bobLock, "pod-live", time.Minute)
+
+	report, err := r.TakeOverPodSessions(ctx, "pod-dead")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Users != 2 || report.LocksReleased != 1 {
+		t.Fatalf("неверный итог передачи: %+v", report)
+	}
+	if n, _ := client.Exists(ctx, domain.ConsumerLockKey(1, "alice")).Result(); n != 0 {
+		t.Fatal("lock выбывшего pod не снят")
+	}
+	if owner, _ := client.Get(ctx, bobLock).Result(); owner != "pod-live" {
+		t.Fatalf("снят lock живого pod: владелец %q", owner)
+	}
+	if n, _ := client.Exists(ctx, domain.PodSessionsKey("pod-dead")).Result(); n != 0 {
+		t.Fatal("реестр сессий выбывшего pod не удален")
+	}
+}
+
+func TestConsumerLockForgetsLostSessions(t *testing.T) {
+	ctx := context.Background()
+	sessions := domain.PodSessionsKey("pod-a")
+
+	tests := []struct {
+		name string
+		lose func(t *testing.T, r *RedisRepository)
+	}{
+		{"продление перехваченного lock", func(t *testing.T, r *RedisRepository) {
+			r.client.Set(ctx, domain.ConsumerLockKey(1, "alice"), "pod-b", time.Minute)
+			if ok, err := r.RenewConsumerLock(ctx, 1, "alice", "pod-a", time.Minute); ok || err != nil {
+				t.Fatalf("RenewConsumerLock = %v, %v", ok, err)
+			}
+		}},
+		{"продление истекшего lock", func(t *testing.T, r *RedisRepository) {
+			r.client.Del(ctx, domain.ConsumerLockKey(1, "alice"))
+			if ok, err := r.RenewConsumerLock(ctx, 1, "alice", "pod-a", time.Minute); ok || err != nil {
+				t.Fatalf("RenewConsumerLock = %v, %v", ok, err)
+			}
+		}},
+		{"снятие перехваченного lock", func(t *testing.T, r *RedisRepository) {
+			r.client.Set(ctx, domain.ConsumerLockKey(1, "alice"), "pod-b", time.Minute)
+			if err := r.ReleaseConsumerLock(ctx, 1, "alice", "pod-a"); err != nil {
+				t.Fatal(err)
+			}
+			if owner, _ := r.client.Get(ctx, domain.ConsumerLockKey(1, "alice")).Result(); owner != "pod-b" {
+				t.Fatalf("снят чужой lock: владелец %q", owner)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _, client := newTestRedisRepo(t)
+			if ok, err := r.AcquireConsumerLock(ctx, 1, "alice", "pod-a", time.Minute); err != nil || !ok {
+				t.Fatalf("AcquireConsumerLock = %v, %v", ok, err)
+			}
+			tt.lose(t, r)
+			if member, _ := client.SIsMember(ctx, sessions, domain.UserKey(1, "alice")).Result(); member {
+				t.Fatal("потерянный lock остался в реестре сессий pod")
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"notification-mvp/internal/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// subscribeScript добавляет тему в подписки пользователя, если их меньше лимита.
+// KEYS: подписки пользователя. ARGV: тема, лимит тем.
+// Возвращает 1 — тема добавлена, 0 — уже была, -1 — лимит исчерпан
+var subscribeScript = redis.NewScript(`
+if redis.call('SISMEMBER', KEYS[1], ARGV[1]) == 1 then
+	return 0
+end
+if redis.call('SCARD', KEYS[1]) >= tonumber(ARGV[2]) then
+	return -1
+end
+return redis.call('SADD', KEYS[1], ARGV[1])
+`)
+
+// Subscribe добавляет тему в notif:subscriptions:{id}-{login} с проверкой лимита, а пользователя — в notif:topic:<topic>
+func (r *RedisRepository) Subscribe(ctx context.Context, userID int64, login string, topic string, maxTopics int) (bool, error) {
+	added, err := subscribeScript.Run(ctx, r.client,
+		[]string{domain.SubscriptionsKey(userID, login)}, topic, maxTopics).Int()
+	if err != nil {
+		return false, fmt.Errorf("ошибка подписки на тему: %w", err)
+	}
+	if added < 0 {
+		return false, fmt.Errorf("%w: не больше %d", domain.ErrTooManyTopics, maxTopics)
+	}
+	// Множество подписчиков в другом слоте Cluster, поэтому пишется отдельно. Запись повторяется
+	// и для уже подписанного пользователя: так восстанавливается подписчик, не записанный при сбое
+	if err := r.client.SAdd(ctx, domain.TopicKey(topic), domain.UserKey(userID, login)).Err(); err != nil {
+		return false, fmt.Errorf("ошибка подписки на тему: %w", err)
+	}
+	return added > 0, nil
+}
+
+// Unsubscribe удаляет пользователя из подписчиков темы и тему из его подписок
+func (r *RedisRepository) Unsubscribe(ctx context.Context, userID int64, login string, topic string) (bool, error) {
+	pipe := r.client.Pipeline()
+	removed := pipe.SRem(ctx, domain.TopicKey(topic), domain.UserKey(userID, login))
+	pipe.SRem(ctx, domain.SubscriptionsKey(userID, login), topic)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("ошибка отписки от темы: %w", err)
+	}
+	return removed.Val() > 0, nil
+}
+
+// GetSubscriptions возвращает темы пользователя
+func (r *RedisRepository) GetSubscriptions(ctx context.Context, userID int64, login string) ([]string, error) {
+	topics, err := r.client.SMembers(ctx, domain.SubscriptionsKey(userID, login)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения подписок пользователя: %w", err)
+	}
+	sort.Strings(topics)
+	return topics, nil
+}
+
+// ScanTopicSubscribers обходит подписчиков темы через SSCAN
+func (r *RedisRepository) ScanTopicSubscribers(ctx context.Context, topic string, cursor uint64, count int64) ([]string, uint64, error) {
+	members, next, err := r.client.SScan(ctx, domain.TopicKey(topic), cursor, "", count).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("ошибка чтения подписчиков темы: %w", err)
+	}
+	return members, next, nil
+}
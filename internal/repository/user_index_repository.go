@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"notification-mvp/internal/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// GetDueUserKeys возвращает до limit пользователей, у которых к моменту now истек TTL уведомлений
+func (r *RedisRepository) GetDueUserKeys(ctx context.Context, now time.Time, offset, limit int64) ([]string, error) {
+	keys, err := r.client.ZRangeByScore(ctx, domain.UserExpiryIndexKey, &redis.ZRangeBy{
+		Min:    "-inf",
+		Max:    fmt.Sprintf("%d", now.Unix()),
+		Offset: offset,
+		Count:  limit,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения индекса истечений: %w", err)
+	}
+	return keys, nil
+}
+
+// GetActiveUserKeys возвращает до limit пользователей с активностью не раньше since (нулевое время — всех)
+func (r *RedisRepository) GetActiveUserKeys(ctx context.Context, since time.Time, offset, limit int64) ([]string, error) {
+	minScore := "-inf"
+	if !since.IsZero() {
+		minScore = fmt.Sprintf("%d", since.Unix())
+	}
+	keys, err := r.client.ZRangeByScore(ctx, domain.ActiveUsersIndexKey, &redis.ZRangeBy{
+		Min:    minScore,
+		Max:    "+inf",
+		Offset: offset,
+		Count:  limit,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения индекса активных пользователей: %w", err)
+	}
+	return keys, nil
+}
+
+// rescheduleUserExpiry переносит пользователя в индексе истечений на ближайшую запись планировщика.
+// CreateNotification пишет планировщик раньше индекса, поэтому после удаления из индекса
+// достаточно перепроверить планировщик, чтобы не потерять параллельно созданное уведомление
+func (r *RedisRepository) rescheduleUserExpiry(ctx context.Context, userID int64, login string) error {
+	userKey := domain.UserKey(userID, login)
+	ttlKey := domain.TTLSchedulerKey(userID, login)
+
+	next, ok, err := r.nextExpiry(ctx, ttlKey)
+	if err != nil {
+		return err
+	}
+	if ok {
+		// Новые уведомления истекают не раньше существующих, поэтому score только растет
+		if err := r.client.ZAdd(ctx, domain.UserExpiryIndexKey, redis.Z{Score: next, Member: userKey}).Err(); err != nil {
+			return fmt.Errorf("ошибка обновления индекса истечений: %w", err)
+		}
+		return nil
+	}
+
+	if err := r.client.ZRem(ctx, domain.UserExpiryIndexKey, userKey).Err(); err != nil {
+		return fmt.Errorf("ошибка удаления из индекса истечений: %w", err)
+	}
+	next, ok, err = r.nextExpiry(ctx, ttlKey)
+	if err != nil || !ok {
+		return err
+	}
+	if err := r.client.ZAddLT(ctx, domain.UserExpiryIndexKey, redis.Z{Score: next, Member: userKey}).Err(); err != nil {
+		return fmt.Errorf("ошибка обновления индекса истечений: %w", err)
+	}
+	return nil
+}
+
+// nextExpiry возвращает score ближайшей записи планировщика TTL
+func (r *RedisRepository) nextExpiry(ctx context.Context, ttlKey string) (float64, bool, error) {
+	first, err := r.client.ZRangeWithScores(ctx, ttlKey, 0, 0).Result()
+	if err != nil {
+		return 0, false, fmt.Errorf("ошибка чтения планировщика TTL: %w", err)
+	}
+	if len(first) == 0 {
+		return 0, false, nil
+	}
+	return first[0].Score, true, nil
+}
+
+// dropInactiveUser убирает пользователя с пустым стримом из индекса активных.
+// После удаления стрим перепроверяется, чтобы не потерять параллельно созданное уведомление
+func (r *RedisRepository) dropInactiveUser(ctx context.Context, userID int64, login string) error {
+	userKey := domain.UserKey(userID, login)
+	streamKey := domain.StreamKey(userID, login)
+
+	n, err := r.client.XLen(ctx, streamKey).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("ошибка чтения длины стрима: %w", err)
+	}
+	if n > 0 {
+		return nil
+	}
+
+	if err := r.client.ZRem(ctx, domain.ActiveUsersIndexKey, userKey).Err(); err != nil {
+		return fmt.Errorf("ошибка удаления из индекса активных пользователей: %w", err)
+	}
+	n, err = r.client.XLen(ctx, streamKey).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("ошибка чтения длины стрима: %w", err)
+	}
+	if n > 0 {
+		return r.client.ZAddNX(ctx, domain.ActiveUsersIndexKey, redis.Z{
+			Score:  float64(time.Now().Unix()),
+			Member: userKey,
+		}).Err()
+	}
+	return nil
+}
+
+// BackfillUserIndex однократно заполняет индексы пользователей по существующим ключам (SCAN).
+// Нужен при обновлении с версии без индексов; повторные вызовы после успешного заполнения ничего не делают
+func (r *RedisRepository) BackfillUserIndex(ctx context.Context) (int, error) {
+	ready, err := r.client.Exists(ctx, domain.UserIndexReadyKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка проверки индекса пользователей: %w", err)
+	}
+	if ready > 0 {
+		return 0, nil
+	}
+
+	var indexed int
+	err = r.scanKeys(ctx, domain.StreamKeyPrefix+"*", func(keys []string) error {
+		for _, key := range keys {
+			userKey := domain.UserKeyFromTag(strings.TrimPrefix(key, domain.StreamKeyPrefix))
+			userID, login, err := domain.ParseUserKey(userKey)
+			if err != nil {
+				slog.WarnContext(ctx, "Ошибка парсинга user key", "user_key", userKey, "error", err)
+				continue
+			}
+			if err := r.backfillUser(ctx, userID, login); err != nil {
+				return err
+			}
+			indexed++
+		}
+		return nil
+	})
+	if err != nil {
+		return indexed, err
+	}
+
+	if err := r.client.Set(ctx, domain.UserIndexReadyKey, time.Now().Format(time.RFC3339), 0).Err(); err != nil {
+		return indexed, fmt.Errorf("ошибка отметки заполнения индекса: %w", err)
+	}
+	return indexed, nil
+}
+
+// backfillUser добавляет пользователя в оба индекса, не перезаписывая более свежие значения
+func (r *RedisRepository) backfillUser(ctx context.Context, userID int64, login string) error {
+	userKey := domain.UserKey(userID, login)
+
+	last, err := r.client.XRevRangeN(ctx, domain.StreamKey(userID, login), "+", "-", 1).Result()
+	if err != nil {
+		return fmt.Errorf("ошибка чтения стрима: %w", err)
+	}
+	if len(last) > 0 {
+		activity := domain.StreamIDTime(last[0].ID)
+		if activity.IsZero() {
+			activity = time.Now()
+		}
+		if err := r.client.ZAddNX(ctx, domain.ActiveUsersIndexKey, redis.Z{Score: float64(activity.Unix()), Member: userKey}).Err(); err != nil {
+			return fmt.Errorf("ошибка заполнения индекса активных пользователей: %w", err)
+		}
+	}
+
+	next, ok, err := r.nextExpiry(ctx, domain.TTLSchedulerKey(userID, login))
+	if err != nil || !ok {
+		return err
+	}
+	if err := r.client.ZAddLT(ctx, domain.UserExpiryIndexKey, redis.Z{Score: next, Member: userKey}).Err(); err != nil {
+		return fmt.Errorf("ошибка заполнения индекса истечений: %w", err)
+	}
+	return nil
+}
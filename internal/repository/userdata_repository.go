@@ -0,0 +1,317 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"notification-mvp/internal/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ExportUserData выгружает стрим, payload, статусы прочтения и retention пользователя
+func (r *RedisRepository) ExportUserData(ctx context.Context, userID int64, login string) (*domain.UserDataExport, error) {
+	stateKey := domain.NotificationStateKey(userID, login)
+
+	pipe := r.client.Pipeline()
+	entriesCmd := pipe.XRange(ctx, domain.StreamKey(userID, login), "-", "+")
+	ttlCmd := pipe.ZRangeWithScores(ctx, domain.TTLSchedulerKey(userID, login), 0, -1)
+	statesCmd := pipe.HGetAll(ctx, stateKey)
+	retentionCmd := pipe.Exists(ctx, domain.RetentionKey(userID, login))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, wrapRedisError("ошибка выгрузки данных пользователя", err)
+	}
+
+	days, err := r.GetUserRetentionDays(ctx, userID, login)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := r.GetDigestPreference(ctx, userID, login)
+	if err != nil {
+		return nil, err
+	}
+	escalations, err := r.userEscalations(ctx, userID, login)
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := r.userChannelDeliveries(ctx, userID, login)
+	if err != nil {
+		return nil, err
+	}
+	webhook, err := r.GetWebhook(ctx, userID, login)
+	if err != nil {
+		return nil, err
+	}
+	if webhook != nil {
+		webhook.Secret = ""
+	}
+	prefs, err := r.GetPreferences(ctx, userID, login)
+	if err != nil {
+		return nil, err
+	}
+	deferred, err := r.userDeferred(ctx, userID, login)
+	if err != nil {
+		return nil, err
+	}
+	topics, err := r.GetSubscriptions(ctx, userID, login)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &domain.UserDataExport{
+		Target:        domain.Target{ID: userID, Login: login},
+		Entries:       []domain.ExportedEntry{},
+		ReadStates:    make(map[string]string),
+		RetentionDays: days,
+		RetentionSet:  retentionCmd.Val() > 0,
+		Digest:        digest,
+		Escalations:   escalations,
+		Deliveries:    deliveries,
+		Webhook:       webhook,
+		Preferences:   prefs,
+		Deferred:      deferred,
+		Topics:        topics,
+		ExportedAt:    time.Now().UTC(),
+	}
+
+	for nid, value := range statesCmd.Val() {
+		if state := r.openState(stateKey, nid, value); state != "" {
+			export.ReadStates[nid] = state
+		}
+	}
+
+	expiresAt := make(map[string]time.Time)
+	for _, z := range ttlCmd.Val() {
+		if member, ok := z.Member.(string); ok {
+			expiresAt[member] = time.Unix(int64(z.Score), 0).UTC()
+		}
+	}
+
+	entries := entriesCmd.Val()
+	nids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if nid, ok := e.Values["nid"].(string); ok {
+			nids = append(nids, nid)
+		}
+	}
+	payloads, err := r.loadPayloads(ctx, userID, login, nids)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		nid, _ := e.Values["nid"].(string)
+		entry := domain.ExportedEntry{
+			StreamID:       e.ID,
+			NotificationID: nid,
+			Fields:         e.Values,
+			Read:           domain.IsReadState(export.ReadStates[nid]),
+		}
+		loaded := payloads[nid]
+		if loaded.err != nil {
+			return nil, fmt.Errorf("ошибка выгрузки уведомления %s: %w", nid, loaded.err)
+		}
+		entry.Payload = loaded.payload
+		if t, ok := expiresAt[domain.TTLSchedulerEntry(e.ID, nid)]; ok {
+			entry.ExpiresAt = &t
+		}
+		export.Entries = append(export.Entries, entry)
+	}
+
+	return export, nil
+}
+
+// EraseUserData удаляет все ключи пользователя. Payload ищутся по стриму, планировщику TTL
+// и хэшу статусов, чтобы удалить и те, чья запись уже вытеснена из стрима. Пользователь также
+// убирается из реестров сессий pod и из сохраненных ответов идемпотентности.
+// Уведомления, создаваемые параллельно с удалением, могут пережить его
+func (r *RedisRepository) EraseUserData(ctx context.Context, userID int64, login string) (*domain.ErasureReport, error) {
+	userKey := domain.UserKey(userID, login)
+	streamKey := domain.StreamKey(userID, login)
+	ttlKey := domain.TTLSchedulerKey(userID, login)
+	stateKey := domain.NotificationStateKey(userID, login)
+
+	nids, err := r.userNotificationIDs(ctx, streamKey, ttlKey, stateKey)
+	if err != nil {
+		return nil, err
+	}
+	escalationIDs, err := r.client.HKeys(ctx, domain.EscalationKey(userID, login)).Result()
+	if err != nil {
+		return nil, wrapRedisError("ошибка чтения эскалаций пользователя", err)
+	}
+	deliveryIDs, err := r.client.HKeys(ctx, domain.ChannelDeliveryKey(userID, login)).Result()
+	if err != nil {
+		return nil, wrapRedisError("ошибка чтения доставок каналами пользователя", err)
+	}
+	deferredIDs, err := r.client.HKeys(ctx, domain.DeferredKey(userID, login)).Result()
+	if err != nil {
+		return nil, wrapRedisError("ошибка чтения отложенных уведомлений пользователя", err)
+	}
+	topics, err := r.client.SMembers(ctx, domain.SubscriptionsKey(userID, login)).Result()
+	if err != nil {
+		return nil, wrapRedisError("ошибка чтения подписок пользователя", err)
+	}
+	idempotencyKeys, err := r.client.SMembers(ctx, domain.IdempotencyIndexKey(userID, login)).Result()
+	if err != nil {
+		return nil, wrapRedisError("ошибка чтения ключей идемпотентности пользователя", err)
+	}
+
+	payloadKeys := make([]string, 0, len(nids))
+	for _, nid := range nids {
+		payloadKeys = append(payloadKeys, domain.NotificationKey(userID, login, nid))
+	}
+	userKeys := []string{
+		streamKey,
+		ttlKey,
+		stateKey,
+		domain.ConsumerLockKey(userID, login),
+		domain.RetentionKey(userID, login),
+		domain.DigestKey(userID, login),
+		domain.DigestCandidatesKey(userID, login),
+		domain.EscalationKey(userID, login),
+		domain.ChannelDeliveryKey(userID, login),
+		domain.WebhookKey(userID, login),
+		domain.PreferencesKey(userID, login),
+		domain.DeferredKey(userID, login),
+		domain.SubscriptionsKey(userID, login),
+		domain.IdempotencyIndexKey(userID, login),
+	}
+
+	// Ключи удаляем по одному: в схеме без хэш-тегов они лежат в разных слотах кластера
+	pipe := r.client.Pipeline()
+	payloadDels := make([]*redis.IntCmd, 0, len(payloadKeys))
+	for _, key := range payloadKeys {
+		payloadDels = append(payloadDels, pipe.Del(ctx, key))
+	}
+	keyDels := make([]*redis.IntCmd, 0, len(userKeys))
+	for _, key := range userKeys {
+		keyDels = append(keyDels, pipe.Del(ctx, key))
+	}
+	pipe.ZRem(ctx, domain.ActiveUsersIndexKey, userKey)
+	pipe.ZRem(ctx, domain.UserExpiryIndexKey, userKey)
+	pipe.ZRem(ctx, domain.DigestDueIndexKey, userKey)
+	for _, nid := range escalationIDs {
+		pipe.ZRem(ctx, domain.EscalationDueIndexKey, domain.NotificationMember(userKey, nid))
+	}
+	for _, nid := range deliveryIDs {
+		pipe.ZRem(ctx, domain.ChannelDueIndexKey, domain.NotificationMember(userKey, nid))
+	}
+	for _, nid := range deferredIDs {
+		pipe.ZRem(ctx, domain.DeferredDueIndexKey, domain.NotificationMember(userKey, nid))
+	}
+	for _, topic := range topics {
+		pipe.SRem(ctx, domain.TopicKey(topic), userKey)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, wrapRedisError("ошибка удаления данных пользователя", err)
+	}
+
+	for _, key := range payloadKeys {
+		r.invalidatePayload(key)
+	}
+
+	report := &domain.ErasureReport{
+		Target:   domain.Target{ID: userID, Login: login},
+		ErasedAt: time.Now().UTC(),
+	}
+	if err := r.forgetPodSessions(ctx, userKey); err != nil {
+		return nil, err
+	}
+	for _, key := range idempotencyKeys {
+		deleted, err := r.forgetIdempotencyTarget(ctx, key, report.Target)
+		if err != nil {
+			return nil, err
+		}
+		report.KeysDeleted += deleted
+	}
+	for _, cmd := range payloadDels {
+		report.PayloadsDeleted += cmd.Val()
+	}
+	for _, cmd := range keyDels {
+		report.KeysDeleted += cmd.Val()
+	}
+	return report, nil
+}
+
+// forgetPodSessions убирает пользователя из реестров сессий всех pod: запись может остаться
+// и у pod, lock которого уже истек
+func (r *RedisRepository) forgetPodSessions(ctx context.Context, userKey string) error {
+	return r.scanKeys(ctx, domain.PodSessionsKeyPrefix+"*", func(keys []string) error {
+		pipe := r.client.Pipeline()
+		for _, key := range keys {
+			pipe.SRem(ctx, key, userKey)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return wrapRedisError("ошибка удаления пользователя из сессий pod", err)
+		}
+		return nil
+	})
+}
+
+// forgetIdempotencyTarget вырезает результаты пользователя из ответа, сохраненного по ключу идемпотентности.
+// Ответ без оставшихся получателей удаляется целиком (возвращается 1); срок хранения не меняется
+func (r *RedisRepository) forgetIdempotencyTarget(ctx context.Context, key string, target domain.Target) (int64, error) {
+	result, err := r.GetIdempotencyResult(ctx, key)
+	if err != nil || result == nil {
+		return 0, err
+	}
+	kept := result.Results[:0]
+	for _, res := range result.Results {
+		if res.Target != target {
+			kept = append(kept, res)
+		}
+	}
+	redisKey := domain.IdempotencyKey(key)
+	if len(kept) == 0 {
+		deleted, err := r.client.Del(ctx, redisKey).Result()
+		if err != nil {
+			return 0, wrapRedisError("ошибка удаления результата идемпотентности", err)
+		}
+		return deleted, nil
+	}
+	result.Results = kept
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сериализации результата идемпотентности: %w", err)
+	}
+	if err := r.client.SetArgs(ctx, redisKey, string(resultBytes), redis.SetArgs{Mode: "XX", KeepTTL: true}).Err(); err != nil && err != redis.Nil {
+		return 0, wrapRedisError("ошибка перезаписи результата идемпотентности", err)
+	}
+	return 0, nil
+}
+
+// userNotificationIDs собирает notification_id пользователя из стрима, планировщика TTL и хэша статусов
+func (r *RedisRepository) userNotificationIDs(ctx context.Context, streamKey, ttlKey, stateKey string) ([]string, error) {
+	pipe := r.client.Pipeline()
+	entriesCmd := pipe.XRange(ctx, streamKey, "-", "+")
+	membersCmd := pipe.ZRange(ctx, ttlKey, 0, -1)
+	statesCmd := pipe.HKeys(ctx, stateKey)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, wrapRedisError("ошибка чтения уведомлений пользователя", err)
+	}
+
+	seen := make(map[string]bool)
+	var nids []string
+	add := func(nid string) {
+		if nid != "" && !seen[nid] {
+			seen[nid] = true
+			nids = append(nids, nid)
+		}
+	}
+	for _, e := range entriesCmd.Val() {
+		nid, _ := e.Values["nid"].(string)
+		add(nid)
+	}
+	for _, member := range membersCmd.Val() {
+		if _, nid, ok := strings.Cut(member, "|"); ok {
+			add(nid)
+		}
+	}
+	for _, nid := range statesCmd.Val() {
+		add(nid)
+	}
+	return nids, nil
+}
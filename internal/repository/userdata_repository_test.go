@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"notification-mvp/internal/domain"
+)
+
+// userDataRepos возвращает обе реализации репозитория для проверки выгрузки и удаления данных
+func userDataRepos(t *testing.T) map[string]domain.NotificationRepository {
+	t.Helper()
+	memory, _ := newTestMemoryRepo(t)
+	redisRepo, _, _ := newTestRedisRepo(t)
+	return map[string]domain.NotificationRepository{"memory": memory, "redis": redisRepo}
+}
+
+// createUserNotification создает уведомление и возвращает stream_id и notification_id
+func createUserNotification(t *testing.T, repo domain.NotificationRepository, target domain.Target) (string, string) {
+	t.Helper()
+	payload := &domain.NotificationPayload{Message: "hello", CreatedAt: testEpoch, Source: "test"}
+	res, err := repo.CreateNotification(context.Background(), payload, target, domain.StreamLimit{})
+	if err != nil {
+		t.Fatalf("CreateNotification: %v", err)
+	}
+	return res.StreamID, payload.NotificationID
+}
+
+func TestExportUserData(t *testing.T) {
+	alice := domain.Target{ID: 1, Login: "alice"}
+	bob := domain.Target{ID: 2, Login: "bob"}
+
+	for name, repo := range userDataRepos(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			readStreamID, readNID := createUserNotification(t, repo, alice)
+			_, unreadNID := createUserNotification(t, repo, alice)
+			createUserNotification(t, repo, bob)
+			if res, err := repo.AckMessage(ctx, 1, "alice", readStreamID, readNID); err != nil || res != domain.AckResultAcked {
+				t.Fatalf("AckMessage = %s, %v", res, err)
+			}
+			if err := repo.SetUserRetentionDays(ctx, 1, "alice", 3); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := repo.Subscribe(ctx, 1, "alice", "news", domain.MaxTopicsPerUser); err != nil {
+				t.Fatal(err)
+			}
+
+			export, err := repo.ExportUserData(ctx, 1, "alice")
+			if err != nil {
+				t.Fatalf("ExportUserData: %v", err)
+			}
+			if export.Target != alice || !export.RetentionSet || export.RetentionDays != 3 {
+				t.Fatalf("неверные сведения о пользователе: %+v", export)
+			}
+			if !slices.Equal(export.Topics, []string{"news"}) {
+				t.Fatalf("темы %v, ожидалось [news]", export.Topics)
+			}
+			if len(export.Entries) != 2 {
+				t.Fatalf("выгружено %d записей, ожидалось 2 (чужие не попадают)", len(export.Entries))
+			}
+			for _, e := range export.Entries {
+				if e.Payload == nil || e.Payload.Message != "hello" {
+					t.Errorf("%s: payload не выгружен: %+v", e.NotificationID, e.Payload)
+				}
+				if e.ExpiresAt == nil {
+					t.Errorf("%s: не указан срок истечения", e.NotificationID)
+				}
+				if e.Read != (e.NotificationID == readNID) {
+					t.Errorf("%s: read = %v", e.NotificationID, e.Read)
+				}
+			}
+			if domain.IsReadState(export.ReadStates[unreadNID]) {
+				t.Errorf("непрочитанное уведомление выгружено как прочитанное")
+			}
+			if !domain.IsReadState(export.ReadStates[readNID]) {
+				t.Errorf("статус прочтения не выгружен: %v", export.ReadStates)
+			}
+		})
+	}
+}
+
+func TestEraseUserData(t *testing.T) {
+	alice := domain.Target{ID: 1, Login: "alice"}
+	bob := domain.Target{ID: 2, Login: "bob"}
+
+	for name, repo := range userDataRepos(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			streamID, nid := createUserNotification(t, repo, alice)
+			createUserNotification(t, repo, bob)
+			if _, err := repo.AckMessage(ctx, 1, "alice", streamID, nid); err != nil {
+				t.Fatal(err)
+			}
+			for _, target := range []domain.Target{alice, bob} {
+				if _, err := repo.Subscribe(ctx, target.ID, target.Login, "news", domain.MaxTopicsPerUser); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if ok, err := repo.AcquireConsumerLock(ctx, 1, "alice", "pod-a", time.Minute); err != nil || !ok {
+				t.Fatalf("AcquireConsumerLock = %v, %v", ok, err)
+			}
+			shared := &domain.NotifyResponse{Results: []domain.NotifyResult{
+				{Target: alice, NotificationID: nid},
+				{Target: bob, NotificationID: "bob-nid"},
+			}}
+			own := &domain.NotifyResponse{Results: []domain.NotifyResult{{Target: alice, NotificationID: nid}}}
+			for key, result := range map[string]*domain.NotifyResponse{"shared": shared, "own": own} {
+				if err := repo.SaveIdempotencyResult(ctx, key, result); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			report, err := repo.EraseUserData(ctx, 1, "alice")
+			if err != nil {
+				t.Fatalf("EraseUserData: %v", err)
+			}
+			if report.PayloadsDeleted != 1 || report.KeysDeleted == 0 {
+				t.Fatalf("неверная квитанция: %+v", report)
+			}
+
+			export, err := repo.ExportUserData(ctx, 1, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(export.Entries) != 0 || len(export.ReadStates) != 0 || len(export.Topics) != 0 || export.RetentionSet {
+				t.Fatalf("после удаления остались данные: %+v", export)
+			}
+			subscribers, _, err := repo.ScanTopicSubscribers(ctx, "news", 0, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(subscribers, []string{"2-bob"}) {
+				t.Fatalf("подписчики темы %v, ожидался только 2-bob", subscribers)
+			}
+
+			if got, err := repo.GetIdempotencyResult(ctx, "own"); err != nil || got != nil {
+				t.Fatalf("ответ только с удаленным пользователем не удален: %+v, %v", got, err)
+			}
+			got, err := repo.GetIdempotencyResult(ctx, "shared")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got == nil || len(got.Results) != 1 || got.Results[0].Target != bob {
+				t.Fatalf("в общем ответе должен остаться только bob: %+v", got)
+			}
+
+			bobExport, err := repo.ExportUserData(ctx, 2, "bob")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(bobExport.Entries) != 1 {
+				t.Fatalf("затронуты данные другого пользователя: %d записей", len(bobExport.Entries))
+			}
+		})
+	}
+}
+
+func TestRedisEraseUserDataPodSessions(t *testing.T) {
+	r, mr, client := newTestRedisRepo(t)
+	ctx := context.Background()
+	createUserNotification(t, r, domain.Target{ID: 1, Login: "alice"})
+	if ok, err := r.AcquireConsumerLock(ctx, 1, "alice", "pod-a", time.Minute); err != nil || !ok {
+		t.Fatalf("AcquireConsumerLock = %v, %v", ok, err)
+	}
+	// Запись в реестре pod, чей lock уже истек, и чужой пользователь в том же реестре
+	client.SAdd(ctx, domain.PodSessionsKey("pod-b"), "1-alice", "2-bob")
+	if err := r.SaveIdempotencyResult(ctx, "own", &domain.NotifyResponse{Results: []domain.NotifyResult{
+		{Target: domain.Target{ID: 1, Login: "alice"}, NotificationID: "n1"},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.EraseUserData(ctx, 1, "alice"); err != nil {
+		t.Fatalf("EraseUserData: %v", err)
+	}
+	for _, pod := range []string{"pod-a", "pod-b"} {
+		if ok, _ := client.SIsMember(ctx, domain.PodSessionsKey(pod), "1-alice").Result(); ok {
+			t.Errorf("пользователь остался в сессиях %s", pod)
+		}
+	}
+	if ok, _ := client.SIsMember(ctx, domain.PodSessionsKey("pod-b"), "2-bob").Result(); !ok {
+		t.Error("из сессий pod удален другой пользователь")
+	}
+	for _, key := range mr.Keys() {
+		if strings.Contains(key, "alice") {
+			t.Errorf("остался ключ пользователя %s", key)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"notification-mvp/internal/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SetWebhook сохраняет регистрацию webhook в notif:webhook:{id}-{login}.
+// Секрет хранится открыто: он нужен каналу для подписи каждого запроса
+func (r *RedisRepository) SetWebhook(ctx context.Context, userID int64, login string, hook domain.Webhook) error {
+	data, err := json.Marshal(hook)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации webhook: %w", err)
+	}
+	if err := r.client.Set(ctx, domain.WebhookKey(userID, login), data, 0).Err(); err != nil {
+		return fmt.Errorf("ошибка сохранения webhook: %w", err)
+	}
+	return nil
+}
+
+// GetWebhook возвращает регистрацию webhook пользователя
+func (r *RedisRepository) GetWebhook(ctx context.Context, userID int64, login string) (*domain.Webhook, error) {
+	data, err := r.client.Get(ctx, domain.WebhookKey(userID, login)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка чтения webhook: %w", err)
+	}
+
+	var hook domain.Webhook
+	if err := json.Unmarshal(data, &hook); err != nil {
+		return nil, fmt.Errorf("ошибка разбора webhook: %w", err)
+	}
+	return &hook, nil
+}
+
+// DeleteWebhook удаляет регистрацию webhook пользователя
+func (r *RedisRepository) DeleteWebhook(ctx context.Context, userID int64, login string) error {
+	if err := r.client.Del(ctx, domain.WebhookKey(userID, login)).Err(); err != nil {
+		return fmt.Errorf("ошибка удаления webhook: %w", err)
+	}
+	return nil
+}
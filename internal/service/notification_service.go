@@ -2,29 +2,50 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"notification-mvp/internal/domain"
 	"notification-mvp/internal/metrics"
+
+	"github.com/google/uuid"
+)
+
+// Паузы между повторами чтения при временной недоступности хранилища
+const (
+	readRetryMinBackoff = 200 * time.Millisecond
+	readRetryMaxBackoff = 5 * time.Second
 )
 
 // NotificationService реализует бизнес-логику работы с уведомлениями
 type NotificationService struct {
-	repo   domain.NotificationRepository
-	logger *slog.Logger
-	podID  string
+	repo    domain.NotificationRepository
+	logger  *slog.Logger
+	podID   string
+	archive domain.ArchiveSink
+	limits  domain.StreamLimitResolver
+	events  domain.ClientEventPublisher
+
+	// channelWindow — через сколько непрочитанное уведомление уходит во внешние каналы (0 — каналы выключены)
+	channelWindow time.Duration
+
+	// topicChunk — сколько подписчиков темы читается за один шаг разворачивания
+	topicChunk int64
 }
 
 // NewNotificationService создает новый экземпляр NotificationService
 func NewNotificationService(repo domain.NotificationRepository, logger *slog.Logger) *NotificationService {
 	return &NotificationService{
-		repo:   repo,
-		logger: logger,
+		repo:       repo,
+		logger:     logger,
+		topicChunk: 500,
 	}
 }
 
@@ -34,6 +55,50 @@ func (s *NotificationService) WithPodID(podID string) *NotificationService {
 	return s
 }
 
+// WithArchive включает асинхронное копирование уведомлений и статусов в долговременный архив
+func (s *NotificationService) WithArchive(archive domain.ArchiveSink) *NotificationService {
+	s.archive = archive
+	return s
+}
+
+// WithStreamLimits задает лимиты стрима пользователя и политики переполнения
+func (s *NotificationService) WithStreamLimits(limits domain.StreamLimitResolver) *NotificationService {
+	s.limits = limits
+	return s
+}
+
+// WithChannels включает доставку внешними каналами: сразу, если получатель не в сети,
+// иначе — если он не прочитал уведомление за window
+func (s *NotificationService) WithChannels(window time.Duration) *NotificationService {
+	s.channelWindow = window
+	return s
+}
+
+// WithTopicChunk задает размер части, которыми разворачиваются подписчики тем
+func (s *NotificationService) WithTopicChunk(chunk int) *NotificationService {
+	if chunk > 0 {
+		s.topicChunk = int64(chunk)
+	}
+	return s
+}
+
+// WithEvents включает отправку служебных событий (inbox.overflow) в сессии пользователя
+func (s *NotificationService) WithEvents(events domain.ClientEventPublisher) *NotificationService {
+	s.events = events
+	return s
+}
+
+// recordArchive передает событие в архив, если он настроен
+func (s *NotificationService) recordArchive(event domain.ArchiveEvent) {
+	if s.archive == nil {
+		return
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+	s.archive.Record(event)
+}
+
 // CreateNotifications создает уведомления для списка получателей
 func (s *NotificationService) CreateNotifications(
 	ctx context.Context,
@@ -43,7 +108,7 @@ func (s *NotificationService) CreateNotifications(
 	// Проверяем идемпотентность если ключ предоставлен
 	if idempotencyKey != "" {
 		if cached, err := s.repo.GetIdempotencyResult(ctx, idempotencyKey); err == nil && cached != nil {
-			s.logger.Debug("Возвращен кэшированный результат", "idempotency_key", idempotencyKey)
+			s.logger.DebugContext(ctx, "Возвращен кэшированный результат", "idempotency_key", idempotencyKey)
 			return cached, nil
 		}
 	}
@@ -53,39 +118,29 @@ func (s *NotificationService) CreateNotifications(
 		return nil, fmt.Errorf("ошибка валидации запроса: %w", err)
 	}
 
-	var results []domain.NotifyResult
+	results := make([]domain.NotifyResult, 0, len(req.Target))
+	seen := make(map[string]struct{}, len(req.Target))
 
 	// Создаем уведомления для каждого получателя
 	for _, target := range req.Target {
-		// Создаем базовый payload
-		payload := &domain.NotificationPayload{
-			Message:   req.Message,
-			CreatedAt: req.CreatedAt,
-			Source:    req.Source,
-			Target:    target,
+		seen[domain.UserKey(target.ID, target.Login)] = struct{}{}
+		if result, ok := s.notifyTarget(ctx, req, target); ok {
+			results = append(results, result)
 		}
+	}
 
-		// Создаем уведомление в репозитории
-		streamID, err := s.repo.CreateNotification(ctx, payload, target)
+	// Подписчики тем читаются частями; получатель из target или нескольких тем получает одно уведомление
+	for _, topic := range req.Topics {
+		topicResults, err := s.notifyTopic(ctx, req, topic, seen)
+		results = append(results, topicResults...)
 		if err != nil {
-			s.logger.Error("Ошибка создания уведомления",
+			// Часть подписчиков уже уведомлена: ответ с ними сохраняется для идемпотентности,
+			// чтобы повтор запроса не разослал уведомление им еще раз
+			s.logger.ErrorContext(ctx, "Ошибка рассылки по теме",
 				"error", err,
-				"target_id", target.ID,
-				"target_login", target.Login)
-			continue // Продолжаем с остальными получателями
+				"topic", topic,
+				"notified", len(topicResults))
 		}
-
-		result := domain.NotifyResult{
-			Target:         target,
-			NotificationID: payload.NotificationID,
-		}
-		results = append(results, result)
-
-		s.logger.Debug("Создано уведомление",
-			"notification_id", payload.NotificationID,
-			"stream_id", streamID,
-			"target_id", target.ID,
-			"target_login", target.Login)
 	}
 
 	response := &domain.NotifyResponse{
@@ -95,19 +150,398 @@ func (s *NotificationService) CreateNotifications(
 	// Сохраняем результат для идемпотентности
 	if idempotencyKey != "" {
 		if err := s.repo.SaveIdempotencyResult(ctx, idempotencyKey, response); err != nil {
-			s.logger.Warn("Ошибка сохранения результата идемпотентности", "error", err)
+			s.logger.WarnContext(ctx, "Ошибка сохранения результата идемпотентности", "error", err)
 			// Не критично, продолжаем
 		}
 	}
 
-	s.logger.Info("Созданы уведомления",
+	s.logger.InfoContext(ctx, "Созданы уведомления",
 		"count", len(results),
 		"total_targets", len(req.Target),
+		"topics", len(req.Topics),
 		"source", req.Source)
 
 	return response, nil
 }
 
+// notifyTarget создает уведомление одному получателю с учетом его настроек.
+// ok == false — уведомление не создано из-за ошибки хранилища, она записана в лог
+func (s *NotificationService) notifyTarget(
+	ctx context.Context,
+	req *domain.NotifyRequest,
+	target domain.Target,
+) (domain.NotifyResult, bool) {
+	// Создаем базовый payload
+	payload := &domain.NotificationPayload{
+		Message:   req.Message,
+		CreatedAt: req.CreatedAt,
+		Source:    req.Source,
+		Category:  req.Category,
+		Tenant:    req.Tenant,
+		Priority:  req.Priority,
+		Target:    target,
+	}
+
+	prefs := s.preferences(ctx, target)
+	if result, handled := s.applyPreferences(ctx, payload, prefs, req.Escalation); handled {
+		return result, true
+	}
+
+	result, err := s.createForTarget(ctx, payload, req.Escalation, prefs)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Ошибка создания уведомления",
+			"error", err,
+			"target_id", target.ID,
+			"target_login", target.Login)
+		return domain.NotifyResult{}, false
+	}
+	return result, true
+}
+
+// notifyTopic создает уведомление подписчикам темы, читая их частями по topicChunk.
+// seen — уже уведомленные получатели запроса; при ошибке возвращаются результаты уже обработанных частей
+func (s *NotificationService) notifyTopic(
+	ctx context.Context,
+	req *domain.NotifyRequest,
+	topic string,
+	seen map[string]struct{},
+) ([]domain.NotifyResult, error) {
+	var results []domain.NotifyResult
+	var cursor uint64
+	for {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		userKeys, next, err := s.repo.ScanTopicSubscribers(ctx, topic, cursor, s.topicChunk)
+		if err != nil {
+			return results, err
+		}
+		for _, userKey := range userKeys {
+			if _, dup := seen[userKey]; dup {
+				continue
+			}
+			seen[userKey] = struct{}{}
+			userID, login, err := domain.ParseUserKey(userKey)
+			if err != nil {
+				s.logger.WarnContext(ctx, "Ошибка парсинга подписчика темы", "topic", topic, "user_key", userKey, "error", err)
+				continue
+			}
+			metrics.TopicRecipients.Inc()
+			if result, ok := s.notifyTarget(ctx, req, domain.Target{ID: userID, Login: login}); ok {
+				results = append(results, result)
+			}
+		}
+		if next == 0 {
+			return results, nil
+		}
+		cursor = next
+	}
+}
+
+// createForTarget записывает уведомление в стрим получателя с учетом лимита и планирует
+// эскалацию и доставку внешними каналами. Отказ лимита возвращается результатом с кодом inbox_full
+func (s *NotificationService) createForTarget(
+	ctx context.Context,
+	payload *domain.NotificationPayload,
+	escalation []domain.EscalationStep,
+	prefs *domain.Preferences,
+) (domain.NotifyResult, error) {
+	target := payload.Target
+
+	// Создаем уведомление в репозитории с учетом лимита стрима получателя
+	limit := s.streamLimit(payload)
+	created, err := s.repo.CreateNotification(ctx, payload, target, limit)
+	if errors.Is(err, domain.ErrInboxFull) {
+		metrics.InboxRejected.Inc()
+		s.logger.WarnContext(ctx, "Стрим получателя заполнен, уведомление отклонено",
+			"policy", limit.Overflow,
+			"max_len", limit.MaxLen,
+			"target_id", target.ID,
+			"target_login", target.Login)
+		s.publishOverflow(ctx, target, domain.InboxOverflowData{
+			Policy:   limit.Overflow,
+			MaxLen:   limit.MaxLen,
+			Rejected: true,
+			Source:   payload.Source,
+		})
+		return domain.NotifyResult{Target: target, Error: domain.ErrorCodeInboxFull}, nil
+	}
+	if err != nil {
+		return domain.NotifyResult{}, err
+	}
+	streamID := created.StreamID
+
+	// Вытеснение прочитанных записей — штатная работа лимита, сообщаем только о потере непрочитанных
+	if droppedUnread := created.DroppedUnread(); droppedUnread > 0 {
+		metrics.InboxDroppedUnread.Add(float64(droppedUnread))
+		s.logger.WarnContext(ctx, "Переполнение стрима: вытеснены непрочитанные уведомления",
+			"dropped_unread", droppedUnread,
+			"policy", limit.Overflow,
+			"max_len", limit.MaxLen,
+			"target_id", target.ID,
+			"target_login", target.Login)
+		s.publishOverflow(ctx, target, domain.InboxOverflowData{
+			Policy:        limit.Overflow,
+			MaxLen:        limit.MaxLen,
+			Source:        payload.Source,
+			DroppedUnread: droppedUnread,
+			Dropped:       created.Dropped,
+		})
+	}
+
+	for _, d := range created.Dropped {
+		s.recordArchive(domain.ArchiveEvent{
+			Type:           domain.ArchiveEventDropped,
+			NotificationID: d.NotificationID,
+			StreamID:       d.StreamID,
+			Target:         target,
+		})
+	}
+	s.recordArchive(domain.ArchiveEvent{
+		Type:           domain.ArchiveEventCreated,
+		NotificationID: payload.NotificationID,
+		StreamID:       streamID,
+		Target:         target,
+		Payload:        payload,
+	})
+
+	if payload.Source != domain.DigestSource {
+		s.addDigestCandidate(ctx, payload, streamID)
+	}
+	if len(escalation) > 0 {
+		s.scheduleEscalation(ctx, payload, streamID, escalation)
+	}
+	if s.channelWindow > 0 {
+		s.scheduleChannelDelivery(ctx, payload, streamID, prefs)
+	}
+
+	s.logger.DebugContext(ctx, "Создано уведомление",
+		"notification_id", payload.NotificationID,
+		"stream_id", streamID,
+		"target_id", target.ID,
+		"target_login", target.Login)
+
+	return domain.NotifyResult{Target: target, NotificationID: payload.NotificationID}, nil
+}
+
+// addDigestCandidate запоминает уведомление для сводки получателя. Ошибка не отменяет
+// созданное уведомление: оно только не попадет в сводку
+func (s *NotificationService) addDigestCandidate(ctx context.Context, payload *domain.NotificationPayload, streamID string) {
+	target := payload.Target
+	err := s.repo.AddDigestCandidate(ctx, target.ID, target.Login, domain.DigestCandidate{
+		StreamID:       streamID,
+		NotificationID: payload.NotificationID,
+		Source:         payload.Source,
+		Category:       payload.Category,
+	})
+	if err != nil {
+		s.logger.WarnContext(ctx, "Ошибка сохранения кандидата в сводку",
+			"error", err,
+			"notification_id", payload.NotificationID,
+			"target_id", target.ID,
+			"target_login", target.Login)
+	}
+}
+
+// preferences возвращает настройки получателя. Ошибка чтения не должна терять уведомление,
+// поэтому оно создается как без настроек
+func (s *NotificationService) preferences(ctx context.Context, target domain.Target) *domain.Preferences {
+	prefs, err := s.repo.GetPreferences(ctx, target.ID, target.Login)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Ошибка чтения настроек уведомлений получателя",
+			"error", err, "target_id", target.ID, "target_login", target.Login)
+		return nil
+	}
+	return prefs
+}
+
+// applyPreferences применяет настройки получателя: заглушенный источник не создает уведомления,
+// в тихие часы и в режиме «не беспокоить» уведомление откладывается. handled == false — создать сразу
+func (s *NotificationService) applyPreferences(
+	ctx context.Context,
+	payload *domain.NotificationPayload,
+	prefs *domain.Preferences,
+	escalation []domain.EscalationStep,
+) (domain.NotifyResult, bool) {
+	if prefs == nil {
+		return domain.NotifyResult{}, false
+	}
+	target := payload.Target
+	if prefs.Muted(payload.Source) {
+		metrics.NotificationsMuted.Inc()
+		s.logger.DebugContext(ctx, "Источник заглушен получателем",
+			"source", payload.Source, "target_id", target.ID, "target_login", target.Login)
+		return domain.NotifyResult{Target: target, Status: domain.NotifyStatusMuted}, true
+	}
+
+	now := time.Now()
+	until := prefs.DeferUntil(now)
+	if until.IsZero() {
+		return domain.NotifyResult{}, false
+	}
+
+	// ID назначается сразу, чтобы вернуть его отправителю; стрим получит запись с ним же
+	payload.NotificationID = uuid.New().String()
+	d := domain.DeferredNotification{
+		Payload:    *payload,
+		Escalation: escalation,
+		DeferredAt: now,
+		ReleaseAt:  until,
+	}
+	if err := s.repo.DeferNotification(ctx, d); err != nil {
+		s.logger.ErrorContext(ctx, "Ошибка откладывания уведомления, доставляем сразу",
+			"error", err, "target_id", target.ID, "target_login", target.Login)
+		return domain.NotifyResult{}, false
+	}
+	metrics.NotificationsDeferred.Inc()
+	s.logger.DebugContext(ctx, "Уведомление отложено",
+		"notification_id", payload.NotificationID,
+		"release_at", until,
+		"target_id", target.ID,
+		"target_login", target.Login)
+	return domain.NotifyResult{
+		Target:         target,
+		NotificationID: payload.NotificationID,
+		Status:         domain.NotifyStatusDeferred,
+		DeferredUntil:  &until,
+	}, true
+}
+
+// ReleaseDeferred создает отложенное уведомление, если получатель снова принимает уведомления.
+// Продленные тихие часы или «не беспокоить» переносят выпуск, заглушенный за это время источник — удаляет уведомление
+func (s *NotificationService) ReleaseDeferred(ctx context.Context, d domain.DeferredNotification) error {
+	payload := d.Payload
+	target := payload.Target
+
+	prefs := s.preferences(ctx, target)
+	if prefs != nil {
+		if prefs.Muted(payload.Source) {
+			metrics.NotificationsMuted.Inc()
+			return s.repo.RemoveDeferred(ctx, target.ID, target.Login, payload.NotificationID)
+		}
+		if until := prefs.DeferUntil(time.Now()); !until.IsZero() {
+			d.ReleaseAt = until
+			return s.repo.DeferNotification(ctx, d)
+		}
+	}
+
+	// Уведомление могло быть создано в прошлой итерации, которая не успела удалить его из отложенных
+	existing, err := s.repo.GetNotification(ctx, target.ID, target.Login, payload.NotificationID)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		result, err := s.createForTarget(ctx, &payload, d.Escalation, prefs)
+		if err != nil {
+			return fmt.Errorf("ошибка создания отложенного уведомления: %w", err)
+		}
+		if result.Error != "" {
+			s.logger.WarnContext(ctx, "Отложенное уведомление отклонено",
+				"error", result.Error,
+				"notification_id", payload.NotificationID,
+				"target_id", target.ID,
+				"target_login", target.Login)
+		}
+	}
+
+	metrics.DeferredReleased.Inc()
+	return s.repo.RemoveDeferred(ctx, target.ID, target.Login, payload.NotificationID)
+}
+
+// scheduleEscalation планирует эскалацию созданного уведомления. Ошибка не отменяет само уведомление
+func (s *NotificationService) scheduleEscalation(
+	ctx context.Context,
+	payload *domain.NotificationPayload,
+	streamID string,
+	steps []domain.EscalationStep,
+) {
+	esc := domain.Escalation{
+		NotificationID: payload.NotificationID,
+		StreamID:       streamID,
+		Target:         payload.Target,
+		Message:        payload.Message,
+		Source:         payload.Source,
+		Category:       payload.Category,
+		CreatedAt:      payload.CreatedAt,
+		ScheduledAt:    time.Now(),
+		Steps:          steps,
+	}
+	if err := s.repo.ScheduleEscalation(ctx, esc); err != nil {
+		s.logger.ErrorContext(ctx, "Ошибка планирования эскалации",
+			"error", err,
+			"notification_id", payload.NotificationID,
+			"target_id", payload.Target.ID,
+			"target_login", payload.Target.Login)
+	}
+}
+
+// scheduleChannelDelivery планирует доставку уведомления внешними каналами. Ошибка не отменяет само уведомление
+func (s *NotificationService) scheduleChannelDelivery(
+	ctx context.Context,
+	payload *domain.NotificationPayload,
+	streamID string,
+	prefs *domain.Preferences,
+) {
+	var channels []string
+	if prefs != nil {
+		var restricted bool
+		channels, restricted = prefs.ChannelsFor(payload.Category)
+		if restricted && len(channels) == 0 {
+			return // получатель отключил внешние каналы для категории
+		}
+	}
+
+	now := time.Now()
+	due := now
+	online, err := s.repo.HasConsumerLock(ctx, payload.Target.ID, payload.Target.Login)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Ошибка проверки сессии получателя", "error", err)
+	}
+	if online {
+		due = now.Add(s.channelWindow)
+	}
+
+	d := domain.ChannelDelivery{
+		NotificationID: payload.NotificationID,
+		StreamID:       streamID,
+		Target:         payload.Target,
+		Message:        payload.Message,
+		Source:         payload.Source,
+		Category:       payload.Category,
+		Priority:       payload.Priority,
+		CreatedAt:      payload.CreatedAt,
+		DueAt:          due,
+		Channels:       channels,
+	}
+	if err := s.repo.ScheduleChannelDelivery(ctx, d); err != nil {
+		s.logger.ErrorContext(ctx, "Ошибка планирования доставки каналами",
+			"error", err,
+			"notification_id", payload.NotificationID,
+			"target_id", payload.Target.ID,
+			"target_login", payload.Target.Login)
+	}
+}
+
+// streamLimit возвращает лимит стрима получателя
+func (s *NotificationService) streamLimit(payload *domain.NotificationPayload) domain.StreamLimit {
+	if s.limits == nil {
+		return domain.DefaultStreamLimit
+	}
+	return s.limits.Resolve(payload.Tenant, payload.Source, payload.Target)
+}
+
+// publishOverflow отправляет пользователю событие inbox.overflow
+func (s *NotificationService) publishOverflow(ctx context.Context, target domain.Target, data domain.InboxOverflowData) {
+	if s.events == nil {
+		return
+	}
+	msg := domain.WebSocketMessage{Type: domain.MessageTypeInboxOverflow, Data: data}
+	if err := s.events.PublishToUser(ctx, target.ID, target.Login, msg); err != nil {
+		s.logger.WarnContext(ctx, "Ошибка отправки события inbox.overflow",
+			"error", err, "target_id", target.ID, "target_login", target.Login)
+	}
+}
+
 // HandleWebSocketConnection обрабатывает WebSocket подключение клиента
 func (s *NotificationService) HandleWebSocketConnection(
 	ctx context.Context,
@@ -115,7 +549,7 @@ func (s *NotificationService) HandleWebSocketConnection(
 	login string,
 	conn domain.WebSocketConnection,
 ) error {
-	s.logger.Info("Новое WebSocket подключение", "user_id", userID, "login", login)
+	s.logger.InfoContext(ctx, "Новое WebSocket подключение", "user_id", userID, "login", login)
 
 	// Убеждаемся что Consumer Group существует
 	if err := s.repo.EnsureConsumerGroup(ctx, userID, login); err != nil {
@@ -132,32 +566,37 @@ func (s *NotificationService) HandleWebSocketConnection(
 	// Захватываем consumer-lock (если задан podID)
 	const lockTTL = 60 * time.Second
 	if s.podID != "" {
-		ok, err := s.repo.AcquireConsumerLock(wsCtx, userID, login, s.podID, lockTTL)
-		if err != nil {
-			s.logger.Warn("Ошибка захвата consumer-lock", "error", err, "user_id", userID, "login", login)
-		} else if !ok {
-			s.logger.Info("Consumer-lock уже занят другим pod — продолжаем только локальную доставку", "user_id", userID, "login", login)
-		} else {
-			s.logger.Debug("Захвачен consumer-lock", "user_id", userID, "login", login, "pod", s.podID)
-			// Продление lock в фоне
-			go func() {
-				ticker := time.NewTicker(20 * time.Second)
-				defer ticker.Stop()
-				for {
-					select {
-					case <-wsCtx.Done():
-						return
-					case <-ticker.C:
-						if ok, _ := s.repo.RenewConsumerLock(wsCtx, userID, login, s.podID, lockTTL); !ok {
-							// Потеряли lock
-							s.logger.Info("Потерян consumer-lock при продлении", "user_id", userID, "login", login)
-							return
-						}
+		var held atomic.Bool
+		held.Store(s.acquireConsumerLock(ctx, userID, login, lockTTL))
+		if !held.Load() {
+			s.logger.InfoContext(ctx, "Consumer-lock уже занят другим pod — продолжаем только локальную доставку", "user_id", userID, "login", login)
+		}
+		// Продление lock в фоне. Если lock занят или потерян, пробуем захватить его снова:
+		// после выбытия pod-владельца соседи снимают его lock, и сессия становится владельцем
+		go func() {
+			ticker := time.NewTicker(20 * time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-wsCtx.Done():
+					return
+				case <-ticker.C:
+					if !held.Load() {
+						held.Store(s.acquireConsumerLock(wsCtx, userID, login, lockTTL))
+						continue
+					}
+					if ok, _ := s.repo.RenewConsumerLock(wsCtx, userID, login, s.podID, lockTTL); !ok {
+						held.Store(false)
+						s.logger.InfoContext(ctx, "Потерян consumer-lock при продлении", "user_id", userID, "login", login)
 					}
 				}
-			}()
-			defer func() { _ = s.repo.ReleaseConsumerLock(context.Background(), userID, login, s.podID) }()
-		}
+			}
+		}()
+		defer func() {
+			if held.Load() {
+				_ = s.repo.ReleaseConsumerLock(context.Background(), userID, login, s.podID)
+			}
+		}()
 	}
 
 	// Горутина для чтения сообщений от клиента (обработка ACK)
@@ -170,15 +609,28 @@ func (s *NotificationService) HandleWebSocketConnection(
 	select {
 	case err := <-errChan:
 		if err != nil {
-			s.logger.Error("Ошибка WebSocket соединения", "error", err, "user_id", userID, "login", login)
+			s.logger.ErrorContext(ctx, "Ошибка WebSocket соединения", "error", err, "user_id", userID, "login", login)
 		}
 		return err
 	case <-ctx.Done():
-		s.logger.Info("WebSocket соединение завершено", "user_id", userID, "login", login)
+		s.logger.InfoContext(ctx, "WebSocket соединение завершено", "user_id", userID, "login", login)
 		return ctx.Err()
 	}
 }
 
+// acquireConsumerLock пытается захватить consumer-lock пользователя для этого pod
+func (s *NotificationService) acquireConsumerLock(ctx context.Context, userID int64, login string, ttl time.Duration) bool {
+	ok, err := s.repo.AcquireConsumerLock(ctx, userID, login, s.podID, ttl)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Ошибка захвата consumer-lock", "error", err, "user_id", userID, "login", login)
+		return false
+	}
+	if ok {
+		s.logger.DebugContext(ctx, "Захвачен consumer-lock", "user_id", userID, "login", login, "pod", s.podID)
+	}
+	return ok
+}
+
 // handleClientMessages обрабатывает сообщения от клиента (ACK)
 func (s *NotificationService) handleClientMessages(
 	ctx context.Context,
@@ -211,7 +663,7 @@ func (s *NotificationService) handleClientMessages(
 					}
 				}
 				if err := s.handleReadAck(ctx, userID, login, &read, conn); err != nil {
-					s.logger.Error("Ошибка обработки ACK", "error", err)
+					s.logger.ErrorContext(ctx, "Ошибка обработки ACK", "error", err)
 				}
 			case domain.MessageTypeRetentionSet:
 				var ev domain.RetentionSetEvent
@@ -223,9 +675,71 @@ func (s *NotificationService) handleClientMessages(
 				}
 				if ev.Data.Days >= 1 && ev.Data.Days <= 15 {
 					if err := s.repo.SetUserRetentionDays(ctx, userID, login, ev.Data.Days); err != nil {
-						s.logger.Warn("Ошибка установки retention", "error", err)
+						s.logger.WarnContext(ctx, "Ошибка установки retention", "error", err)
 					}
 				}
+			case domain.MessageTypeDigestSet:
+				var ev domain.DigestSetEvent
+				ev.Type = raw.Type
+				if m, ok := raw.Data.(map[string]interface{}); ok {
+					if v, ok := m["mode"].(string); ok {
+						ev.Data.Mode = domain.DigestMode(v)
+					}
+					if v, ok := m["at"].(string); ok {
+						ev.Data.At = v
+					}
+					if v, ok := m["timezone"].(string); ok {
+						ev.Data.Timezone = v
+					}
+					if v, ok := m["mark_digested"].(bool); ok {
+						ev.Data.MarkDigested = v
+					}
+				}
+				if _, err := s.SetDigestPreference(ctx, userID, login, ev.Data); err != nil {
+					s.logger.WarnContext(ctx, "Ошибка установки настроек сводки", "error", err)
+				}
+			case domain.MessageTypeWebhookSet:
+				var ev domain.WebhookSetEvent
+				ev.Type = raw.Type
+				if m, ok := raw.Data.(map[string]interface{}); ok {
+					if v, ok := m["url"].(string); ok {
+						ev.Data.URL = v
+					}
+					if v, ok := m["secret"].(string); ok {
+						ev.Data.Secret = v
+					}
+				}
+				if err := s.handleWebhookSet(ctx, userID, login, &ev, conn); err != nil {
+					s.logger.WarnContext(ctx, "Ошибка регистрации webhook", "error", err)
+				}
+			case domain.MessageTypeSettingsGet:
+				if err := s.sendSettings(ctx, userID, login, conn); err != nil {
+					s.logger.WarnContext(ctx, "Ошибка отправки настроек уведомлений", "error", err)
+				}
+			case domain.MessageTypeSettingsSet:
+				var ev domain.SettingsSetEvent
+				ev.Type = raw.Type
+				// Настройки вложенные, поэтому разбираем данные повторным декодированием, а не обходом map
+				if data, err := json.Marshal(raw.Data); err == nil {
+					if err := json.Unmarshal(data, &ev.Data); err != nil {
+						s.logger.WarnContext(ctx, "Неверный формат settings.set", "error", err)
+						break
+					}
+				}
+				if err := s.handleSettingsSet(ctx, userID, login, &ev, conn); err != nil {
+					s.logger.WarnContext(ctx, "Ошибка установки настроек уведомлений", "error", err)
+				}
+			case domain.MessageTypeTopicSubscribe, domain.MessageTypeTopicUnsubscribe:
+				var ev domain.TopicEvent
+				ev.Type = raw.Type
+				if m, ok := raw.Data.(map[string]interface{}); ok {
+					if v, ok := m["topic"].(string); ok {
+						ev.Data.Topic = v
+					}
+				}
+				if err := s.handleTopicEvent(ctx, userID, login, &ev, conn); err != nil {
+					s.logger.WarnContext(ctx, "Ошибка изменения подписки на тему", "error", err)
+				}
 			case domain.MessageTypeSyncRequest:
 				var ev domain.SyncRequestEvent
 				ev.Type = raw.Type
@@ -238,7 +752,7 @@ func (s *NotificationService) handleClientMessages(
 					ev.Data.Limit = 100
 				}
 				if err := s.deliverLastMessagesWithRead(ctx, userID, login, conn, int64(ev.Data.Limit)); err != nil {
-					s.logger.Warn("Ошибка sync.request", "error", err)
+					s.logger.WarnContext(ctx, "Ошибка sync.request", "error", err)
 				}
 			default:
 				// игнорируем неизвестные
@@ -263,10 +777,12 @@ func (s *NotificationService) handleNotificationDelivery(
 
 	// Затем отправляем последние 100 сообщений из истории с признаком прочтения
 	if err := s.deliverLastMessagesWithRead(ctx, userID, login, conn, 100); err != nil {
-		s.logger.Warn("Ошибка начальной синхронизации XRANGE", "error", err)
+		s.logger.WarnContext(ctx, "Ошибка начальной синхронизации XRANGE", "error", err)
 	}
 
 	// Затем слушаем новые уведомления в цикле
+	backoff := readRetryMinBackoff
+	unavailable := false
 	for {
 		select {
 		case <-ctx.Done():
@@ -275,13 +791,38 @@ func (s *NotificationService) handleNotificationDelivery(
 			// Читаем новые сообщения с блокировкой 30 секунд (как в ТЗ)
 			messages, err := s.repo.ReadNewMessages(ctx, userID, login, 30*time.Second, 100)
 			if err != nil {
-				errChan <- fmt.Errorf("ошибка чтения новых сообщений: %w", err)
-				return
+				if !errors.Is(err, domain.ErrStorageUnavailable) {
+					errChan <- fmt.Errorf("ошибка чтения новых сообщений: %w", err)
+					return
+				}
+				// Failover или разрыв соединения: сессию не закрываем, повторяем чтение с паузой
+				metrics.StorageReadRetries.Inc()
+				s.logger.WarnContext(ctx, "Хранилище недоступно, повторяем чтение",
+					"error", err, "retry_in", backoff, "user_id", userID, "login", login)
+				unavailable = true
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				backoff = min(backoff*2, readRetryMaxBackoff)
+				continue
+			}
+
+			if unavailable {
+				unavailable = false
+				backoff = readRetryMinBackoff
+				s.logger.InfoContext(ctx, "Чтение новых сообщений восстановлено", "user_id", userID, "login", login)
+				// Ответ XREADGROUP мог потеряться при разрыве: такие сообщения остались в PEL,
+				// поэтому повторно доставляем pending (клиент различает повторы по notification_id)
+				if err := s.deliverPendingMessages(ctx, userID, login, conn); err != nil {
+					s.logger.WarnContext(ctx, "Ошибка повторной доставки pending сообщений", "error", err)
+				}
 			}
 
 			// Отправляем полученные сообщения
 			for _, msg := range messages {
-				if err := s.sendMessageToClient(conn, &msg); err != nil {
+				if err := s.sendMessageToClient(ctx, conn, &msg); err != nil {
 					errChan <- fmt.Errorf("ошибка отправки сообщения клиенту: %w", err)
 					return
 				}
@@ -302,10 +843,10 @@ func (s *NotificationService) deliverPendingMessages(
 		return fmt.Errorf("ошибка чтения pending сообщений: %w", err)
 	}
 
-	s.logger.Debug("Доставляем pending сообщения", "count", len(messages), "user_id", userID, "login", login)
+	s.logger.DebugContext(ctx, "Доставляем pending сообщения", "count", len(messages), "user_id", userID, "login", login)
 
 	for _, msg := range messages {
-		if err := s.sendMessageToClient(conn, &msg); err != nil {
+		if err := s.sendMessageToClient(ctx, conn, &msg); err != nil {
 			return fmt.Errorf("ошибка отправки pending сообщения: %w", err)
 		}
 	}
@@ -365,6 +906,8 @@ func (s *NotificationService) sendMessageToClientWithRead(
 			Message:        msg.Payload.Message,
 			CreatedAt:      msg.Payload.CreatedAt,
 			Source:         msg.Payload.Source,
+			Category:       msg.Payload.Category,
+			Priority:       msg.Payload.Priority,
 			Status:         domain.StatusUnread,
 			Read:           read,
 		}
@@ -392,7 +935,7 @@ func (s *NotificationService) sendMessageToClientWithRead(
 }
 
 // sendMessageToClient отправляет сообщение клиенту через WebSocket
-func (s *NotificationService) sendMessageToClient(conn domain.WebSocketConnection, msg *domain.StreamMessage) error {
+func (s *NotificationService) sendMessageToClient(ctx context.Context, conn domain.WebSocketConnection, msg *domain.StreamMessage) error {
 	var pushPayload domain.PushPayload
 	var status string
 
@@ -404,6 +947,8 @@ func (s *NotificationService) sendMessageToClient(conn domain.WebSocketConnectio
 			Message:        msg.Payload.Message,
 			CreatedAt:      msg.Payload.CreatedAt,
 			Source:         msg.Payload.Source,
+			Category:       msg.Payload.Category,
+			Priority:       msg.Payload.Priority,
 			Status:         domain.StatusUnread,
 			Read:           false,
 		}
@@ -442,7 +987,7 @@ func (s *NotificationService) sendMessageToClient(conn domain.WebSocketConnectio
 		return fmt.Errorf("ошибка отправки сообщения в WebSocket: %w", err)
 	}
 
-	s.logger.Debug("Отправлено уведомление клиенту",
+	s.logger.DebugContext(ctx, "Отправлено уведомление клиенту",
 		"notification_id", pushPayload.NotificationID,
 		"stream_id", pushPayload.StreamID,
 		"status", status)
@@ -462,27 +1007,35 @@ func (s *NotificationService) handleReadAck(
 		return fmt.Errorf("неожиданный тип сообщения: %s", readEvent.Type)
 	}
 
-	// Подтверждаем и удаляем сообщение
-	err := s.repo.AckMessage(ctx, userID, login, readEvent.Data.StreamID, readEvent.Data.NotificationID)
+	result, err := s.AckNotification(ctx, userID, login, readEvent.Data.StreamID, readEvent.Data.NotificationID)
 	if err != nil {
-		return fmt.Errorf("ошибка подтверждения сообщения: %w", err)
+		return err
+	}
+	if result == domain.AckResultUnknown || result == domain.AckResultMismatched {
+		s.logger.WarnContext(ctx, "Отклонен ACK от клиента",
+			"result", result,
+			"notification_id", readEvent.Data.NotificationID,
+			"stream_id", readEvent.Data.StreamID,
+			"user_id", userID,
+			"login", login)
+		return s.sendAckError(conn, result, readEvent)
 	}
 
-	// Отправляем ACK клиенту
+	// Отправляем ACK клиенту (повторный ACK прочитанного уведомления тоже подтверждаем)
 	ackMessage := domain.WebSocketMessage{
 		Type: domain.MessageTypeNotificationAck,
 		Data: map[string]string{
 			"notification_id": readEvent.Data.NotificationID,
 			"stream_id":       readEvent.Data.StreamID,
+			"result":          string(result),
 		},
 	}
 
 	if err := conn.WriteJSON(ackMessage); err != nil {
 		return fmt.Errorf("ошибка отправки ACK: %w", err)
 	}
-	metrics.NotificationsAcked.Inc()
 
-	s.logger.Debug("Обработан ACK от клиента",
+	s.logger.DebugContext(ctx, "Обработан ACK от клиента",
 		"notification_id", readEvent.Data.NotificationID,
 		"stream_id", readEvent.Data.StreamID,
 		"user_id", userID,
@@ -491,16 +1044,305 @@ func (s *NotificationService) handleReadAck(
 	return nil
 }
 
+// AckNotification записывает прочтение уведомления через AckMessage (репозиторий проверяет, что stream_id
+// и notification_id согласованы), отмечает его в архиве и метриках. Используется WebSocket-сессиями
+// и внешними каналами, подтверждающими доставку
+func (s *NotificationService) AckNotification(
+	ctx context.Context,
+	userID int64,
+	login string,
+	streamID, notificationID string,
+) (domain.AckResult, error) {
+	result, err := s.repo.AckMessage(ctx, userID, login, streamID, notificationID)
+	if err != nil {
+		return "", fmt.Errorf("ошибка подтверждения сообщения: %w", err)
+	}
+
+	switch result {
+	case domain.AckResultUnknown, domain.AckResultMismatched:
+		metrics.AcksRejected.Inc()
+	case domain.AckResultAcked:
+		s.recordArchive(domain.ArchiveEvent{
+			Type:           domain.ArchiveEventRead,
+			NotificationID: notificationID,
+			StreamID:       streamID,
+			Target:         domain.Target{ID: userID, Login: login},
+		})
+		metrics.NotificationsAcked.Inc()
+	default:
+		metrics.NotificationsAcked.Inc()
+	}
+	return result, nil
+}
+
+// sendAckError сообщает клиенту, что ACK отклонен
+func (s *NotificationService) sendAckError(
+	conn domain.WebSocketConnection,
+	result domain.AckResult,
+	readEvent *domain.ReadEvent,
+) error {
+	data := domain.ErrorData{
+		Code:           domain.ErrorCodeAckUnknown,
+		Message:        "запись стрима не найдена",
+		NotificationID: readEvent.Data.NotificationID,
+		StreamID:       readEvent.Data.StreamID,
+	}
+	if result == domain.AckResultMismatched {
+		data.Code = domain.ErrorCodeAckMismatched
+		data.Message = "запись стрима относится к другому уведомлению"
+	}
+
+	if err := conn.WriteJSON(domain.WebSocketMessage{Type: domain.MessageTypeError, Data: data}); err != nil {
+		return fmt.Errorf("ошибка отправки ошибки ACK: %w", err)
+	}
+	return nil
+}
+
+// SetDigestPreference проверяет и сохраняет настройки сводки. Время предыдущей сводки берется
+// из сохраненных настроек, чтобы смена режима не включала в следующую сводку уже учтенные уведомления
+func (s *NotificationService) SetDigestPreference(
+	ctx context.Context,
+	userID int64,
+	login string,
+	pref domain.DigestPreference,
+) (*domain.DigestPreference, error) {
+	if pref.Mode == "" {
+		pref.Mode = domain.DigestOff
+	}
+	if err := pref.Validate(); err != nil {
+		return nil, err
+	}
+
+	current, err := s.repo.GetDigestPreference(ctx, userID, login)
+	if err != nil {
+		return nil, err
+	}
+	pref.LastDigestAt = nil
+	if current != nil {
+		pref.LastDigestAt = current.LastDigestAt
+	}
+
+	if err := s.repo.SetDigestPreference(ctx, userID, login, pref); err != nil {
+		return nil, err
+	}
+	s.logger.InfoContext(ctx, "Настройки сводки обновлены",
+		"user_id", userID, "login", login, "mode", pref.Mode)
+	return &pref, nil
+}
+
+// handleWebhookSet регистрирует webhook из сессии и отвечает webhook.set.ack с URL и секретом подписи
+func (s *NotificationService) handleWebhookSet(
+	ctx context.Context,
+	userID int64,
+	login string,
+	ev *domain.WebhookSetEvent,
+	conn domain.WebSocketConnection,
+) error {
+	hook, err := s.RegisterWebhook(ctx, userID, login, ev.Data.URL, ev.Data.Secret)
+	if err != nil {
+		msg := domain.WebSocketMessage{
+			Type: domain.MessageTypeError,
+			Data: domain.ErrorData{Code: domain.ErrorCodeInvalidWebhook, Message: err.Error()},
+		}
+		if werr := conn.WriteJSON(msg); werr != nil {
+			return fmt.Errorf("ошибка отправки ошибки webhook: %w", werr)
+		}
+		return err
+	}
+
+	data := domain.WebhookSetData{}
+	if hook != nil {
+		data = domain.WebhookSetData{URL: hook.URL, Secret: hook.Secret}
+	}
+	if err := conn.WriteJSON(domain.WebSocketMessage{Type: domain.MessageTypeWebhookSetAck, Data: data}); err != nil {
+		return fmt.Errorf("ошибка отправки подтверждения webhook: %w", err)
+	}
+	return nil
+}
+
+// RegisterWebhook проверяет URL и сохраняет webhook пользователя. Если секрет не задан,
+// генерируется случайный; пустой URL удаляет регистрацию
+func (s *NotificationService) RegisterWebhook(
+	ctx context.Context,
+	userID int64,
+	login string,
+	url, secret string,
+) (*domain.Webhook, error) {
+	if url == "" {
+		if err := s.repo.DeleteWebhook(ctx, userID, login); err != nil {
+			return nil, err
+		}
+		s.logger.InfoContext(ctx, "Webhook удален", "user_id", userID, "login", login)
+		return nil, nil
+	}
+	if err := domain.ValidateWebhookURL(url); err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("ошибка генерации секрета webhook: %w", err)
+		}
+		secret = hex.EncodeToString(buf)
+	}
+
+	hook := domain.Webhook{URL: url, Secret: secret, CreatedAt: time.Now().UTC()}
+	if err := s.repo.SetWebhook(ctx, userID, login, hook); err != nil {
+		return nil, err
+	}
+	s.logger.InfoContext(ctx, "Webhook зарегистрирован", "user_id", userID, "login", login, "url", url)
+	return &hook, nil
+}
+
+// sendSettings отправляет клиенту текущие настройки уведомлений
+func (s *NotificationService) sendSettings(
+	ctx context.Context,
+	userID int64,
+	login string,
+	conn domain.WebSocketConnection,
+) error {
+	prefs, err := s.repo.GetPreferences(ctx, userID, login)
+	if err != nil {
+		return err
+	}
+	if prefs == nil {
+		prefs = &domain.Preferences{}
+	}
+	if err := conn.WriteJSON(domain.WebSocketMessage{Type: domain.MessageTypeSettings, Data: prefs}); err != nil {
+		return fmt.Errorf("ошибка отправки настроек: %w", err)
+	}
+	return nil
+}
+
+// handleSettingsSet сохраняет настройки из сессии и отвечает сообщением settings с сохраненным значением
+func (s *NotificationService) handleSettingsSet(
+	ctx context.Context,
+	userID int64,
+	login string,
+	ev *domain.SettingsSetEvent,
+	conn domain.WebSocketConnection,
+) error {
+	saved, err := s.SetPreferences(ctx, userID, login, ev.Data)
+	if err != nil {
+		msg := domain.WebSocketMessage{
+			Type: domain.MessageTypeError,
+			Data: domain.ErrorData{Code: domain.ErrorCodeInvalidSettings, Message: err.Error()},
+		}
+		if werr := conn.WriteJSON(msg); werr != nil {
+			return fmt.Errorf("ошибка отправки ошибки настроек: %w", werr)
+		}
+		return err
+	}
+	if err := conn.WriteJSON(domain.WebSocketMessage{Type: domain.MessageTypeSettings, Data: saved}); err != nil {
+		return fmt.Errorf("ошибка отправки настроек: %w", err)
+	}
+	return nil
+}
+
+// SetPreferences проверяет и сохраняет настройки уведомлений. Уже отложенные уведомления
+// выпускаются в назначенное время и при выпуске проверяются по новым настройкам
+func (s *NotificationService) SetPreferences(
+	ctx context.Context,
+	userID int64,
+	login string,
+	prefs domain.Preferences,
+) (*domain.Preferences, error) {
+	if err := prefs.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetPreferences(ctx, userID, login, prefs); err != nil {
+		return nil, err
+	}
+	s.logger.InfoContext(ctx, "Настройки уведомлений обновлены",
+		"user_id", userID, "login", login,
+		"muted_sources", len(prefs.MutedSources),
+		"quiet_hours", prefs.QuietHours != nil,
+		"dnd_until", prefs.DNDUntil)
+	return &prefs, nil
+}
+
+// handleTopicEvent подписывает или отписывает пользователя и отвечает сообщением topics со всеми его темами
+func (s *NotificationService) handleTopicEvent(
+	ctx context.Context,
+	userID int64,
+	login string,
+	ev *domain.TopicEvent,
+	conn domain.WebSocketConnection,
+) error {
+	var topics []string
+	var err error
+	if ev.Type == domain.MessageTypeTopicSubscribe {
+		topics, err = s.SubscribeTopic(ctx, userID, login, ev.Data.Topic)
+	} else {
+		topics, err = s.UnsubscribeTopic(ctx, userID, login, ev.Data.Topic)
+	}
+	if err != nil {
+		msg := domain.WebSocketMessage{
+			Type: domain.MessageTypeError,
+			Data: domain.ErrorData{Code: domain.ErrorCodeInvalidTopic, Message: err.Error()},
+		}
+		if werr := conn.WriteJSON(msg); werr != nil {
+			return fmt.Errorf("ошибка отправки ошибки подписки: %w", werr)
+		}
+		return err
+	}
+	msg := domain.WebSocketMessage{Type: domain.MessageTypeTopics, Data: domain.TopicsData{Topics: topics}}
+	if err := conn.WriteJSON(msg); err != nil {
+		return fmt.Errorf("ошибка отправки списка тем: %w", err)
+	}
+	return nil
+}
+
+// SubscribeTopic подписывает пользователя на тему; число тем пользователя ограничено MaxTopicsPerUser
+func (s *NotificationService) SubscribeTopic(ctx context.Context, userID int64, login string, topic string) ([]string, error) {
+	if err := domain.ValidateTopic(topic); err != nil {
+		return nil, err
+	}
+	// Лимит проверяется в репозитории вместе с записью: параллельные подписки не превысят его
+	added, err := s.repo.Subscribe(ctx, userID, login, topic, domain.MaxTopicsPerUser)
+	if err != nil {
+		return nil, err
+	}
+	if added {
+		s.logger.InfoContext(ctx, "Подписка на тему", "user_id", userID, "login", login, "topic", topic)
+	}
+	return s.repo.GetSubscriptions(ctx, userID, login)
+}
+
+// UnsubscribeTopic отписывает пользователя от темы
+func (s *NotificationService) UnsubscribeTopic(ctx context.Context, userID int64, login string, topic string) ([]string, error) {
+	if err := domain.ValidateTopic(topic); err != nil {
+		return nil, err
+	}
+	removed, err := s.repo.Unsubscribe(ctx, userID, login, topic)
+	if err != nil {
+		return nil, err
+	}
+	if removed {
+		s.logger.InfoContext(ctx, "Отписка от темы", "user_id", userID, "login", login, "topic", topic)
+	}
+	return s.repo.GetSubscriptions(ctx, userID, login)
+}
+
 // validateNotifyRequest валидирует входящий запрос
 func (s *NotificationService) validateNotifyRequest(req *domain.NotifyRequest) error {
 	if req == nil {
 		return fmt.Errorf("запрос не может быть nil")
 	}
 
-	if len(req.Target) == 0 {
+	if len(req.Target) == 0 && len(req.Topics) == 0 {
 		return fmt.Errorf("список получателей не может быть пустым")
 	}
 
+	if len(req.Topics) > domain.MaxTopicsPerRequest {
+		return fmt.Errorf("не больше %d тем в запросе", domain.MaxTopicsPerRequest)
+	}
+	for _, topic := range req.Topics {
+		if err := domain.ValidateTopic(topic); err != nil {
+			return err
+		}
+	}
+
 	if req.Message == "" {
 		return fmt.Errorf("сообщение не может быть пустым")
 	}
@@ -513,6 +1355,14 @@ func (s *NotificationService) validateNotifyRequest(req *domain.NotifyRequest) e
 		return fmt.Errorf("время создания не может быть нулевым")
 	}
 
+	if !domain.ValidPriority(req.Priority) {
+		return fmt.Errorf("неизвестный приоритет: %s", req.Priority)
+	}
+
+	if err := domain.ValidateEscalation(req.Escalation); err != nil {
+		return err
+	}
+
 	for i, target := range req.Target {
 		if target.ID <= 0 {
 			return fmt.Errorf("ID получателя %d должен быть положительным", i)
@@ -0,0 +1,404 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"notification-mvp/internal/clock"
+	"notification-mvp/internal/domain"
+	"notification-mvp/internal/repository"
+)
+
+var testEpoch = time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+func newTestService(t *testing.T) (*NotificationService, *repository.MemoryRepository, *clock.Fake) {
+	t.Helper()
+	clock := clock.NewFake(testEpoch)
+	repo := repository.NewMemoryRepository(clock)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewNotificationService(repo, logger), repo, clock
+}
+
+func notifyRequest(message string, targets ...domain.Target) *domain.NotifyRequest {
+	return &domain.NotifyRequest{
+		Target:    targets,
+		Message:   message,
+		CreatedAt: testEpoch,
+		Source:    "test",
+	}
+}
+
+// fakeConn — WebSocket-соединение в памяти: клиентские сообщения подаются в in, ответы сервера читаются из out
+type fakeConn struct {
+	in     chan any
+	out    chan []byte
+	closed chan struct{}
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{in: make(chan any, 16), out: make(chan []byte, 256), closed: make(chan struct{})}
+}
+
+func (c *fakeConn) ReadJSON(v interface{}) error {
+	select {
+	case msg := <-c.in:
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(data, v)
+	case <-c.closed:
+		return io.EOF
+	}
+}
+
+func (c *fakeConn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.out <- data
+	return nil
+}
+
+func (c *fakeConn) Close() error {
+	close(c.closed)
+	return nil
+}
+
+// next ждет следующее сообщение сервера указанного типа
+func (c *fakeConn) next(t *testing.T, msgType string) map[string]any {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case data := <-c.out:
+			var msg struct {
+				Type string         `json:"type"`
+				Data map[string]any `json:"data"`
+			}
+			if err := json.Unmarshal(data, &msg); err != nil {
+				t.Fatalf("ошибка разбора сообщения сервера: %v", err)
+			}
+			if msg.Type == msgType {
+				return msg.Data
+			}
+		case <-timeout:
+			t.Fatalf("не получено сообщение %s", msgType)
+			return nil
+		}
+	}
+}
+
+func TestCreateNotificationsValidation(t *testing.T) {
+	svc, _, _ := newTestService(t)
+	alice := domain.Target{ID: 1, Login: "alice"}
+
+	tests := []struct {
+		name   string
+		mutate func(*domain.NotifyRequest)
+	}{
+		{"без получателей", func(r *domain.NotifyRequest) { r.Target = nil }},
+		{"пустое сообщение", func(r *domain.NotifyRequest) { r.Message = "" }},
+		{"без источника", func(r *domain.NotifyRequest) { r.Source = "" }},
+		{"нулевое время", func(r *domain.NotifyRequest) { r.CreatedAt = time.Time{} }},
+		{"неизвестный приоритет", func(r *domain.NotifyRequest) { r.Priority = "extreme" }},
+		{"неположительный ID", func(r *domain.NotifyRequest) { r.Target = []domain.Target{{ID: 0, Login: "x"}} }},
+		{"пустой логин", func(r *domain.NotifyRequest) { r.Target = []domain.Target{{ID: 1}} }},
+		{"неверная тема", func(r *domain.NotifyRequest) { r.Topics = []string{"a/b"} }},
+		{"шаг эскалации после истечения", func(r *domain.NotifyRequest) {
+			r.Escalation = []domain.EscalationStep{{AfterMinutes: 30, Action: domain.EscalationRepush}}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := notifyRequest("hello", alice)
+			tt.mutate(req)
+			if _, err := svc.CreateNotifications(context.Background(), req, ""); err == nil {
+				t.Fatal("ожидалась ошибка валидации")
+			}
+		})
+	}
+}
+
+func TestCreateNotificationsAndAck(t *testing.T) {
+	svc, repo, _ := newTestService(t)
+	ctx := context.Background()
+	alice := domain.Target{ID: 1, Login: "alice"}
+	bob := domain.Target{ID: 2, Login: "bob"}
+
+	resp, err := svc.CreateNotifications(ctx, notifyRequest("hello", alice, bob), "")
+	if err != nil {
+		t.Fatalf("CreateNotifications: %v", err)
+	}
+	if len(resp.Results) != 2 {
+		t.Fatalf("ожидалось 2 результата, получено %+v", resp.Results)
+	}
+
+	msgs, err := repo.RangeLastMessages(ctx, 1, "alice", 10)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("RangeLastMessages = %v, %v", msgs, err)
+	}
+	msg := msgs[0]
+	if msg.Payload == nil || msg.Payload.Message != "hello" || msg.Payload.NotificationID != resp.Results[0].NotificationID {
+		t.Fatalf("неверная запись стрима: %+v", msg.Payload)
+	}
+
+	tests := []struct {
+		name     string
+		streamID string
+		nid      string
+		want     domain.AckResult
+	}{
+		{"прочтение", msg.ID, msg.Payload.NotificationID, domain.AckResultAcked},
+		{"повтор", msg.ID, msg.Payload.NotificationID, domain.AckResultAlreadyRead},
+		{"чужое уведомление", msg.ID, resp.Results[1].NotificationID, domain.AckResultMismatched},
+		{"неизвестная запись", "1-1", msg.Payload.NotificationID, domain.AckResultUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.AckNotification(ctx, 1, "alice", tt.streamID, tt.nid)
+			if err != nil {
+				t.Fatalf("AckNotification: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("получено %s, ожидалось %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateNotificationsIdempotency(t *testing.T) {
+	svc, repo, clock := newTestService(t)
+	ctx := context.Background()
+	alice := domain.Target{ID: 1, Login: "alice"}
+
+	first, err := svc.CreateNotifications(ctx, notifyRequest("hello", alice), "key-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := svc.CreateNotifications(ctx, notifyRequest("hello", alice), "key-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Results[0].NotificationID != second.Results[0].NotificationID {
+		t.Fatal("повтор с тем же ключом создал новое уведомление")
+	}
+	if msgs, _ := repo.RangeLastMessages(ctx, 1, "alice", 10); len(msgs) != 1 {
+		t.Fatalf("в стриме %d записей, ожидалась одна", len(msgs))
+	}
+
+	// Результат идемпотентности живет 10 минут
+	clock.Advance(11 * time.Minute)
+	third, err := svc.CreateNotifications(ctx, notifyRequest("hello", alice), "key-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.Results[0].NotificationID == first.Results[0].NotificationID {
+		t.Fatal("истекший ключ идемпотентности вернул старый результат")
+	}
+}
+
+func TestCreateNotificationsInboxFull(t *testing.T) {
+	svc, _, _ := newTestService(t)
+	svc.WithStreamLimits(staticLimit{domain.StreamLimit{MaxLen: 1, Overflow: domain.OverflowRejectNew}})
+	ctx := context.Background()
+	alice := domain.Target{ID: 1, Login: "alice"}
+
+	if _, err := svc.CreateNotifications(ctx, notifyRequest("first", alice), ""); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := svc.CreateNotifications(ctx, notifyRequest("second", alice), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 1 || resp.Results[0].Error != domain.ErrorCodeInboxFull {
+		t.Fatalf("ожидался отказ inbox_full, получено %+v", resp.Results)
+	}
+}
+
+type staticLimit struct{ limit domain.StreamLimit }
+
+func (l staticLimit) Resolve(string, string, domain.Target) domain.StreamLimit { return l.limit }
+
+func TestWebSocketSessionDeliversAndAcks(t *testing.T) {
+	svc, _, _ := newTestService(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	alice := domain.Target{ID: 1, Login: "alice"}
+
+	// Уведомление, созданное до подключения, приходит при синхронизации
+	before, err := svc.CreateNotifications(ctx, notifyRequest("before", alice), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := newFakeConn()
+	done := make(chan error, 1)
+	go func() { done <- svc.HandleWebSocketConnection(ctx, 1, "alice", conn) }()
+
+	push := conn.next(t, domain.MessageTypeNotificationPush)
+	if push["notification_id"] != before.Results[0].NotificationID {
+		t.Fatalf("первым ожидалось уведомление %s, получено %v", before.Results[0].NotificationID, push)
+	}
+
+	// Новое уведомление приходит в открытую сессию
+	after, err := svc.CreateNotifications(ctx, notifyRequest("after", alice), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		push = conn.next(t, domain.MessageTypeNotificationPush)
+		if push["notification_id"] == after.Results[0].NotificationID {
+			break
+		}
+	}
+	if push["message"] != "after" {
+		t.Fatalf("неверный текст уведомления: %v", push)
+	}
+
+	conn.in <- domain.WebSocketMessage{
+		Type: domain.MessageTypeNotificationRead,
+		Data: map[string]string{"notification_id": push["notification_id"].(string), "stream_id": push["stream_id"].(string)},
+	}
+	ack := conn.next(t, domain.MessageTypeNotificationAck)
+	if ack["result"] != string(domain.AckResultAcked) {
+		t.Fatalf("ожидался результат acked, получено %v", ack)
+	}
+
+	conn.in <- domain.WebSocketMessage{
+		Type: domain.MessageTypeNotificationRead,
+		Data: map[string]string{"notification_id": "missing", "stream_id": push["stream_id"].(string)},
+	}
+	if e := conn.next(t, domain.MessageTypeError); e["code"] != domain.ErrorCodeAckMismatched {
+		t.Fatalf("ожидалась ошибка %s, получено %v", domain.ErrorCodeAckMismatched, e)
+	}
+
+	_ = conn.Close()
+	select {
+	case err := <-done:
+		if err == nil || errors.Is(err, context.Canceled) {
+			t.Fatalf("ожидалась ошибка чтения закрытого соединения, получено %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("сессия не завершилась после закрытия соединения")
+	}
+}
+
+func TestTopicFanOut(t *testing.T) {
+	svc, _, _ := newTestService(t)
+	svc.WithTopicChunk(1)
+	ctx := context.Background()
+
+	for _, u := range []domain.Target{{ID: 1, Login: "alice"}, {ID: 2, Login: "bob"}} {
+		for _, topic := range []string{"deploys", "alerts"} {
+			if _, err := svc.SubscribeTopic(ctx, u.ID, u.Login, topic); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	req := notifyRequest("release", domain.Target{ID: 1, Login: "alice"})
+	req.Topics = []string{"deploys", "alerts"}
+	resp, err := svc.CreateNotifications(ctx, req, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0, len(resp.Results))
+	for _, r := range resp.Results {
+		got = append(got, r.Target.Login)
+	}
+	if strings.Join(got, ",") != "alice,bob" {
+		t.Fatalf("каждый получатель должен получить одно уведомление, получено %v", got)
+	}
+}
+
+func TestPreferencesDeferAndRelease(t *testing.T) {
+	svc, repo, _ := newTestService(t)
+	ctx := context.Background()
+	alice := domain.Target{ID: 1, Login: "alice"}
+
+	// Сервис откладывает по реальному времени, поэтому «не беспокоить» задается относительно time.Now
+	dnd := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	if _, err := svc.SetPreferences(ctx, 1, "alice", domain.Preferences{DNDUntil: &dnd}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := svc.CreateNotifications(ctx, notifyRequest("hello", alice), "")
+	if err != nil {
+		t.Fatalf("CreateNotifications: %v", err)
+	}
+	res := resp.Results[0]
+	if res.Status != domain.NotifyStatusDeferred || res.DeferredUntil == nil || !res.DeferredUntil.Equal(dnd) {
+		t.Fatalf("уведомление не отложено до конца «не беспокоить»: %+v", res)
+	}
+	if msgs, _ := repo.RangeLastMessages(ctx, 1, "alice", 10); len(msgs) != 0 {
+		t.Fatalf("отложенное уведомление попало в стрим: %d записей", len(msgs))
+	}
+
+	d, err := repo.GetDeferredNotification(ctx, 1, "alice", res.NotificationID)
+	if err != nil || d == nil {
+		t.Fatalf("GetDeferredNotification = %+v, %v", d, err)
+	}
+
+	// Пока режим действует, выпуск переносится
+	if err := svc.ReleaseDeferred(ctx, *d); err != nil {
+		t.Fatal(err)
+	}
+	if msgs, _ := repo.RangeLastMessages(ctx, 1, "alice", 10); len(msgs) != 0 {
+		t.Fatal("уведомление выпущено до конца «не беспокоить»")
+	}
+
+	if _, err := svc.SetPreferences(ctx, 1, "alice", domain.Preferences{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.ReleaseDeferred(ctx, *d); err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := repo.RangeLastMessages(ctx, 1, "alice", 10)
+	if err != nil || len(msgs) != 1 || msgs[0].Payload.NotificationID != res.NotificationID {
+		t.Fatalf("выпущенное уведомление не создано с тем же notification_id: %v, %v", msgs, err)
+	}
+	if d, _ := repo.GetDeferredNotification(ctx, 1, "alice", res.NotificationID); d != nil {
+		t.Fatal("выпущенное уведомление осталось в отложенных")
+	}
+}
+
+// recordingSink запоминает события архива
+type recordingSink struct{ events []domain.ArchiveEvent }
+
+func (s *recordingSink) Record(event domain.ArchiveEvent) { s.events = append(s.events, event) }
+
+func TestCreateNotificationsArchivesDropped(t *testing.T) {
+	svc, _, _ := newTestService(t)
+	sink := &recordingSink{}
+	svc.WithArchive(sink).WithStreamLimits(staticLimit{domain.StreamLimit{MaxLen: 1, Overflow: domain.OverflowDropOldest}})
+	ctx := context.Background()
+	alice := domain.Target{ID: 1, Login: "alice"}
+
+	first, err := svc.CreateNotifications(ctx, notifyRequest("first", alice), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.CreateNotifications(ctx, notifyRequest("second", alice), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var dropped []domain.ArchiveEvent
+	for _, ev := range sink.events {
+		if ev.Type == domain.ArchiveEventDropped {
+			dropped = append(dropped, ev)
+		}
+	}
+	if len(dropped) != 1 || dropped[0].NotificationID != first.Results[0].NotificationID {
+		t.Fatalf("в архив записано вытеснение %+v, ожидалось %s", dropped, first.Results[0].NotificationID)
+	}
+	if dropped[0].Target != alice || dropped[0].OccurredAt.IsZero() {
+		t.Fatalf("неполное событие вытеснения: %+v", dropped[0])
+	}
+}
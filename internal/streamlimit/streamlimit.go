@@ -0,0 +1,109 @@
+package streamlimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"notification-mvp/internal/domain"
+)
+
+// Table выбирает лимит стрима по приоритету: пользователь, источник, tenant, значение по умолчанию
+type Table struct {
+	def     domain.StreamLimit
+	tenants map[string]domain.StreamLimit
+	sources map[string]domain.StreamLimit
+	users   map[string]domain.StreamLimit
+}
+
+// fileFormat — формат файла лимитов; пропущенные поля берутся из лимита по умолчанию
+type fileFormat struct {
+	Default *limitEntry           `json:"default"`
+	Tenants map[string]limitEntry `json:"tenants"`
+	Sources map[string]limitEntry `json:"sources"`
+	Users   map[string]limitEntry `json:"users"` // ключ — "<id>-<login>"
+}
+
+type limitEntry struct {
+	MaxLen   int64  `json:"max_len"`
+	Overflow string `json:"overflow"`
+}
+
+// New создает таблицу только с лимитом по умолчанию
+func New(def domain.StreamLimit) *Table {
+	return &Table{def: def}
+}
+
+// Load читает таблицу лимитов из JSON файла; пустой путь — только лимит по умолчанию
+func Load(path string, def domain.StreamLimit) (*Table, error) {
+	t := New(def)
+	if path == "" {
+		return t, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла лимитов стрима: %w", err)
+	}
+	var f fileFormat
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("ошибка разбора файла лимитов стрима: %w", err)
+	}
+
+	if f.Default != nil {
+		if t.def, err = f.Default.merge(def); err != nil {
+			return nil, err
+		}
+	}
+	if t.tenants, err = mergeAll(f.Tenants, t.def); err != nil {
+		return nil, err
+	}
+	if t.sources, err = mergeAll(f.Sources, t.def); err != nil {
+		return nil, err
+	}
+	if t.users, err = mergeAll(f.Users, t.def); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Resolve возвращает лимит для уведомления
+func (t *Table) Resolve(tenant, source string, target domain.Target) domain.StreamLimit {
+	if l, ok := t.users[domain.UserKey(target.ID, target.Login)]; ok {
+		return l
+	}
+	if l, ok := t.sources[source]; ok && source != "" {
+		return l
+	}
+	if l, ok := t.tenants[tenant]; ok && tenant != "" {
+		return l
+	}
+	return t.def
+}
+
+func (e limitEntry) merge(def domain.StreamLimit) (domain.StreamLimit, error) {
+	l := def
+	if e.MaxLen > 0 {
+		l.MaxLen = e.MaxLen
+	}
+	if e.Overflow != "" {
+		p, err := domain.ParseOverflowPolicy(e.Overflow)
+		if err != nil {
+			return l, err
+		}
+		l.Overflow = p
+	}
+	return l, nil
+}
+
+func mergeAll(entries map[string]limitEntry, def domain.StreamLimit) (map[string]domain.StreamLimit, error) {
+	out := make(map[string]domain.StreamLimit, len(entries))
+	for name, e := range entries {
+		l, err := e.merge(def)
+		if err != nil {
+			return nil, fmt.Errorf("лимит %q: %w", name, err)
+		}
+		out[name] = l
+	}
+	return out, nil
+}
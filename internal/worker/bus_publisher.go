@@ -0,0 +1,86 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"notification-mvp/internal/domain"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// busMessageTypeClientEvent — служебное событие для WebSocket-сессий пользователя
+const busMessageTypeClientEvent = "client.event"
+
+// BusPublisher доставляет служебные события пользователю: локальным сессиям
+// и через шину pod-владельцу consumer-lock пользователя
+type BusPublisher struct {
+	rdb    redis.UniversalClient // nil — только локальная доставка (хранилище в памяти)
+	podID  string
+	logger *slog.Logger
+	maxLen int64 // приблизительный MAXLEN стрима шины (0 — без ограничения)
+
+	deliverLocal func(userKey string, payload json.RawMessage) error
+}
+
+// NewBusPublisher создает публикатор событий
+func NewBusPublisher(
+	rdb redis.UniversalClient,
+	podID string,
+	logger *slog.Logger,
+	deliverLocal func(userKey string, payload json.RawMessage) error,
+) *BusPublisher {
+	return &BusPublisher{rdb: rdb, podID: podID, logger: logger, deliverLocal: deliverLocal}
+}
+
+// WithMaxLen ограничивает длину стрима шины получателя; при переполнении вытесняются старые сообщения
+func (p *BusPublisher) WithMaxLen(maxLen int) *BusPublisher {
+	p.maxLen = int64(maxLen)
+	return p
+}
+
+// PublishToUser отправляет событие пользователю на текущем pod и на pod-владельце его сессии
+func (p *BusPublisher) PublishToUser(ctx context.Context, userID int64, login string, msg domain.WebSocketMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации события: %w", err)
+	}
+	userKey := domain.UserKey(userID, login)
+
+	// Ошибка локальной доставки не мешает переслать событие pod-владельцу сессии
+	if p.deliverLocal != nil {
+		if err := p.deliverLocal(userKey, data); err != nil && !errors.Is(err, domain.ErrNoLocalSession) {
+			p.logger.WarnContext(ctx, "Ошибка локальной доставки события", "user", userKey, "type", msg.Type, "error", err)
+		}
+	}
+	if p.rdb == nil {
+		return nil
+	}
+
+	owner, err := p.rdb.Get(ctx, domain.ConsumerLockKey(userID, login)).Result()
+	if err == redis.Nil || owner == p.podID {
+		return nil // пользователь не подключен или подключен к текущему pod
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка чтения consumer lock: %w", err)
+	}
+
+	busMsg, err := json.Marshal(BusMessage{Type: busMessageTypeClientEvent, UserKey: userKey, Data: data})
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации сообщения шины: %w", err)
+	}
+	if err := p.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: busStreamPrefix + owner,
+		MaxLen: p.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{"payload": string(busMsg)},
+	}).Err(); err != nil {
+		return fmt.Errorf("ошибка публикации в шину: %w", err)
+	}
+
+	p.logger.DebugContext(ctx, "Событие отправлено через шину", "user", userKey, "pod", owner, "type", msg.Type)
+	return nil
+}
@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"notification-mvp/internal/domain"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestBusPublisherLocalDeliveryError(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	ctx := context.Background()
+	// Сессия пользователя на другом pod: событие уходит и в шину
+	rdb.Set(ctx, domain.ConsumerLockKey(1, "alice"), "pod-b", time.Minute)
+
+	tests := []struct {
+		name    string
+		err     error
+		wantLog bool
+	}{
+		{"нет локальной сессии", domain.ErrNoLocalSession, false},
+		{"ошибка записи в WebSocket", errors.New("ошибка записи"), true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&logs, nil))
+			p := NewBusPublisher(rdb, "pod-a", logger, func(string, json.RawMessage) error { return tt.err })
+
+			if err := p.PublishToUser(ctx, 1, "alice", domain.WebSocketMessage{Type: "inbox.overflow"}); err != nil {
+				t.Fatalf("PublishToUser: %v", err)
+			}
+			if n := rdb.XLen(ctx, busStreamPrefix+"pod-b").Val(); n != int64(i+1) {
+				t.Fatalf("в шине pod-b %d сообщений, ожидалось %d", n, i+1)
+			}
+			if got := strings.Contains(logs.String(), "Ошибка локальной доставки события"); got != tt.wantLog {
+				t.Fatalf("предупреждение в логе: %v, ожидалось %v\n%s", got, tt.wantLog, logs.String())
+			}
+		})
+	}
+}
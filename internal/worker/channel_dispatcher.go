@@ -0,0 +1,202 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"notification-mvp/internal/clock"
+	"notification-mvp/internal/domain"
+	"notification-mvp/internal/metrics"
+)
+
+// channelDispatchBatch — доставок за одну итерацию
+const channelDispatchBatch = 500
+
+// Результаты отправки во внешний канал (метка result метрики)
+const (
+	channelResultSent      = "sent"
+	channelResultError     = "error"
+	channelResultNoAddress = "no_address"
+)
+
+// ChannelDispatcher доставляет внешними каналами уведомления, которые получатель не прочитал:
+// сразу после создания, если он не в сети, или по истечении окна непрочитанности
+type ChannelDispatcher struct {
+	repo      domain.NotificationRepository
+	channels  []domain.Channel
+	directory domain.UserDirectory
+	logger    *slog.Logger
+	shard     KeyFilter // nil — обрабатываются все пользователи
+	clock     clock.Clock
+
+	maxAttempts int
+	backoff     time.Duration
+}
+
+func NewChannelDispatcher(
+	repo domain.NotificationRepository,
+	channels []domain.Channel,
+	directory domain.UserDirectory,
+	logger *slog.Logger,
+) *ChannelDispatcher {
+	return &ChannelDispatcher{
+		repo:        repo,
+		channels:    channels,
+		directory:   directory,
+		logger:      logger,
+		clock:       clock.System{},
+		maxAttempts: 5,
+		backoff:     30 * time.Second,
+	}
+}
+
+// WithShard ограничивает обработку пользователями, принадлежащими этому pod
+func (w *ChannelDispatcher) WithShard(shard KeyFilter) *ChannelDispatcher {
+	w.shard = shard
+	return w
+}
+
+// WithClock задает источник времени для выборки доставок и планирования повторов (подменяется в тестах)
+func (w *ChannelDispatcher) WithClock(clock clock.Clock) *ChannelDispatcher {
+	w.clock = clock
+	return w
+}
+
+// WithRetryPolicy задает число попыток доставки и начальную задержку повтора (удваивается с каждой попыткой)
+func (w *ChannelDispatcher) WithRetryPolicy(maxAttempts int, backoff time.Duration) *ChannelDispatcher {
+	if maxAttempts > 0 {
+		w.maxAttempts = maxAttempts
+	}
+	if backoff > 0 {
+		w.backoff = backoff
+	}
+	return w
+}
+
+func (w *ChannelDispatcher) Name() string {
+	return "channel_dispatch"
+}
+
+func (w *ChannelDispatcher) RunOnce(ctx context.Context) error {
+	now := w.clock.Now()
+	members, err := ownedDue(ctx, w.shard, channelDispatchBatch, memberUserKey,
+		func(ctx context.Context, offset, limit int64) ([]string, error) {
+			return w.repo.GetDueChannelDeliveries(ctx, now, offset, limit)
+		})
+	if err != nil {
+		return fmt.Errorf("ошибка получения доставок каналами: %w", err)
+	}
+
+	var failed int
+	for _, member := range members {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		userKey, nid, err := domain.ParseNotificationMember(member)
+		if err != nil {
+			w.logger.Warn("Ошибка парсинга доставки каналами", "member", member, "error", err)
+			continue
+		}
+		userID, login, err := domain.ParseUserKey(userKey)
+		if err != nil {
+			w.logger.Warn("Ошибка парсинга user key", "user_key", userKey, "error", err)
+			continue
+		}
+		if err := w.dispatch(ctx, userID, login, nid); err != nil {
+			w.logger.Warn("Ошибка доставки каналами", "user", userKey, "notification_id", nid, "error", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("не удалось доставить каналами %d из %d уведомлений", failed, len(members))
+	}
+	return nil
+}
+
+// dispatch отправляет уведомление во все каналы, которые его еще не доставили.
+// При сбое канала доставка переносится с экспоненциальной задержкой до maxAttempts попыток
+func (w *ChannelDispatcher) dispatch(ctx context.Context, userID int64, login, nid string) error {
+	d, err := w.repo.GetChannelDelivery(ctx, userID, login, nid)
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		// Доставка отменена, а member индекса остался — убираем его
+		return w.repo.CancelChannelDelivery(ctx, userID, login, nid)
+	}
+
+	read, err := w.repo.GetReadStatuses(ctx, userID, login, []string{nid})
+	if err != nil {
+		return err
+	}
+	if read[nid] {
+		return w.repo.CancelChannelDelivery(ctx, userID, login, nid)
+	}
+
+	contact, err := w.directory.Lookup(ctx, d.Target)
+	if err != nil {
+		return fmt.Errorf("ошибка поиска контакта пользователя: %w", err)
+	}
+
+	var sendErr error
+	delivered := false
+	for _, ch := range w.channels {
+		if d.SentVia(ch.Name()) || !d.Allows(ch.Name()) {
+			continue
+		}
+		if delivered {
+			// Канал мог подтвердить прочтение (webhook) — тогда остальным каналам слать нечего
+			read, err := w.repo.GetReadStatuses(ctx, userID, login, []string{nid})
+			if err != nil {
+				return err
+			}
+			if read[nid] {
+				return w.repo.CancelChannelDelivery(ctx, userID, login, nid)
+			}
+		}
+		err := ch.Send(ctx, contact, *d)
+		switch {
+		case errors.Is(err, domain.ErrNoAddress):
+			metrics.ChannelDeliveries.WithLabelValues(ch.Name(), channelResultNoAddress).Inc()
+		case err != nil:
+			metrics.ChannelDeliveries.WithLabelValues(ch.Name(), channelResultError).Inc()
+			sendErr = errors.Join(sendErr, fmt.Errorf("%s: %w", ch.Name(), err))
+		default:
+			metrics.ChannelDeliveries.WithLabelValues(ch.Name(), channelResultSent).Inc()
+			d.Sent = append(d.Sent, ch.Name())
+			delivered = true
+			w.logger.Info("Уведомление доставлено каналом",
+				"channel", ch.Name(), "notification_id", nid, "user_id", userID, "login", login)
+		}
+	}
+	if sendErr == nil {
+		return w.repo.CancelChannelDelivery(ctx, userID, login, nid)
+	}
+
+	d.Attempts++
+	if d.Attempts >= w.maxAttempts {
+		metrics.ChannelDeliveriesDropped.Inc()
+		w.logger.Warn("Доставка каналами прекращена после всех попыток",
+			"notification_id", nid, "user_id", userID, "login", login, "attempts", d.Attempts, "error", sendErr)
+		return w.repo.CancelChannelDelivery(ctx, userID, login, nid)
+	}
+	d.DueAt = w.clock.Now().Add(w.retryDelay(d.Attempts))
+	if err := w.repo.ScheduleChannelDelivery(ctx, *d); err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// retryDelay возвращает задержку повтора после attempts неудачных попыток
+func (w *ChannelDispatcher) retryDelay(attempts int) time.Duration {
+	delay := w.backoff
+	for i := 1; i < attempts && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	return min(delay, time.Hour)
+}
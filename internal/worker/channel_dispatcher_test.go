@@ -0,0 +1,214 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"notification-mvp/internal/clock"
+	"notification-mvp/internal/domain"
+	"notification-mvp/internal/repository"
+)
+
+// fakeChannel возвращает ошибки из errs по очереди, затем отправляет успешно
+type fakeChannel struct {
+	name  string
+	errs  []error
+	calls int
+}
+
+func (c *fakeChannel) Name() string { return c.name }
+
+func (c *fakeChannel) Send(ctx context.Context, contact domain.Contact, d domain.ChannelDelivery) error {
+	c.calls++
+	if len(c.errs) == 0 {
+		return nil
+	}
+	err := c.errs[0]
+	c.errs = c.errs[1:]
+	return err
+}
+
+type fakeDirectory struct{}
+
+func (fakeDirectory) Lookup(ctx context.Context, target domain.Target) (domain.Contact, error) {
+	return domain.Contact{Email: target.Login + "@example.com"}, nil
+}
+
+// scheduleDelivery создает уведомление alice и планирует его доставку каналами на текущий момент
+func scheduleDelivery(t *testing.T, repo *repository.MemoryRepository, clock *clock.Fake) string {
+	t.Helper()
+	ctx := context.Background()
+	alice := domain.Target{ID: 1, Login: "alice"}
+	created := createNotification(t, repo, clock, alice)
+	msgs, _ := repo.RangeLastMessages(ctx, 1, "alice", 1)
+	nid := msgs[0].Payload.NotificationID
+	if err := repo.ScheduleChannelDelivery(ctx, domain.ChannelDelivery{
+		NotificationID: nid,
+		StreamID:       created.StreamID,
+		Target:         alice,
+		DueAt:          clock.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return nid
+}
+
+func TestChannelDispatcherRetryBackoff(t *testing.T) {
+	ctx := context.Background()
+	repo, clock := newTestRepo()
+	nid := scheduleDelivery(t, repo, clock)
+
+	failure := errors.New("сервер недоступен")
+	email := &fakeChannel{name: "email", errs: []error{failure, failure}}
+	dispatcher := NewChannelDispatcher(repo, []domain.Channel{email}, fakeDirectory{}, testLogger()).
+		WithClock(clock).
+		WithRetryPolicy(5, time.Minute)
+
+	// Каждая неудача переносит доставку на удвоенную задержку
+	for attempt, wantDelay := range []time.Duration{time.Minute, 2 * time.Minute} {
+		if err := dispatcher.RunOnce(ctx); err == nil {
+			t.Fatalf("попытка %d: ошибка канала не возвращена", attempt+1)
+		}
+		d, err := repo.GetChannelDelivery(ctx, 1, "alice", nid)
+		if err != nil || d == nil {
+			t.Fatalf("попытка %d: доставка не перенесена: %+v, %v", attempt+1, d, err)
+		}
+		if d.Attempts != attempt+1 {
+			t.Fatalf("попытка %d: Attempts = %d", attempt+1, d.Attempts)
+		}
+		if want := clock.Now().Add(wantDelay); !d.DueAt.Equal(want) {
+			t.Fatalf("попытка %d: DueAt = %v, ожидалось %v", attempt+1, d.DueAt, want)
+		}
+
+		// До наступления повтора канал не вызывается
+		calls := email.calls
+		clock.Advance(wantDelay - time.Second)
+		if err := dispatcher.RunOnce(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if email.calls != calls {
+			t.Fatalf("попытка %d: канал вызван до наступления повтора", attempt+1)
+		}
+		clock.Advance(time.Second)
+	}
+
+	if err := dispatcher.RunOnce(ctx); err != nil {
+		t.Fatalf("третья попытка: %v", err)
+	}
+	if email.calls != 3 {
+		t.Fatalf("канал вызван %d раз, ожидалось 3", email.calls)
+	}
+	if d, _ := repo.GetChannelDelivery(ctx, 1, "alice", nid); d != nil {
+		t.Fatal("доставка не удалена после успешной отправки")
+	}
+}
+
+func TestChannelDispatcherGivesUp(t *testing.T) {
+	ctx := context.Background()
+	repo, clock := newTestRepo()
+	nid := scheduleDelivery(t, repo, clock)
+
+	failure := errors.New("сервер недоступен")
+	email := &fakeChannel{name: "email", errs: []error{failure, failure, failure}}
+	dispatcher := NewChannelDispatcher(repo, []domain.Channel{email}, fakeDirectory{}, testLogger()).
+		WithClock(clock).
+		WithRetryPolicy(2, time.Minute)
+
+	if err := dispatcher.RunOnce(ctx); err == nil {
+		t.Fatal("ошибка первой попытки не возвращена")
+	}
+	clock.Advance(time.Minute)
+	// Последняя попытка: доставка прекращается без ошибки прохода
+	if err := dispatcher.RunOnce(ctx); err != nil {
+		t.Fatalf("последняя попытка: %v", err)
+	}
+	if d, _ := repo.GetChannelDelivery(ctx, 1, "alice", nid); d != nil {
+		t.Fatalf("доставка осталась после %d попыток: %+v", email.calls, d)
+	}
+
+	clock.Advance(time.Hour)
+	if err := dispatcher.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if email.calls != 2 {
+		t.Fatalf("канал вызван %d раз, ожидалось 2", email.calls)
+	}
+}
+
+func TestChannelDispatcherRetriesOnlyFailedChannels(t *testing.T) {
+	ctx := context.Background()
+	repo, clock := newTestRepo()
+	nid := scheduleDelivery(t, repo, clock)
+
+	email := &fakeChannel{name: "email"}
+	sms := &fakeChannel{name: "sms", errs: []error{errors.New("шлюз недоступен")}}
+	dispatcher := NewChannelDispatcher(repo, []domain.Channel{email, sms}, fakeDirectory{}, testLogger()).
+		WithClock(clock).
+		WithRetryPolicy(5, time.Minute)
+
+	if err := dispatcher.RunOnce(ctx); err == nil {
+		t.Fatal("ошибка канала sms не возвращена")
+	}
+	d, err := repo.GetChannelDelivery(ctx, 1, "alice", nid)
+	if err != nil || d == nil || !d.SentVia("email") || d.SentVia("sms") {
+		t.Fatalf("успешные каналы не записаны: %+v, %v", d, err)
+	}
+
+	clock.Advance(time.Minute)
+	if err := dispatcher.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if email.calls != 1 || sms.calls != 2 {
+		t.Fatalf("вызовы email=%d sms=%d, ожидалось 1 и 2", email.calls, sms.calls)
+	}
+}
+
+func TestChannelDispatcherSkipsRead(t *testing.T) {
+	ctx := context.Background()
+	repo, clock := newTestRepo()
+	nid := scheduleDelivery(t, repo, clock)
+	msgs, _ := repo.RangeLastMessages(ctx, 1, "alice", 1)
+	if res, err := repo.AckMessage(ctx, 1, "alice", msgs[0].ID, nid); err != nil || res != domain.AckResultAcked {
+		t.Fatalf("AckMessage = %s, %v", res, err)
+	}
+	// AckMessage отменяет доставку; возвращаем её, чтобы проверить проверку прочтения воркером
+	if err := repo.ScheduleChannelDelivery(ctx, domain.ChannelDelivery{
+		NotificationID: nid,
+		Target:         domain.Target{ID: 1, Login: "alice"},
+		DueAt:          clock.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	email := &fakeChannel{name: "email"}
+	if err := NewChannelDispatcher(repo, []domain.Channel{email}, fakeDirectory{}, testLogger()).WithClock(clock).RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if email.calls != 0 {
+		t.Fatal("прочитанное уведомление отправлено каналом")
+	}
+	if d, _ := repo.GetChannelDelivery(ctx, 1, "alice", nid); d != nil {
+		t.Fatal("доставка прочитанного уведомления не удалена")
+	}
+}
+
+func TestChannelDispatcherRetryDelay(t *testing.T) {
+	w := NewChannelDispatcher(nil, nil, nil, testLogger()).WithRetryPolicy(5, 30*time.Second)
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{10, time.Hour},
+		{100, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := w.retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %v, ожидалось %v", tt.attempts, got, tt.want)
+		}
+	}
+}
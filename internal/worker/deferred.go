@@ -0,0 +1,90 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"notification-mvp/internal/domain"
+)
+
+// deferredBatch — отложенных уведомлений за одну итерацию
+const deferredBatch = 1000
+
+// DeferredWorker выпускает уведомления, отложенные до конца тихих часов или режима «не беспокоить»
+type DeferredWorker struct {
+	repo    domain.NotificationRepository
+	service domain.NotificationService
+	logger  *slog.Logger
+	shard   KeyFilter // nil — обрабатываются все пользователи
+}
+
+func NewDeferredWorker(
+	repo domain.NotificationRepository,
+	service domain.NotificationService,
+	logger *slog.Logger,
+) *DeferredWorker {
+	return &DeferredWorker{repo: repo, service: service, logger: logger}
+}
+
+// WithShard ограничивает обработку пользователями, принадлежащими этому pod
+func (w *DeferredWorker) WithShard(shard KeyFilter) *DeferredWorker {
+	w.shard = shard
+	return w
+}
+
+func (w *DeferredWorker) Name() string {
+	return "deferred_release"
+}
+
+func (w *DeferredWorker) RunOnce(ctx context.Context) error {
+	now := time.Now()
+	members, err := ownedDue(ctx, w.shard, deferredBatch, memberUserKey,
+		func(ctx context.Context, offset, limit int64) ([]string, error) {
+			return w.repo.GetDueDeferred(ctx, now, offset, limit)
+		})
+	if err != nil {
+		return fmt.Errorf("ошибка получения отложенных уведомлений: %w", err)
+	}
+
+	var failed int
+	for _, member := range members {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		userKey, nid, err := domain.ParseNotificationMember(member)
+		if err != nil {
+			w.logger.Warn("Ошибка парсинга отложенного уведомления", "member", member, "error", err)
+			continue
+		}
+		userID, login, err := domain.ParseUserKey(userKey)
+		if err != nil {
+			w.logger.Warn("Ошибка парсинга user key", "user_key", userKey, "error", err)
+			continue
+		}
+		if err := w.release(ctx, userID, login, nid); err != nil {
+			w.logger.Warn("Ошибка выпуска отложенного уведомления", "user", userKey, "notification_id", nid, "error", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("не удалось выпустить %d из %d отложенных уведомлений", failed, len(members))
+	}
+	return nil
+}
+
+// release выпускает одно отложенное уведомление
+func (w *DeferredWorker) release(ctx context.Context, userID int64, login, nid string) error {
+	d, err := w.repo.GetDeferredNotification(ctx, userID, login, nid)
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		// Уведомление удалено, а member индекса остался — убираем его
+		return w.repo.RemoveDeferred(ctx, userID, login, nid)
+	}
+	return w.service.ReleaseDeferred(ctx, *d)
+}
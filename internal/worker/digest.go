@@ -0,0 +1,206 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"notification-mvp/internal/clock"
+	"notification-mvp/internal/domain"
+	"notification-mvp/internal/metrics"
+)
+
+const (
+	digestUsersBatch = 1000 // пользователей за одну итерацию
+	digestScanLimit  = 1000 // последних кандидатов, просматриваемых при сборке сводки
+)
+
+// DigestWorker собирает непрочитанные уведомления пользователей в одну сводку по их расписанию
+// и отправляет ее обычным путем CreateNotifications
+type DigestWorker struct {
+	repo    domain.NotificationRepository
+	service domain.NotificationService
+	logger  *slog.Logger
+	shard   KeyFilter // nil — обрабатываются все пользователи
+	clock   clock.Clock
+}
+
+func NewDigestWorker(repo domain.NotificationRepository, service domain.NotificationService, logger *slog.Logger) *DigestWorker {
+	return &DigestWorker{repo: repo, service: service, logger: logger, clock: clock.System{}}
+}
+
+// WithShard ограничивает обработку пользователями, принадлежащими этому pod
+func (w *DigestWorker) WithShard(shard KeyFilter) *DigestWorker {
+	w.shard = shard
+	return w
+}
+
+// WithClock подменяет источник времени (для тестов)
+func (w *DigestWorker) WithClock(clock clock.Clock) *DigestWorker {
+	w.clock = clock
+	return w
+}
+
+func (w *DigestWorker) Name() string {
+	return "digest"
+}
+
+func (w *DigestWorker) RunOnce(ctx context.Context) error {
+	now := w.clock.Now()
+	userKeys, err := ownedDue(ctx, w.shard, digestUsersBatch, userKeyItem,
+		func(ctx context.Context, offset, limit int64) ([]string, error) {
+			return w.repo.GetDueDigestUserKeys(ctx, now, offset, limit)
+		})
+	if err != nil {
+		return fmt.Errorf("ошибка получения пользователей для сводки: %w", err)
+	}
+
+	var failed int
+	for _, uk := range userKeys {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		userID, login, err := domain.ParseUserKey(uk)
+		if err != nil {
+			w.logger.Warn("Ошибка парсинга user key", "user_key", uk, "error", err)
+			continue
+		}
+		if err := w.digestUser(ctx, userID, login, now); err != nil {
+			w.logger.Warn("Ошибка отправки сводки", "user", uk, "error", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("не удалось отправить сводку %d из %d пользователей", failed, len(userKeys))
+	}
+	return nil
+}
+
+// digestUser отправляет сводку одному пользователю и планирует следующую
+func (w *DigestWorker) digestUser(ctx context.Context, userID int64, login string, now time.Time) error {
+	pref, err := w.repo.GetDigestPreference(ctx, userID, login)
+	if err != nil {
+		return err
+	}
+	if pref == nil {
+		// Настройки удалены в обход SetDigestPreference — убираем пользователя из индекса
+		return w.repo.SetDigestPreference(ctx, userID, login, domain.DigestPreference{Mode: domain.DigestOff})
+	}
+
+	var since time.Time
+	if pref.LastDigestAt != nil {
+		since = *pref.LastDigestAt
+	}
+	items, err := w.collectUnread(ctx, userID, login, since)
+	if err != nil {
+		return err
+	}
+
+	if len(items) > 0 {
+		req := &domain.NotifyRequest{
+			Target:    []domain.Target{{ID: userID, Login: login}},
+			Message:   digestMessage(items),
+			CreatedAt: now,
+			Source:    domain.DigestSource,
+			Category:  domain.DigestSource,
+		}
+		// Ключ привязан к началу периода: если сбой случится до сохранения LastDigestAt,
+		// повторная итерация получит кэшированный ответ вместо второй сводки
+		key := "digest:" + domain.UserKey(userID, login) + ":" + strconv.FormatInt(since.Unix(), 10)
+		resp, err := w.service.CreateNotifications(ctx, req, key)
+		if err != nil {
+			return fmt.Errorf("ошибка создания сводки: %w", err)
+		}
+		if len(resp.Results) > 0 && resp.Results[0].Error != "" {
+			// Сводка отклонена (например, inbox_full) — попробуем в следующем периоде
+			w.logger.Warn("Сводка отклонена", "user_id", userID, "login", login, "reason", resp.Results[0].Error)
+		} else {
+			metrics.DigestsSent.Inc()
+			metrics.DigestItems.Add(float64(len(items)))
+
+			if pref.MarkDigested {
+				marked, err := w.repo.MarkDigested(ctx, userID, login, items)
+				if err != nil {
+					return fmt.Errorf("ошибка пометки уведомлений digested: %w", err)
+				}
+				metrics.DigestMarked.Add(float64(marked))
+			}
+		}
+	}
+
+	pref.LastDigestAt = &now
+	if err := w.repo.SetDigestPreference(ctx, userID, login, *pref); err != nil {
+		return fmt.Errorf("ошибка планирования следующей сводки: %w", err)
+	}
+	return nil
+}
+
+// collectUnread возвращает непрочитанные уведомления, добавленные в стрим после since.
+// Кандидаты хранятся дольше payload, поэтому в сводку попадают и уже истекшие уведомления.
+// Сами сводки кандидатами не становятся
+func (w *DigestWorker) collectUnread(ctx context.Context, userID int64, login string, since time.Time) ([]domain.DigestCandidate, error) {
+	candidates, err := w.repo.GetDigestCandidates(ctx, userID, login, since, digestScanLimit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения кандидатов для сводки: %w", err)
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		ids = append(ids, c.NotificationID)
+	}
+
+	read, err := w.repo.GetReadStatuses(ctx, userID, login, ids)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения статусов для сводки: %w", err)
+	}
+	unread := candidates[:0]
+	for _, c := range candidates {
+		if !read[c.NotificationID] {
+			unread = append(unread, c)
+		}
+	}
+	return unread, nil
+}
+
+// digestMessage формирует текст сводки: число непрочитанных по источникам и категориям
+func digestMessage(items []domain.DigestCandidate) string {
+	type group struct{ source, category string }
+	counts := make(map[group]int)
+	for _, c := range items {
+		counts[group{c.Source, c.Category}]++
+	}
+
+	groups := make([]group, 0, len(counts))
+	for g := range counts {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].source != groups[j].source {
+			return groups[i].source < groups[j].source
+		}
+		return groups[i].category < groups[j].category
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Непрочитанных уведомлений: %d", len(items))
+	for _, g := range groups {
+		source := g.source
+		if source == "" {
+			source = "без источника"
+		}
+		if g.category != "" {
+			source += "/" + g.category
+		}
+		fmt.Fprintf(&b, "\n%s: %d", source, counts[g])
+	}
+	return b.String()
+}
@@ -0,0 +1,152 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"notification-mvp/internal/clock"
+	"notification-mvp/internal/domain"
+	"notification-mvp/internal/repository"
+	"notification-mvp/internal/service"
+)
+
+// digestsOf возвращает сводки в стриме пользователя
+func digestsOf(t *testing.T, repo *repository.MemoryRepository, target domain.Target) []domain.StreamMessage {
+	t.Helper()
+	msgs, err := repo.RangeLastMessages(context.Background(), target.ID, target.Login, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var digests []domain.StreamMessage
+	for _, msg := range msgs {
+		if msg.Payload != nil && msg.Payload.Source == domain.DigestSource {
+			digests = append(digests, msg)
+		}
+	}
+	return digests
+}
+
+// notifyAt создает уведомление через сервис в момент at, как это делает API
+func notifyAt(t *testing.T, svc *service.NotificationService, fake *clock.Fake, at time.Time, target domain.Target, category string) string {
+	t.Helper()
+	fake.Set(at)
+	resp, err := svc.CreateNotifications(context.Background(), &domain.NotifyRequest{
+		Target:    []domain.Target{target},
+		Message:   "hello",
+		CreatedAt: at,
+		Source:    "billing",
+		Category:  category,
+	}, "")
+	if err != nil || len(resp.Results) != 1 || resp.Results[0].NotificationID == "" {
+		t.Fatalf("CreateNotifications = %+v, %v", resp, err)
+	}
+	return resp.Results[0].NotificationID
+}
+
+func TestDigestWorkerHourlyIncludesExpired(t *testing.T) {
+	ctx := context.Background()
+	repo, fake := newTestRepo()
+	svc := service.NewNotificationService(repo, testLogger())
+	alice := domain.Target{ID: 1, Login: "alice"}
+	bob := domain.Target{ID: 2, Login: "bob"}
+	start := testEpoch
+	if err := repo.SetDigestPreference(ctx, 1, "alice", domain.DigestPreference{
+		Mode: domain.DigestHourly, MarkDigested: true, LastDigestAt: &start,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// За час payload первых трех уведомлений истекает (NotificationTTL — 15 минут), четвертое еще живо
+	read := notifyAt(t, svc, fake, start.Add(time.Minute), alice, "invoice")
+	notifyAt(t, svc, fake, start.Add(10*time.Minute), alice, "invoice")
+	notifyAt(t, svc, fake, start.Add(40*time.Minute), alice, "refund")
+	live := notifyAt(t, svc, fake, start.Add(50*time.Minute), alice, "refund")
+	notifyAt(t, svc, fake, start.Add(20*time.Minute), bob, "invoice")
+
+	msgs, err := repo.RangeLastMessages(ctx, 1, "alice", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.Set(start.Add(5 * time.Minute))
+	if res, err := repo.AckMessage(ctx, 1, "alice", msgs[0].ID, read); err != nil || res != domain.AckResultAcked {
+		t.Fatalf("AckMessage = %s, %v", res, err)
+	}
+
+	fake.Set(start.Add(time.Hour + time.Minute))
+	if err := NewTTLJanitor(repo, testLogger()).WithClock(fake).RunOnce(ctx); err != nil {
+		t.Fatalf("TTL janitor: %v", err)
+	}
+	if _, _, err := repo.CompactReadStates(ctx, 1, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if n := streamLen(t, repo, alice); n != 1 {
+		t.Fatalf("после джанитора в стриме %d записей, ожидалась 1", n)
+	}
+
+	worker := NewDigestWorker(repo, svc, testLogger()).WithClock(fake)
+	if err := worker.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+
+	digests := digestsOf(t, repo, alice)
+	if len(digests) != 1 {
+		t.Fatalf("сводок %d, ожидалась 1", len(digests))
+	}
+	// Прочитанное до истечения уведомление в сводку не входит, истекшие непрочитанные — входят
+	want := "Непрочитанных уведомлений: 3\nbilling/invoice: 1\nbilling/refund: 2"
+	if got := digests[0].Payload.Message; got != want {
+		t.Fatalf("текст сводки %q, ожидался %q", got, want)
+	}
+	if statuses, err := repo.GetReadStatuses(ctx, 1, "alice", []string{live}); err != nil || !statuses[live] {
+		t.Fatalf("живое уведомление не помечено digested: %v, %v", statuses, err)
+	}
+	if got := digestsOf(t, repo, bob); len(got) != 0 {
+		t.Fatalf("сводка отправлена пользователю без настроек: %+v", got)
+	}
+	pref, err := repo.GetDigestPreference(ctx, 1, "alice")
+	if err != nil || pref.LastDigestAt == nil || !pref.LastDigestAt.Equal(fake.Now()) {
+		t.Fatalf("время сводки не сохранено: %+v, %v", pref, err)
+	}
+
+	// Следующий час без новых уведомлений: сама сводка в следующую не попадает
+	before := streamLen(t, repo, alice)
+	fake.Advance(time.Hour)
+	if err := worker.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if n := streamLen(t, repo, alice); n != before {
+		t.Fatalf("в стриме %d записей вместо %d: повторная сводка не ожидалась", n, before)
+	}
+}
+
+func TestDigestWorkerNotDue(t *testing.T) {
+	ctx := context.Background()
+	repo, fake := newTestRepo()
+	svc := service.NewNotificationService(repo, testLogger())
+	alice := domain.Target{ID: 1, Login: "alice"}
+	start := testEpoch
+	if err := repo.SetDigestPreference(ctx, 1, "alice", domain.DigestPreference{
+		Mode: domain.DigestHourly, LastDigestAt: &start,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	notifyAt(t, svc, fake, start.Add(10*time.Minute), alice, "")
+
+	fake.Set(start.Add(59 * time.Minute))
+	worker := NewDigestWorker(repo, svc, testLogger()).WithClock(fake)
+	if err := worker.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if got := digestsOf(t, repo, alice); len(got) != 0 {
+		t.Fatalf("сводка отправлена до наступления периода: %+v", got)
+	}
+
+	fake.Set(start.Add(time.Hour))
+	if err := worker.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if got := digestsOf(t, repo, alice); len(got) != 1 || got[0].Payload.Message != "Непрочитанных уведомлений: 1\nbilling: 1" {
+		t.Fatalf("неверные сводки: %+v", got)
+	}
+}
@@ -0,0 +1,182 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"notification-mvp/internal/domain"
+	"notification-mvp/internal/metrics"
+)
+
+// escalationBatch — эскалаций за одну итерацию
+const escalationBatch = 1000
+
+// EscalationWorker выполняет наступившие шаги эскалации непрочитанных уведомлений:
+// повторно отправляет уведомление получателю с повышенным приоритетом или уведомляет резервных получателей
+type EscalationWorker struct {
+	repo    domain.NotificationRepository
+	service domain.NotificationService
+	events  domain.ClientEventPublisher
+	logger  *slog.Logger
+	shard   KeyFilter // nil — обрабатываются все пользователи
+}
+
+func NewEscalationWorker(
+	repo domain.NotificationRepository,
+	service domain.NotificationService,
+	events domain.ClientEventPublisher,
+	logger *slog.Logger,
+) *EscalationWorker {
+	return &EscalationWorker{repo: repo, service: service, events: events, logger: logger}
+}
+
+// WithShard ограничивает обработку пользователями, принадлежащими этому pod
+func (w *EscalationWorker) WithShard(shard KeyFilter) *EscalationWorker {
+	w.shard = shard
+	return w
+}
+
+func (w *EscalationWorker) Name() string {
+	return "escalation"
+}
+
+func (w *EscalationWorker) RunOnce(ctx context.Context) error {
+	now := time.Now()
+	members, err := ownedDue(ctx, w.shard, escalationBatch, memberUserKey,
+		func(ctx context.Context, offset, limit int64) ([]string, error) {
+			return w.repo.GetDueEscalations(ctx, now, offset, limit)
+		})
+	if err != nil {
+		return fmt.Errorf("ошибка получения эскалаций: %w", err)
+	}
+
+	var failed int
+	for _, member := range members {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		userKey, nid, err := domain.ParseNotificationMember(member)
+		if err != nil {
+			w.logger.Warn("Ошибка парсинга эскалации", "member", member, "error", err)
+			continue
+		}
+		userID, login, err := domain.ParseUserKey(userKey)
+		if err != nil {
+			w.logger.Warn("Ошибка парсинга user key", "user_key", userKey, "error", err)
+			continue
+		}
+		if err := w.escalate(ctx, userID, login, nid); err != nil {
+			w.logger.Warn("Ошибка эскалации", "user", userKey, "notification_id", nid, "error", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("не удалось выполнить %d из %d шагов эскалации", failed, len(members))
+	}
+	return nil
+}
+
+// escalate выполняет следующий шаг эскалации уведомления, если оно все еще не прочитано
+func (w *EscalationWorker) escalate(ctx context.Context, userID int64, login, nid string) error {
+	esc, err := w.repo.GetEscalation(ctx, userID, login, nid)
+	if err != nil {
+		return err
+	}
+	if esc == nil || esc.Done() {
+		// Эскалация отменена, а member индекса остался — убираем его
+		return w.repo.CancelEscalation(ctx, userID, login, nid)
+	}
+
+	// Подтверждение прочтения отменяет эскалацию сразу, но статус проверяем и здесь:
+	// уведомление могло попасть в сводку (digested) или эскалация пережила сбой отмены
+	read, err := w.repo.GetReadStatuses(ctx, userID, login, []string{nid})
+	if err != nil {
+		return err
+	}
+	if read[nid] {
+		metrics.EscalationsCancelled.Inc()
+		return w.repo.CancelEscalation(ctx, userID, login, nid)
+	}
+
+	step := esc.Steps[esc.NextStep]
+	switch step.Action {
+	case domain.EscalationRepush:
+		err = w.repush(ctx, esc, step)
+	case domain.EscalationNotify:
+		err = w.notifyFallback(ctx, esc, step)
+	default:
+		err = fmt.Errorf("неизвестное действие эскалации: %s", step.Action)
+	}
+	if err != nil {
+		return err
+	}
+	metrics.EscalationSteps.WithLabelValues(string(step.Action)).Inc()
+	w.logger.Info("Выполнен шаг эскалации",
+		"notification_id", nid, "user_id", userID, "login", login,
+		"step", esc.NextStep, "action", step.Action, "priority", step.Priority)
+
+	esc.NextStep++
+	if _, err := w.repo.AdvanceEscalation(ctx, *esc); err != nil {
+		return err
+	}
+	return nil
+}
+
+// repush повторно отправляет уведомление в сессии получателя с приоритетом шага.
+// Клиент подтверждает его прежними notification_id и stream_id, что отменяет эскалацию
+func (w *EscalationWorker) repush(ctx context.Context, esc *domain.Escalation, step domain.EscalationStep) error {
+	if w.events == nil {
+		return fmt.Errorf("публикатор событий не настроен")
+	}
+	createdAt := esc.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = esc.ScheduledAt // эскалация сохранена до появления created_at
+	}
+	msg := domain.WebSocketMessage{
+		Type: domain.MessageTypeNotificationPush,
+		Data: domain.PushPayload{
+			NotificationID: esc.NotificationID,
+			StreamID:       esc.StreamID,
+			Message:        esc.Message,
+			CreatedAt:      createdAt,
+			Source:         esc.Source,
+			Category:       esc.Category,
+			Priority:       escalatedPriority(step.Priority),
+			Escalation:     esc.NextStep + 1,
+			Status:         domain.StatusUnread,
+		},
+	}
+	return w.events.PublishToUser(ctx, esc.Target.ID, esc.Target.Login, msg)
+}
+
+// notifyFallback создает уведомление резервным получателям обычным путем CreateNotifications
+func (w *EscalationWorker) notifyFallback(ctx context.Context, esc *domain.Escalation, step domain.EscalationStep) error {
+	req := &domain.NotifyRequest{
+		Target: step.Target,
+		Message: fmt.Sprintf("Не прочитано уведомление для %s (id %d): %s",
+			esc.Target.Login, esc.Target.ID, esc.Message),
+		CreatedAt: time.Now(),
+		Source:    esc.Source,
+		Category:  esc.Category,
+		Priority:  escalatedPriority(step.Priority),
+	}
+	// Ключ по уведомлению и шагу: повтор итерации после сбоя не уведомит резервных получателей дважды
+	key := "escalation:" + esc.NotificationID + ":" + strconv.Itoa(esc.NextStep)
+	if _, err := w.service.CreateNotifications(ctx, req, key); err != nil {
+		return fmt.Errorf("ошибка уведомления резервных получателей: %w", err)
+	}
+	return nil
+}
+
+// escalatedPriority возвращает приоритет шага; по умолчанию эскалация повышает приоритет до high
+func escalatedPriority(p string) string {
+	if p == "" || p == domain.PriorityNormal {
+		return domain.PriorityHigh
+	}
+	return p
+}
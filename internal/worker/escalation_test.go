@@ -0,0 +1,57 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"notification-mvp/internal/domain"
+	"notification-mvp/internal/service"
+)
+
+func TestEscalationRepushKeepsCreatedAt(t *testing.T) {
+	ctx := context.Background()
+	repo, fake := newTestRepo()
+	alice := domain.Target{ID: 1, Login: "alice"}
+	created := createNotification(t, repo, fake, alice)
+	msgs, _ := repo.RangeLastMessages(ctx, 1, "alice", 1)
+	nid := msgs[0].Payload.NotificationID
+
+	// Шаг наступил: эскалация запланирована в прошлом относительно часов воркера
+	scheduledAt := time.Now().Add(-10 * time.Minute)
+	if err := repo.ScheduleEscalation(ctx, domain.Escalation{
+		NotificationID: nid,
+		StreamID:       created.StreamID,
+		Target:         alice,
+		Message:        "hello",
+		Source:         "test",
+		CreatedAt:      testEpoch,
+		ScheduledAt:    scheduledAt,
+		Steps:          []domain.EscalationStep{{AfterMinutes: 5, Action: domain.EscalationRepush}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	events := &recordingPublisher{}
+	svc := service.NewNotificationService(repo, testLogger())
+	if err := NewEscalationWorker(repo, svc, events, testLogger()).RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+
+	pushed := events.published()
+	if len(pushed) != 1 {
+		t.Fatalf("отправлено %d сообщений, ожидалось 1", len(pushed))
+	}
+	push, ok := pushed[0].Data.(domain.PushPayload)
+	if !ok || push.NotificationID != nid || push.StreamID != created.StreamID || push.Escalation != 1 ||
+		push.Priority != domain.PriorityHigh {
+		t.Fatalf("неверный repush: %+v", pushed[0])
+	}
+	if !push.CreatedAt.Equal(testEpoch) {
+		t.Fatalf("repush с created_at %v, ожидалось время создания уведомления %v", push.CreatedAt, testEpoch)
+	}
+	// Последний шаг выполнен — эскалация завершена
+	if esc, err := repo.GetEscalation(ctx, 1, "alice", nid); err != nil || esc != nil {
+		t.Fatalf("эскалация не завершена: %+v, %v", esc, err)
+	}
+}
@@ -0,0 +1,149 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"notification-mvp/internal/domain"
+	"notification-mvp/internal/metrics"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// expiredEventsPattern — канал событий истечения ключей во всех базах
+const expiredEventsPattern = "__keyevent@*__:expired"
+
+// NotificationExpirer удаляет запись стрима уведомления, payload которого истек.
+// Возвращает stream_id удаленной записи; пустая строка — запись уже удалена
+type NotificationExpirer interface {
+	ExpireNotification(ctx context.Context, userID int64, login, notificationID string) (string, error)
+}
+
+// ExpiryListener подписывается на события истечения payload (notification:*) и сразу удаляет
+// запись стрима, отправляя живой сессии auto_cleared. Работает только в схеме ключей hashtag:
+// в исходной схеме имя payload не содержит получателя. TTLJanitor остается страховкой
+// на случай пропущенных событий (Pub/Sub не гарантирует доставку)
+type ExpiryListener struct {
+	repo    NotificationExpirer
+	rdb     redis.UniversalClient
+	events  domain.ClientEventPublisher
+	logger  *slog.Logger
+	archive domain.ArchiveSink // nil — архив не настроен
+}
+
+// NewExpiryListener создает слушателя событий истечения
+func NewExpiryListener(
+	repo NotificationExpirer,
+	rdb redis.UniversalClient,
+	events domain.ClientEventPublisher,
+	logger *slog.Logger,
+) *ExpiryListener {
+	return &ExpiryListener{repo: repo, rdb: rdb, events: events, logger: logger}
+}
+
+// WithArchive записывает удаление истекших уведомлений в долговременный архив
+func (l *ExpiryListener) WithArchive(archive domain.ArchiveSink) *ExpiryListener {
+	l.archive = archive
+	return l
+}
+
+// Start подписывается на события истечения. В Redis Cluster события публикуются локально на узле,
+// поэтому подписка ставится на каждый master, известный на момент запуска
+func (l *ExpiryListener) Start(ctx context.Context) {
+	l.checkConfig(ctx)
+
+	if cluster, ok := l.rdb.(*redis.ClusterClient); ok {
+		err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			l.listen(ctx, node)
+			return nil
+		})
+		if err != nil && ctx.Err() == nil {
+			l.logger.Error("Ошибка подписки на события истечения", "error", err)
+		}
+		return
+	}
+	l.listen(ctx, l.rdb)
+}
+
+// checkConfig предупреждает, если Redis не публикует события истечения (notify-keyspace-events без E и x)
+func (l *ExpiryListener) checkConfig(ctx context.Context) {
+	cfg, err := l.rdb.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		l.logger.Warn("Не удалось проверить notify-keyspace-events", "error", err)
+		return
+	}
+	flags := cfg["notify-keyspace-events"]
+	if !strings.Contains(flags, "E") || !(strings.Contains(flags, "x") || strings.Contains(flags, "A")) {
+		l.logger.Warn("Redis не публикует события истечения ключей: задайте notify-keyspace-events Ex",
+			"current", flags)
+	}
+}
+
+func (l *ExpiryListener) listen(ctx context.Context, client redis.UniversalClient) {
+	pubsub := client.PSubscribe(ctx, expiredEventsPattern)
+	defer func() { _ = pubsub.Close() }()
+
+	l.logger.Info("Слушатель событий истечения запущен")
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			l.logger.Info("Слушатель событий истечения остановлен")
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			l.handleExpired(ctx, msg.Payload)
+		}
+	}
+}
+
+// handleExpired удаляет запись стрима истекшего уведомления и уведомляет сессию пользователя.
+// Событие получают все pod, но запись удаляет и публикует auto_cleared только первый
+func (l *ExpiryListener) handleExpired(ctx context.Context, key string) {
+	userKey, notificationID, ok := domain.ParseNotificationKey(key)
+	if !ok {
+		return
+	}
+	userID, login, err := domain.ParseUserKey(userKey)
+	if err != nil {
+		l.logger.Warn("Ошибка парсинга user key", "user_key", userKey, "error", err)
+		return
+	}
+
+	streamID, err := l.repo.ExpireNotification(ctx, userID, login, notificationID)
+	if err != nil {
+		l.logger.Warn("Ошибка обработки истекшего уведомления",
+			"user_id", userID, "login", login, "notification_id", notificationID, "error", err)
+		return
+	}
+	if streamID == "" {
+		return
+	}
+	metrics.ExpiredByEvent.Inc()
+	if l.archive != nil {
+		l.archive.Record(domain.ArchiveEvent{
+			Type:           domain.ArchiveEventAutoCleared,
+			NotificationID: notificationID,
+			StreamID:       streamID,
+			Target:         domain.Target{ID: userID, Login: login},
+			OccurredAt:     time.Now(),
+		})
+	}
+
+	msg := domain.WebSocketMessage{
+		Type: domain.MessageTypeNotificationPush,
+		Data: domain.PushPayload{
+			NotificationID: notificationID,
+			StreamID:       streamID,
+			Status:         domain.StatusAutoCleared,
+			Read:           true,
+		},
+	}
+	if err := l.events.PublishToUser(ctx, userID, login, msg); err != nil {
+		l.logger.Warn("Ошибка отправки auto_cleared", "user_id", userID, "login", login, "error", err)
+	}
+}
@@ -0,0 +1,149 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"notification-mvp/internal/clock"
+	"notification-mvp/internal/domain"
+	"notification-mvp/internal/repository"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// recordingPublisher запоминает служебные события, отправленные пользователям
+type recordingPublisher struct {
+	mu   sync.Mutex
+	msgs []domain.WebSocketMessage
+}
+
+func (p *recordingPublisher) PublishToUser(_ context.Context, _ int64, _ string, msg domain.WebSocketMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.msgs = append(p.msgs, msg)
+	return nil
+}
+
+func (p *recordingPublisher) published() []domain.WebSocketMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]domain.WebSocketMessage(nil), p.msgs...)
+}
+
+// createExpiredRedisNotification создает уведомление в Redis и переводит его в истекшее:
+// payload удаляется по TTL, а запись планировщика считается наступившей
+func createExpiredRedisNotification(t *testing.T, mr *miniredis.Miniredis, rdb redis.UniversalClient, repo *repository.RedisRepository, target domain.Target) (string, string) {
+	t.Helper()
+	ctx := context.Background()
+	payload := &domain.NotificationPayload{Message: "hello", CreatedAt: time.Now(), Source: "test"}
+	created, err := repo.CreateNotification(ctx, payload, target, domain.StreamLimit{})
+	if err != nil {
+		t.Fatalf("CreateNotification: %v", err)
+	}
+	nid := payload.NotificationID
+	rdb.ZAddXX(ctx, domain.TTLSchedulerKey(target.ID, target.Login),
+		redis.Z{Score: 1, Member: domain.TTLSchedulerEntry(created.StreamID, nid)})
+	mr.FastForward(domain.NotificationTTL)
+	if mr.Exists(domain.NotificationKey(target.ID, target.Login, nid)) {
+		t.Fatal("payload не истек")
+	}
+	return created.StreamID, nid
+}
+
+// useKeyLayout переключает схему ключей на время теста
+func useKeyLayout(t *testing.T, layout domain.KeyLayout) {
+	prev := domain.CurrentKeyLayout()
+	domain.SetKeyLayout(layout)
+	t.Cleanup(func() { domain.SetKeyLayout(prev) })
+}
+
+func TestExpiryListenerHandlesExpiredEvent(t *testing.T) {
+	useKeyLayout(t, domain.KeyLayoutHashTag)
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	repo := repository.NewRedisRepository(rdb)
+	alice := domain.Target{ID: 1, Login: "alice"}
+	streamID, nid := createExpiredRedisNotification(t, mr, rdb, repo, alice)
+
+	events := &recordingPublisher{}
+	sink := &recordingSink{}
+	listener := NewExpiryListener(repo, rdb, events, testLogger()).WithArchive(sink)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		listener.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	eventually(t, "подписка на события истечения", func() bool {
+		n, _ := rdb.PubSubNumPat(ctx).Result()
+		return n == 1
+	})
+
+	// События чужих ключей и payload исходной схемы (без получателя) пропускаются.
+	// miniredis не публикует keyspace-события сам, поэтому событие отправляется как от Redis
+	channel := "__keyevent@0__:expired"
+	mr.Publish(channel, domain.StreamKey(1, "alice"))
+	mr.Publish(channel, domain.NotificationKeyPrefix+nid)
+	mr.Publish(channel, domain.NotificationKey(1, "alice", nid))
+	eventually(t, "auto_cleared в сессию пользователя", func() bool { return len(events.published()) > 0 })
+
+	msgs := events.published()
+	push, ok := msgs[0].Data.(domain.PushPayload)
+	if len(msgs) != 1 || !ok || push.NotificationID != nid || push.StreamID != streamID ||
+		push.Status != domain.StatusAutoCleared || !push.Read {
+		t.Fatalf("неверное событие для сессии: %+v", msgs)
+	}
+	if n := rdb.XLen(ctx, domain.StreamKey(1, "alice")).Val(); n != 0 {
+		t.Fatalf("запись истекшего уведомления осталась в стриме: %d", n)
+	}
+	if recorded := sink.recorded(); len(recorded) != 1 || recorded[0].Type != domain.ArchiveEventAutoCleared ||
+		recorded[0].NotificationID != nid || recorded[0].StreamID != streamID {
+		t.Fatalf("неверные события архива: %+v", recorded)
+	}
+
+	// Повторное событие (его получает каждый pod) запись уже не находит и ничего не отправляет
+	mr.Publish(channel, domain.NotificationKey(1, "alice", nid))
+	time.Sleep(50 * time.Millisecond)
+	if n := len(events.published()); n != 1 {
+		t.Fatalf("повторное событие отправлено в сессию: %d сообщений", n)
+	}
+}
+
+func TestTTLJanitorWithoutExpiryEvents(t *testing.T) {
+	// Без EXPIRY_EVENTS (или в исходной схеме ключей) слушатель не запускается,
+	// и истекшие записи удаляет TTL джанитор
+	for name, layout := range map[string]domain.KeyLayout{"legacy": domain.KeyLayoutLegacy, "hashtag": domain.KeyLayoutHashTag} {
+		t.Run(name, func(t *testing.T) {
+			useKeyLayout(t, layout)
+			mr := miniredis.RunT(t)
+			rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			t.Cleanup(func() { _ = rdb.Close() })
+			repo := repository.NewRedisRepository(rdb)
+			alice := domain.Target{ID: 1, Login: "alice"}
+			_, nid := createExpiredRedisNotification(t, mr, rdb, repo, alice)
+
+			sink := &recordingSink{}
+			janitor := NewTTLJanitor(repo, testLogger()).
+				WithClock(clock.NewFake(time.Now().Add(domain.NotificationTTL + time.Second))).
+				WithArchive(sink)
+			if err := janitor.RunOnce(context.Background()); err != nil {
+				t.Fatalf("RunOnce: %v", err)
+			}
+			if n := rdb.XLen(context.Background(), domain.StreamKey(1, "alice")).Val(); n != 0 {
+				t.Fatalf("джанитор не удалил истекшую запись: %d", n)
+			}
+			if recorded := sink.recorded(); len(recorded) != 1 || recorded[0].Type != domain.ArchiveEventExpired ||
+				recorded[0].NotificationID != nid {
+				t.Fatalf("неверные события архива: %+v", recorded)
+			}
+		})
+	}
+}
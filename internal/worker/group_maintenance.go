@@ -4,10 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"strconv"
-	"strings"
 	"time"
 
+	"notification-mvp/internal/clock"
 	"notification-mvp/internal/domain"
 )
 
@@ -15,6 +14,8 @@ import (
 type GroupMaintenance struct {
 	repo   domain.NotificationRepository
 	logger *slog.Logger
+	shard  KeyFilter // nil — обрабатываются все пользователи
+	clock  clock.Clock
 }
 
 // NewGroupMaintenance создает новый экземпляр GroupMaintenance
@@ -22,50 +23,50 @@ func NewGroupMaintenance(repo domain.NotificationRepository, logger *slog.Logger
 	return &GroupMaintenance{
 		repo:   repo,
 		logger: logger,
+		clock:  clock.System{},
 	}
 }
 
-// Start запускает воркер обслуживания групп
-func (gm *GroupMaintenance) Start(ctx context.Context) {
-	ticker := time.NewTicker(2 * time.Minute) // Каждые 2 минуты проверяем зависшие сообщения
-	defer ticker.Stop()
+// WithShard ограничивает обработку пользователями, принадлежащими этому pod
+func (gm *GroupMaintenance) WithShard(shard KeyFilter) *GroupMaintenance {
+	gm.shard = shard
+	return gm
+}
 
-	gm.logger.Info("Group maintenance воркер запущен")
+// WithClock задает источник времени для выборки пользователей (подменяется в тестах)
+func (gm *GroupMaintenance) WithClock(clock clock.Clock) *GroupMaintenance {
+	gm.clock = clock
+	return gm
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			gm.logger.Info("Group maintenance воркер остановлен")
-			return
-		case <-ticker.C:
-			gm.reclaimPendingMessages(ctx)
-		}
-	}
+// Name возвращает имя воркера для Runtime
+func (gm *GroupMaintenance) Name() string {
+	return "group_maintenance"
 }
 
-// reclaimPendingMessages перехватывает зависшие сообщения для всех пользователей
-func (gm *GroupMaintenance) reclaimPendingMessages(ctx context.Context) {
-	start := time.Now()
+// RunOnce перехватывает зависшие сообщения для всех пользователей
+func (gm *GroupMaintenance) RunOnce(ctx context.Context) error {
+	start := gm.clock.Now()
 
-	// Получаем все пользовательские ключи
-	userKeys, err := gm.repo.GetAllUserKeys(ctx)
+	// Зависшие сообщения бывают только у пользователей, активных в пределах окна TTL
+	userKeys, err := gm.repo.GetActiveUserKeys(ctx, start.Add(-domain.PendingActivityWindow), 0, 0)
 	if err != nil {
-		gm.logger.Error("Ошибка получения пользовательских ключей", "error", err)
-		return
+		return fmt.Errorf("ошибка получения пользовательских ключей: %w", err)
 	}
+	userKeys = ownedKeys(gm.shard, userKeys)
 
 	if len(userKeys) == 0 {
 		gm.logger.Debug("Нет пользователей для обслуживания групп")
-		return
+		return nil
 	}
 
 	var totalReclaimed int
-	var processedUsers int
+	var processedUsers, failedUsers int
 
 	// Обрабатываем каждого пользователя
 	for _, userKey := range userKeys {
 		// Парсим userKey для получения ID и логина
-		userID, login, err := gm.parseUserKey(userKey)
+		userID, login, err := domain.ParseUserKey(userKey)
 		if err != nil {
 			gm.logger.Warn("Ошибка парсинга user key", "user_key", userKey, "error", err)
 			continue
@@ -78,6 +79,7 @@ func (gm *GroupMaintenance) reclaimPendingMessages(ctx context.Context) {
 				"user_id", userID,
 				"login", login,
 				"error", err)
+			failedUsers++
 			continue
 		}
 
@@ -98,12 +100,12 @@ func (gm *GroupMaintenance) reclaimPendingMessages(ctx context.Context) {
 		// Небольшая пауза между пользователями
 		select {
 		case <-ctx.Done():
-			return
+			return ctx.Err()
 		case <-time.After(10 * time.Millisecond):
 		}
 	}
 
-	duration := time.Since(start)
+	duration := gm.clock.Now().Sub(start)
 
 	if totalReclaimed > 0 || len(userKeys) > 10 {
 		gm.logger.Info("Завершено обслуживание групп",
@@ -118,19 +120,9 @@ func (gm *GroupMaintenance) reclaimPendingMessages(ctx context.Context) {
 			"total_users", len(userKeys),
 			"duration", duration)
 	}
-}
 
-// parseUserKey парсит user key в формате "id-login"
-func (gm *GroupMaintenance) parseUserKey(userKey string) (int64, string, error) {
-	parts := strings.SplitN(userKey, "-", 2)
-	if len(parts) != 2 {
-		return 0, "", fmt.Errorf("неверный формат user key: %s", userKey)
+	if failedUsers > 0 {
+		return fmt.Errorf("не удалось обслужить группы %d из %d пользователей", failedUsers, len(userKeys))
 	}
-
-	userID, err := strconv.ParseInt(parts[0], 10, 64)
-	if err != nil {
-		return 0, "", fmt.Errorf("ошибка парсинга user ID: %w", err)
-	}
-
-	return userID, parts[1], nil
+	return nil
 }
@@ -2,70 +2,91 @@ package worker
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"strconv"
 	"time"
 
+	"notification-mvp/internal/domain"
+	"notification-mvp/internal/metrics"
+
 	"github.com/redis/go-redis/v9"
 )
 
+// podsHeartbeatKey — реестр heartbeat pod: pod_id -> unix сек последнего пульса
+const podsHeartbeatKey = "notif:pods:hb"
+
+// podStaleAfter — через сколько без пульса pod считается выбывшим
+const podStaleAfter = 90 * time.Second
+
+// SessionTakeover освобождает consumer lock и pending сообщения выбывшего pod
+type SessionTakeover interface {
+	TakeOverPodSessions(ctx context.Context, podID string) (*domain.PodTakeover, error)
+}
+
 // HeartbeatWorker periodically updates pod heartbeat and cleans stale entries.
 type HeartbeatWorker struct {
-	rdb              *redis.Client
+	rdb              redis.UniversalClient
 	podID            string
 	logger           *slog.Logger
-	tickInterval     time.Duration
 	staleAfter       time.Duration
 	podsHeartbeatKey string
+	takeover         SessionTakeover // nil — сессии выбывших pod освобождаются по TTL lock
 }
 
-func NewHeartbeatWorker(rdb *redis.Client, podID string, logger *slog.Logger) *HeartbeatWorker {
+func NewHeartbeatWorker(rdb redis.UniversalClient, podID string, logger *slog.Logger) *HeartbeatWorker {
 	return &HeartbeatWorker{
 		rdb:              rdb,
 		podID:            podID,
 		logger:           logger,
-		tickInterval:     30 * time.Second,
-		staleAfter:       90 * time.Second,
-		podsHeartbeatKey: "notif:pods:hb",
+		staleAfter:       podStaleAfter,
+		podsHeartbeatKey: podsHeartbeatKey,
 	}
 }
 
-func (w *HeartbeatWorker) Start(ctx context.Context) {
-	ticker := time.NewTicker(w.tickInterval)
-	defer ticker.Stop()
+// WithStaleAfter задает, через сколько без пульса pod считается выбывшим
+func (w *HeartbeatWorker) WithStaleAfter(d time.Duration) *HeartbeatWorker {
+	if d > 0 {
+		w.staleAfter = d
+	}
+	return w
+}
 
-	w.logger.Info("Heartbeat воркер запущен", "pod", w.podID)
+// WithTakeover включает освобождение сессий выбывших pod
+func (w *HeartbeatWorker) WithTakeover(takeover SessionTakeover) *HeartbeatWorker {
+	w.takeover = takeover
+	return w
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			w.logger.Info("Heartbeat воркер остановлен")
-			return
-		case <-ticker.C:
-			w.beat(ctx)
-			w.cleanupStale(ctx)
-		}
+func (w *HeartbeatWorker) Name() string {
+	return "heartbeat"
+}
+
+// RunOnce обновляет пульс pod и удаляет записи выбывших pod
+func (w *HeartbeatWorker) RunOnce(ctx context.Context) error {
+	if err := w.beat(ctx); err != nil {
+		return err
 	}
+	return w.cleanupStale(ctx)
 }
 
-func (w *HeartbeatWorker) beat(ctx context.Context) {
+func (w *HeartbeatWorker) beat(ctx context.Context) error {
 	now := time.Now().Unix()
 	if err := w.rdb.HSet(ctx, w.podsHeartbeatKey, w.podID, strconv.FormatInt(now, 10)).Err(); err != nil {
-		w.logger.Warn("Ошибка heartbeat", "error", err)
-		return
+		return fmt.Errorf("ошибка heartbeat: %w", err)
 	}
 	w.logger.Debug("Heartbeat", "pod", w.podID, "ts", now)
+	return nil
 }
 
-func (w *HeartbeatWorker) cleanupStale(ctx context.Context) {
+func (w *HeartbeatWorker) cleanupStale(ctx context.Context) error {
 	entries, err := w.rdb.HGetAll(ctx, w.podsHeartbeatKey).Result()
 	if err != nil {
-		w.logger.Warn("Ошибка чтения heartbeat реестра", "error", err)
-		return
+		return fmt.Errorf("ошибка чтения heartbeat реестра: %w", err)
 	}
 
 	if len(entries) == 0 {
-		return
+		return nil
 	}
 
 	cutoff := time.Now().Add(-w.staleAfter).Unix()
@@ -82,13 +103,84 @@ func (w *HeartbeatWorker) cleanupStale(ctx context.Context) {
 		}
 	}
 
-	if len(stalePods) == 0 {
-		return
+	if len(stalePods) > 0 {
+		if err := w.rdb.HDel(ctx, w.podsHeartbeatKey, stalePods...).Err(); err != nil {
+			return fmt.Errorf("ошибка удаления протухших podов %v: %w", stalePods, err)
+		}
+		w.logger.Info("Очищены протухшие pod записи", "count", len(stalePods))
+		for _, pod := range stalePods {
+			delete(entries, pod)
+		}
+	}
+
+	return w.releaseDeadPods(ctx, entries, stalePods)
+}
+
+// beatsNow перечитывает пульс pod непосредственно перед освобождением его ресурсов
+func (w *HeartbeatWorker) beatsNow(ctx context.Context, pod string) (bool, error) {
+	tsStr, err := w.rdb.HGet(ctx, w.podsHeartbeatKey, pod).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("ошибка чтения пульса pod %s: %w", pod, err)
+	}
+	ts, err := strconv.ParseInt(tsStr, 10, 64)
+	return err == nil && ts >= time.Now().Add(-w.staleAfter).Unix(), nil
+}
+
+// releaseDeadPods освобождает ресурсы pod, которых нет в реестре heartbeat: только что выбывших
+// и тех, чей стрим шины остался после предыдущих сбоев. Сессии pod передаются другим pod,
+// стрим шины удаляется — сообщения в нем адресованы сессиям, которых больше не существует.
+// Все шаги идемпотентны, поэтому несколько pod могут выполнять их одновременно
+func (w *HeartbeatWorker) releaseDeadPods(ctx context.Context, alive map[string]string, stalePods []string) error {
+	busPods, err := w.rdb.SMembers(ctx, busPodsKey).Result()
+	if err != nil {
+		return fmt.Errorf("ошибка чтения реестра стримов шины: %w", err)
 	}
 
-	if err := w.rdb.HDel(ctx, w.podsHeartbeatKey, stalePods...).Err(); err != nil {
-		w.logger.Warn("Ошибка удаления протухших podов", "error", err, "pods", stalePods)
-		return
+	dead := make(map[string]struct{}, len(stalePods))
+	for _, pod := range append(stalePods, busPods...) {
+		if _, ok := alive[pod]; ok || pod == w.podID {
+			continue
+		}
+		dead[pod] = struct{}{}
+	}
+
+	for pod := range dead {
+		// Pod мог запуститься или вернуться после чтения реестра: его lock и стрим шины снова нужны
+		if alive, err := w.beatsNow(ctx, pod); err != nil {
+			return err
+		} else if alive {
+			continue
+		}
+
+		if w.takeover != nil {
+			report, err := w.takeover.TakeOverPodSessions(ctx, pod)
+			if err != nil {
+				// Стрим шины оставляем в реестре, чтобы повторить передачу на следующем цикле
+				return fmt.Errorf("ошибка передачи сессий pod %s: %w", pod, err)
+			}
+			if report.Users > 0 {
+				metrics.PodTakeovers.Inc()
+				metrics.PodTakeoverLocks.Add(float64(report.LocksReleased))
+				w.logger.Info("Сессии выбывшего pod переданы",
+					"pod", pod,
+					"users", report.Users,
+					"locks_released", report.LocksReleased)
+			}
+		}
+
+		stream := busStreamPrefix + pod
+		dropped, _ := w.rdb.XLen(ctx, stream).Result()
+		if err := w.rdb.Del(ctx, stream).Err(); err != nil {
+			return fmt.Errorf("ошибка удаления стрима шины %s: %w", stream, err)
+		}
+		if err := w.rdb.SRem(ctx, busPodsKey, pod).Err(); err != nil {
+			return fmt.Errorf("ошибка удаления pod %s из реестра стримов шины: %w", pod, err)
+		}
+		metrics.BusStreamsRemoved.Inc()
+		w.logger.Info("Удален стрим шины выбывшего pod", "pod", pod, "dropped", dropped)
 	}
-	w.logger.Info("Очищены протухшие pod записи", "count", len(stalePods))
+	return nil
 }
@@ -0,0 +1,60 @@
+package worker
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"notification-mvp/internal/domain"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// recordingTakeover запоминает pod, сессии которых передавались
+type recordingTakeover struct{ pods []string }
+
+func (r *recordingTakeover) TakeOverPodSessions(_ context.Context, podID string) (*domain.PodTakeover, error) {
+	r.pods = append(r.pods, podID)
+	return &domain.PodTakeover{Pod: podID}, nil
+}
+
+func TestHeartbeatReleasesOnlyDeadPods(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	ctx := context.Background()
+
+	now := time.Now()
+	rdb.HSet(ctx, podsHeartbeatKey,
+		"pod-self", strconv.FormatInt(now.Unix(), 10),
+		"pod-dead", strconv.FormatInt(now.Add(-time.Hour).Unix(), 10))
+	for _, pod := range []string{"pod-dead", "pod-late"} {
+		rdb.SAdd(ctx, busPodsKey, pod)
+		rdb.XAdd(ctx, &redis.XAddArgs{Stream: busStreamPrefix + pod, Values: map[string]interface{}{"payload": "{}"}})
+	}
+
+	takeover := &recordingTakeover{}
+	w := NewHeartbeatWorker(rdb, "pod-self", testLogger()).WithTakeover(takeover)
+
+	// pod-late зарегистрировал стрим шины раньше первого пульса: к освобождению он уже жив
+	alive := map[string]string{"pod-self": ""}
+	rdb.HSet(ctx, podsHeartbeatKey, "pod-late", strconv.FormatInt(now.Unix(), 10))
+	if err := w.releaseDeadPods(ctx, alive, []string{"pod-dead"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(takeover.pods) != 1 || takeover.pods[0] != "pod-dead" {
+		t.Fatalf("сессии переданы у %v, ожидался только pod-dead", takeover.pods)
+	}
+	if n, _ := rdb.Exists(ctx, busStreamPrefix+"pod-dead").Result(); n != 0 {
+		t.Fatal("стрим шины выбывшего pod не удален")
+	}
+	if n, _ := rdb.Exists(ctx, busStreamPrefix+"pod-late").Result(); n != 1 {
+		t.Fatal("удален стрим шины живого pod")
+	}
+	if member, _ := rdb.SIsMember(ctx, busPodsKey, "pod-late").Result(); !member {
+		t.Fatal("живой pod удален из реестра стримов шины")
+	}
+}
@@ -0,0 +1,190 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"notification-mvp/internal/domain"
+	"notification-mvp/internal/metrics"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// leaderKeyPrefix — префикс лиза singleton-воркера: notif:leader:<worker>
+const leaderKeyPrefix = "notif:leader:"
+
+// renewLeaseScript продлевает лиз, только если он принадлежит pod. ARGV: pod, ttl (мс)
+var renewLeaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseLeaseScript снимает лиз, только если он принадлежит pod. ARGV: pod
+var releaseLeaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// LeaderElection запускает singleton-воркеры ровно на одном pod через лизы в Redis.
+// Лидер продлевает лиз каждые leaseTTL/3; при потере лиза или недоступности Redis дольше
+// leaseTTL воркер останавливается, а при штатной остановке лиз снимается сразу
+type LeaderElection struct {
+	rdb      redis.UniversalClient // nil — одиночный pod (хранилище в памяти), выборы не нужны
+	podID    string
+	logger   *slog.Logger
+	leaseTTL time.Duration
+
+	mu      sync.Mutex
+	workers map[string]bool
+}
+
+// NewLeaderElection создает выборы лидера. rdb == nil — все воркеры запускаются на этом pod
+func NewLeaderElection(rdb redis.UniversalClient, podID string, logger *slog.Logger, leaseTTL time.Duration) *LeaderElection {
+	if leaseTTL <= 0 {
+		leaseTTL = 15 * time.Second
+	}
+	return &LeaderElection{
+		rdb:      rdb,
+		podID:    podID,
+		logger:   logger,
+		leaseTTL: leaseTTL,
+		workers:  make(map[string]bool),
+	}
+}
+
+// Run выполняет fn, пока pod удерживает лиз воркера name, и снова участвует в выборах
+// после потери лиза. Блокируется до отмены ctx
+func (e *LeaderElection) Run(ctx context.Context, name string, fn func(ctx context.Context)) {
+	e.mu.Lock()
+	e.workers[name] = true
+	e.mu.Unlock()
+
+	if e.rdb == nil {
+		metrics.WorkerLeader.WithLabelValues(name).Set(1)
+		fn(ctx)
+		metrics.WorkerLeader.WithLabelValues(name).Set(0)
+		return
+	}
+
+	key := leaderKeyPrefix + name
+	retry := time.NewTicker(e.leaseTTL / 3)
+	defer retry.Stop()
+
+	for {
+		acquired, err := e.rdb.SetNX(ctx, key, e.podID, e.leaseTTL).Result()
+		if err != nil && ctx.Err() == nil {
+			e.logger.Warn("Ошибка захвата лиза воркера", "worker", name, "error", err)
+		}
+		if acquired {
+			e.lead(ctx, name, key, fn)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-retry.C:
+		}
+	}
+}
+
+// lead выполняет fn и продлевает лиз; при потере лиза или отмене ctx останавливает fn и ждет завершения
+func (e *LeaderElection) lead(ctx context.Context, name, key string, fn func(ctx context.Context)) {
+	metrics.WorkerLeader.WithLabelValues(name).Set(1)
+	metrics.LeaderAcquired.WithLabelValues(name).Inc()
+	e.logger.Info("Pod стал лидером воркера", "worker", name, "pod", e.podID)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(runCtx)
+	}()
+
+	renew := time.NewTicker(e.leaseTTL / 3)
+	defer renew.Stop()
+	renewedAt := time.Now()
+
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-done:
+			break loop
+		case <-renew.C:
+			ok, err := renewLeaseScript.Run(ctx, e.rdb, []string{key}, e.podID, e.leaseTTL.Milliseconds()).Int()
+			if err != nil {
+				if time.Since(renewedAt) < e.leaseTTL {
+					e.logger.Warn("Ошибка продления лиза воркера", "worker", name, "error", err)
+					continue
+				}
+				// Лиз мог истечь и достаться другому pod — останавливаемся
+				e.logger.Warn("Лиз воркера не продлевался дольше TTL", "worker", name, "error", err)
+				break loop
+			}
+			if ok == 0 {
+				e.logger.Warn("Лиз воркера перехвачен другим pod", "worker", name)
+				break loop
+			}
+			renewedAt = time.Now()
+		}
+	}
+
+	cancel()
+	<-done
+	metrics.WorkerLeader.WithLabelValues(name).Set(0)
+
+	// Снимаем лиз, чтобы другой pod подхватил воркер без ожидания TTL
+	releaseCtx, releaseCancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer releaseCancel()
+	if err := releaseLeaseScript.Run(releaseCtx, e.rdb, []string{key}, e.podID).Err(); err != nil {
+		e.logger.Warn("Ошибка снятия лиза воркера", "worker", name, "error", err)
+	}
+	e.logger.Info("Pod больше не лидер воркера", "worker", name, "pod", e.podID)
+}
+
+// Leaders возвращает текущих владельцев лизов зарегистрированных воркеров
+func (e *LeaderElection) Leaders(ctx context.Context) ([]domain.LeaderInfo, error) {
+	e.mu.Lock()
+	names := make([]string, 0, len(e.workers))
+	for name := range e.workers {
+		names = append(names, name)
+	}
+	e.mu.Unlock()
+	sort.Strings(names)
+
+	leaders := make([]domain.LeaderInfo, 0, len(names))
+	if e.rdb == nil {
+		for _, name := range names {
+			leaders = append(leaders, domain.LeaderInfo{Worker: name, PodID: e.podID})
+		}
+		return leaders, nil
+	}
+
+	pipe := e.rdb.Pipeline()
+	owners := make([]*redis.StringCmd, len(names))
+	ttls := make([]*redis.DurationCmd, len(names))
+	for i, name := range names {
+		owners[i] = pipe.Get(ctx, leaderKeyPrefix+name)
+		ttls[i] = pipe.PTTL(ctx, leaderKeyPrefix+name)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	for i, name := range names {
+		info := domain.LeaderInfo{Worker: name, PodID: owners[i].Val()}
+		if ttl := ttls[i].Val(); ttl > 0 {
+			info.LeaseExpiresIn = ttl.Milliseconds()
+		}
+		leaders = append(leaders, info)
+	}
+	return leaders, nil
+}
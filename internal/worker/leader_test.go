@@ -0,0 +1,150 @@
+package worker
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// testLeaseTTL — короткий лиз: продление и повторные попытки каждые 30мс
+const testLeaseTTL = 90 * time.Millisecond
+
+// leaderPod — участник выборов, который отмечает начало и конец своего лидерства
+type leaderPod struct {
+	election *LeaderElection
+	leading  atomic.Bool
+	started  chan struct{}
+	stopped  chan struct{}
+	done     chan struct{}
+	cancel   context.CancelFunc
+}
+
+// startLeaderPod запускает выборы воркера "singleton" для pod со своим подключением к Redis
+func startLeaderPod(t *testing.T, mr *miniredis.Miniredis, podID string) (*leaderPod, redis.UniversalClient) {
+	t.Helper()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &leaderPod{
+		election: NewLeaderElection(rdb, podID, testLogger(), testLeaseTTL),
+		started:  make(chan struct{}),
+		stopped:  make(chan struct{}),
+		done:     make(chan struct{}),
+		cancel:   cancel,
+	}
+	go func() {
+		defer close(p.done)
+		p.election.Run(ctx, "singleton", func(ctx context.Context) {
+			p.leading.Store(true)
+			close(p.started)
+			<-ctx.Done()
+			p.leading.Store(false)
+			close(p.stopped)
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-p.done
+	})
+	return p, rdb
+}
+
+// waitClosed ждет закрытия канала
+func waitClosed(t *testing.T, what string, ch <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("не дождались: %s", what)
+	}
+}
+
+func TestLeaderElectionAcquireAndRenew(t *testing.T) {
+	mr := miniredis.RunT(t)
+	pod, _ := startLeaderPod(t, mr, "pod-a")
+	key := leaderKeyPrefix + "singleton"
+
+	waitClosed(t, "захват лиза", pod.started)
+	if owner, _ := mr.Get(key); owner != "pod-a" {
+		t.Fatalf("владелец лиза %q, ожидался pod-a", owner)
+	}
+	leaders, err := pod.election.Leaders(context.Background())
+	if err != nil || len(leaders) != 1 || leaders[0].PodID != "pod-a" || leaders[0].LeaseExpiresIn <= 0 {
+		t.Fatalf("Leaders = %+v, %v", leaders, err)
+	}
+
+	// Без продления лиз истек бы: miniredis сдвигает время только явно
+	mr.FastForward(testLeaseTTL * 2 / 3)
+	eventually(t, "продление лиза", func() bool { return mr.TTL(key) > testLeaseTTL/2 })
+	if !pod.leading.Load() {
+		t.Fatal("лидер остановлен при успешном продлении")
+	}
+
+	// Штатная остановка снимает лиз сразу
+	pod.cancel()
+	waitClosed(t, "остановка воркера", pod.stopped)
+	waitClosed(t, "выход из выборов", pod.done)
+	if mr.Exists(key) {
+		t.Fatal("лиз не снят при остановке")
+	}
+}
+
+func TestLeaderElectionHandover(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a, _ := startLeaderPod(t, mr, "pod-a")
+	waitClosed(t, "лидерство pod-a", a.started)
+	b, _ := startLeaderPod(t, mr, "pod-b")
+
+	time.Sleep(2 * testLeaseTTL)
+	if b.leading.Load() {
+		t.Fatal("второй pod стал лидером при живом лизе")
+	}
+
+	a.cancel()
+	waitClosed(t, "лидерство pod-b после остановки pod-a", b.started)
+	if owner, _ := mr.Get(leaderKeyPrefix + "singleton"); owner != "pod-b" {
+		t.Fatalf("владелец лиза %q, ожидался pod-b", owner)
+	}
+}
+
+func TestLeaderElectionFailoverOnLeaseExpiry(t *testing.T) {
+	mr := miniredis.RunT(t)
+	key := leaderKeyPrefix + "singleton"
+	a, aClient := startLeaderPod(t, mr, "pod-a")
+	waitClosed(t, "лидерство pod-a", a.started)
+	b, _ := startLeaderPod(t, mr, "pod-b")
+
+	// pod-a теряет Redis: продлевать лиз он не может и через TTL останавливает воркер сам
+	_ = aClient.Close()
+	waitClosed(t, "остановка pod-a без продления лиза", a.stopped)
+	if b.leading.Load() {
+		t.Fatal("pod-b стал лидером до истечения лиза")
+	}
+
+	// Лиз истекает — pod-b подхватывает воркер
+	mr.FastForward(testLeaseTTL)
+	waitClosed(t, "лидерство pod-b после истечения лиза", b.started)
+	if owner, _ := mr.Get(key); owner != "pod-b" {
+		t.Fatalf("владелец лиза %q, ожидался pod-b", owner)
+	}
+}
+
+func TestLeaderElectionStepsDownWhenLeaseTaken(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a, _ := startLeaderPod(t, mr, "pod-a")
+	waitClosed(t, "лидерство pod-a", a.started)
+
+	// Лиз истек во время паузы pod-a и достался другому pod
+	if err := mr.Set(leaderKeyPrefix+"singleton", "pod-b"); err != nil {
+		t.Fatal(err)
+	}
+	waitClosed(t, "остановка pod-a после перехвата лиза", a.stopped)
+	if owner, _ := mr.Get(leaderKeyPrefix + "singleton"); owner != "pod-b" {
+		t.Fatalf("pod-a снял чужой лиз: владелец %q", owner)
+	}
+}
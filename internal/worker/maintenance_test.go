@@ -0,0 +1,323 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"notification-mvp/internal/clock"
+	"notification-mvp/internal/domain"
+	"notification-mvp/internal/repository"
+)
+
+var testEpoch = time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func newTestRepo() (*repository.MemoryRepository, *clock.Fake) {
+	clock := clock.NewFake(testEpoch)
+	return repository.NewMemoryRepository(clock), clock
+}
+
+func createNotification(t *testing.T, repo *repository.MemoryRepository, clock *clock.Fake, target domain.Target) domain.CreateResult {
+	t.Helper()
+	payload := &domain.NotificationPayload{Message: "hello", CreatedAt: clock.Now(), Source: "test"}
+	res, err := repo.CreateNotification(context.Background(), payload, target, domain.StreamLimit{})
+	if err != nil {
+		t.Fatalf("CreateNotification: %v", err)
+	}
+	return res
+}
+
+// ownsOnly — шард, которому принадлежат только перечисленные пользователи
+type ownsOnly map[string]bool
+
+func (o ownsOnly) Owns(userKey string) bool { return o[userKey] }
+
+func streamLen(t *testing.T, repo *repository.MemoryRepository, target domain.Target) int {
+	t.Helper()
+	msgs, err := repo.RangeLastMessages(context.Background(), target.ID, target.Login, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(msgs)
+}
+
+func TestTTLJanitor(t *testing.T) {
+	alice := domain.Target{ID: 1, Login: "alice"}
+	bob := domain.Target{ID: 2, Login: "bob"}
+
+	tests := []struct {
+		name      string
+		advance   time.Duration
+		shard     KeyFilter
+		wantAlice int
+		wantBob   int
+	}{
+		{"до истечения TTL", domain.NotificationTTL - time.Second, nil, 1, 1},
+		{"после истечения TTL", domain.NotificationTTL, nil, 0, 0},
+		{"только свой шард", domain.NotificationTTL, ownsOnly{"1-alice": true}, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, clock := newTestRepo()
+			createNotification(t, repo, clock, alice)
+			createNotification(t, repo, clock, bob)
+			clock.Advance(tt.advance)
+
+			janitor := NewTTLJanitor(repo, testLogger()).WithClock(clock)
+			if tt.shard != nil {
+				janitor.WithShard(tt.shard)
+			}
+			if err := janitor.RunOnce(context.Background()); err != nil {
+				t.Fatalf("RunOnce: %v", err)
+			}
+			if got := streamLen(t, repo, alice); got != tt.wantAlice {
+				t.Errorf("у alice %d записей, ожидалось %d", got, tt.wantAlice)
+			}
+			if got := streamLen(t, repo, bob); got != tt.wantBob {
+				t.Errorf("у bob %d записей, ожидалось %d", got, tt.wantBob)
+			}
+		})
+	}
+}
+
+func TestGroupMaintenanceReclaimsIdlePending(t *testing.T) {
+	ctx := context.Background()
+	alice := domain.Target{ID: 1, Login: "alice"}
+
+	tests := []struct {
+		name        string
+		advance     time.Duration
+		wantReclaim bool
+	}{
+		{"сообщение еще не зависло", 30 * time.Second, false},
+		{"зависшее сообщение перехвачено", 61 * time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, clock := newTestRepo()
+			if err := repo.EnsureConsumerGroup(ctx, 1, "alice"); err != nil {
+				t.Fatal(err)
+			}
+			createNotification(t, repo, clock, alice)
+			if msgs, err := repo.ReadNewMessages(ctx, 1, "alice", time.Second, 10); err != nil || len(msgs) != 1 {
+				t.Fatalf("ReadNewMessages = %v, %v", msgs, err)
+			}
+			clock.Advance(tt.advance)
+
+			if err := NewGroupMaintenance(repo, testLogger()).WithClock(clock).RunOnce(ctx); err != nil {
+				t.Fatalf("RunOnce: %v", err)
+			}
+
+			// Перехват сбрасывает время доставки: через 30с после прохода воркера сообщение
+			// простаивает 60с только если воркер его не трогал
+			clock.Advance(30 * time.Second)
+			msgs, err := repo.ReclaimPendingMessages(ctx, 1, "alice", 60*time.Second, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reclaimedByWorker := len(msgs) == 0; reclaimedByWorker != tt.wantReclaim {
+				t.Fatalf("перехват воркером: %v, ожидалось %v", reclaimedByWorker, tt.wantReclaim)
+			}
+		})
+	}
+}
+
+func TestRetentionTrimmer(t *testing.T) {
+	ctx := context.Background()
+	alice := domain.Target{ID: 1, Login: "alice"}
+	bob := domain.Target{ID: 2, Login: "bob"}
+
+	repo, clock := newTestRepo()
+	if err := repo.SetUserRetentionDays(ctx, 1, "alice", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetUserRetentionDays(ctx, 2, "bob", 3); err != nil {
+		t.Fatal(err)
+	}
+	old := createNotification(t, repo, clock, alice)
+	createNotification(t, repo, clock, bob)
+	msgs, _ := repo.RangeLastMessages(ctx, 1, "alice", 1)
+	oldNID := msgs[0].Payload.NotificationID
+	if res, err := repo.AckMessage(ctx, 1, "alice", old.StreamID, oldNID); err != nil || res != domain.AckResultAcked {
+		t.Fatalf("AckMessage = %s, %v", res, err)
+	}
+
+	clock.Advance(36 * time.Hour)
+	createNotification(t, repo, clock, alice)
+
+	if err := NewRetentionTrimmer(repo, testLogger()).RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if got := streamLen(t, repo, alice); got != 1 {
+		t.Errorf("у alice %d записей, ожидалась 1 (старше срока хранения удалены)", got)
+	}
+	if got := streamLen(t, repo, bob); got != 1 {
+		t.Errorf("у bob %d записей, ожидалась 1 (срок хранения 3 дня)", got)
+	}
+	statuses, err := repo.GetReadStatuses(ctx, 1, "alice", []string{oldNID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[oldNID] {
+		t.Error("статус прочтения удаленной записи не собран")
+	}
+}
+
+func TestRetentionTrimmerStopsOnCancel(t *testing.T) {
+	repo, clock := newTestRepo()
+	// 500 пользователей с паузой 10мс между ними — проход без отмены занял бы больше 5с
+	for i := int64(1); i <= 500; i++ {
+		createNotification(t, repo, clock, domain.Target{ID: i, Login: "user"})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(30*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := NewRetentionTrimmer(repo, testLogger()).RunOnce(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("ожидалась ошибка отмены, получено %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("воркер остановился через %v после отмены", elapsed)
+	}
+}
+
+func TestTTLJanitorShardBeyondBatch(t *testing.T) {
+	repo, clock := newTestRepo()
+	// Первые dueUsersBatch записей индекса принадлежат чужим pod, своя — за их пределами
+	for i := int64(1); i <= dueUsersBatch; i++ {
+		createNotification(t, repo, clock, domain.Target{ID: i, Login: "other"})
+	}
+	clock.Advance(time.Second)
+	mine := domain.Target{ID: dueUsersBatch + 1, Login: "mine"}
+	createNotification(t, repo, clock, mine)
+	clock.Advance(domain.NotificationTTL)
+
+	janitor := NewTTLJanitor(repo, testLogger()).WithClock(clock).WithShard(ownsOnly{domain.UserKey(mine.ID, mine.Login): true})
+	if err := janitor.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if got := streamLen(t, repo, mine); got != 0 {
+		t.Fatalf("просроченное уведомление своего шарда не удалено: %d записей", got)
+	}
+}
+
+func TestTTLJanitorCancelsEscalationAndDelivery(t *testing.T) {
+	repo, clock := newTestRepo()
+	ctx := context.Background()
+	alice := domain.Target{ID: 1, Login: "alice"}
+	created := createNotification(t, repo, clock, alice)
+	msgs, _ := repo.RangeLastMessages(ctx, 1, "alice", 1)
+	nid := msgs[0].Payload.NotificationID
+
+	if err := repo.ScheduleEscalation(ctx, domain.Escalation{
+		NotificationID: nid,
+		StreamID:       created.StreamID,
+		Target:         alice,
+		ScheduledAt:    clock.Now(),
+		Steps:          []domain.EscalationStep{{AfterMinutes: 10, Action: domain.EscalationRepush}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.ScheduleChannelDelivery(ctx, domain.ChannelDelivery{
+		NotificationID: nid,
+		StreamID:       created.StreamID,
+		Target:         alice,
+		DueAt:          clock.Now().Add(domain.NotificationTTL + time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(domain.NotificationTTL)
+	if err := NewTTLJanitor(repo, testLogger()).WithClock(clock).RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if esc, err := repo.GetEscalation(ctx, 1, "alice", nid); err != nil || esc != nil {
+		t.Fatalf("эскалация просроченного уведомления не отменена: %+v, %v", esc, err)
+	}
+	if d, err := repo.GetChannelDelivery(ctx, 1, "alice", nid); err != nil || d != nil {
+		t.Fatalf("доставка просроченного уведомления не отменена: %+v, %v", d, err)
+	}
+}
+
+// recordingSink запоминает события архива; Record может вызываться из горутины воркера
+type recordingSink struct {
+	mu     sync.Mutex
+	events []domain.ArchiveEvent
+}
+
+func (s *recordingSink) Record(event domain.ArchiveEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+}
+
+func (s *recordingSink) recorded() []domain.ArchiveEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.events)
+}
+
+func TestTTLJanitorArchivesExpired(t *testing.T) {
+	repo, clock := newTestRepo()
+	ctx := context.Background()
+	alice := domain.Target{ID: 1, Login: "alice"}
+	createNotification(t, repo, clock, alice)
+	msgs, _ := repo.RangeLastMessages(ctx, 1, "alice", 1)
+	nid := msgs[0].Payload.NotificationID
+
+	sink := &recordingSink{}
+	janitor := NewTTLJanitor(repo, testLogger()).WithClock(clock).WithArchive(sink)
+	if err := janitor.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if len(sink.events) != 0 {
+		t.Fatalf("до истечения TTL записаны события: %+v", sink.events)
+	}
+
+	clock.Advance(domain.NotificationTTL)
+	if err := janitor.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if len(sink.events) != 1 {
+		t.Fatalf("записано %d событий, ожидалось 1", len(sink.events))
+	}
+	ev := sink.events[0]
+	if ev.Type != domain.ArchiveEventExpired || ev.NotificationID != nid || ev.Target != alice || !ev.OccurredAt.Equal(clock.Now()) {
+		t.Fatalf("неверное событие истечения: %+v", ev)
+	}
+}
+
+func TestRetentionTrimmerPagesActiveIndex(t *testing.T) {
+	ctx := context.Background()
+	repo, clock := newTestRepo()
+	// Первая страница индекса активных целиком принадлежит чужим pod, свой пользователь — за ее пределами
+	for i := int64(1); i <= activeUsersBatch; i++ {
+		createNotification(t, repo, clock, domain.Target{ID: i, Login: "other"})
+	}
+	clock.Advance(time.Second)
+	mine := domain.Target{ID: activeUsersBatch + 1, Login: "mine"}
+	if err := repo.SetUserRetentionDays(ctx, mine.ID, mine.Login, 1); err != nil {
+		t.Fatal(err)
+	}
+	createNotification(t, repo, clock, mine)
+	clock.Advance(36 * time.Hour)
+	createNotification(t, repo, clock, mine)
+
+	trimmer := NewRetentionTrimmer(repo, testLogger()).WithShard(ownsOnly{domain.UserKey(mine.ID, mine.Login): true})
+	if err := trimmer.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if got := streamLen(t, repo, mine); got != 1 {
+		t.Fatalf("у пользователя за первой страницей индекса %d записей, ожидалась 1", got)
+	}
+}
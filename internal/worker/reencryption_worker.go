@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"notification-mvp/internal/metrics"
+)
+
+// PayloadReencryptor перешифровывает сохранённые payload активным ключом
+type PayloadReencryptor interface {
+	ReencryptPayloads(ctx context.Context) (int, error)
+}
+
+// ReencryptionWorker в фоне перешифровывает payload после ротации ключей
+type ReencryptionWorker struct {
+	repo   PayloadReencryptor
+	logger *slog.Logger
+}
+
+func NewReencryptionWorker(repo PayloadReencryptor, logger *slog.Logger) *ReencryptionWorker {
+	return &ReencryptionWorker{repo: repo, logger: logger}
+}
+
+func (w *ReencryptionWorker) Name() string {
+	return "reencryption"
+}
+
+// RunOnce выполняет полный обход payload, перешифровывая значения со старым ключом
+func (w *ReencryptionWorker) RunOnce(ctx context.Context) error {
+	start := time.Now()
+
+	rotated, err := w.repo.ReencryptPayloads(ctx)
+	metrics.PayloadsReencrypted.Add(float64(rotated))
+	if err != nil {
+		return fmt.Errorf("ошибка перешифрования payload (перешифровано %d): %w", rotated, err)
+	}
+
+	if rotated > 0 {
+		w.logger.Info("Завершено перешифрование payload", "rotated", rotated, "duration", time.Since(start))
+	} else {
+		w.logger.Debug("Завершено перешифрование payload", "rotated", rotated, "duration", time.Since(start))
+	}
+	return nil
+}
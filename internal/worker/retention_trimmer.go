@@ -2,69 +2,93 @@ package worker
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
-	"strconv"
-	"strings"
 	"time"
 
 	"notification-mvp/internal/domain"
+	"notification-mvp/internal/metrics"
 )
 
+// activeUsersBatch — размер страницы индекса активных пользователей при обходе триммером
+const activeUsersBatch = 1000
+
 // RetentionTrimmer выполняет периодический XTRIM MINID по per-user TTL
 type RetentionTrimmer struct {
 	repo   domain.NotificationRepository
 	logger *slog.Logger
-	tick   time.Duration
+	shard  KeyFilter // nil — обрабатываются все пользователи
 }
 
 func NewRetentionTrimmer(repo domain.NotificationRepository, logger *slog.Logger) *RetentionTrimmer {
-	return &RetentionTrimmer{repo: repo, logger: logger, tick: 1 * time.Minute}
+	return &RetentionTrimmer{repo: repo, logger: logger}
+}
+
+// WithShard ограничивает обработку пользователями, принадлежащими этому pod
+func (w *RetentionTrimmer) WithShard(shard KeyFilter) *RetentionTrimmer {
+	w.shard = shard
+	return w
+}
+
+func (w *RetentionTrimmer) Name() string {
+	return "retention_trimmer"
 }
 
-func (w *RetentionTrimmer) Start(ctx context.Context) {
-	ticker := time.NewTicker(w.tick)
-	defer ticker.Stop()
-	w.logger.Info("Retention trimmer запущен")
-	for {
-		select {
-		case <-ctx.Done():
-			w.logger.Info("Retention trimmer остановлен")
-			return
-		case <-ticker.C:
-			w.runOnce(ctx)
+func (w *RetentionTrimmer) RunOnce(ctx context.Context) error {
+	// Обходим индекс активных постранично: туда попадает каждый, у кого есть стрим,
+	// даже если его планировщик TTL уже пуст. Пользователь, активность которого обновилась
+	// во время обхода, переезжает в конец индекса и будет обработан в следующем проходе
+	var processed, failed int
+	for offset := int64(0); ; offset += activeUsersBatch {
+		page, err := w.repo.GetActiveUserKeys(ctx, time.Time{}, offset, activeUsersBatch)
+		if err != nil {
+			return fmt.Errorf("ошибка получения userKeys для тримминга: %w", err)
+		}
+		for _, uk := range ownedKeys(w.shard, page) {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			processed++
+			if !w.trimUser(ctx, uk) {
+				failed++
+			}
+			// лёгкий троттлинг, прерываемый остановкой воркера
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		if int64(len(page)) < activeUsersBatch {
+			break
 		}
 	}
+	if failed > 0 {
+		return fmt.Errorf("не удалось обрезать стримы %d из %d пользователей", failed, processed)
+	}
+	return nil
 }
 
-func (w *RetentionTrimmer) runOnce(ctx context.Context) {
-	// Используем существующий SCAN-список через TTL планировщик, чтобы получить userKeys
-	userKeys, err := w.repo.GetAllUserKeys(ctx)
+// trimUser обрезает стрим пользователя по retention и собирает статусы прочтения;
+// возвращает false, если обрезать стрим не удалось
+func (w *RetentionTrimmer) trimUser(ctx context.Context, uk string) bool {
+	userID, login, err := domain.ParseUserKey(uk)
 	if err != nil {
-		w.logger.Warn("Ошибка получения userKeys для тримминга", "error", err)
-		return
+		w.logger.Warn("Ошибка парсинга user key", "user_key", uk, "error", err)
+		return true
 	}
-	for _, uk := range userKeys {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-		}
-		// uk в формате id-login, нужно распарсить
-		// В репозитории TrimUserStreamByRetention уже знает userID/login, так что распарсим здесь схожим путем
-		// Чтобы не дублировать, можно временно пропустить сложные кейсы — uk корректен
-		parts := strings.SplitN(uk, "-", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		userID, err := strconv.ParseInt(parts[0], 10, 64)
-		if err != nil {
-			continue
-		}
-		login := parts[1]
-		if err := w.repo.TrimUserStreamByRetention(ctx, userID, login); err != nil {
-			w.logger.Warn("Ошибка тримминга по retention", "user", uk, "error", err)
-		}
-		// лёгкий троттлинг
-		time.Sleep(10 * time.Millisecond)
+	ok := true
+	if err := w.repo.TrimUserStreamByRetention(ctx, userID, login); err != nil {
+		w.logger.Warn("Ошибка тримминга по retention", "user", uk, "error", err)
+		ok = false
+	}
+	// После тримминга убираем статусы прочтения записей, которых больше нет в стриме
+	removed, remaining, err := w.repo.CompactReadStates(ctx, userID, login)
+	if err != nil {
+		w.logger.Warn("Ошибка сборки статусов прочтения", "user", uk, "error", err)
+	} else {
+		metrics.StateFieldsRemoved.Add(float64(removed))
+		metrics.StateHashFields.Observe(float64(remaining))
 	}
+	return ok
 }
@@ -3,12 +3,43 @@ package worker
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"notification-mvp/internal/domain"
+	"notification-mvp/internal/metrics"
+
 	"github.com/redis/go-redis/v9"
 )
 
+// busStreamPrefix — префикс стрима шины pod: notif:bus:<podID>
+const busStreamPrefix = "notif:bus:"
+
+// busPodsKey — множество pod, у которых есть стрим шины; по нему удаляются стримы выбывших pod
+const busPodsKey = "notif:pods:bus"
+
+// busDeadLetterStream — общий стрим сообщений шины, не доставленных после всех попыток
+const busDeadLetterStream = "notif:dlq:bus"
+
+const (
+	busGroup            = "router"
+	busReadBlock        = 5 * time.Second // ограничивает задержку остановки роутера
+	busRetryInterval    = 1 * time.Second
+	busStatsInterval    = 10 * time.Second
+	busMaxBackoff       = 30 * time.Second
+	busDeadLetterMaxLen = 10000
+)
+
+// Причины попадания сообщения в dead-letter стрим
+const (
+	busDeadMalformed     = "malformed"
+	busDeadMaxDeliveries = "max_deliveries"
+)
+
 // BusMessage структура сообщения шины
 type BusMessage struct {
 	Type    string          `json:"type"`
@@ -16,28 +47,63 @@ type BusMessage struct {
 	Data    json.RawMessage `json:"data"`
 }
 
-// InterPodRouter читает notif:bus:<podID> и доставляет локальным WS
+// InterPodRouter читает notif:bus:<podID> и доставляет локальным WS.
+// Недоставленные сообщения остаются в PEL группы и повторяются с экспоненциальной задержкой,
+// после maxDeliveries попыток переносятся в notif:dlq:bus. Сообщения пользователям, у которых
+// нет сессии на этом pod, подтверждаются сразу: уведомление дождется их в стриме
 type InterPodRouter struct {
-	rdb    *redis.Client
+	rdb    redis.UniversalClient
 	podID  string
 	logger *slog.Logger
-	// простейший коллбек-доставщик
-	deliver func(userKey string, payload json.RawMessage) bool
+	// простейший коллбек-доставщик; domain.ErrNoLocalSession — пользователь не подключен к pod
+	deliver func(userKey string, payload json.RawMessage) error
+
+	// handleMu не дает чтению новых сообщений и повторам обрабатывать записи одновременно
+	handleMu sync.Mutex
+
+	maxDeliveries int64
+	backoff       time.Duration
 }
 
-func NewInterPodRouter(rdb *redis.Client, podID string, logger *slog.Logger, deliver func(userKey string, payload json.RawMessage) bool) *InterPodRouter {
-	return &InterPodRouter{rdb: rdb, podID: podID, logger: logger, deliver: deliver}
+func NewInterPodRouter(rdb redis.UniversalClient, podID string, logger *slog.Logger, deliver func(userKey string, payload json.RawMessage) error) *InterPodRouter {
+	return &InterPodRouter{
+		rdb:           rdb,
+		podID:         podID,
+		logger:        logger,
+		deliver:       deliver,
+		maxDeliveries: 5,
+		backoff:       time.Second,
+	}
+}
+
+// WithRetryPolicy задает число попыток доставки и начальную задержку повтора (удваивается с каждой попыткой)
+func (r *InterPodRouter) WithRetryPolicy(maxDeliveries int, backoff time.Duration) *InterPodRouter {
+	if maxDeliveries > 0 {
+		r.maxDeliveries = int64(maxDeliveries)
+	}
+	if backoff > 0 {
+		r.backoff = backoff
+	}
+	return r
 }
 
 func (r *InterPodRouter) Start(ctx context.Context) {
-	group := "router"
-	stream := "notif:bus:" + r.podID
+	stream := busStreamPrefix + r.podID
 	consumer := "consumer:" + r.podID
 
-	// ensure group
-	_ = r.rdb.XGroupCreateMkStream(ctx, stream, group, "$").Err()
+	r.ensureGroup(ctx, stream)
+
+	// Повторы и метрики выполняются отдельно, чтобы не ждать блокирующего чтения
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.maintain(ctx, stream, consumer)
+	}()
+	defer wg.Wait()
 
-	r.logger.Info("InterPodRouter запущен", "stream", stream)
+	r.logger.Info("InterPodRouter запущен", "stream", stream,
+		"max_deliveries", r.maxDeliveries, "backoff", r.backoff)
 	for {
 		select {
 		case <-ctx.Done():
@@ -47,35 +113,232 @@ func (r *InterPodRouter) Start(ctx context.Context) {
 		}
 
 		streams, err := r.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
-			Group:    group,
+			Group:    busGroup,
 			Consumer: consumer,
 			Streams:  []string{stream, ">"},
 			Count:    100,
-			Block:    30 * time.Second,
+			Block:    busReadBlock,
 		}).Result()
 		if err != nil {
-			if err == redis.Nil {
+			if err == redis.Nil || ctx.Err() != nil {
+				continue
+			}
+			if redis.HasErrorPrefix(err, "NOGROUP") {
+				// Стрим удален соседом, посчитавшим pod выбывшим, — создаем заново
+				r.logger.Warn("Стрим шины pod удален, создаем заново", "stream", stream)
+				r.ensureGroup(ctx, stream)
 				continue
 			}
 			r.logger.Warn("Ошибка XREADGROUP в роутере", "error", err)
-			time.Sleep(200 * time.Millisecond)
+			select {
+			case <-ctx.Done():
+			case <-time.After(200 * time.Millisecond):
+			}
 			continue
 		}
+		r.handleMu.Lock()
 		for _, s := range streams {
 			for _, m := range s.Messages {
-				var busMsg BusMessage
-				if b, ok := m.Values["payload"].(string); ok {
-					_ = json.Unmarshal([]byte(b), &busMsg)
-				}
-				userKey := busMsg.UserKey
-				delivered := false
-				if len(busMsg.Data) > 0 && userKey != "" && r.deliver != nil {
-					delivered = r.deliver(userKey, busMsg.Data)
-				}
-				if delivered {
-					_ = r.rdb.XAck(ctx, stream, group, m.ID).Err()
-				}
+				r.handle(ctx, stream, m, 1)
+			}
+		}
+		r.handleMu.Unlock()
+	}
+}
+
+// ensureGroup создает стрим и группу роутера и регистрирует стрим pod для последующей очистки
+func (r *InterPodRouter) ensureGroup(ctx context.Context, stream string) {
+	_ = r.rdb.XGroupCreateMkStream(ctx, stream, busGroup, "$").Err()
+	if err := r.rdb.SAdd(ctx, busPodsKey, r.podID).Err(); err != nil {
+		r.logger.Warn("Ошибка регистрации стрима шины", "error", err)
+	}
+}
+
+// handle пытается доставить сообщение. Доставленное или адресованное пользователю без сессии
+// на этом pod подтверждается и удаляется из стрима, недоставленное остается в PEL до следующей попытки.
+// Вызывается под handleMu
+func (r *InterPodRouter) handle(ctx context.Context, stream string, m redis.XMessage, deliveries int64) {
+	var busMsg BusMessage
+	raw, _ := m.Values["payload"].(string)
+	if err := json.Unmarshal([]byte(raw), &busMsg); err != nil || busMsg.UserKey == "" || len(busMsg.Data) == 0 {
+		r.deadLetter(ctx, stream, m, busDeadMalformed, deliveries)
+		return
+	}
+
+	err := domain.ErrNoLocalSession
+	if r.deliver != nil {
+		err = r.deliver(busMsg.UserKey, busMsg.Data)
+	}
+	switch {
+	case err == nil:
+		metrics.BusDelivered.Inc()
+	case errors.Is(err, domain.ErrNoLocalSession):
+		// Пользователь отключился или переподключился к другому pod — повтор ничего не даст
+		metrics.BusNoSession.Inc()
+		r.logger.Debug("Сообщение шины для пользователя без сессии на pod подтверждено",
+			"id", m.ID, "user", busMsg.UserKey)
+	default:
+		r.logger.Debug("Сообщение шины не доставлено, будет повтор",
+			"id", m.ID, "user", busMsg.UserKey, "deliveries", deliveries, "error", err)
+		return
+	}
+	r.remove(ctx, stream, m.ID)
+}
+
+// maintain повторяет зависшие сообщения и обновляет метрики шины
+func (r *InterPodRouter) maintain(ctx context.Context, stream, consumer string) {
+	retry := time.NewTicker(busRetryInterval)
+	defer retry.Stop()
+	stats := time.NewTicker(busStatsInterval)
+	defer stats.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-retry.C:
+			r.retryPending(ctx, stream, consumer)
+		case <-stats.C:
+			r.updateStats(ctx, stream)
+		}
+	}
+}
+
+// retryPending повторяет доставку сообщений, чья задержка истекла, и переносит в dead-letter
+// исчерпавшие попытки. Выполняется под handleMu, чтобы запись не обрабатывалась параллельно с чтением
+func (r *InterPodRouter) retryPending(ctx context.Context, stream, consumer string) {
+	r.handleMu.Lock()
+	defer r.handleMu.Unlock()
+
+	pending, err := r.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: stream,
+		Group:  busGroup,
+		Idle:   r.backoff,
+		Start:  "-",
+		End:    "+",
+		Count:  100,
+	}).Result()
+	if err != nil {
+		if ctx.Err() == nil && err != redis.Nil {
+			r.logger.Warn("Ошибка чтения PEL шины", "error", err)
+		}
+		return
+	}
+
+	for _, p := range pending {
+		delay := r.retryDelay(p.RetryCount)
+		if p.Idle < delay {
+			continue
+		}
+
+		if p.RetryCount >= r.maxDeliveries {
+			msgs, err := r.rdb.XRangeN(ctx, stream, p.ID, p.ID, 1).Result()
+			if err != nil {
+				r.logger.Warn("Ошибка чтения сообщения шины", "id", p.ID, "error", err)
+				continue
 			}
+			if len(msgs) == 0 {
+				r.remove(ctx, stream, p.ID) // запись уже вытеснена MAXLEN
+				continue
+			}
+			r.deadLetter(ctx, stream, msgs[0], busDeadMaxDeliveries, p.RetryCount)
+			continue
+		}
+
+		// XCLAIM увеличивает счетчик доставок и сбрасывает idle
+		msgs, err := r.rdb.XClaim(ctx, &redis.XClaimArgs{
+			Stream:   stream,
+			Group:    busGroup,
+			Consumer: consumer,
+			MinIdle:  delay,
+			Messages: []string{p.ID},
+		}).Result()
+		if err != nil {
+			r.logger.Warn("Ошибка XCLAIM сообщения шины", "id", p.ID, "error", err)
+			continue
+		}
+		if len(msgs) == 0 {
+			r.remove(ctx, stream, p.ID)
+			continue
+		}
+		metrics.BusRetries.Inc()
+		r.handle(ctx, stream, msgs[0], p.RetryCount+1)
+	}
+}
+
+// retryDelay возвращает задержку перед следующей попыткой после deliveries доставок
+func (r *InterPodRouter) retryDelay(deliveries int64) time.Duration {
+	delay := r.backoff
+	for i := int64(1); i < deliveries && delay < busMaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, busMaxBackoff)
+}
+
+// deadLetter переносит сообщение в notif:dlq:bus и удаляет его из стрима pod
+func (r *InterPodRouter) deadLetter(ctx context.Context, stream string, m redis.XMessage, reason string, deliveries int64) {
+	raw, _ := m.Values["payload"].(string)
+	err := r.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: busDeadLetterStream,
+		MaxLen: busDeadLetterMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"payload":    raw,
+			"pod":        r.podID,
+			"source_id":  m.ID,
+			"reason":     reason,
+			"deliveries": strconv.FormatInt(deliveries, 10),
+		},
+	}).Err()
+	if err != nil {
+		r.logger.Warn("Ошибка записи в dead-letter стрим шины", "id", m.ID, "error", err)
+		return
+	}
+
+	metrics.BusDeadLettered.WithLabelValues(reason).Inc()
+	r.logger.Warn("Сообщение шины перенесено в dead-letter", "id", m.ID, "reason", reason, "deliveries", deliveries)
+	r.remove(ctx, stream, m.ID)
+}
+
+// remove подтверждает и удаляет сообщение из стрима pod
+func (r *InterPodRouter) remove(ctx context.Context, stream, id string) {
+	pipe := r.rdb.Pipeline()
+	pipe.XAck(ctx, stream, busGroup, id)
+	pipe.XDel(ctx, stream, id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		r.logger.Warn("Ошибка подтверждения сообщения шины", "id", id, "error", err)
+	}
+}
+
+// updateStats обновляет метрики отставания и PEL группы роутера
+func (r *InterPodRouter) updateStats(ctx context.Context, stream string) {
+	groups, err := r.rdb.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		if ctx.Err() == nil {
+			r.logger.Debug("Ошибка XINFO GROUPS шины", "error", err)
+		}
+		return
+	}
+	for _, g := range groups {
+		if g.Name != busGroup {
+			continue
+		}
+		metrics.BusPending.Set(float64(g.Pending))
+		if g.Lag >= 0 {
+			metrics.BusLag.Set(float64(g.Lag))
 		}
 	}
+
+	oldest := 0.0
+	if summary, err := r.rdb.XPending(ctx, stream, busGroup).Result(); err == nil && summary.Count > 0 {
+		msStr, _, _ := strings.Cut(summary.Lower, "-")
+		if ms, err := strconv.ParseInt(msStr, 10, 64); err == nil {
+			oldest = time.Since(time.UnixMilli(ms)).Seconds()
+		}
+	}
+	metrics.BusOldestPending.Set(oldest)
+
+	if n, err := r.rdb.XLen(ctx, busDeadLetterStream).Result(); err == nil {
+		metrics.BusDeadLetterSize.Set(float64(n))
+	}
 }
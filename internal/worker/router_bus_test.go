@@ -0,0 +1,164 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"notification-mvp/internal/domain"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRouter создает роутер pod-a над Redis в процессе и возвращает стрим его шины
+func newTestRouter(t *testing.T, deliver func(string, json.RawMessage) error) (*InterPodRouter, redis.UniversalClient, string) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	r := NewInterPodRouter(rdb, "pod-a", testLogger(), deliver).WithRetryPolicy(2, time.Millisecond)
+	stream := busStreamPrefix + "pod-a"
+	r.ensureGroup(context.Background(), stream)
+	return r, rdb, stream
+}
+
+// readBus публикует сообщение в шину pod и читает его группой роутера, как цикл Start
+func readBus(t *testing.T, rdb redis.UniversalClient, stream, payload string) redis.XMessage {
+	t.Helper()
+	ctx := context.Background()
+	if err := rdb.XAdd(ctx, &redis.XAddArgs{Stream: stream, Values: map[string]interface{}{"payload": payload}}).Err(); err != nil {
+		t.Fatal(err)
+	}
+	streams, err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group: busGroup, Consumer: "consumer:pod-a", Streams: []string{stream, ">"}, Count: 1,
+	}).Result()
+	if err != nil || len(streams) != 1 || len(streams[0].Messages) != 1 {
+		t.Fatalf("XReadGroup = %v, %v", streams, err)
+	}
+	return streams[0].Messages[0]
+}
+
+func busPayload(t *testing.T) string {
+	t.Helper()
+	data, err := json.Marshal(BusMessage{Type: busMessageTypeClientEvent, UserKey: "1-alice", Data: json.RawMessage(`{"type":"x"}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestInterPodRouterHandle(t *testing.T) {
+	errWrite := errors.New("ошибка записи")
+
+	tests := []struct {
+		name       string
+		payload    string
+		results    []error // результаты доставки по попыткам
+		wantCalls  int
+		wantDead   int64
+		wantReason string
+	}{
+		{"доставлено", "", []error{nil}, 1, 0, ""},
+		{"нет сессии на pod — подтверждается без повтора", "", []error{domain.ErrNoLocalSession}, 1, 0, ""},
+		{"нет сессии после сбоя записи", "", []error{errWrite, domain.ErrNoLocalSession}, 2, 0, ""},
+		{"повтор после сбоя записи", "", []error{errWrite, nil}, 2, 0, ""},
+		{"исчерпаны попытки", "", []error{errWrite, errWrite, errWrite}, 2, 1, busDeadMaxDeliveries},
+		{"неразборчивое сообщение", "{", nil, 0, 1, busDeadMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			deliver := func(string, json.RawMessage) error {
+				err := tt.results[min(calls, len(tt.results)-1)]
+				calls++
+				return err
+			}
+			r, rdb, stream := newTestRouter(t, deliver)
+			ctx := context.Background()
+
+			payload := tt.payload
+			if payload == "" {
+				payload = busPayload(t)
+			}
+			r.handle(ctx, stream, readBus(t, rdb, stream, payload), 1)
+			// Повторы с задержкой 1мс, 2мс; третий проход переносит исчерпавшие попытки в dead-letter
+			for i := 0; i < 3; i++ {
+				time.Sleep(5 * time.Millisecond)
+				r.retryPending(ctx, stream, "consumer:pod-a")
+			}
+
+			if calls != tt.wantCalls {
+				t.Errorf("попыток доставки %d, ожидалось %d", calls, tt.wantCalls)
+			}
+			if n, _ := rdb.XLen(ctx, stream).Result(); n != 0 {
+				t.Errorf("в стриме шины осталось %d сообщений", n)
+			}
+			pending, err := rdb.XPending(ctx, stream, busGroup).Result()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pending.Count != 0 {
+				t.Errorf("в PEL осталось %d сообщений", pending.Count)
+			}
+			dead, err := rdb.XRange(ctx, busDeadLetterStream, "-", "+").Result()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(dead)) != tt.wantDead {
+				t.Fatalf("в dead-letter %d сообщений, ожидалось %d", len(dead), tt.wantDead)
+			}
+			if tt.wantDead > 0 && dead[0].Values["reason"] != tt.wantReason {
+				t.Errorf("причина %v, ожидалась %s", dead[0].Values["reason"], tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestInterPodRouterRetryWaitsForRead(t *testing.T) {
+	// Пока чтение обрабатывает пачку, повтор не должен взять те же записи
+	release := make(chan struct{})
+	entered := make(chan struct{}, 1)
+	calls := 0
+	deliver := func(string, json.RawMessage) error {
+		calls++
+		if calls == 1 {
+			entered <- struct{}{}
+			<-release
+		}
+		return nil
+	}
+	r, rdb, stream := newTestRouter(t, deliver)
+	ctx := context.Background()
+	m := readBus(t, rdb, stream, busPayload(t))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.handleMu.Lock()
+		r.handle(ctx, stream, m, 1)
+		r.handleMu.Unlock()
+	}()
+	<-entered
+	time.Sleep(5 * time.Millisecond) // запись простаивает дольше задержки повтора
+
+	retried := make(chan struct{})
+	go func() {
+		defer close(retried)
+		r.retryPending(ctx, stream, "consumer:pod-a")
+	}()
+	select {
+	case <-retried:
+		t.Fatal("повтор выполнился параллельно с обработкой чтения")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-done
+	<-retried
+	if calls != 1 {
+		t.Fatalf("сообщение доставлено %d раз", calls)
+	}
+}
@@ -0,0 +1,488 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"notification-mvp/internal/domain"
+	"notification-mvp/internal/metrics"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// workersPausedKey — множество приостановленных воркеров кластера
+	workersPausedKey = "notif:workers:paused"
+	// workerTriggerChannel — канал запросов внеочередного запуска; сообщение — имя воркера
+	workerTriggerChannel = "notif:workers:trigger"
+	// workerStatusKeyPrefix — состояние воркера на pod, где выполняется его цикл:
+	// notif:workers:status:<worker> -> pod_id -> JSON domain.WorkerStatus
+	workerStatusKeyPrefix = "notif:workers:status:"
+)
+
+// Runner — одна итерация фонового воркера. Цикл, расписание, статус и метрики обеспечивает Runtime
+type Runner interface {
+	Name() string
+	RunOnce(ctx context.Context) error
+}
+
+// Schedule задает период запуска воркера. К каждому периоду добавляется случайная задержка
+// до Jitter, чтобы pod не начинали обход одновременно
+type Schedule struct {
+	Interval  time.Duration
+	Jitter    time.Duration
+	Immediate bool // первая итерация сразу после запуска, без ожидания Interval
+}
+
+// Job выполняет Runner по расписанию и хранит его состояние на этом pod
+type Job struct {
+	rt       *Runtime
+	runner   Runner
+	schedule Schedule
+	logger   *slog.Logger
+	trigger  chan struct{}
+
+	mu     sync.Mutex
+	status domain.WorkerStatus
+}
+
+// Runtime — реестр фоновых воркеров pod; реализует domain.WorkerController для админ API.
+// С общим Redis пауза, внеочередной запуск и состояние воркеров видны всем pod: лидер воркера
+// выполняет команды, принятые любым pod, а админ API показывает состояние с того pod, где идет цикл
+type Runtime struct {
+	logger     *slog.Logger
+	rdb        redis.UniversalClient // nil — состояние воркеров локально для pod
+	podID      string
+	staleAfter time.Duration
+
+	mu   sync.Mutex
+	jobs []*Job
+}
+
+// NewRuntime создает пустой реестр воркеров
+func NewRuntime(logger *slog.Logger) *Runtime {
+	return &Runtime{logger: logger, staleAfter: podStaleAfter}
+}
+
+// WithControl хранит паузу, запросы запуска и состояние воркеров в Redis, общем для всех pod
+func (rt *Runtime) WithControl(rdb redis.UniversalClient, podID string) *Runtime {
+	rt.rdb = rdb
+	rt.podID = podID
+	return rt
+}
+
+// WithStaleAfter задает, через сколько без пульса состояние воркеров pod перестает учитываться
+func (rt *Runtime) WithStaleAfter(d time.Duration) *Runtime {
+	if d > 0 {
+		rt.staleAfter = d
+	}
+	return rt
+}
+
+// Start принимает запросы внеочередного запуска от админ API любого pod и передает их
+// воркерам, цикл которых выполняется на этом pod. Блокируется до отмены ctx
+func (rt *Runtime) Start(ctx context.Context) {
+	sub := rt.rdb.Subscribe(ctx, workerTriggerChannel)
+	defer sub.Close()
+
+	rt.logger.Info("Прием команд воркерам запущен", "pod", rt.podID)
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			rt.logger.Info("Прием команд воркерам остановлен")
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			if j, err := rt.job(msg.Payload); err == nil && j.Status().Active {
+				j.requestRun()
+			}
+		}
+	}
+}
+
+// Register добавляет воркер в реестр. Цикл запускается вызовом Run у возвращенного Job
+func (rt *Runtime) Register(runner Runner, schedule Schedule) *Job {
+	if schedule.Interval <= 0 {
+		schedule.Interval = time.Minute
+	}
+	j := &Job{
+		rt:       rt,
+		runner:   runner,
+		schedule: schedule,
+		logger:   rt.logger.With("worker", runner.Name()),
+		trigger:  make(chan struct{}, 1),
+		status: domain.WorkerStatus{
+			Name:     runner.Name(),
+			Interval: schedule.Interval.String(),
+			Jitter:   schedule.Jitter.String(),
+		},
+	}
+
+	rt.mu.Lock()
+	rt.jobs = append(rt.jobs, j)
+	rt.mu.Unlock()
+	return j
+}
+
+// Workers возвращает состояние зарегистрированных воркеров. С общим Redis для каждого воркера
+// возвращается состояние всех живых pod, где выполняется его цикл (лидер или шарды), а если
+// воркер нигде не выполняется — состояние этого pod
+func (rt *Runtime) Workers(ctx context.Context) ([]domain.WorkerStatus, error) {
+	jobs := rt.snapshot()
+	if rt.rdb == nil {
+		statuses := make([]domain.WorkerStatus, 0, len(jobs))
+		for _, j := range jobs {
+			statuses = append(statuses, j.Status())
+		}
+		return statuses, nil
+	}
+
+	names := make([]string, len(jobs))
+	for i, j := range jobs {
+		names[i] = j.Name()
+	}
+	active, err := rt.activeStatuses(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+	paused, err := rt.rdb.SMembers(ctx, workersPausedKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения паузы воркеров: %w", err)
+	}
+	pausedSet := make(map[string]bool, len(paused))
+	for _, name := range paused {
+		pausedSet[name] = true
+	}
+
+	statuses := make([]domain.WorkerStatus, 0, len(jobs))
+	for _, j := range jobs {
+		reported := active[j.Name()]
+		if len(reported) == 0 {
+			reported = []domain.WorkerStatus{j.Status()}
+		}
+		for _, st := range reported {
+			st.Paused = pausedSet[j.Name()]
+			statuses = append(statuses, st)
+		}
+	}
+	return statuses, nil
+}
+
+// PauseWorker приостанавливает плановые запуски воркера на всех pod
+func (rt *Runtime) PauseWorker(ctx context.Context, name string) error {
+	return rt.setPaused(ctx, name, true)
+}
+
+// ResumeWorker возобновляет плановые запуски воркера на всех pod
+func (rt *Runtime) ResumeWorker(ctx context.Context, name string) error {
+	return rt.setPaused(ctx, name, false)
+}
+
+func (rt *Runtime) setPaused(ctx context.Context, name string, paused bool) error {
+	j, err := rt.job(name)
+	if err != nil {
+		return err
+	}
+	if rt.rdb != nil {
+		// Остальные pod увидят флаг перед следующим плановым запуском
+		if paused {
+			err = rt.rdb.SAdd(ctx, workersPausedKey, name).Err()
+		} else {
+			err = rt.rdb.SRem(ctx, workersPausedKey, name).Err()
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка сохранения паузы воркера: %w", err)
+		}
+	}
+	j.setPaused(paused)
+	return nil
+}
+
+// TriggerWorker запускает внеочередную итерацию (в том числе у приостановленного воркера) на pod,
+// где выполняется его цикл. Повторные запросы до начала итерации объединяются
+func (rt *Runtime) TriggerWorker(ctx context.Context, name string) error {
+	j, err := rt.job(name)
+	if err != nil {
+		return err
+	}
+	if rt.rdb == nil {
+		if !j.Status().Active {
+			return domain.ErrWorkerInactive
+		}
+		j.requestRun()
+		return nil
+	}
+
+	active, err := rt.activeStatuses(ctx, []string{name})
+	if err != nil {
+		return err
+	}
+	if len(active[name]) == 0 {
+		return domain.ErrWorkerInactive
+	}
+	// Запрос получают все pod, включая этот; запускают его те, где цикл воркера активен
+	if err := rt.rdb.Publish(ctx, workerTriggerChannel, name).Err(); err != nil {
+		return fmt.Errorf("ошибка отправки запроса запуска воркера: %w", err)
+	}
+	return nil
+}
+
+// activeStatuses читает из Redis состояние воркеров на живых pod, где их цикл активен
+func (rt *Runtime) activeStatuses(ctx context.Context, names []string) (map[string][]domain.WorkerStatus, error) {
+	live, err := rt.livePods(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := rt.rdb.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(names))
+	for i, name := range names {
+		cmds[i] = pipe.HGetAll(ctx, workerStatusKeyPrefix+name)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("ошибка чтения состояния воркеров: %w", err)
+	}
+
+	active := make(map[string][]domain.WorkerStatus, len(names))
+	for i, name := range names {
+		for pod, raw := range cmds[i].Val() {
+			if !live[pod] {
+				continue
+			}
+			var st domain.WorkerStatus
+			if err := json.Unmarshal([]byte(raw), &st); err != nil {
+				rt.logger.Warn("Ошибка разбора состояния воркера", "worker", name, "pod", pod, "error", err)
+				continue
+			}
+			if st.Active {
+				active[name] = append(active[name], st)
+			}
+		}
+		sort.Slice(active[name], func(a, b int) bool { return active[name][a].Pod < active[name][b].Pod })
+	}
+	return active, nil
+}
+
+// livePods возвращает pod со свежим пульсом в реестре heartbeat; этот pod считается живым всегда
+func (rt *Runtime) livePods(ctx context.Context) (map[string]bool, error) {
+	entries, err := rt.rdb.HGetAll(ctx, podsHeartbeatKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения heartbeat реестра: %w", err)
+	}
+	cutoff := time.Now().Add(-rt.staleAfter).Unix()
+	live := map[string]bool{rt.podID: true}
+	for pod, tsStr := range entries {
+		if ts, err := strconv.ParseInt(tsStr, 10, 64); err == nil && ts >= cutoff {
+			live[pod] = true
+		}
+	}
+	return live, nil
+}
+
+func (rt *Runtime) snapshot() []*Job {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return append([]*Job(nil), rt.jobs...)
+}
+
+func (rt *Runtime) job(name string) (*Job, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	for _, j := range rt.jobs {
+		if j.runner.Name() == name {
+			return j, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", domain.ErrWorkerNotFound, name)
+}
+
+// Name возвращает имя воркера
+func (j *Job) Name() string {
+	return j.runner.Name()
+}
+
+// Status возвращает копию состояния воркера
+func (j *Job) Status() domain.WorkerStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	st := j.status
+	st.Pod = j.rt.podID
+	return st
+}
+
+// Run выполняет воркер по расписанию до отмены ctx. Блокируется; текущая итерация
+// получает тот же ctx и должна завершиться после его отмены
+func (j *Job) Run(ctx context.Context) {
+	j.update(func(s *domain.WorkerStatus) { s.Active = true })
+	defer j.withdraw()
+	defer j.update(func(s *domain.WorkerStatus) {
+		s.Active = false
+		s.NextRunAt = nil
+	})
+
+	j.logger.Info("Воркер запущен", "interval", j.schedule.Interval, "jitter", j.schedule.Jitter)
+
+	if j.schedule.Immediate && !j.paused(ctx) {
+		j.execute(ctx)
+	}
+
+	timer := time.NewTimer(j.nextDelay())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			j.logger.Info("Воркер остановлен")
+			return
+		case <-timer.C:
+			if !j.paused(ctx) {
+				j.execute(ctx)
+			}
+			timer.Reset(j.nextDelay())
+		case <-j.trigger:
+			j.logger.Info("Внеочередной запуск воркера")
+			j.execute(ctx)
+		}
+	}
+}
+
+// nextDelay вычисляет задержку до следующего планового запуска и запоминает его время
+func (j *Job) nextDelay() time.Duration {
+	delay := j.schedule.Interval
+	if j.schedule.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(j.schedule.Jitter)))
+	}
+	next := time.Now().Add(delay)
+	j.update(func(s *domain.WorkerStatus) { s.NextRunAt = &next })
+	j.report()
+	return delay
+}
+
+// requestRun ставит внеочередной запуск; повторные запросы до начала итерации объединяются
+func (j *Job) requestRun() {
+	select {
+	case j.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// paused сообщает, приостановлен ли воркер. С общим Redis флаг читается перед каждым плановым
+// запуском, поэтому пауза, поставленная через любой pod, действует и на лидере
+func (j *Job) paused(ctx context.Context) bool {
+	if j.rt.rdb == nil {
+		return j.Status().Paused
+	}
+	paused, err := j.rt.rdb.SIsMember(ctx, workersPausedKey, j.Name()).Result()
+	if err != nil {
+		if ctx.Err() == nil {
+			j.logger.Warn("Ошибка чтения паузы воркера, используется последнее известное состояние", "error", err)
+		}
+		return j.Status().Paused
+	}
+	if paused != j.Status().Paused {
+		j.setPaused(paused)
+	}
+	return paused
+}
+
+// report публикует состояние воркера в Redis для админ API других pod
+func (j *Job) report() {
+	if j.rt.rdb == nil {
+		return
+	}
+	data, err := json.Marshal(j.Status())
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := j.rt.rdb.HSet(ctx, workerStatusKeyPrefix+j.Name(), j.rt.podID, data).Err(); err != nil {
+		j.logger.Warn("Ошибка публикации состояния воркера", "error", err)
+	}
+}
+
+// withdraw убирает состояние воркера этого pod из Redis после остановки цикла
+func (j *Job) withdraw() {
+	if j.rt.rdb == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := j.rt.rdb.HDel(ctx, workerStatusKeyPrefix+j.Name(), j.rt.podID).Err(); err != nil {
+		j.logger.Warn("Ошибка удаления состояния воркера", "error", err)
+	}
+}
+
+// execute выполняет одну итерацию, обновляя статус и метрики. Паника итерации не останавливает цикл
+func (j *Job) execute(ctx context.Context) {
+	name := j.runner.Name()
+	start := time.Now()
+	j.update(func(s *domain.WorkerStatus) { s.Running = true })
+	j.report()
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("паника воркера: %v", r)
+			}
+		}()
+		return j.runner.RunOnce(ctx)
+	}()
+
+	duration := time.Since(start)
+	if err != nil && ctx.Err() != nil {
+		// Итерация прервана остановкой pod — это не сбой воркера
+		j.update(func(s *domain.WorkerStatus) { s.Running = false })
+		return
+	}
+	defer j.report()
+
+	result := domain.WorkerResultOK
+	if err != nil {
+		result = domain.WorkerResultError
+		j.logger.Warn("Ошибка выполнения воркера", "error", err, "duration", duration)
+	} else {
+		metrics.WorkerLastSuccess.WithLabelValues(name).Set(float64(time.Now().Unix()))
+	}
+	metrics.WorkerRuns.WithLabelValues(name, result).Inc()
+	metrics.WorkerRunDuration.WithLabelValues(name).Observe(duration.Seconds())
+
+	j.update(func(s *domain.WorkerStatus) {
+		s.Running = false
+		s.Runs++
+		s.LastRunAt = &start
+		s.LastDuration = duration.String()
+		s.LastResult = result
+		s.LastError = ""
+		if err != nil {
+			s.Failures++
+			s.LastError = err.Error()
+		}
+	})
+}
+
+func (j *Job) setPaused(paused bool) {
+	j.update(func(s *domain.WorkerStatus) { s.Paused = paused })
+	value := 0.0
+	if paused {
+		value = 1
+	}
+	metrics.WorkerPaused.WithLabelValues(j.runner.Name()).Set(value)
+	j.logger.Info("Изменено состояние паузы воркера", "paused", paused)
+}
+
+func (j *Job) update(fn func(s *domain.WorkerStatus)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(&j.status)
+}
@@ -0,0 +1,169 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"notification-mvp/internal/domain"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// countingRunner считает итерации
+type countingRunner struct{ runs atomic.Int64 }
+
+func (r *countingRunner) Name() string                  { return "counting" }
+func (r *countingRunner) RunOnce(context.Context) error { r.runs.Add(1); return nil }
+
+// eventually ждет выполнения условия
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("не дождались: %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// newControlledRuntime создает Runtime pod с общим Redis и регистрирует в нем воркер
+func newControlledRuntime(rdb redis.UniversalClient, podID string, runner Runner) (*Runtime, *Job) {
+	rt := NewRuntime(testLogger()).WithControl(rdb, podID)
+	return rt, rt.Register(runner, Schedule{Interval: 20 * time.Millisecond})
+}
+
+func TestRuntimeControlAcrossPods(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Цикл воркера выполняется на лидере; админ API вызывается на другом pod
+	leaderRunner := &countingRunner{}
+	leaderRT, leaderJob := newControlledRuntime(rdb, "pod-leader", leaderRunner)
+	otherRT, _ := newControlledRuntime(rdb, "pod-other", &countingRunner{})
+	rdb.HSet(ctx, podsHeartbeatKey, "pod-leader", strconv.FormatInt(time.Now().Unix(), 10))
+
+	go leaderRT.Start(ctx)
+	eventually(t, "подписка на запросы запуска", func() bool {
+		subs, _ := rdb.PubSubNumSub(ctx, workerTriggerChannel).Result()
+		return subs[workerTriggerChannel] == 1
+	})
+	jobCtx, stopJob := context.WithCancel(ctx)
+	jobDone := make(chan struct{})
+	go func() {
+		defer close(jobDone)
+		leaderJob.Run(jobCtx)
+	}()
+	eventually(t, "первый плановый запуск", func() bool { return leaderRunner.runs.Load() > 0 })
+
+	statuses, err := otherRT.Workers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].Pod != "pod-leader" || !statuses[0].Active {
+		t.Fatalf("ожидалось состояние лидера, получено %+v", statuses)
+	}
+
+	// Пауза через другой pod останавливает плановые запуски на лидере
+	if err := otherRT.PauseWorker(ctx, "counting"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "пауза на лидере", func() bool { return leaderJob.Status().Paused })
+	paused := leaderRunner.runs.Load()
+	time.Sleep(100 * time.Millisecond)
+	if got := leaderRunner.runs.Load(); got > paused+1 {
+		t.Fatalf("приостановленный воркер продолжил плановые запуски: %d -> %d", paused, got)
+	}
+	if statuses, _ := otherRT.Workers(ctx); !statuses[0].Paused {
+		t.Fatalf("пауза не видна в состоянии: %+v", statuses)
+	}
+
+	// Внеочередной запуск через другой pod выполняется на лидере и при паузе
+	before := leaderRunner.runs.Load()
+	if err := otherRT.TriggerWorker(ctx, "counting"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "внеочередной запуск на лидере", func() bool { return leaderRunner.runs.Load() > before })
+
+	if err := otherRT.ResumeWorker(ctx, "counting"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "возобновление на лидере", func() bool { return !leaderJob.Status().Paused })
+
+	// После остановки цикла воркер нигде не активен
+	stopJob()
+	<-jobDone
+	if err := otherRT.TriggerWorker(ctx, "counting"); !errors.Is(err, domain.ErrWorkerInactive) {
+		t.Fatalf("ожидалась ошибка %v, получено %v", domain.ErrWorkerInactive, err)
+	}
+	statuses, err = otherRT.Workers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].Pod != "pod-other" || statuses[0].Active {
+		t.Fatalf("ожидалось неактивное состояние этого pod, получено %+v", statuses)
+	}
+}
+
+func TestRuntimeIgnoresStalePods(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	ctx := context.Background()
+
+	// Pod упал, не убрав состояние воркера: его пульс устарел
+	rdb.HSet(ctx, podsHeartbeatKey, "pod-dead", strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10))
+	rdb.HSet(ctx, workerStatusKeyPrefix+"counting", "pod-dead", `{"name":"counting","pod":"pod-dead","active":true}`)
+
+	rt, _ := newControlledRuntime(rdb, "pod-live", &countingRunner{})
+	if err := rt.TriggerWorker(ctx, "counting"); !errors.Is(err, domain.ErrWorkerInactive) {
+		t.Fatalf("воркер выбывшего pod считается активным: %v", err)
+	}
+	statuses, err := rt.Workers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].Pod != "pod-live" {
+		t.Fatalf("в состоянии остался выбывший pod: %+v", statuses)
+	}
+}
+
+func TestRuntimeLocal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runner := &countingRunner{}
+	rt := NewRuntime(testLogger())
+	job := rt.Register(runner, Schedule{Interval: time.Hour})
+
+	if err := rt.TriggerWorker(ctx, "counting"); !errors.Is(err, domain.ErrWorkerInactive) {
+		t.Fatalf("ожидалась ошибка %v, получено %v", domain.ErrWorkerInactive, err)
+	}
+	if err := rt.PauseWorker(ctx, "missing"); !errors.Is(err, domain.ErrWorkerNotFound) {
+		t.Fatalf("ожидалась ошибка %v, получено %v", domain.ErrWorkerNotFound, err)
+	}
+
+	go job.Run(ctx)
+	eventually(t, "запуск цикла", func() bool { return job.Status().Active })
+	if err := rt.PauseWorker(ctx, "counting"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.TriggerWorker(ctx, "counting"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "внеочередной запуск", func() bool { return runner.runs.Load() == 1 })
+	statuses, err := rt.Workers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || !statuses[0].Paused || statuses[0].Runs != 1 {
+		t.Fatalf("неверное состояние: %+v", statuses)
+	}
+}
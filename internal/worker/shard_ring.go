@@ -0,0 +1,235 @@
+package worker
+
+import (
+	"context"
+	"hash/fnv"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"notification-mvp/internal/domain"
+	"notification-mvp/internal/metrics"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ringReplicas — число виртуальных узлов pod на кольце; сглаживает распределение пользователей
+const ringReplicas = 128
+
+// KeyFilter решает, обрабатывает ли этот pod пользователя в обслуживающих воркерах
+type KeyFilter interface {
+	Owns(userKey string) bool
+}
+
+// ownedDue выбирает до limit наступивших записей индекса, принадлежащих шарду. Индексы общие
+// для всех pod, поэтому с шардом индекс листается страницами, пока не наберется limit своих записей
+// или не кончится индекс: иначе первые limit записей чужих пользователей заслоняли бы свои.
+// userKeyOf извлекает пользователя из записи; нераспознанные записи возвращаются воркеру, чтобы он
+// залогировал ошибку. Параллельная обработка другими pod сдвигает страницы, и часть записей может
+// быть пропущена — они вернутся в выборку на следующем тике
+func ownedDue(
+	ctx context.Context,
+	shard KeyFilter,
+	limit int64,
+	userKeyOf func(item string) (string, bool),
+	fetch func(ctx context.Context, offset, limit int64) ([]string, error),
+) ([]string, error) {
+	if shard == nil {
+		return fetch(ctx, 0, limit)
+	}
+	var owned []string
+	for offset := int64(0); ; offset += limit {
+		page, err := fetch(ctx, offset, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page {
+			if userKey, ok := userKeyOf(item); ok && !shard.Owns(userKey) {
+				continue
+			}
+			owned = append(owned, item)
+			if int64(len(owned)) >= limit {
+				return owned, nil
+			}
+		}
+		if int64(len(page)) < limit {
+			return owned, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// ownedKeys оставляет пользователей, принадлежащих шарду (nil — всех)
+func ownedKeys(shard KeyFilter, userKeys []string) []string {
+	if shard == nil {
+		return userKeys
+	}
+	owned := make([]string, 0, len(userKeys))
+	for _, userKey := range userKeys {
+		if shard.Owns(userKey) {
+			owned = append(owned, userKey)
+		}
+	}
+	return owned
+}
+
+// userKeyItem — запись индекса, которая сама является userKey
+func userKeyItem(item string) (string, bool) { return item, true }
+
+// memberUserKey извлекает пользователя из member индекса уведомлений
+func memberUserKey(member string) (string, bool) {
+	userKey, _, err := domain.ParseNotificationMember(member)
+	return userKey, err == nil
+}
+
+type ringPoint struct {
+	hash uint64
+	pod  string
+}
+
+// ShardRing делит пользователей между живыми pod из реестра heartbeat консистентным хэшированием.
+// Pod без свежего heartbeat выпадает из кольца при следующем обновлении, и его доля
+// переходит соседям; остальные пользователи при этом не перемещаются
+type ShardRing struct {
+	rdb        redis.UniversalClient
+	podID      string
+	logger     *slog.Logger
+	refresh    time.Duration
+	staleAfter time.Duration
+
+	mu     sync.RWMutex
+	pods   []string
+	points []ringPoint
+}
+
+// NewShardRing создает кольцо, в котором до первого обновления состоит только этот pod
+func NewShardRing(rdb redis.UniversalClient, podID string, logger *slog.Logger) *ShardRing {
+	r := &ShardRing{
+		rdb:        rdb,
+		podID:      podID,
+		logger:     logger,
+		refresh:    10 * time.Second,
+		staleAfter: podStaleAfter,
+	}
+	r.rebuild([]string{podID})
+	return r
+}
+
+// WithStaleAfter задает, через сколько без пульса pod выпадает из кольца (как в HeartbeatWorker)
+func (r *ShardRing) WithStaleAfter(d time.Duration) *ShardRing {
+	if d > 0 {
+		r.staleAfter = d
+	}
+	return r
+}
+
+// Start периодически перечитывает реестр heartbeat и перестраивает кольцо
+func (r *ShardRing) Start(ctx context.Context) {
+	ticker := time.NewTicker(r.refresh)
+	defer ticker.Stop()
+
+	r.logger.Info("Шардирование обслуживания запущено", "pod", r.podID)
+	r.update(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.logger.Info("Шардирование обслуживания остановлено")
+			return
+		case <-ticker.C:
+			r.update(ctx)
+		}
+	}
+}
+
+// Owns сообщает, принадлежит ли пользователь этому pod
+func (r *ShardRing) Owns(userKey string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.points) == 0 {
+		return true
+	}
+	h := ringHash(userKey)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].pod == r.podID
+}
+
+// Pods возвращает текущий состав кольца
+func (r *ShardRing) Pods() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string(nil), r.pods...)
+}
+
+// update читает живые pod из реестра heartbeat. Сам pod входит в кольцо всегда,
+// даже если его heartbeat еще не записан
+func (r *ShardRing) update(ctx context.Context) {
+	entries, err := r.rdb.HGetAll(ctx, podsHeartbeatKey).Result()
+	if err != nil {
+		r.logger.Warn("Ошибка чтения heartbeat реестра", "error", err)
+		return
+	}
+
+	cutoff := time.Now().Add(-r.staleAfter).Unix()
+	pods := []string{r.podID}
+	for pod, tsStr := range entries {
+		if pod == r.podID {
+			continue
+		}
+		ts, err := strconv.ParseInt(tsStr, 10, 64)
+		if err != nil || ts < cutoff {
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	sort.Strings(pods)
+
+	r.mu.RLock()
+	changed := strings.Join(pods, ",") != strings.Join(r.pods, ",")
+	r.mu.RUnlock()
+	if !changed {
+		return
+	}
+
+	r.rebuild(pods)
+	r.logger.Info("Состав кольца обслуживания изменен", "pods", pods)
+}
+
+func (r *ShardRing) rebuild(pods []string) {
+	points := make([]ringPoint, 0, len(pods)*ringReplicas)
+	for _, pod := range pods {
+		for i := 0; i < ringReplicas; i++ {
+			points = append(points, ringPoint{hash: ringHash(pod + "#" + strconv.Itoa(i)), pod: pod})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].hash < points[j].hash })
+
+	r.mu.Lock()
+	r.pods = pods
+	r.points = points
+	r.mu.Unlock()
+	metrics.ShardPods.Set(float64(len(pods)))
+}
+
+// ringHash — FNV-1a с финальным перемешиванием (splitmix64): сами по себе хэши FNV
+// похожих строк вроде "pod-a#1" ложатся на кольцо кучно
+func ringHash(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
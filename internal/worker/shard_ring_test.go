@@ -0,0 +1,139 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"notification-mvp/internal/domain"
+)
+
+// sliceIndex — индекс с постраничным чтением, как ZRANGEBYSCORE ... LIMIT offset count
+type sliceIndex struct {
+	items []string
+	pages int
+}
+
+func (s *sliceIndex) fetch(_ context.Context, offset, limit int64) ([]string, error) {
+	s.pages++
+	if offset >= int64(len(s.items)) {
+		return nil, nil
+	}
+	end := offset + limit
+	if end > int64(len(s.items)) {
+		end = int64(len(s.items))
+	}
+	return s.items[offset:end], nil
+}
+
+// evenUsers — шард, которому принадлежат пользователи с четным ID
+type evenUsers struct{}
+
+func (evenUsers) Owns(userKey string) bool {
+	id, _, err := domain.ParseUserKey(userKey)
+	return err == nil && id%2 == 0
+}
+
+func userKeys(from, to int) []string {
+	var keys []string
+	for i := from; i <= to; i++ {
+		keys = append(keys, domain.UserKey(int64(i), "user"))
+	}
+	return keys
+}
+
+func TestOwnedDue(t *testing.T) {
+	tests := []struct {
+		name      string
+		items     []string
+		shard     KeyFilter
+		limit     int64
+		userKeyOf func(string) (string, bool)
+		want      []string
+		wantPages int
+	}{
+		{
+			name:      "без шарда одна страница",
+			items:     userKeys(1, 10),
+			limit:     3,
+			userKeyOf: userKeyItem,
+			want:      userKeys(1, 3),
+			wantPages: 1,
+		},
+		{
+			name:      "свои записи за пределами первой страницы",
+			items:     append(oddUsers(1, 9), domain.UserKey(10, "user")),
+			shard:     evenUsers{},
+			limit:     2,
+			userKeyOf: userKeyItem,
+			want:      userKeys(10, 10),
+			wantPages: 4,
+		},
+		{
+			name:      "листание останавливается на limit своих",
+			items:     userKeys(1, 100),
+			shard:     evenUsers{},
+			limit:     3,
+			userKeyOf: userKeyItem,
+			want:      []string{domain.UserKey(2, "user"), domain.UserKey(4, "user"), domain.UserKey(6, "user")},
+			wantPages: 2,
+		},
+		{
+			name: "member индекса уведомлений и нераспознанные записи",
+			items: []string{
+				domain.NotificationMember(domain.UserKey(1, "user"), "n1"),
+				"garbage",
+				domain.NotificationMember(domain.UserKey(2, "user"), "n2"),
+			},
+			shard:     evenUsers{},
+			limit:     5,
+			userKeyOf: memberUserKey,
+			want:      []string{"garbage", domain.NotificationMember(domain.UserKey(2, "user"), "n2")},
+			wantPages: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := &sliceIndex{items: tt.items}
+			got, err := ownedDue(context.Background(), tt.shard, tt.limit, tt.userKeyOf, index.fetch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("получено %v, ожидалось %v", got, tt.want)
+			}
+			if index.pages != tt.wantPages {
+				t.Fatalf("прочитано %d страниц, ожидалось %d", index.pages, tt.wantPages)
+			}
+		})
+	}
+}
+
+// oddUsers возвращает пользователей с нечетными ID из диапазона (чужие для evenUsers)
+func oddUsers(from, to int) []string {
+	var keys []string
+	for i := from; i <= to; i += 2 {
+		keys = append(keys, domain.UserKey(int64(i), "user"))
+	}
+	return keys
+}
+
+func TestOwnedDueFetchError(t *testing.T) {
+	fetch := func(context.Context, int64, int64) ([]string, error) { return nil, fmt.Errorf("нет связи") }
+	if _, err := ownedDue(context.Background(), evenUsers{}, 10, userKeyItem, fetch); err == nil {
+		t.Fatal("ожидалась ошибка чтения индекса")
+	}
+}
+
+func TestOwnedKeys(t *testing.T) {
+	keys := userKeys(1, 4)
+	if got := ownedKeys(nil, keys); !reflect.DeepEqual(got, keys) {
+		t.Fatalf("без шарда получено %v", got)
+	}
+	want := []string{domain.UserKey(2, "user"), domain.UserKey(4, "user")}
+	if got := ownedKeys(evenUsers{}, keys); !reflect.DeepEqual(got, want) {
+		t.Fatalf("получено %v, ожидалось %v", got, want)
+	}
+}
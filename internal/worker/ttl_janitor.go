@@ -4,17 +4,22 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"strconv"
-	"strings"
 	"time"
 
+	"notification-mvp/internal/clock"
 	"notification-mvp/internal/domain"
 )
 
+// dueUsersBatch ограничивает число пользователей, обрабатываемых за один проход
+const dueUsersBatch = 1000
+
 // TTLJanitor отвечает за удаление просроченных уведомлений
 type TTLJanitor struct {
-	repo   domain.NotificationRepository
-	logger *slog.Logger
+	repo    domain.NotificationRepository
+	logger  *slog.Logger
+	shard   KeyFilter // nil — обрабатываются все пользователи
+	clock   clock.Clock
+	archive domain.ArchiveSink // nil — архив не настроен
 }
 
 // NewTTLJanitor создает новый экземпляр TTLJanitor
@@ -22,50 +27,58 @@ func NewTTLJanitor(repo domain.NotificationRepository, logger *slog.Logger) *TTL
 	return &TTLJanitor{
 		repo:   repo,
 		logger: logger,
+		clock:  clock.System{},
 	}
 }
 
-// Start запускает TTL джанитор
-func (j *TTLJanitor) Start(ctx context.Context) {
-	ticker := time.NewTicker(1 * time.Minute) // Каждую минуту как указано в ТЗ
-	defer ticker.Stop()
+// WithShard ограничивает обработку пользователями, принадлежащими этому pod
+func (j *TTLJanitor) WithShard(shard KeyFilter) *TTLJanitor {
+	j.shard = shard
+	return j
+}
 
-	j.logger.Info("TTL джанитор запущен")
+// WithClock задает источник времени для выборки пользователей (подменяется в тестах)
+func (j *TTLJanitor) WithClock(clock clock.Clock) *TTLJanitor {
+	j.clock = clock
+	return j
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			j.logger.Info("TTL джанитор остановлен")
-			return
-		case <-ticker.C:
-			j.cleanupExpiredNotifications(ctx)
-		}
-	}
+// WithArchive записывает удаление просроченных уведомлений в долговременный архив
+func (j *TTLJanitor) WithArchive(archive domain.ArchiveSink) *TTLJanitor {
+	j.archive = archive
+	return j
 }
 
-// cleanupExpiredNotifications удаляет просроченные уведомления для всех пользователей
-func (j *TTLJanitor) cleanupExpiredNotifications(ctx context.Context) {
-	start := time.Now()
+// Name возвращает имя воркера для Runtime
+func (j *TTLJanitor) Name() string {
+	return "ttl_janitor"
+}
 
-	// Получаем все пользовательские ключи
-	userKeys, err := j.repo.GetAllUserKeys(ctx)
+// RunOnce удаляет просроченные уведомления для всех пользователей
+func (j *TTLJanitor) RunOnce(ctx context.Context) error {
+	start := j.clock.Now()
+
+	// Берем из индекса только своих пользователей с истекшими уведомлениями; остальные придут в следующих тиках
+	userKeys, err := ownedDue(ctx, j.shard, dueUsersBatch, userKeyItem,
+		func(ctx context.Context, offset, limit int64) ([]string, error) {
+			return j.repo.GetDueUserKeys(ctx, start, offset, limit)
+		})
 	if err != nil {
-		j.logger.Error("Ошибка получения пользовательских ключей", "error", err)
-		return
+		return fmt.Errorf("ошибка получения пользовательских ключей: %w", err)
 	}
 
 	if len(userKeys) == 0 {
 		j.logger.Debug("Нет пользователей для очистки")
-		return
+		return nil
 	}
 
 	var totalCleaned int64
-	var processedUsers int
+	var processedUsers, failedUsers int
 
 	// Обрабатываем каждого пользователя
 	for _, userKey := range userKeys {
 		// Парсим userKey для получения ID и логина
-		userID, login, err := j.parseUserKey(userKey)
+		userID, login, err := domain.ParseUserKey(userKey)
 		if err != nil {
 			j.logger.Warn("Ошибка парсинга user key", "user_key", userKey, "error", err)
 			continue
@@ -78,28 +91,39 @@ func (j *TTLJanitor) cleanupExpiredNotifications(ctx context.Context) {
 				"user_id", userID,
 				"login", login,
 				"error", err)
+			failedUsers++
 			continue
 		}
 
-		if cleaned > 0 {
+		if len(cleaned) > 0 {
 			j.logger.Debug("Очищены просроченные уведомления",
 				"user_id", userID,
 				"login", login,
-				"count", cleaned)
+				"count", len(cleaned))
+		}
+		if j.archive != nil {
+			for _, nid := range cleaned {
+				j.archive.Record(domain.ArchiveEvent{
+					Type:           domain.ArchiveEventExpired,
+					NotificationID: nid,
+					Target:         domain.Target{ID: userID, Login: login},
+					OccurredAt:     j.clock.Now(),
+				})
+			}
 		}
 
-		totalCleaned += cleaned
+		totalCleaned += int64(len(cleaned))
 		processedUsers++
 
 		// Небольшая пауза между пользователями чтобы не нагружать Redis
 		select {
 		case <-ctx.Done():
-			return
+			return ctx.Err()
 		case <-time.After(10 * time.Millisecond):
 		}
 	}
 
-	duration := time.Since(start)
+	duration := j.clock.Now().Sub(start)
 
 	if totalCleaned > 0 || len(userKeys) > 10 {
 		j.logger.Info("Завершена очистка просроченных уведомлений",
@@ -114,19 +138,9 @@ func (j *TTLJanitor) cleanupExpiredNotifications(ctx context.Context) {
 			"total_users", len(userKeys),
 			"duration", duration)
 	}
-}
 
-// parseUserKey парсит user key в формате "id-login"
-func (j *TTLJanitor) parseUserKey(userKey string) (int64, string, error) {
-	parts := strings.SplitN(userKey, "-", 2)
-	if len(parts) != 2 {
-		return 0, "", fmt.Errorf("неверный формат user key: %s", userKey)
+	if failedUsers > 0 {
+		return fmt.Errorf("не удалось очистить уведомления %d из %d пользователей", failedUsers, len(userKeys))
 	}
-
-	userID, err := strconv.ParseInt(parts[0], 10, 64)
-	if err != nil {
-		return 0, "", fmt.Errorf("ошибка парсинга user ID: %w", err)
-	}
-
-	return userID, parts[1], nil
+	return nil
 }